@@ -0,0 +1,355 @@
+// Package client calls the map API from Go:
+//
+//	c, err := client.New("https://map.example.com", client.Options{APIKey: key})
+//	resp, err := c.Generate(ctx, client.GenerateRequest{
+//		Width:  80,
+//		Marker: &client.Marker{Place: "Lisbon"},
+//	})
+//	fmt.Println(resp.Plain)
+//
+// Failed requests are retried with exponential backoff: after network
+// errors, 502, 503 and 504, and after 429 once the rate limit allows,
+// honoring Retry-After.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultMinBackoff = 500 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+	maxErrorBytes     = 4 << 10
+)
+
+type Options struct {
+	// APIKey is sent as X-API-Key.
+	APIKey string
+	// Secret signs every request with HMAC-SHA256, for API keys the server
+	// only accepts signed.
+	Secret string
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// MaxRetries is the number of retries after the first attempt: 3 when
+	// zero, none when negative.
+	MaxRetries int
+	// MinBackoff and MaxBackoff bound the wait between attempts, 500ms and
+	// 30s by default. Without Retry-After, a rate-limited request waits
+	// for the server's rate window, up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	UserAgent  string
+	// Header is added to every request, e.g. X-Terminal-Cols and
+	// X-Terminal-Rows to have the server fit the map to a terminal.
+	Header http.Header
+}
+
+type Client struct {
+	baseURL *url.URL
+	opts    Options
+
+	// rateWindow is the server's rate limit window, learned from
+	// /api/limits after the first 429.
+	rateWindow atomic.Int64
+}
+
+// Error is an error response of the API, an RFC 7807 problem. Params
+// lists the request fields at fault, when the server names them.
+type Error struct {
+	StatusCode int
+	Message    string
+	Params     []InvalidParam
+}
+
+// InvalidParam names a request field by JSON pointer, e.g. /marker/lat.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("map api: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// New returns a client for the API at baseURL, such as
+// "https://map.example.com"; paths start with /api.
+func New(baseURL string, opts Options) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("client: base URL must be an absolute http or https URL")
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = defaultMaxRetries
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultMinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultMaxBackoff
+	}
+	return &Client{baseURL: u, opts: opts}, nil
+}
+
+func (c *Client) Generate(ctx context.Context, req GenerateRequest) (*GenerateResponse, error) {
+	var resp GenerateResponse
+	if err := c.do(ctx, http.MethodPost, "/api/generate", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Share renders req and returns a link to the result that works for ttl,
+// or for the server's share.ttl when ttl is 0.
+func (c *Client) Share(ctx context.Context, req GenerateRequest, ttl time.Duration) (*Share, error) {
+	var params url.Values
+	if ttl > 0 {
+		params = url.Values{"ttl": {ttl.String()}}
+	}
+	var resp Share
+	if err := c.do(ctx, http.MethodPost, "/api/share", params, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// History returns the client's recent renders, newest first; limit 0
+// returns all the server keeps.
+func (c *Client) History(ctx context.Context, limit int) ([]HistoryEntry, error) {
+	var params url.Values
+	if limit > 0 {
+		params = url.Values{"limit": {strconv.Itoa(limit)}}
+	}
+	var resp struct {
+		Renders []HistoryEntry `json:"renders"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/history", params, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Renders, nil
+}
+
+// Rerender renders the request of a history entry again.
+func (c *Client) Rerender(ctx context.Context, id string) (*GenerateResponse, error) {
+	var resp GenerateResponse
+	if err := c.do(ctx, http.MethodPost, "/api/history/"+url.PathEscape(id)+"/render", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Geocode looks up cities by name, most populous first; limit 0 uses the
+// server default.
+func (c *Client) Geocode(ctx context.Context, query string, limit int) ([]Place, error) {
+	params := url.Values{"q": {query}}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	var resp struct {
+		Results []Place `json:"results"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/geocode", params, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+func (c *Client) Options(ctx context.Context) (*ServerOptions, error) {
+	var resp ServerOptions
+	if err := c.do(ctx, http.MethodGet, "/api/options", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Limits returns the limits of the client's API key.
+func (c *Client) Limits(ctx context.Context) (*Limits, error) {
+	var resp Limits
+	if err := c.do(ctx, http.MethodGet, "/api/limits", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Quota returns the requests left in the client's rate window; asking does
+// not use one up.
+func (c *Client) Quota(ctx context.Context) (*Quota, error) {
+	var resp Quota
+	if err := c.do(ctx, http.MethodGet, "/api/quota", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Presets(ctx context.Context) ([]Preset, error) {
+	var resp struct {
+		Presets []Preset `json:"presets"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/presets", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Presets, nil
+}
+
+// Live reports whether the server is up.
+func (c *Client) Live(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/api/livez", nil, nil, nil)
+}
+
+// Ready reports whether the server can render. A server that is not ready
+// answers 503, which is retried like any other before Ready gives up.
+func (c *Client) Ready(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/api/readyz", nil, nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, params url.Values, body any, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	u := *c.baseURL
+	u.Path += path
+	u.RawQuery = params.Encode()
+
+	for attempt := 0; ; attempt++ {
+		wait, err := c.attempt(ctx, method, u.String(), payload, out)
+		if wait < 0 || attempt >= max(c.opts.MaxRetries, 0) {
+			return err
+		}
+
+		backoff := min(c.opts.MinBackoff<<attempt, c.opts.MaxBackoff)
+		backoff = backoff/2 + rand.N(backoff/2+1)
+		timer := time.NewTimer(max(wait, backoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends one request. A wait of zero or more means the request may
+// be retried after at least that long.
+func (c *Client) attempt(ctx context.Context, method string, target string, payload []byte, out any) (time.Duration, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return -1, err
+	}
+	for name, values := range c.opts.Header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("Accept", "application/json, application/problem+json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.opts.APIKey != "" {
+		req.Header.Set("X-API-Key", c.opts.APIKey)
+	}
+	if c.opts.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(c.opts.Secret))
+		mac.Write([]byte(timestamp + "\n" + method + "\n" + req.URL.RequestURI() + "\n"))
+		mac.Write(payload)
+		req.Header.Set("X-Signature-Timestamp", timestamp)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	if c.opts.UserAgent != "" {
+		req.Header.Set("User-Agent", c.opts.UserAgent)
+	}
+
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return -1, err
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if out == nil {
+			return -1, nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return -1, fmt.Errorf("map api: invalid response: %w", err)
+		}
+		return -1, nil
+	}
+
+	apiErr := &Error{StatusCode: resp.StatusCode, Message: resp.Status}
+	var problem struct {
+		Detail        string         `json:"detail"`
+		InvalidParams []InvalidParam `json:"invalid-params"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBytes))
+	if json.Unmarshal(data, &problem) == nil && problem.Detail != "" {
+		apiErr.Message, apiErr.Params = problem.Detail, problem.InvalidParams
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		if wait, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return wait, apiErr
+		}
+		return min(c.rateLimitWindow(ctx), c.opts.MaxBackoff), apiErr
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		wait, _ := retryAfter(resp.Header.Get("Retry-After"))
+		return wait, apiErr
+	}
+	return -1, apiErr
+}
+
+// rateLimitWindow returns the server's rate window, which a rate-limited
+// client may have to wait out.
+func (c *Client) rateLimitWindow(ctx context.Context) time.Duration {
+	if c.rateWindow.Load() == 0 {
+		var limits Limits
+		if _, err := c.attempt(ctx, http.MethodGet, c.baseURL.String()+"/api/limits", nil, &limits); err == nil {
+			c.rateWindow.Store(int64(limits.RateWindowSeconds * float64(time.Second)))
+		}
+	}
+	return time.Duration(c.rateWindow.Load())
+}
+
+func retryAfter(raw string) (time.Duration, bool) {
+	if raw == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(raw); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(raw); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,235 @@
+package client
+
+import (
+	"encoding/json"
+	"maps"
+	"time"
+)
+
+// GenerateRequest is the body of POST /api/generate. Unset fields keep the
+// server's defaults; use Bool, Int and Float for options whose zero value
+// is meaningful. Extra carries any other option by its JSON name, such as
+// "graticule" or "choropleth", and wins over the typed fields.
+type GenerateRequest struct {
+	Width       int      `json:"width,omitempty"`
+	Supersample int      `json:"supersample,omitempty"`
+	CharAspect  float64  `json:"char_aspect,omitempty"`
+	Margin      *int     `json:"margin,omitempty"`
+	Frame       *bool    `json:"frame,omitempty"`
+	FrameStyle  string   `json:"frame_style,omitempty"`
+	Title       string   `json:"title,omitempty"`
+	Footer      string   `json:"footer,omitempty"`
+	Continent   string   `json:"continent,omitempty"`
+	Projection  string   `json:"projection,omitempty"`
+	Center      *LonLat  `json:"center,omitempty"`
+	Preset      string   `json:"preset,omitempty"`
+	Format      string   `json:"format,omitempty"`
+	Theme       string   `json:"theme,omitempty"`
+	Charset     string   `json:"charset,omitempty"`
+	Borders     *bool    `json:"borders,omitempty"`
+	Terrain     *bool    `json:"terrain,omitempty"`
+	Highlight   []string `json:"highlight_countries,omitempty"`
+	Lines       bool     `json:"lines,omitempty"`
+	Cells       bool     `json:"cells,omitempty"`
+	Color       *Color   `json:"color,omitempty"`
+	Marker      *Marker  `json:"marker,omitempty"`
+	Markers     []Point  `json:"markers,omitempty"`
+
+	Extra map[string]any `json:"-"`
+}
+
+type LonLat struct {
+	Lon float64 `json:"lon"`
+	Lat float64 `json:"lat"`
+}
+
+type Color struct {
+	// Mode is never, always, ansi256 or truecolor.
+	Mode        string `json:"mode,omitempty"`
+	MapColor    string `json:"map_color,omitempty"`
+	FrameColor  string `json:"frame_color,omitempty"`
+	MarkerColor string `json:"marker_color,omitempty"`
+}
+
+// Marker is the single marker; Enabled is set when it is sent. Place, a
+// city from the gazetteer, takes the place of Lon and Lat.
+type Marker struct {
+	Lon   float64 `json:"lon"`
+	Lat   float64 `json:"lat"`
+	Place string  `json:"place,omitempty"`
+	Label string  `json:"label,omitempty"`
+	Style string  `json:"style,omitempty"`
+}
+
+// Point is one of several markers.
+type Point struct {
+	Lon   float64 `json:"lon"`
+	Lat   float64 `json:"lat"`
+	Place string  `json:"place,omitempty"`
+	Label string  `json:"label,omitempty"`
+}
+
+func (r GenerateRequest) MarshalJSON() ([]byte, error) {
+	type plain GenerateRequest
+	body, err := json.Marshal(plain(r))
+	if err != nil {
+		return nil, err
+	}
+	if r.Marker == nil && len(r.Extra) == 0 {
+		return body, nil
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	if marker, ok := fields["marker"].(map[string]any); ok {
+		marker["enabled"] = true
+	}
+	maps.Copy(fields, r.Extra)
+	return json.Marshal(fields)
+}
+
+func Bool(v bool) *bool {
+	return &v
+}
+
+func Int(v int) *int {
+	return &v
+}
+
+func Float(v float64) *float64 {
+	return &v
+}
+
+type GenerateResponse struct {
+	Plain string       `json:"plain"`
+	ANSI  string       `json:"ansi"`
+	Meta  GenerateMeta `json:"meta"`
+	// Message is the map wrapped for the chat service named by Format.
+	Message string `json:"message,omitempty"`
+	// Lines and Cells are set when the request asks for them.
+	Lines []string `json:"lines,omitempty"`
+	Cells [][]Cell `json:"cells,omitempty"`
+	// Grid is set for Format "grid".
+	Grid [][]GridCell `json:"grid,omitempty"`
+}
+
+// Cell is one terminal column of the map; Color holds its SGR parameters,
+// such as "1;91", empty for the terminal default.
+type Cell struct {
+	Char  string `json:"char"`
+	Color string `json:"color"`
+}
+
+// GridCell is one terminal column of a grid; FG and BG are "#rrggbb",
+// empty for the terminal default, and Attrs names attributes like "bold".
+type GridCell struct {
+	Char  string   `json:"char"`
+	FG    string   `json:"fg"`
+	BG    string   `json:"bg"`
+	Attrs []string `json:"attrs"`
+}
+
+// GenerateMeta holds the common metadata of a render. Raw is the complete
+// meta object, including the parts of overlays such as the ISS or weather.
+type GenerateMeta struct {
+	Width       int          `json:"width"`
+	Height      int          `json:"height"`
+	Supersample int          `json:"supersample"`
+	CharAspect  float64      `json:"char_aspect"`
+	Continent   string       `json:"continent,omitempty"`
+	DurationMS  int64        `json:"duration_ms"`
+	Bytes       int          `json:"bytes"`
+	Markers     []MarkerMeta `json:"markers,omitempty"`
+
+	Raw json.RawMessage `json:"-"`
+}
+
+func (m *GenerateMeta) UnmarshalJSON(data []byte) error {
+	type plain GenerateMeta
+	if err := json.Unmarshal(data, (*plain)(m)); err != nil {
+		return err
+	}
+	m.Raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+type MarkerMeta struct {
+	Row         int    `json:"row"`
+	Col         int    `json:"col"`
+	Visible     bool   `json:"visible"`
+	Clipped     bool   `json:"clipped"`
+	Snapped     bool   `json:"snapped"`
+	Country     string `json:"country,omitempty"`
+	CountryName string `json:"country_name,omitempty"`
+	Continent   string `json:"continent,omitempty"`
+	Timezone    string `json:"timezone,omitempty"`
+	LocalTime   string `json:"local_time,omitempty"`
+}
+
+type Place struct {
+	Name       string  `json:"name"`
+	Country    string  `json:"country"`
+	Lon        float64 `json:"lon"`
+	Lat        float64 `json:"lat"`
+	Population int64   `json:"population"`
+}
+
+// ServerOptions lists the continents, projections, layers and masks the
+// server accepts.
+type ServerOptions struct {
+	Continents  []string `json:"continents"`
+	Projections []string `json:"projections"`
+	Layers      []string `json:"layers"`
+	Masks       []string `json:"masks"`
+}
+
+type Limits struct {
+	MinWidth          int     `json:"min_width"`
+	MaxWidth          int     `json:"max_width"`
+	MinSupersample    int     `json:"min_supersample"`
+	MaxSupersample    int     `json:"max_supersample"`
+	MaxMargin         int     `json:"max_margin"`
+	MinCharAspect     float64 `json:"min_char_aspect"`
+	MaxCharAspect     float64 `json:"max_char_aspect"`
+	RateLimit         int     `json:"rate_limit"`
+	RateWindow        string  `json:"rate_window"`
+	RateWindowSeconds float64 `json:"rate_window_seconds"`
+	MaxBodyBytes      int64   `json:"max_body_bytes"`
+	MaxGeoJSONBytes   int64   `json:"max_geojson_bytes"`
+}
+
+// Quota is what the client has left in its current rate window.
+type Quota struct {
+	Limit        int     `json:"limit"`
+	Remaining    int     `json:"remaining"`
+	Window       string  `json:"window"`
+	Reset        string  `json:"reset"`
+	ResetSeconds float64 `json:"reset_seconds"`
+}
+
+// Share is a share link from POST /api/share. URL is a path unless the
+// server has share.base_url set.
+type Share struct {
+	URL     string    `json:"url"`
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// HistoryEntry is a past render from GET /api/history. Request is empty
+// for renders that used an upload, which cannot be rendered again.
+type HistoryEntry struct {
+	ID       string          `json:"id"`
+	Time     time.Time       `json:"time"`
+	Endpoint string          `json:"endpoint"`
+	Hash     string          `json:"hash"`
+	Format   string          `json:"format"`
+	Meta     GenerateMeta    `json:"meta"`
+	Request  json.RawMessage `json:"request"`
+}
+
+type Preset struct {
+	Name    string          `json:"name"`
+	Request json.RawMessage `json:"request"`
+}
@@ -0,0 +1,500 @@
+// Command mapctl prints ASCII maps from the shell, either rendered by a map
+// API server or locally with the embedded land mask and cities, which needs
+// no network:
+//
+//	mapctl -width 60 -marker Lisbon -label LIS
+//	mapctl -api https://map.example.com -theme ocean -marker 2.35,48.85
+//	mapctl -o /run/motd-map -every 1h -marker here
+//	echo '{"graticule":{"enabled":true}}' | mapctl -api http://localhost:8081 -request -
+//
+// Flags mirror the fields of a generate request and win over those of
+// -request. Themes, presets, output formats and -request need a server.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	mapascii "github.com/Kivayan/map-ascii"
+
+	"map-ascii-generator/api/client"
+	"map-ascii-generator/api/internal/geo"
+	"map-ascii-generator/api/internal/render"
+)
+
+const (
+	defaultWidth       = 80
+	defaultSupersample = 3
+	defaultCharAspect  = 2.0
+	defaultMargin      = 2
+	maxCharAspect      = 3.5
+	requestTimeout     = 30 * time.Second
+)
+
+type options struct {
+	api     string
+	key     string
+	secret  string
+	request string
+	json    bool
+	output  string
+	every   time.Duration
+
+	// requestData is the -request body, read once.
+	requestData []byte
+
+	width       int
+	supersample int
+	charAspect  float64
+	margin      int
+	frame       bool
+	title       string
+	continent   string
+	marker      string
+	label       string
+	markerStyle string
+	color       string
+	mapColor    string
+	frameColor  string
+	markerColor string
+	theme       string
+	preset      string
+	format      string
+
+	// termCols and termRows are the terminal size to fit the map to when
+	// -width is left out, 0 if unknown.
+	termCols int
+	termRows int
+
+	// set holds the names of the flags given on the command line.
+	set map[string]bool
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("mapctl: ")
+
+	var opts options
+	flag.StringVar(&opts.api, "api", os.Getenv("MAP_API_URL"), "render on the API server at this URL instead of locally (default $MAP_API_URL)")
+	flag.StringVar(&opts.key, "key", "", "API key for -api (default $MAP_API_KEY)")
+	flag.StringVar(&opts.request, "request", "", "JSON generate request file to start from, - for stdin; needs -api")
+	flag.BoolVar(&opts.json, "json", false, "print the whole response as JSON instead of the map")
+	flag.StringVar(&opts.output, "o", "", "write the map to this file instead of stdout, replacing it in one step")
+	flag.DurationVar(&opts.every, "every", 0, "keep running and rewrite the -o file at this interval, e.g. 1h")
+	flag.IntVar(&opts.width, "width", defaultWidth, "map width in columns; without it the map fits the terminal, or takes the server's default with -api")
+	flag.IntVar(&opts.supersample, "supersample", defaultSupersample, "samples per cell in each direction")
+	flag.Float64Var(&opts.charAspect, "char-aspect", defaultCharAspect, "height to width ratio of a terminal cell")
+	flag.IntVar(&opts.margin, "margin", defaultMargin, "blank rows above and below the map")
+	flag.BoolVar(&opts.frame, "frame", true, "draw a frame around the map")
+	flag.StringVar(&opts.title, "title", "", "title in the top frame border")
+	flag.StringVar(&opts.continent, "continent", "", "continent to show instead of the world: "+mapascii.ContinentNamesCSV())
+	flag.StringVar(&opts.marker, "marker", "", "marker position as lon,lat, a city name, or here for the host's location")
+	flag.StringVar(&opts.label, "label", "", "marker label")
+	flag.StringVar(&opts.markerStyle, "marker-style", "", "marker style: "+strings.Join(render.MarkerStyles(), ", "))
+	flag.StringVar(&opts.color, "color", "auto", "color mode: auto, never, always, ansi256 or truecolor; auto colors a terminal unless NO_COLOR is set")
+	flag.StringVar(&opts.mapColor, "map-color", "green", "land color")
+	flag.StringVar(&opts.frameColor, "frame-color", "bright-white", "frame color")
+	flag.StringVar(&opts.markerColor, "marker-color", "bright-red", "marker color")
+	flag.StringVar(&opts.theme, "theme", "", "color theme; needs -api")
+	flag.StringVar(&opts.preset, "preset", "", "render preset; needs -api")
+	flag.StringVar(&opts.format, "format", "", "chat format such as discord, printing its message; needs -api")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: mapctl [flags]\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	opts.set = map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { opts.set[f.Name] = true })
+	if !opts.set["key"] {
+		opts.key = os.Getenv("MAP_API_KEY")
+	}
+	// The signing secret only comes from the environment, to keep it out
+	// of process listings.
+	opts.secret = os.Getenv("MAP_API_SECRET")
+	if !opts.set["width"] && opts.output == "" {
+		opts.termCols, opts.termRows = terminalSize()
+	}
+	if opts.color == "auto" {
+		opts.color = string(render.ColorModeNever)
+		if opts.output == "" && isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == "" {
+			opts.color = string(render.ColorModeANSI16)
+		}
+	}
+
+	if opts.request != "" {
+		var err error
+		if opts.requestData, err = readRequest(opts.request); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if opts.every < 0 || (opts.every > 0 && opts.output == "") {
+		log.Fatal("-every needs -o and a positive interval")
+	}
+
+	for {
+		err := run(opts)
+		if opts.every == 0 {
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		// A failed refresh leaves the last map in place.
+		if err != nil {
+			log.Print(err)
+		}
+		time.Sleep(opts.every)
+	}
+}
+
+func run(opts options) error {
+	var out string
+	var err error
+	if opts.api != "" {
+		out, err = renderRemote(opts)
+	} else {
+		out, err = renderLocal(opts)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.output == "" {
+		_, err = os.Stdout.WriteString(out)
+		return err
+	}
+	return writeFileAtomic(opts.output, []byte(out))
+}
+
+// writeFileAtomic replaces path in one step, so that a login never shows a
+// half-written map.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// terminalSize returns the size in COLUMNS and LINES, or else that of the
+// terminal on stdout; rows is 0 when only the columns are known.
+func terminalSize() (cols int, rows int) {
+	if cols, _ = strconv.Atoi(os.Getenv("COLUMNS")); cols > 0 {
+		rows, _ = strconv.Atoi(os.Getenv("LINES"))
+		return cols, max(rows, 0)
+	}
+	if cols, rows, ok := ttySize(os.Stdout); ok {
+		return cols, rows
+	}
+	return 0, 0
+}
+
+func isHere(marker string) bool {
+	return strings.EqualFold(strings.TrimSpace(marker), "here")
+}
+
+// hostCity guesses the host's city from its time zone, TZ or the
+// /etc/localtime link, as the zone names a city: Europe/Berlin is Berlin.
+// It needs no network, but only finds cities the gazetteer knows.
+func hostCity() (string, error) {
+	zone := strings.TrimPrefix(os.Getenv("TZ"), ":")
+	if zone == "" {
+		target, err := os.Readlink("/etc/localtime")
+		if err != nil {
+			return "", fmt.Errorf("cannot tell the host's time zone, pass -marker lon,lat")
+		}
+		_, zone, _ = strings.Cut(target, "zoneinfo/")
+	}
+	city := strings.ReplaceAll(path.Base(zone), "_", " ")
+	if !strings.Contains(zone, "/") || strings.HasPrefix(zone, "Etc/") {
+		return "", fmt.Errorf("time zone %q names no city, pass -marker lon,lat", zone)
+	}
+	return city, nil
+}
+
+// parseMarker splits "lon,lat" into coordinates; anything else is a place.
+func parseMarker(raw string) (lon float64, lat float64, place string) {
+	if a, b, ok := strings.Cut(raw, ","); ok {
+		lon, errLon := strconv.ParseFloat(strings.TrimSpace(a), 64)
+		lat, errLat := strconv.ParseFloat(strings.TrimSpace(b), 64)
+		if errLon == nil && errLat == nil {
+			return lon, lat, ""
+		}
+	}
+	return 0, 0, strings.TrimSpace(raw)
+}
+
+func renderRemote(opts options) (string, error) {
+	header := http.Header{}
+	if opts.termCols > 0 {
+		header.Set("X-Terminal-Cols", strconv.Itoa(opts.termCols))
+		if opts.termRows > 0 {
+			header.Set("X-Terminal-Rows", strconv.Itoa(opts.termRows))
+		}
+	}
+	c, err := client.New(opts.api, client.Options{APIKey: opts.key, Secret: opts.secret, UserAgent: "mapctl", Header: header})
+	if err != nil {
+		return "", err
+	}
+
+	request := map[string]any{}
+	if opts.requestData != nil {
+		if err := json.Unmarshal(opts.requestData, &request); err != nil || request == nil {
+			return "", fmt.Errorf("%s: request must be a JSON object", opts.request)
+		}
+	}
+	// Flags left at their defaults keep the values of the request, or the
+	// server's defaults.
+	fields := map[string]any{
+		"width":       opts.width,
+		"supersample": opts.supersample,
+		"char-aspect": opts.charAspect,
+		"margin":      opts.margin,
+		"frame":       opts.frame,
+		"title":       opts.title,
+		"continent":   opts.continent,
+		"theme":       opts.theme,
+		"preset":      opts.preset,
+		"format":      opts.format,
+	}
+	for name, value := range fields {
+		if opts.set[name] {
+			request[strings.ReplaceAll(name, "-", "_")] = value
+		}
+	}
+	if opts.set["marker"] {
+		marker := object(request, "marker")
+		marker["enabled"] = true
+		// The server places "here" by the address it sees, the host's
+		// public one.
+		if isHere(opts.marker) {
+			marker["use_client_ip"] = true
+		} else {
+			lon, lat, place := parseMarker(opts.marker)
+			marker["lon"], marker["lat"], marker["place"] = lon, lat, place
+		}
+	}
+	if opts.set["label"] {
+		object(request, "marker")["label"] = opts.label
+	}
+	if opts.set["marker-style"] {
+		object(request, "marker")["style"] = opts.markerStyle
+	}
+	color := object(request, "color")
+	if _, ok := color["mode"]; !ok || opts.set["color"] {
+		color["mode"] = opts.color
+	}
+	for name, value := range map[string]string{"map-color": opts.mapColor, "frame-color": opts.frameColor, "marker-color": opts.markerColor} {
+		if opts.set[name] {
+			color[strings.ReplaceAll(name, "-", "_")] = value
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	resp, err := c.Generate(ctx, client.GenerateRequest{Extra: request})
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case opts.json:
+		return formatJSON(map[string]any{"plain": resp.Plain, "ansi": resp.ANSI, "meta": resp.Meta.Raw, "message": resp.Message})
+	case resp.Message != "":
+		return resp.Message + "\n", nil
+	case color["mode"] == string(render.ColorModeNever):
+		return resp.Plain, nil
+	default:
+		return resp.ANSI, nil
+	}
+}
+
+func readRequest(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// object returns request[name] as an object, replacing anything else.
+func object(request map[string]any, name string) map[string]any {
+	value, ok := request[name].(map[string]any)
+	if !ok {
+		value = map[string]any{}
+		request[name] = value
+	}
+	return value
+}
+
+func renderLocal(opts options) (string, error) {
+	for _, name := range []string{"request", "theme", "preset", "format"} {
+		if opts.set[name] {
+			return "", fmt.Errorf("-%s needs a server, set -api or MAP_API_URL", name)
+		}
+	}
+
+	mask, err := mapascii.LoadEmbeddedDefaultLandMask()
+	if err != nil {
+		return "", err
+	}
+	renderOpts := render.Options{
+		Width:       opts.width,
+		Supersample: opts.supersample,
+		CharAspect:  opts.charAspect,
+		Margin:      opts.margin,
+		Frame:       opts.frame,
+		Title:       opts.title,
+	}
+	if raw := strings.TrimSpace(opts.continent); raw != "" && !strings.EqualFold(raw, "world") {
+		continent, err := mapascii.ParseContinent(raw)
+		if err != nil {
+			return "", err
+		}
+		viewport, err := continent.Viewport()
+		if err != nil {
+			return "", err
+		}
+		renderOpts.Viewport = &viewport
+	}
+	if opts.termCols > 0 {
+		fitTerminal(&renderOpts, opts)
+	}
+	if opts.marker != "" {
+		style, err := render.ParseMarkerStyle(opts.markerStyle)
+		if err != nil {
+			return "", err
+		}
+		lon, lat, place := parseMarker(opts.marker)
+		if isHere(opts.marker) {
+			if place, err = hostCity(); err != nil {
+				return "", err
+			}
+		}
+		if place != "" {
+			cities, err := geo.EmbeddedGazetteer()
+			if err != nil {
+				return "", err
+			}
+			found := cities.Search(place, 1)
+			if len(found) == 0 {
+				return "", fmt.Errorf("no city matches %q", place)
+			}
+			lon, lat = found[0].Lon, found[0].Lat
+		}
+		renderOpts.Markers = []render.Marker{{
+			Lon:        lon,
+			Lat:        lat,
+			Style:      style,
+			Center:     'O',
+			Horizontal: '-',
+			Vertical:   '|',
+			ArmX:       -1,
+			ArmY:       -1,
+			Number:     1,
+			Label:      opts.label,
+		}}
+	}
+
+	mode, err := render.ParseColorMode(opts.color)
+	if err != nil {
+		return "", err
+	}
+	var palette render.Palette
+	for _, c := range []struct {
+		flag  string
+		raw   string
+		color *render.Color
+	}{
+		{"map-color", opts.mapColor, &palette.Map},
+		{"frame-color", opts.frameColor, &palette.Frame},
+		{"marker-color", opts.markerColor, &palette.Marker},
+	} {
+		if *c.color, err = render.ParseColor(c.raw); err != nil {
+			return "", fmt.Errorf("-%s: %w", c.flag, err)
+		}
+	}
+
+	canvas, err := render.Render(mask, renderOpts)
+	if err != nil {
+		return "", err
+	}
+	plain, ansi := canvas.Plain(), ""
+	if mode != render.ColorModeNever {
+		ansi = canvas.ANSI(mode, palette)
+	}
+	switch {
+	case opts.json:
+		return formatJSON(map[string]any{"plain": plain, "ansi": ansi, "meta": map[string]any{"width": canvas.MapWidth, "height": canvas.MapHeight, "char_aspect": renderOpts.CharAspect}})
+	case mode == render.ColorModeNever:
+		return plain, nil
+	default:
+		return ansi, nil
+	}
+}
+
+// fitTerminal sizes the map to the terminal like the server does for
+// X-Terminal-Cols and X-Terminal-Rows, leaving a row for the prompt. An
+// explicit -char-aspect is kept.
+func fitTerminal(renderOpts *render.Options, opts options) {
+	viewport := render.WorldViewport()
+	if renderOpts.Viewport != nil {
+		viewport = *renderOpts.Viewport
+	}
+	cols, rows := opts.termCols, opts.termRows
+	if opts.frame {
+		cols -= 2
+	}
+	if rows > 0 {
+		rows -= 2*opts.margin + 1
+		if opts.frame {
+			rows -= 2
+		}
+		rows = max(rows, 1)
+	}
+	maxAspect := maxCharAspect
+	if opts.set["char-aspect"] {
+		maxAspect = opts.charAspect
+	}
+	renderOpts.Width, renderOpts.CharAspect = render.FitTerminal(cols, rows, opts.charAspect, maxAspect, func(width int, charAspect float64) int {
+		return render.MapHeight(width, charAspect, viewport)
+	})
+}
+
+func formatJSON(v any) (string, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
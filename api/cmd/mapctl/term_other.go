@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package main
+
+import "os"
+
+// ttySize is not supported here; COLUMNS and LINES still apply.
+func ttySize(f *os.File) (cols int, rows int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ttySize asks the terminal behind f for its size.
+func ttySize(f *os.File) (cols int, rows int, ok bool) {
+	var size struct{ Row, Col, Xpixel, Ypixel uint16 }
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&size)))
+	if errno != 0 || size.Col == 0 {
+		return 0, 0, false
+	}
+	return int(size.Col), int(size.Row), true
+}
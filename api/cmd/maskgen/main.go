@@ -0,0 +1,173 @@
+// Command maskgen rasterizes GeoJSON or shapefile polygons into a land mask
+// for the API server, e.g. Natural Earth's ne_10m_land at a higher
+// resolution than the built-in mask, or hand-drawn land for a fictional map.
+//
+//	go run ./cmd/maskgen -width 7200 -o masks/hires.png ne_10m_land.zip
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"map-ascii-generator/api/internal/geo"
+	"map-ascii-generator/api/internal/landmask"
+)
+
+const (
+	defaultWidth       = 3600
+	defaultSupersample = 4
+	maxSupersample     = 16
+	// coordinateSlack tolerates rings that overshoot the poles or the
+	// antimeridian slightly, as some datasets do.
+	coordinateSlack = 1.0
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("maskgen: ")
+
+	output := flag.String("o", "", "output mask file; the extension picks the format: .png, .pbm or .pgm")
+	width := flag.Int("width", defaultWidth, "mask width in pixels")
+	height := flag.Int("height", 0, "mask height in pixels (default width/2)")
+	supersample := flag.Int("supersample", defaultSupersample, "samples per pixel in each direction; coastline pixels get the covered fraction")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: maskgen -o mask.png [flags] input.geojson|input.shp|input.zip...\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *output == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(*output)), ".")
+	if !slices.Contains([]string{landmask.FormatPNG, landmask.FormatPBM, landmask.FormatPGM}, format) {
+		log.Fatalf("output must end in .png, .pbm or .pgm, got %s", *output)
+	}
+	if *height == 0 {
+		*height = *width / 2
+	}
+	if *width < 2 || *height < 2 {
+		log.Fatalf("mask must be at least 2x2 pixels, got %dx%d", *width, *height)
+	}
+	if *supersample < 1 || *supersample > maxSupersample {
+		log.Fatalf("supersample must be between 1 and %d", maxSupersample)
+	}
+
+	var polygons []geo.Polygon
+	for _, path := range flag.Args() {
+		read, err := readPolygons(path)
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+		if err := checkCoordinates(read); err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+		log.Printf("%s: %d polygons", path, len(read))
+		polygons = append(polygons, read...)
+	}
+	if len(polygons) == 0 {
+		log.Fatalf("no polygons in the input")
+	}
+
+	mask := landmask.Rasterize(polygons, *width, *height, *supersample)
+
+	var buf bytes.Buffer
+	if err := landmask.Encode(&buf, mask, format); err != nil {
+		log.Fatalf("encode mask: %v", err)
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0o644); err != nil {
+		log.Fatalf("write mask: %v", err)
+	}
+
+	land := 0.0
+	for _, v := range mask.Data {
+		land += v
+	}
+	log.Printf("wrote %s: %dx%d %s, %.1f%% of pixels land", *output, mask.Width, mask.Height, format, 100*land/float64(len(mask.Data)))
+}
+
+// readPolygons loads a GeoJSON file, a .shp file, or a zip archive holding
+// shapefiles such as the Natural Earth downloads.
+func readPolygons(path string) ([]geo.Polygon, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".shp":
+		return geo.ParseShapefile(data)
+	case ".zip":
+		return readZip(data)
+	default:
+		features, err := geo.ParseFeatures(data)
+		if err != nil {
+			return nil, err
+		}
+		var polygons []geo.Polygon
+		for _, feature := range features {
+			polygons = append(polygons, feature.Polygons...)
+		}
+		return polygons, nil
+	}
+}
+
+func readZip(data []byte) ([]geo.Polygon, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("open zip: %w", err)
+	}
+
+	var polygons []geo.Polygon
+	found := false
+	for _, file := range archive.File {
+		if !strings.EqualFold(filepath.Ext(file.Name), ".shp") {
+			continue
+		}
+		found = true
+
+		rc, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name, err)
+		}
+		shp, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name, err)
+		}
+
+		read, err := geo.ParseShapefile(shp)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name, err)
+		}
+		polygons = append(polygons, read...)
+	}
+	if !found {
+		return nil, fmt.Errorf("zip archive holds no .shp file")
+	}
+	return polygons, nil
+}
+
+// checkCoordinates rejects input that is not in lon/lat degrees, which
+// usually means a projected shapefile.
+func checkCoordinates(polygons []geo.Polygon) error {
+	for _, polygon := range polygons {
+		for _, ring := range polygon {
+			for _, p := range ring {
+				if p.Lon() < -180-coordinateSlack || p.Lon() > 180+coordinateSlack || p.Lat() < -90-coordinateSlack || p.Lat() > 90+coordinateSlack {
+					return fmt.Errorf("coordinate %g,%g is outside lon/lat range; reproject the data to WGS 84 degrees first", p.Lon(), p.Lat())
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"map-ascii-generator/api/internal/trace"
+)
+
+const (
+	accessLogCombined = "combined"
+	accessLogJSON     = "json"
+	accessLogOff      = "off"
+)
+
+var accessLogFormats = []string{accessLogCombined, accessLogJSON, accessLogOff}
+
+// accessLog writes one line per request, apart from the application log:
+// to stdout, or to access_log.file when set.
+type accessLog struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func openAccessLog(path string) (*accessLog, error) {
+	if path == "" {
+		return &accessLog{out: os.Stdout}, nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open access log: %w", err)
+	}
+	return &accessLog{out: file}, nil
+}
+
+func validateAccessLogFormat(format string) error {
+	for _, known := range accessLogFormats {
+		if format == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("access_log.format must be one of %s, got %q", strings.Join(accessLogFormats, ", "), format)
+}
+
+// accessEntry is what handlers add to a request's access log line. It is
+// kept when the log is off too, for requestClient.
+type accessEntry struct {
+	client string
+}
+
+type accessEntryContext struct{}
+
+// noteClient records the rate-limit key a request was counted under for
+// the access log. API keys are counted, and so logged, by ID.
+func noteClient(r *http.Request, clientKey string) {
+	entry, ok := r.Context().Value(accessEntryContext{}).(*accessEntry)
+	if !ok {
+		return
+	}
+	entry.client = clientKey
+}
+
+// requestClient returns the client noteClient recorded for r: an IP
+// address, key:<id> or jwt:<sub>, or "" before one was resolved.
+func requestClient(r *http.Request) string {
+	entry, ok := r.Context().Value(accessEntryContext{}).(*accessEntry)
+	if !ok {
+		return ""
+	}
+	return entry.client
+}
+
+type accessRecord struct {
+	Time       string  `json:"time"`
+	RequestID  string  `json:"request_id"`
+	TraceID    string  `json:"trace_id,omitempty"`
+	RemoteAddr string  `json:"remote_addr"`
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	Query      string  `json:"query,omitempty"`
+	Proto      string  `json:"proto"`
+	Status     int     `json:"status"`
+	Bytes      int64   `json:"bytes"`
+	DurationMS float64 `json:"duration_ms"`
+	Client     string  `json:"client,omitempty"`
+	Cache      string  `json:"cache,omitempty"`
+	Referer    string  `json:"referer,omitempty"`
+	UserAgent  string  `json:"user_agent,omitempty"`
+}
+
+// withAccessLog logs every request once it is answered, in the format
+// access_log.format selects. The cache field is the response's X-Cache
+// header, for handlers that serve from a cache.
+func (s *server) withAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := &accessEntry{}
+		r = r.WithContext(context.WithValue(r.Context(), accessEntryContext{}, entry))
+		format := s.config().accessLogFormat
+		if s.accessLog == nil || format == accessLogOff {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		tw := &trackingWriter{ResponseWriter: w}
+		defer func() {
+			s.accessLog.write(format, newAccessRecord(r, tw, entry, start))
+		}()
+		next.ServeHTTP(tw, r)
+	})
+}
+
+func newAccessRecord(r *http.Request, tw *trackingWriter, entry *accessEntry, start time.Time) accessRecord {
+	status := tw.status
+	if status == 0 {
+		// Nothing was written: a hijacked WebSocket upgrade, or an empty 200.
+		status = http.StatusOK
+		if r.Header.Get("Upgrade") != "" {
+			status = http.StatusSwitchingProtocols
+		}
+	}
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	return accessRecord{
+		Time:       start.UTC().Format(time.RFC3339Nano),
+		RequestID:  requestID(r),
+		TraceID:    traceID(r),
+		RemoteAddr: remote,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		Proto:      r.Proto,
+		Status:     status,
+		Bytes:      tw.bytes,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+		Client:     entry.client,
+		Cache:      strings.ToLower(tw.Header().Get("X-Cache")),
+		Referer:    r.Referer(),
+		UserAgent:  r.UserAgent(),
+	}
+}
+
+// traceID is the ID of the trace r is part of, if it is sampled.
+func traceID(r *http.Request) string {
+	if span := trace.FromContext(r.Context()); span != nil {
+		return span.TraceID().String()
+	}
+	return ""
+}
+
+func (l *accessLog) write(format string, rec accessRecord) {
+	var line []byte
+	if format == accessLogJSON {
+		line, _ = json.Marshal(rec)
+	} else {
+		line = []byte(rec.combined())
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.out.Write(append(line, '\n'))
+}
+
+// combined formats rec in the Apache combined log format, followed by the
+// duration in milliseconds, client, cache status and request ID.
+func (rec accessRecord) combined() string {
+	at, _ := time.Parse(time.RFC3339Nano, rec.Time)
+	target := (&url.URL{Path: rec.Path}).EscapedPath()
+	if rec.Query != "" {
+		target += "?" + rec.Query
+	}
+	bytes := "-"
+	if rec.Bytes > 0 {
+		bytes = strconv.FormatInt(rec.Bytes, 10)
+	}
+	return fmt.Sprintf(`%s - - [%s] "%s %s %s" %d %s %s %s %.3f %s %s %s`,
+		rec.RemoteAddr,
+		at.Format("02/Jan/2006:15:04:05 -0700"),
+		rec.Method, target, rec.Proto,
+		rec.Status, bytes,
+		quoteField(rec.Referer), quoteField(rec.UserAgent),
+		rec.DurationMS,
+		quoteField(rec.Client), quoteField(rec.Cache), quoteField(rec.RequestID),
+	)
+}
+
+// quoteField quotes a log field, "-" when empty, escaping quotes and
+// control characters so a field cannot forge a line.
+func quoteField(value string) string {
+	if value == "" {
+		value = "-"
+	}
+	return strconv.Quote(value)
+}
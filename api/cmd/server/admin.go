@@ -0,0 +1,30 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// requireAdmin checks the bearer token of an admin request and writes the
+// error response when it does not match. Without a configured token the
+// admin endpoints do not exist.
+func (s *server) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token := s.config().adminToken
+	if token == "" {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return false
+	}
+
+	auth := strings.TrimSpace(r.Header.Get("Authorization"))
+	given := ""
+	if len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		given = strings.TrimSpace(auth[len("Bearer "):])
+	}
+	if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeJSONError(w, http.StatusUnauthorized, "invalid admin token")
+		return false
+	}
+	return true
+}
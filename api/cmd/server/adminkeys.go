@@ -0,0 +1,292 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"map-ascii-generator/api/internal/apikey"
+)
+
+const maxKeyNameLength = 64
+
+type adminKeysResponse struct {
+	Keys []adminKeyInfo `json:"keys"`
+}
+
+// adminKeyInfo describes an API key by its ID. The key and its secret are
+// only returned when they are created.
+type adminKeyInfo struct {
+	ID      string        `json:"id"`
+	Name    string        `json:"name"`
+	Tier    string        `json:"tier"`
+	Signed  bool          `json:"signed"`
+	Limits  keyLimitsBody `json:"limits"`
+	Source  string        `json:"source"`
+	Revoked bool          `json:"revoked"`
+	Created *time.Time    `json:"created,omitempty"`
+	Key     string        `json:"key,omitempty"`
+	Secret  string        `json:"secret,omitempty"`
+}
+
+// keyLimitsBody is a key's own limits; omitted or zero fields fall back to
+// its tier's.
+type keyLimitsBody struct {
+	RateLimit      int    `json:"rate_limit,omitempty"`
+	RateWindow     string `json:"rate_window,omitempty"`
+	MaxWidth       int    `json:"max_width,omitempty"`
+	MaxSupersample int    `json:"max_supersample,omitempty"`
+}
+
+type createKeyRequest struct {
+	Name   string        `json:"name"`
+	Tier   string        `json:"tier"`
+	Signed bool          `json:"signed"`
+	Limits keyLimitsBody `json:"limits"`
+}
+
+type updateKeyRequest struct {
+	Name   *string        `json:"name"`
+	Tier   *string        `json:"tier"`
+	Limits *keyLimitsBody `json:"limits"`
+}
+
+// parse converts the limits, recording their problems in errs.
+func (b keyLimitsBody) parse(errs *fieldErrors) apikey.Limits {
+	if b.RateLimit < 0 {
+		errs.add("/limits/rate_limit", fmt.Errorf("limits.rate_limit must not be negative"))
+	}
+	if b.MaxWidth < 0 {
+		errs.add("/limits/max_width", fmt.Errorf("limits.max_width must not be negative"))
+	}
+	if b.MaxSupersample < 0 {
+		errs.add("/limits/max_supersample", fmt.Errorf("limits.max_supersample must not be negative"))
+	}
+
+	limits := apikey.Limits{RateLimit: b.RateLimit, MaxWidth: b.MaxWidth, MaxSupersample: b.MaxSupersample}
+	if b.RateWindow != "" {
+		window, err := time.ParseDuration(b.RateWindow)
+		if err != nil || window <= 0 {
+			errs.add("/limits/rate_window", fmt.Errorf("limits.rate_window must be a positive duration such as 1m"))
+		}
+		limits.RateWindow = window
+	}
+	return limits
+}
+
+func keyLimits(limits apikey.Limits) keyLimitsBody {
+	body := keyLimitsBody{RateLimit: limits.RateLimit, MaxWidth: limits.MaxWidth, MaxSupersample: limits.MaxSupersample}
+	if limits.RateWindow > 0 {
+		body.RateWindow = limits.RateWindow.String()
+	}
+	return body
+}
+
+func validateKeyName(name string) error {
+	if name == "" || len(name) > maxKeyNameLength {
+		return fmt.Errorf("name must be 1 to %d characters", maxKeyNameLength)
+	}
+	return nil
+}
+
+func keyInfo(k apikey.Key) adminKeyInfo {
+	info := adminKeyInfo{
+		ID:      k.ID(),
+		Name:    k.Name,
+		Tier:    k.Tier,
+		Signed:  k.Secret != "",
+		Limits:  keyLimits(k.Limits),
+		Source:  "file",
+		Revoked: k.Revoked,
+	}
+	if k.Managed {
+		info.Source = "admin"
+	}
+	if !k.Created.IsZero() {
+		info.Created = &k.Created
+	}
+	return info
+}
+
+// adminKeys returns the key store for the admin key endpoints, writing the
+// error response when there is none.
+func (s *server) adminKeys(w http.ResponseWriter, r *http.Request) (*apikey.Store, bool) {
+	if !s.requireAdmin(w, r) {
+		return nil, false
+	}
+	keys := s.keys.Load()
+	if keys == nil {
+		writeJSONError(w, http.StatusNotFound, "API keys are not enabled; set keys_file")
+		return nil, false
+	}
+	return keys, true
+}
+
+// handleAdminKeys lists the API keys or creates one.
+func (s *server) handleAdminKeys(w http.ResponseWriter, r *http.Request) {
+	keys, ok := s.adminKeys(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		list := keys.Keys()
+		resp := adminKeysResponse{Keys: make([]adminKeyInfo, 0, len(list))}
+		for _, k := range list {
+			resp.Keys = append(resp.Keys, keyInfo(k))
+		}
+		writeJSON(w, http.StatusOK, resp)
+	case http.MethodPost:
+		s.createKey(w, r, keys)
+	}
+}
+
+func (s *server) createKey(w http.ResponseWriter, r *http.Request, keys *apikey.Store) {
+	body, err := readJSONBody(w, r, s.config())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var req createKeyRequest
+	if err := decodeStrictJSON(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	var errs fieldErrors
+	errs.add("/name", validateKeyName(req.Name))
+	limits := req.Limits.parse(&errs)
+	if err := errs.err(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	k, err := keys.Create(req.Name, strings.TrimSpace(req.Tier), limits, req.Signed)
+	if err != nil {
+		writeKeyError(w, err)
+		return
+	}
+	log.Printf("api key %s created: name=%q tier=%s", k.ID(), k.Name, k.Tier)
+
+	info := keyInfo(k)
+	info.Key = k.Key
+	info.Secret = k.Secret
+	writeJSON(w, http.StatusCreated, info)
+}
+
+// handleAdminKey returns, changes (PATCH: name, tier and limits) or
+// revokes (DELETE) the API key with the given ID.
+func (s *server) handleAdminKey(w http.ResponseWriter, r *http.Request) {
+	keys, ok := s.adminKeys(w, r)
+	if !ok {
+		return
+	}
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		k, ok := keys.Get(id)
+		if !ok {
+			writeKeyError(w, apikey.ErrNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, keyInfo(k))
+	case http.MethodPatch:
+		s.updateKey(w, r, keys, id)
+	case http.MethodDelete:
+		k, err := keys.Revoke(id)
+		if err != nil {
+			writeKeyError(w, err)
+			return
+		}
+		log.Printf("api key %s revoked: name=%q", id, k.Name)
+		writeJSON(w, http.StatusOK, keyInfo(k))
+	}
+}
+
+func (s *server) updateKey(w http.ResponseWriter, r *http.Request, keys *apikey.Store, id string) {
+	body, err := readJSONBody(w, r, s.config())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var req updateKeyRequest
+	if err := decodeStrictJSON(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var errs fieldErrors
+	if req.Name != nil {
+		*req.Name = strings.TrimSpace(*req.Name)
+		errs.add("/name", validateKeyName(*req.Name))
+	}
+	var limits apikey.Limits
+	if req.Limits != nil {
+		limits = req.Limits.parse(&errs)
+	}
+	if err := errs.err(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	k, err := keys.Update(id, func(k *apikey.Key) {
+		if req.Name != nil {
+			k.Name = *req.Name
+		}
+		if req.Tier != nil {
+			k.Tier = strings.TrimSpace(*req.Tier)
+		}
+		if req.Limits != nil {
+			k.Limits = limits
+		}
+	})
+	if err != nil {
+		writeKeyError(w, err)
+		return
+	}
+	log.Printf("api key %s updated: name=%q tier=%s", id, k.Name, k.Tier)
+	writeJSON(w, http.StatusOK, keyInfo(k))
+}
+
+// handleAdminKeyRotate replaces a key with a new one that has the same
+// settings and revokes the old one.
+func (s *server) handleAdminKeyRotate(w http.ResponseWriter, r *http.Request) {
+	keys, ok := s.adminKeys(w, r)
+	if !ok {
+		return
+	}
+	id := r.PathValue("id")
+	k, err := keys.Rotate(id)
+	if err != nil {
+		writeKeyError(w, err)
+		return
+	}
+	log.Printf("api key %s rotated to %s: name=%q", id, k.ID(), k.Name)
+
+	info := keyInfo(k)
+	info.Key = k.Key
+	info.Secret = k.Secret
+	writeJSON(w, http.StatusCreated, info)
+}
+
+func writeKeyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, apikey.ErrNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, apikey.ErrUnknownTier):
+		writeError(w, http.StatusBadRequest, &paramError{Name: "/tier", Err: err})
+	case errors.Is(err, apikey.ErrRevoked):
+		writeJSONError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, apikey.ErrNoStateSecret):
+		writeJSONError(w, http.StatusNotImplemented, err.Error()+" (set data.state_secret)")
+	default:
+		log.Printf("failed to store api key: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to store API key")
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"map-ascii-generator/api/internal/apikey"
+	"map-ascii-generator/api/internal/ratelimit"
+)
+
+type tierLimiter struct {
+	limit      int
+	window     time.Duration
+	maxBuckets int
+	limiter    ratelimit.Limiter
+}
+
+type tierLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]tierLimiter
+	// saved holds counters from before a restart until the tier's limiter
+	// is created.
+	saved map[string]savedLimiter
+}
+
+// restoreLater keeps saved counters for the tiers' limiters to start with.
+func (t *tierLimiters) restoreLater(saved map[string]savedLimiter) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.saved = saved
+}
+
+// pending returns the saved counters of the tiers not used since.
+func (t *tierLimiters) pending() map[string]savedLimiter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return maps.Clone(t.saved)
+}
+
+func (t *tierLimiters) forTier(tier apikey.Tier, algorithm ratelimit.Algorithm, fallbackLimit int, fallbackWindow time.Duration, maxBuckets int) ratelimit.Limiter {
+	limit := tier.RateLimit
+	if limit <= 0 {
+		limit = fallbackLimit
+	}
+	window := tier.RateWindow
+	if window <= 0 {
+		window = fallbackWindow
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.limiters == nil {
+		t.limiters = make(map[string]tierLimiter)
+	}
+
+	// A reload that changes a tier's limits starts it with fresh counters.
+	current, ok := t.limiters[tier.Name]
+	if !ok || current.limit != limit || current.window != window {
+		if ok {
+			current.limiter.Stop()
+		}
+		current = tierLimiter{
+			limit:      limit,
+			window:     window,
+			maxBuckets: maxBuckets,
+			limiter:    ratelimit.New(algorithm, limit, window, maxBuckets),
+		}
+		if saved, ok := t.saved[tier.Name]; ok && saved.Window == window {
+			current.limiter.Restore(saved.Counters, time.Now())
+		}
+		delete(t.saved, tier.Name)
+		t.limiters[tier.Name] = current
+	}
+	if current.maxBuckets != maxBuckets {
+		current.limiter.SetMaxBuckets(maxBuckets)
+		current.maxBuckets = maxBuckets
+		t.limiters[tier.Name] = current
+	}
+
+	return current.limiter
+}
+
+func requestAPIKey(r *http.Request) string {
+	if key := strings.TrimSpace(r.Header.Get("X-API-Key")); key != "" {
+		return key
+	}
+
+	auth := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		return strings.TrimSpace(auth[len("Bearer "):])
+	}
+
+	return ""
+}
+
+// resolveClient returns the limiter, rate-limit key and effective limits for a
+// request. Requests without an API key or JWT use the global limits keyed by
+// client IP.
+func (s *server) resolveClient(r *http.Request) (ratelimit.Limiter, string, config, bool) {
+	limiter, clientKey, cfg, ok := s.identifyClient(r)
+	if ok {
+		noteClient(r, clientKey)
+	}
+	return limiter, clientKey, cfg, ok
+}
+
+func (s *server) identifyClient(r *http.Request) (ratelimit.Limiter, string, config, bool) {
+	cfg := s.config()
+	keys := s.keys.Load()
+
+	key := requestAPIKey(r)
+	if auth := s.jwt.Load(); auth != nil && looksLikeJWT(key) {
+		return s.resolveJWT(r, auth, key, cfg)
+	}
+	if key == "" || keys == nil {
+		return s.limiter, clientIdentifier(r), cfg, true
+	}
+
+	k, tier, ok := keys.Lookup(key)
+	if !ok || (k.Secret != "" && !signedWith(r, k.Key)) {
+		return nil, "", config{}, false
+	}
+
+	cfg = tierLimits(cfg, tier)
+	return s.tierLimiters.forTier(tier, cfg.rateAlgorithm, cfg.rateLimit, cfg.rateWindow, cfg.rateMaxClients), "key:" + k.ID(), cfg, true
+}
+
+// tierLimits applies the overrides of tier to cfg.
+func tierLimits(cfg config, tier apikey.Tier) config {
+	if tier.MaxWidth > 0 {
+		cfg.maxWidth = tier.MaxWidth
+	}
+	if tier.MaxSupersample > 0 {
+		cfg.maxSupersample = tier.MaxSupersample
+	}
+	if tier.RateLimit > 0 {
+		cfg.rateLimit = tier.RateLimit
+	}
+	if tier.RateWindow > 0 {
+		cfg.rateWindow = tier.RateWindow
+	}
+	return cfg
+}
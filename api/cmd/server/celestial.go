@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"map-ascii-generator/api/internal/orbit"
+	"map-ascii-generator/api/internal/render"
+)
+
+const (
+	defaultSunGlyph  = 'S'
+	defaultMoonGlyph = 'M'
+)
+
+// celestialMeta reports the time the sun and moon were computed for and
+// where they were drawn.
+type celestialMeta struct {
+	Time time.Time      `json:"time"`
+	Sun  *celestialBody `json:"sun,omitempty"`
+	Moon *celestialBody `json:"moon,omitempty"`
+}
+
+type celestialBody struct {
+	Lon     float64 `json:"lon"`
+	Lat     float64 `json:"lat"`
+	Row     int     `json:"row"`
+	Col     int     `json:"col"`
+	Visible bool    `json:"visible"`
+}
+
+// celestialLayer holds the markers for celestial.sun and celestial.moon, in
+// that order, with the meta entries they fill in.
+type celestialLayer struct {
+	markers []render.Marker
+	bodies  []*celestialBody
+	meta    celestialMeta
+}
+
+// requestCelestial places the sun at the subsolar and the moon at the
+// sublunar point for celestial.time, or for the time of the request.
+func requestCelestial(req generateRequest, now time.Time) (*celestialLayer, error) {
+	if !req.Celestial.Sun && !req.Celestial.Moon {
+		if strings.TrimSpace(req.Celestial.Time) != "" {
+			return nil, fmt.Errorf("celestial.time requires celestial.sun or celestial.moon")
+		}
+		return nil, nil
+	}
+
+	at := now.UTC()
+	if raw := strings.TrimSpace(req.Celestial.Time); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, fmt.Errorf("celestial.time must be an RFC 3339 timestamp")
+		}
+		at = parsed.UTC()
+	}
+
+	layer := &celestialLayer{meta: celestialMeta{Time: at}}
+	bodies := []struct {
+		enabled  bool
+		name     string
+		glyph    string
+		fallback rune
+		locate   func(time.Time) (float64, float64)
+		dst      **celestialBody
+	}{
+		{req.Celestial.Sun, "celestial.sun_glyph", req.Celestial.SunGlyph, defaultSunGlyph, orbit.SubsolarPoint, &layer.meta.Sun},
+		{req.Celestial.Moon, "celestial.moon_glyph", req.Celestial.MoonGlyph, defaultMoonGlyph, orbit.SublunarPoint, &layer.meta.Moon},
+	}
+	for _, body := range bodies {
+		if !body.enabled {
+			continue
+		}
+		center, centerGlyph, err := parseGlyph(body.glyph, body.fallback, body.name, req.AllowUnicode)
+		if err != nil {
+			return nil, err
+		}
+		lon, lat := body.locate(at)
+		*body.dst = &celestialBody{Lon: lon, Lat: lat}
+		layer.markers = append(layer.markers, render.Marker{Lon: lon, Lat: lat, Style: render.MarkerDot, Center: center, CenterGlyph: centerGlyph})
+		layer.bodies = append(layer.bodies, *body.dst)
+	}
+	return layer, nil
+}
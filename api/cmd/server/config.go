@@ -0,0 +1,431 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"map-ascii-generator/api/internal/acme"
+	"map-ascii-generator/api/internal/configfile"
+	"map-ascii-generator/api/internal/objstore"
+	"map-ascii-generator/api/internal/ratelimit"
+	"map-ascii-generator/api/internal/storage"
+	"map-ascii-generator/api/internal/weather"
+)
+
+const (
+	defaultRenderWidth       = 120
+	defaultRenderSupersample = 3
+	defaultRenderCharAspect  = 2.0
+	defaultRenderMargin      = 2
+	defaultRenderFrame       = true
+	defaultRenderColorMode   = "always"
+	defaultRenderMapColor    = "green"
+	defaultRenderFrameColor  = "bright-white"
+	defaultRenderMarkerColor = "bright-red"
+)
+
+type config struct {
+	listenAddr string
+	grpcAddr   string
+	debugAddr  string
+	// listenRoutes is what listen_addr serves; listeners serve more
+	// addresses, each with its own routes.
+	listenRoutes routeSet
+	listeners    []listenerConfig
+	// basePath prefixes every route, such as /map-api; "" or without a
+	// trailing slash.
+	basePath string
+
+	minWidth       int
+	maxWidth       int
+	maxMargin      int
+	minSupersample int
+	maxSupersample int
+	minCharAspect  float64
+	maxCharAspect  float64
+
+	rateLimit       int
+	rateWindow      time.Duration
+	rateMaxClients  int
+	rateAlgorithm   ratelimit.Algorithm
+	maxBodyBytes    int64
+	maxGeoJSONBytes int64
+	renderTimeout   time.Duration
+	maxRenders      int
+
+	defaultWidth       int
+	defaultSupersample int
+	defaultCharAspect  float64
+	defaultMargin      int
+	defaultFrame       bool
+	defaultColorMode   string
+	defaultMapColor    string
+	defaultFrameColor  string
+	defaultMarkerColor string
+
+	adminToken string
+	masksDir   string
+	stateDir   string
+	// stateBackend is how records are kept in stateDir: storage.BackendSQLite
+	// or storage.BackendFiles.
+	stateBackend string
+	// stateSecret encrypts the secrets of signed API keys in stateDir.
+	stateSecret string
+
+	serverHeader string
+
+	cacheMaxEntries    int
+	cacheTTL           time.Duration
+	cacheMaxAge        time.Duration
+	cacheWarmup        bool
+	cacheWarmupWidths  string
+	cacheWarmupPresets string
+
+	usageMaxClients int
+
+	maintenanceEnabled  bool
+	maintenanceMessage  string
+	maintenanceNotReady bool
+
+	historyEnabled    bool
+	historyMaxEntries int
+
+	shareTTL     time.Duration
+	shareSecret  string
+	shareBaseURL string
+
+	slowRenderThreshold  time.Duration
+	slowRenderProfileDir string
+
+	accessLogFormat string
+	accessLogFile   string
+
+	tracingEndpoint    string
+	tracingHeaders     string
+	tracingServiceName string
+	tracingSampleRatio float64
+
+	jwtJWKSURL   string
+	jwtKeyFile   string
+	jwtSecret    string
+	jwtIssuer    string
+	jwtAudience  string
+	jwtTierClaim string
+
+	storageEndpoint  string
+	storageRegion    string
+	storageAccessKey string
+	storageSecretKey string
+	storagePathStyle bool
+
+	jobWorkers   int
+	jobQueueSize int
+	jobTTL       time.Duration
+
+	keysFile       string
+	schedulesFile  string
+	presetsFile    string
+	countriesFile  string
+	timezonesFile  string
+	citiesFile     string
+	airportsFile   string
+	elevationFile  string
+	populationFile string
+	geoipFile      string
+
+	issPositionURL string
+	issTLEURL      string
+	issTLEFile     string
+	issOffline     bool
+
+	earthquakesFeedURL  string
+	earthquakesCacheTTL time.Duration
+
+	weatherSource   string
+	weatherURL      string
+	weatherGridStep float64
+	weatherCacheTTL time.Duration
+
+	discordPublicKey string
+
+	telegramBotToken string
+	telegramSecret   string
+	telegramAPIURL   string
+
+	tlsCertFile         string
+	tlsKeyFile          string
+	tlsAutocertHost     string
+	tlsAutocertEmail    string
+	tlsAutocertCacheDir string
+	tlsACMEDirectory    string
+	tlsHTTPAddr         string
+}
+
+// loadConfig reads settings from the optional config file at path, with
+// environment variables taking precedence over file values.
+func loadConfig(path string) (config, error) {
+	src := &configSource{used: make(map[string]struct{})}
+	if path != "" {
+		file, err := configfile.Load(path)
+		if err != nil {
+			return config{}, err
+		}
+		src.file = file
+	}
+
+	cfg := config{
+		listenAddr:      src.str("API_LISTEN_ADDR", "listen_addr", defaultListenAddr),
+		grpcAddr:        src.str("API_GRPC_ADDR", "grpc_addr", ""),
+		debugAddr:       src.str("API_DEBUG_ADDR", "debug_addr", ""),
+		basePath:        src.str("API_BASE_PATH", "base_path", ""),
+		minWidth:        src.int("API_MIN_WIDTH", "limits.min_width", defaultMinWidth),
+		maxWidth:        src.int("API_MAX_WIDTH", "limits.max_width", defaultMaxWidth),
+		maxMargin:       src.int("API_MAX_MARGIN", "limits.max_margin", defaultMaxMargin),
+		minSupersample:  src.int("API_MIN_SUPERSAMPLE", "limits.min_supersample", defaultMinSupersample),
+		maxSupersample:  src.int("API_MAX_SUPERSAMPLE", "limits.max_supersample", defaultMaxSupersample),
+		minCharAspect:   src.float("API_MIN_CHAR_ASPECT", "limits.min_char_aspect", defaultMinCharAspect),
+		maxCharAspect:   src.float("API_MAX_CHAR_ASPECT", "limits.max_char_aspect", defaultMaxCharAspect),
+		rateLimit:       src.int("API_RATE_LIMIT", "rate_limit.limit", defaultRateLimit),
+		rateWindow:      src.duration("API_RATE_WINDOW", "rate_limit.window", defaultRateWindow),
+		rateMaxClients:  src.int("API_RATE_MAX_CLIENTS", "rate_limit.max_clients", ratelimit.DefaultMaxBuckets),
+		rateAlgorithm:   ratelimit.Algorithm(strings.ToLower(src.str("API_RATE_ALGORITHM", "rate_limit.algorithm", string(ratelimit.AlgorithmFixed)))),
+		maxBodyBytes:    int64(src.int("API_MAX_BODY_BYTES", "limits.max_body_bytes", defaultMaxBodyBytes)),
+		maxGeoJSONBytes: int64(src.int("API_MAX_GEOJSON_BYTES", "limits.max_geojson_bytes", defaultMaxGeoJSONBytes)),
+		renderTimeout:   src.duration("API_RENDER_TIMEOUT", "limits.render_timeout", defaultRenderTimeout),
+		maxRenders:      src.int("API_MAX_CONCURRENT_RENDERS", "limits.max_concurrent_renders", defaultMaxRenders()),
+
+		defaultWidth:       src.int("API_DEFAULT_WIDTH", "defaults.width", defaultRenderWidth),
+		defaultSupersample: src.int("API_DEFAULT_SUPERSAMPLE", "defaults.supersample", defaultRenderSupersample),
+		defaultCharAspect:  src.float("API_DEFAULT_CHAR_ASPECT", "defaults.char_aspect", defaultRenderCharAspect),
+		defaultMargin:      src.int("API_DEFAULT_MARGIN", "defaults.margin", defaultRenderMargin),
+		defaultFrame:       src.bool("API_DEFAULT_FRAME", "defaults.frame", defaultRenderFrame),
+		defaultColorMode:   strings.ToLower(src.str("API_DEFAULT_COLOR_MODE", "defaults.color.mode", defaultRenderColorMode)),
+		defaultMapColor:    strings.ToLower(src.str("API_DEFAULT_MAP_COLOR", "defaults.color.map_color", defaultRenderMapColor)),
+		defaultFrameColor:  strings.ToLower(src.str("API_DEFAULT_FRAME_COLOR", "defaults.color.frame_color", defaultRenderFrameColor)),
+		defaultMarkerColor: strings.ToLower(src.str("API_DEFAULT_MARKER_COLOR", "defaults.color.marker_color", defaultRenderMarkerColor)),
+
+		adminToken:   src.str("API_ADMIN_TOKEN", "admin.token", ""),
+		masksDir:     src.str("API_MASKS_DIR", "data.masks_dir", ""),
+		stateDir:     src.str("API_STATE_DIR", "data.state_dir", ""),
+		stateBackend: strings.ToLower(src.str("API_STATE_BACKEND", "data.state_backend", storage.BackendSQLite)),
+		stateSecret:  src.str("API_STATE_SECRET", "data.state_secret", ""),
+
+		serverHeader: src.str("API_SERVER_HEADER", "security.server_header", ""),
+
+		cacheMaxEntries:    src.int("API_CACHE_MAX_ENTRIES", "cache.max_entries", defaultCacheMaxEntries),
+		cacheTTL:           src.duration("API_CACHE_TTL", "cache.ttl", defaultCacheTTL),
+		cacheMaxAge:        src.duration("API_CACHE_MAX_AGE", "cache.max_age", defaultCacheMaxAge),
+		cacheWarmup:        src.bool("API_CACHE_WARMUP", "cache.warmup", true),
+		cacheWarmupWidths:  src.str("API_CACHE_WARMUP_WIDTHS", "cache.warmup_widths", ""),
+		cacheWarmupPresets: src.str("API_CACHE_WARMUP_PRESETS", "cache.warmup_presets", ""),
+
+		maintenanceEnabled:  src.bool("API_MAINTENANCE_ENABLED", "maintenance.enabled", false),
+		maintenanceMessage:  src.str("API_MAINTENANCE_MESSAGE", "maintenance.message", defaultMaintenanceMessage),
+		maintenanceNotReady: src.bool("API_MAINTENANCE_NOT_READY", "maintenance.not_ready", false),
+
+		usageMaxClients: src.int("API_USAGE_MAX_CLIENTS", "usage.max_clients", defaultUsageMaxClients),
+
+		historyEnabled:    src.bool("API_HISTORY_ENABLED", "history.enabled", false),
+		historyMaxEntries: src.int("API_HISTORY_MAX_ENTRIES", "history.max_entries", defaultHistoryMaxEntries),
+
+		shareTTL:     src.duration("API_SHARE_TTL", "share.ttl", defaultShareTTL),
+		shareSecret:  src.str("API_SHARE_SECRET", "share.secret", ""),
+		shareBaseURL: src.str("API_SHARE_BASE_URL", "share.base_url", ""),
+
+		slowRenderThreshold:  src.duration("API_SLOW_RENDER_THRESHOLD", "slow_render.threshold", defaultSlowRenderThreshold),
+		slowRenderProfileDir: src.str("API_SLOW_RENDER_PROFILE_DIR", "slow_render.profile_dir", ""),
+
+		accessLogFormat: strings.ToLower(src.str("API_ACCESS_LOG_FORMAT", "access_log.format", accessLogCombined)),
+		accessLogFile:   src.str("API_ACCESS_LOG_FILE", "access_log.file", ""),
+
+		tracingEndpoint:    src.str("API_TRACING_OTLP_ENDPOINT", "tracing.otlp_endpoint", ""),
+		tracingHeaders:     src.str("API_TRACING_HEADERS", "tracing.headers", ""),
+		tracingServiceName: src.str("API_TRACING_SERVICE_NAME", "tracing.service_name", defaultTracingServiceName),
+		tracingSampleRatio: src.float("API_TRACING_SAMPLE_RATIO", "tracing.sample_ratio", 1),
+
+		jwtJWKSURL:   src.str("API_JWT_JWKS_URL", "jwt.jwks_url", ""),
+		jwtKeyFile:   src.str("API_JWT_KEY_FILE", "jwt.key_file", ""),
+		jwtSecret:    src.str("API_JWT_SECRET", "jwt.secret", ""),
+		jwtIssuer:    src.str("API_JWT_ISSUER", "jwt.issuer", ""),
+		jwtAudience:  src.str("API_JWT_AUDIENCE", "jwt.audience", ""),
+		jwtTierClaim: src.str("API_JWT_TIER_CLAIM", "jwt.tier_claim", defaultJWTTierClaim),
+
+		storageEndpoint:  src.str("API_STORAGE_ENDPOINT", "storage.endpoint", objstore.DefaultS3Endpoint),
+		storageRegion:    src.str("API_STORAGE_REGION", "storage.region", defaultStorageRegion),
+		storageAccessKey: src.str("API_STORAGE_ACCESS_KEY_ID", "storage.access_key_id", ""),
+		storageSecretKey: src.str("API_STORAGE_SECRET_ACCESS_KEY", "storage.secret_access_key", ""),
+		storagePathStyle: src.bool("API_STORAGE_PATH_STYLE", "storage.path_style", false),
+
+		jobWorkers:   src.int("API_JOB_WORKERS", "jobs.workers", defaultJobWorkers),
+		jobQueueSize: src.int("API_JOB_QUEUE_SIZE", "jobs.queue_size", defaultJobQueueSize),
+		jobTTL:       src.duration("API_JOB_TTL", "jobs.ttl", defaultJobTTL),
+
+		keysFile:       src.str("API_KEYS_FILE", "keys_file", ""),
+		schedulesFile:  src.str("API_SCHEDULES_FILE", "schedules_file", ""),
+		presetsFile:    src.str("API_PRESETS_FILE", "data.presets_file", ""),
+		countriesFile:  src.str("API_COUNTRIES_FILE", "data.countries_file", ""),
+		timezonesFile:  src.str("API_TIMEZONES_FILE", "data.timezones_file", ""),
+		citiesFile:     src.str("API_CITIES_FILE", "data.cities_file", ""),
+		airportsFile:   src.str("API_AIRPORTS_FILE", "data.airports_file", ""),
+		elevationFile:  src.str("API_ELEVATION_FILE", "data.elevation_file", ""),
+		populationFile: src.str("API_POPULATION_FILE", "data.population_file", ""),
+		geoipFile:      src.str("API_GEOIP_FILE", "data.geoip_file", ""),
+
+		issPositionURL: src.str("API_ISS_POSITION_URL", "iss.position_url", defaultISSPositionURL),
+		issTLEURL:      src.str("API_ISS_TLE_URL", "iss.tle_url", defaultISSTLEURL),
+		issTLEFile:     src.str("API_ISS_TLE_FILE", "iss.tle_file", ""),
+		issOffline:     src.bool("API_ISS_OFFLINE", "iss.offline", false),
+
+		earthquakesFeedURL:  src.str("API_EARTHQUAKES_FEED_URL", "earthquakes.feed_url", defaultEarthquakesFeedURL),
+		earthquakesCacheTTL: src.duration("API_EARTHQUAKES_CACHE_TTL", "earthquakes.cache_ttl", defaultEarthquakesCacheTTL),
+
+		weatherSource:   strings.ToLower(src.str("API_WEATHER_SOURCE", "weather.source", defaultWeatherSource)),
+		weatherURL:      src.str("API_WEATHER_URL", "weather.url", weather.DefaultOpenMeteoURL),
+		weatherGridStep: src.float("API_WEATHER_GRID_STEP", "weather.grid_step", defaultWeatherGridStep),
+		weatherCacheTTL: src.duration("API_WEATHER_CACHE_TTL", "weather.cache_ttl", defaultWeatherCacheTTL),
+
+		discordPublicKey: src.str("API_DISCORD_PUBLIC_KEY", "discord.public_key", ""),
+
+		telegramBotToken: src.str("API_TELEGRAM_BOT_TOKEN", "telegram.bot_token", ""),
+		telegramSecret:   src.str("API_TELEGRAM_WEBHOOK_SECRET", "telegram.webhook_secret", ""),
+		telegramAPIURL:   src.str("API_TELEGRAM_API_URL", "telegram.api_url", defaultTelegramAPIURL),
+
+		tlsCertFile:         src.str("API_TLS_CERT_FILE", "tls.cert_file", ""),
+		tlsKeyFile:          src.str("API_TLS_KEY_FILE", "tls.key_file", ""),
+		tlsHTTPAddr:         src.str("API_TLS_HTTP_ADDR", "tls.http_addr", defaultTLSHTTPAddr),
+		tlsAutocertHost:     src.str("API_TLS_AUTOCERT_HOST", "tls.autocert.host", ""),
+		tlsAutocertEmail:    src.str("API_TLS_AUTOCERT_EMAIL", "tls.autocert.email", ""),
+		tlsAutocertCacheDir: src.str("API_TLS_AUTOCERT_CACHE_DIR", "tls.autocert.cache_dir", defaultAutocertCacheDir),
+		tlsACMEDirectory:    src.str("API_TLS_ACME_DIRECTORY", "tls.autocert.directory", acme.LetsEncryptURL),
+	}
+
+	var err error
+	if cfg.listeners, err = loadListeners(src); err != nil {
+		return config{}, err
+	}
+	// A lone listen_addr serves every route as it always has; once other
+	// listeners are configured it defaults to the public ones.
+	defaultRoutes := "all"
+	if len(cfg.listeners) > 0 {
+		defaultRoutes = "api"
+	}
+	if cfg.listenRoutes, err = parseRouteSet(src.str("API_LISTEN_ROUTES", "listen_routes", defaultRoutes)); err != nil {
+		return config{}, fmt.Errorf("listen_routes: %w", err)
+	}
+	for _, l := range cfg.listeners {
+		if l.tls && !tlsEnabled(cfg) {
+			return config{}, fmt.Errorf("listener %s has tls set but no certificate is configured", l.addr)
+		}
+	}
+
+	if unknown := src.unusedKeys(); len(unknown) > 0 {
+		return config{}, fmt.Errorf("unknown config keys in %s: %s", path, strings.Join(unknown, ", "))
+	}
+	basePath, err := normalizeBasePath(cfg.basePath)
+	if err != nil {
+		return config{}, err
+	}
+	cfg.basePath = basePath
+
+	return cfg, nil
+}
+
+type configSource struct {
+	file map[string]string
+	used map[string]struct{}
+}
+
+func (c *configSource) lookup(env string, key string) (string, string) {
+	c.used[key] = struct{}{}
+
+	if value := strings.TrimSpace(os.Getenv(env)); value != "" {
+		return value, env
+	}
+	if value := strings.TrimSpace(c.file[key]); value != "" {
+		return value, "config key " + key
+	}
+
+	return "", ""
+}
+
+func (c *configSource) unusedKeys() []string {
+	var unknown []string
+	for _, key := range configfile.Keys(c.file) {
+		if _, ok := c.used[key]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	return unknown
+}
+
+func (c *configSource) str(env string, key string, fallback string) string {
+	value, _ := c.lookup(env, key)
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func (c *configSource) int(env string, key string, fallback int) int {
+	value, origin := c.lookup(env, key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("invalid integer for %s (%q), using fallback %d", origin, value, fallback)
+		return fallback
+	}
+
+	return parsed
+}
+
+func (c *configSource) float(env string, key string, fallback float64) float64 {
+	value, origin := c.lookup(env, key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("invalid float for %s (%q), using fallback %.2f", origin, value, fallback)
+		return fallback
+	}
+
+	return parsed
+}
+
+func (c *configSource) bool(env string, key string, fallback bool) bool {
+	value, origin := c.lookup(env, key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("invalid boolean for %s (%q), using fallback %t", origin, value, fallback)
+		return fallback
+	}
+
+	return parsed
+}
+
+func (c *configSource) duration(env string, key string, fallback time.Duration) time.Duration {
+	value, origin := c.lookup(env, key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("invalid duration for %s (%q), using fallback %s", origin, value, fallback)
+		return fallback
+	}
+
+	return parsed
+}
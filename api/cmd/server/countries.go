@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	mapascii "github.com/Kivayan/map-ascii"
+
+	"map-ascii-generator/api/internal/geo"
+	"map-ascii-generator/api/internal/render"
+)
+
+// loadCountries reads the configured country polygons, falling back to the
+// coarse embedded dataset.
+func loadCountries(path string) (*geo.Countries, error) {
+	if path == "" {
+		return geo.EmbeddedCountries()
+	}
+	return geo.LoadCountriesFile(path)
+}
+
+func (s *server) requestBorders(req generateRequest) (*render.Borders, error) {
+	if !req.Borders {
+		return nil, nil
+	}
+
+	ch, err := parseRune(req.BorderChar, '+', "border_char", req.AllowUnicode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &render.Borders{Regions: s.countries.Load(), Char: ch}, nil
+}
+
+// requestHighlight resolves highlight_countries against the loaded dataset.
+// Unknown codes are rejected rather than silently ignored.
+func (s *server) requestHighlight(req generateRequest) (*render.Highlight, error) {
+	if len(req.Highlight) == 0 {
+		return nil, nil
+	}
+
+	ch, err := parseRune(req.HighlightChar, 0, "highlight_char", req.AllowUnicode)
+	if err != nil {
+		return nil, err
+	}
+
+	countries := s.countries.Load()
+	selected := make(map[int]bool, len(req.Highlight))
+	for _, code := range req.Highlight {
+		idx, ok := countries.Lookup(code)
+		if !ok {
+			return nil, fmt.Errorf("highlight_countries: unknown country code %q (see /api/countries)", code)
+		}
+		selected[idx] = true
+	}
+
+	return &render.Highlight{Regions: countries, Selected: selected, Char: ch}, nil
+}
+
+const defaultChoroplethRamp = ":-=+%"
+
+// choroplethSettings checks the request-only choropleth options. Buckets
+// follow the ramp, or the color list when only colors are given.
+func choroplethSettings(req generateRequest) ([]rune, int, render.Scale, error) {
+	scale, err := render.ParseScale(req.Choropleth.Scale)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("choropleth.%w", err)
+	}
+
+	for code, value := range req.Choropleth.Values {
+		if !isFinite(value) {
+			return nil, 0, "", fmt.Errorf("choropleth.values[%s] must be a finite number", code)
+		}
+		if scale == render.ScaleLog && value <= 0 {
+			return nil, 0, "", fmt.Errorf("choropleth.values[%s] must be positive with scale log", code)
+		}
+	}
+
+	ramp, err := parseRamp(req.Choropleth.Ramp, "choropleth.ramp", 1, req.AllowUnicode)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	if len(ramp) == 0 && len(req.Color.ChoroplethColors) > 0 {
+		return nil, len(req.Color.ChoroplethColors), scale, nil
+	}
+	if len(ramp) == 0 {
+		ramp = []rune(defaultChoroplethRamp)
+	}
+	return ramp, len(ramp), scale, nil
+}
+
+func (s *server) requestChoropleth(req generateRequest) (*render.Choropleth, error) {
+	if len(req.Choropleth.Values) == 0 {
+		return nil, nil
+	}
+
+	ramp, levels, scale, err := choroplethSettings(req)
+	if err != nil {
+		return nil, err
+	}
+
+	countries := s.countries.Load()
+	values := make(map[int]float64, len(req.Choropleth.Values))
+	for code, value := range req.Choropleth.Values {
+		idx, ok := countries.Lookup(code)
+		if !ok {
+			return nil, fmt.Errorf("choropleth.values: unknown country code %q (see /api/countries)", code)
+		}
+		values[idx] = value
+	}
+
+	return &render.Choropleth{
+		Regions: countries,
+		Values:  values,
+		Ramp:    ramp,
+		Levels:  levels,
+		Scale:   scale,
+		Legend:  req.Choropleth.Legend,
+	}, nil
+}
+
+type countryInfo struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// reverseGeocode returns the code, name and continent of the country
+// containing lon/lat. All three are empty at sea, and the continent is empty
+// when the dataset has none or uses a name map-ascii does not know.
+func (s *server) reverseGeocode(lon float64, lat float64) (string, string, string) {
+	countries := s.countries.Load()
+	idx := countries.Locate(lon, lat)
+	if idx < 0 {
+		return "", "", ""
+	}
+
+	country := countries.Country(idx)
+	continent := ""
+	if parsed, err := mapascii.ParseContinent(country.Continent); err == nil {
+		continent = string(parsed)
+	}
+	return country.Code, country.Name, continent
+}
+
+type countriesResponse struct {
+	Countries []countryInfo `json:"countries"`
+}
+
+func (s *server) handleCountries(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, countriesResponse{Countries: s.countryList()})
+}
+
+func (s *server) countryList() []countryInfo {
+	countries := s.countries.Load()
+	list := make([]countryInfo, 0, countries.Len())
+	for _, code := range countries.Codes() {
+		idx, _ := countries.Lookup(code)
+		list = append(list, countryInfo{Code: code, Name: countries.Country(idx).Name})
+	}
+	return list
+}
+
+type locateResponse struct {
+	Lon         float64 `json:"lon"`
+	Lat         float64 `json:"lat"`
+	Country     string  `json:"country,omitempty"`
+	CountryName string  `json:"country_name,omitempty"`
+	Continent   string  `json:"continent,omitempty"`
+}
+
+// handleLocate reverse geocodes a single coordinate. Points at sea get a
+// response without country fields rather than an error.
+func (s *server) handleLocate(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	lon, err := strconv.ParseFloat(query.Get("lon"), 64)
+	if err != nil || !isFinite(lon) || lon < -180.0 || lon > 180.0 {
+		writeJSONError(w, http.StatusBadRequest, "lon must be between -180 and 180")
+		return
+	}
+	lat, err := strconv.ParseFloat(query.Get("lat"), 64)
+	if err != nil || !isFinite(lat) || lat < -90.0 || lat > 90.0 {
+		writeJSONError(w, http.StatusBadRequest, "lat must be between -90 and 90")
+		return
+	}
+
+	resp := locateResponse{Lon: lon, Lat: lat}
+	resp.Country, resp.CountryName, resp.Continent = s.reverseGeocode(lon, lat)
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"map-ascii-generator/api/internal/geo"
+	"map-ascii-generator/api/internal/render"
+)
+
+func requestDensity(req generateRequest) (*render.Density, error) {
+	if len(req.Points) == 0 {
+		return nil, nil
+	}
+
+	if err := checkFeatureCoordinates(geo.Feature{Points: req.Points}); err != nil {
+		return nil, fmt.Errorf("points: %w", err)
+	}
+	if req.Density.Threshold < 1 {
+		return nil, fmt.Errorf("density.threshold must be at least 1")
+	}
+	ramp, err := parseRamp(req.Density.Ramp, "density.ramp", 1, req.AllowUnicode)
+	if err != nil {
+		return nil, err
+	}
+	scale, err := render.ParseScale(req.Density.Scale)
+	if err != nil {
+		return nil, fmt.Errorf("density.%w", err)
+	}
+
+	return &render.Density{
+		Points:    req.Points,
+		Ramp:      ramp,
+		Threshold: req.Density.Threshold,
+		Scale:     scale,
+		Legend:    req.Density.Legend,
+	}, nil
+}
+
+var (
+	csvLonColumns = []string{"lon", "lng", "long", "longitude", "x"}
+	csvLatColumns = []string{"lat", "latitude", "y"}
+)
+
+// parsePointsCSV reads lon/lat pairs from CSV. With a header row the
+// columns are found by name (lon/lng/longitude, lat/latitude); without one
+// the first two columns are lon and lat.
+func parsePointsCSV(data []byte) ([]geo.Point, error) {
+	reader := csv.NewReader(strings.NewReader(string(data)))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	lonCol, latCol := 0, 1
+	var points []geo.Point
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("points CSV: %w", err)
+		}
+
+		if first && !isNumber(record[0]) {
+			lonCol, latCol = csvColumn(record, csvLonColumns), csvColumn(record, csvLatColumns)
+			if lonCol < 0 || latCol < 0 {
+				return nil, fmt.Errorf("points CSV header must name a lon and a lat column")
+			}
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(record) <= max(lonCol, latCol) {
+			return nil, fmt.Errorf("points CSV line %d: expected lon and lat columns", line)
+		}
+		lon, errLon := strconv.ParseFloat(strings.TrimSpace(record[lonCol]), 64)
+		lat, errLat := strconv.ParseFloat(strings.TrimSpace(record[latCol]), 64)
+		if errLon != nil || errLat != nil {
+			return nil, fmt.Errorf("points CSV line %d: lon and lat must be numbers", line)
+		}
+		points = append(points, geo.Point{lon, lat})
+	}
+
+	if len(points) == 0 {
+		return nil, fmt.Errorf("points CSV has no rows")
+	}
+	return points, nil
+}
+
+func csvColumn(header []string, names []string) int {
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		for _, name := range names {
+			if column == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isNumber(value string) bool {
+	_, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	return err == nil
+}
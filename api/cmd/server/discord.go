@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"map-ascii-generator/api/internal/render"
+)
+
+const formatDiscord = "discord"
+
+var outputFormats = []string{formatDiscord, formatMini, formatGrid}
+
+// Discord interaction and response types.
+const (
+	discordPing               = 1
+	discordApplicationCommand = 2
+
+	discordPong           = 1
+	discordChannelMessage = 4
+
+	discordEphemeral = 1 << 6
+)
+
+const maxDiscordInteractionBytes = 64 << 10
+
+type discordInteraction struct {
+	Type int `json:"type"`
+	Data struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string          `json:"name"`
+			Value json.RawMessage `json:"value"`
+		} `json:"options"`
+	} `json:"data"`
+	Member *struct {
+		User discordUser `json:"user"`
+	} `json:"member"`
+	User *discordUser `json:"user"`
+}
+
+type discordUser struct {
+	ID string `json:"id"`
+}
+
+type discordResponse struct {
+	Type int                  `json:"type"`
+	Data *discordResponseData `json:"data,omitempty"`
+}
+
+type discordResponseData struct {
+	Content string `json:"content"`
+	Flags   int    `json:"flags,omitempty"`
+}
+
+// discordMessage wraps a rendered map in a code block, an ansi one for
+// colors. Backticks would end the block early, so they become quotes.
+func discordMessage(resp generateResponse, color bool) string {
+	if color {
+		return "```ansi\n" + strings.ReplaceAll(resp.ANSI, "`", "'") + "\n```"
+	}
+	return "```\n" + strings.ReplaceAll(resp.Plain, "`", "'") + "\n```"
+}
+
+func validateFormat(req generateRequest) error {
+	switch req.Format {
+	case "", formatGrid:
+	case formatDiscord:
+		// Discord's ansi code blocks only know the basic colors, and
+		// wide characters break the alignment.
+		mode := strings.ToLower(strings.TrimSpace(req.Color.Mode))
+		if mode != string(render.ColorModeNever) && mode != string(render.ColorModeANSI16) {
+			return fmt.Errorf("format discord needs color.mode never or always")
+		}
+		if req.AllowUnicode {
+			return fmt.Errorf("format discord cannot be combined with allow_unicode")
+		}
+	case formatMini:
+		if len(req.Markers) > 0 {
+			return fmt.Errorf("format mini takes a single marker, set marker instead of markers")
+		}
+	default:
+		return fmt.Errorf("format must be one of: %s", strings.Join(outputFormats, ", "))
+	}
+	return nil
+}
+
+// generateDiscord renders req as a Discord message.
+func (s *server) generateDiscord(r *http.Request, req generateRequest, limits config, overlay *render.Overlay) (generateResponse, error) {
+	if err := validateFormat(req); err != nil {
+		return generateResponse{}, err
+	}
+	req.Format = ""
+	color := req.Color.Mode != string(render.ColorModeNever)
+	return s.generateMessage(r, req, limits, overlay, "Discord", discordMaxContent, func(resp generateResponse) string {
+		return discordMessage(resp, color)
+	})
+}
+
+// generateMessage renders req and sets Message to its chat message,
+// narrowing the map until the message is at most maxLength characters.
+func (s *server) generateMessage(r *http.Request, req generateRequest, limits config, overlay *render.Overlay, service string, maxLength int, message func(generateResponse) string) (generateResponse, error) {
+	for {
+		resp, err := s.generate(r, req, limits, overlay)
+		if err != nil {
+			return generateResponse{}, err
+		}
+
+		resp.Message = message(resp)
+		n := utf8.RuneCountInString(resp.Message)
+		if n <= maxLength {
+			return resp, nil
+		}
+		if req.Width <= limits.minWidth {
+			return generateResponse{}, fmt.Errorf("map does not fit in a %s message: %d characters at width %d, %s allows %d", service, n, req.Width, service, maxLength)
+		}
+
+		// The message grows with about the square of the width.
+		next := int(float64(req.Width) * math.Sqrt(float64(maxLength)/float64(n)))
+		req.Width = max(min(next, req.Width-1), limits.minWidth)
+	}
+}
+
+func discordPublicKey(cfg config) (ed25519.PublicKey, error) {
+	if cfg.discordPublicKey == "" {
+		return nil, nil
+	}
+	key, err := hex.DecodeString(cfg.discordPublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("discord.public_key must be the application's hex-encoded Ed25519 public key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// handleDiscord answers Discord interactions for a slash command, by
+// default /map, with options place, preset, width and color. Discord signs
+// every request with the application's key, which must be configured.
+func (s *server) handleDiscord(w http.ResponseWriter, r *http.Request) {
+	cfg := s.config()
+	publicKey, err := discordPublicKey(cfg)
+	if err != nil || publicKey == nil {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDiscordInteractionBytes))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid interaction")
+		return
+	}
+	signature, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+	timestamp := r.Header.Get("X-Signature-Timestamp")
+	if err != nil || timestamp == "" || !ed25519.Verify(publicKey, append([]byte(timestamp), body...), signature) {
+		writeJSONError(w, http.StatusUnauthorized, "invalid request signature")
+		return
+	}
+
+	var interaction discordInteraction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid interaction")
+		return
+	}
+
+	switch interaction.Type {
+	case discordPing:
+		writeJSON(w, http.StatusOK, discordResponse{Type: discordPong})
+	case discordApplicationCommand:
+		writeJSON(w, http.StatusOK, s.discordCommand(r, interaction, cfg))
+	default:
+		writeJSONError(w, http.StatusBadRequest, "unsupported interaction type")
+	}
+}
+
+func (s *server) discordCommand(r *http.Request, interaction discordInteraction, cfg config) discordResponse {
+	reply := func(content string) discordResponse {
+		return discordResponse{Type: discordChannelMessage, Data: &discordResponseData{Content: content, Flags: discordEphemeral}}
+	}
+
+	user := ""
+	if interaction.Member != nil {
+		user = interaction.Member.User.ID
+	} else if interaction.User != nil {
+		user = interaction.User.ID
+	}
+	if !s.limiter.Allow("discord:"+user, time.Now()) {
+		return reply("Rate limit exceeded, try again later.")
+	}
+
+	fields := map[string]any{}
+	color := false
+	for _, option := range interaction.Data.Options {
+		var err error
+		switch option.Name {
+		case "place":
+			var place string
+			if err = json.Unmarshal(option.Value, &place); err == nil {
+				fields["marker"] = map[string]any{"enabled": true, "place": place}
+			}
+		case "preset":
+			var preset string
+			if err = json.Unmarshal(option.Value, &preset); err == nil {
+				fields["preset"] = preset
+			}
+		case "width":
+			var width int
+			if err = json.Unmarshal(option.Value, &width); err == nil {
+				fields["width"] = width
+			}
+		case "color":
+			err = json.Unmarshal(option.Value, &color)
+		default:
+			err = fmt.Errorf("unknown option")
+		}
+		if err != nil {
+			return reply(fmt.Sprintf("Invalid option %q.", option.Name))
+		}
+	}
+
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return reply("Invalid options.")
+	}
+	req, err := parseGenerateRequest(body, cfg, s.presetSet())
+	if err != nil {
+		return reply("Error: " + err.Error())
+	}
+	req.Format = formatDiscord
+	req.AllowUnicode = false
+	req.Color.Mode = string(render.ColorModeNever)
+	if color {
+		req.Color.Mode = string(render.ColorModeANSI16)
+	}
+
+	resp, err := s.generate(r, req, cfg, nil)
+	if err != nil {
+		return reply("Error: " + err.Error())
+	}
+	return discordResponse{Type: discordChannelMessage, Data: &discordResponseData{Content: resp.Message}}
+}
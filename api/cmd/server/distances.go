@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"map-ascii-generator/api/internal/geo"
+	"map-ascii-generator/api/internal/render"
+)
+
+const (
+	kmPerNM   = 1.852
+	kmPerMile = 1.609344
+	// maxAnnotatedMarkers keeps annotated maps readable: every pair gets a
+	// path and a label.
+	maxAnnotatedMarkers = 6
+	defaultDistanceChar = '-'
+	defaultDistanceUnit = "km"
+)
+
+var distanceUnits = []string{"km", "mi", "nm"}
+
+// distance is a great-circle distance in kilometers, statute miles and
+// nautical miles, rounded to 0.1.
+type distance struct {
+	DistanceKM float64 `json:"distance_km"`
+	DistanceMI float64 `json:"distance_mi"`
+	DistanceNM float64 `json:"distance_nm"`
+}
+
+func newDistance(km float64) distance {
+	return distance{
+		DistanceKM: roundTenth(km),
+		DistanceMI: roundTenth(km / kmPerMile),
+		DistanceNM: roundTenth(km / kmPerNM),
+	}
+}
+
+func (d distance) in(unit string) float64 {
+	switch unit {
+	case "mi":
+		return d.DistanceMI
+	case "nm":
+		return d.DistanceNM
+	default:
+		return d.DistanceKM
+	}
+}
+
+// distanceMeta relates two entries of meta.markers by index. The bearing is
+// the initial compass direction from the first towards the second.
+type distanceMeta struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+	distance
+	Bearing float64 `json:"bearing"`
+}
+
+// distanceLayer is the optional annotation: a path per marker pair with a
+// label marker at its midpoint.
+type distanceLayer struct {
+	tracks []render.Track
+	labels []render.Marker
+	meta   []distanceMeta
+}
+
+// distanceSettings validates the distances options and returns the path
+// character.
+func distanceSettings(req generateRequest, markerCount int) (rune, error) {
+	if !slices.Contains(distanceUnits, req.Distances.Unit) {
+		return 0, fmt.Errorf("distances.unit must be one of: %s", strings.Join(distanceUnits, ", "))
+	}
+	if req.Distances.Annotate && markerCount > maxAnnotatedMarkers {
+		return 0, fmt.Errorf("distances.annotate supports at most %d markers", maxAnnotatedMarkers)
+	}
+	return parseRune(req.Distances.Char, defaultDistanceChar, "distances.char", req.AllowUnicode)
+}
+
+// requestDistances measures every pair of requested markers, in request
+// order, when there are at least two.
+func requestDistances(req generateRequest, markers []render.Marker) (*distanceLayer, error) {
+	ch, err := distanceSettings(req, len(markers))
+	if err != nil {
+		return nil, err
+	}
+	if len(markers) < 2 {
+		return nil, nil
+	}
+
+	layer := &distanceLayer{}
+	for i := range markers {
+		for j := i + 1; j < len(markers); j++ {
+			a, b := geo.Point{markers[i].Lon, markers[i].Lat}, geo.Point{markers[j].Lon, markers[j].Lat}
+			d := newDistance(geo.Distance(a, b))
+			layer.meta = append(layer.meta, distanceMeta{
+				From:     i,
+				To:       j,
+				distance: d,
+				Bearing:  roundTenth(geo.InitialBearing(a, b)),
+			})
+			if !req.Distances.Annotate {
+				continue
+			}
+
+			mid := geo.Midpoint(a, b)
+			layer.tracks = append(layer.tracks, render.Track{Points: geo.GreatCircle(a, b, routeStep), Char: ch})
+			layer.labels = append(layer.labels, render.Marker{
+				Lon:    mid.Lon(),
+				Lat:    mid.Lat(),
+				Style:  render.MarkerDot,
+				Center: ch,
+				Label:  fmt.Sprintf("%.0f %s", d.in(req.Distances.Unit), req.Distances.Unit),
+			})
+		}
+	}
+	return layer, nil
+}
+
+func roundTenth(v float64) float64 {
+	return math.Round(v*10) / 10
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"map-ascii-generator/api/internal/render"
+)
+
+const (
+	defaultEarthquakesFeedURL  = "https://earthquake.usgs.gov/earthquakes/feed/v1.0/summary"
+	defaultEarthquakesCacheTTL = time.Minute
+	defaultEarthquakesPeriod   = "day"
+	defaultEarthquakesMinMag   = 2.5
+	// maxEarthquakesFeedBytes fits the largest summary feed, all_month,
+	// with room to grow.
+	maxEarthquakesFeedBytes = 32 << 20
+)
+
+var earthquakePeriods = []string{"hour", "day", "week", "month"}
+
+var errEarthquakesUnavailable = fmt.Errorf("earthquake feed %w", errUnavailable)
+
+type earthquake struct {
+	Magnitude float64   `json:"magnitude"`
+	Place     string    `json:"place,omitempty"`
+	Time      time.Time `json:"time"`
+	Lon       float64   `json:"lon"`
+	Lat       float64   `json:"lat"`
+}
+
+type earthquakeFeed struct {
+	updated time.Time
+	quakes  []earthquake
+}
+
+// earthquakesMeta summarizes the plotted earthquakes. Updated is when USGS
+// generated the feed, which is older than the request when the cached copy
+// is used.
+type earthquakesMeta struct {
+	Feed    string      `json:"feed"`
+	Updated time.Time   `json:"updated"`
+	Count   int         `json:"count"`
+	Largest *earthquake `json:"largest,omitempty"`
+}
+
+// earthquakeSettings validates the earthquakes options and returns the
+// magnitude characters, nil for digits.
+func earthquakeSettings(req generateRequest) ([]rune, error) {
+	if !req.Earthquakes.Enabled {
+		return nil, nil
+	}
+	if !slices.Contains(earthquakePeriods, req.Earthquakes.Period) {
+		return nil, fmt.Errorf("earthquakes.period must be one of: %s", strings.Join(earthquakePeriods, ", "))
+	}
+	if !isFinite(req.Earthquakes.MinMagnitude) || req.Earthquakes.MinMagnitude < -1 || req.Earthquakes.MinMagnitude > 10 {
+		return nil, fmt.Errorf("earthquakes.min_magnitude must be between -1 and 10")
+	}
+	return parseRamp(req.Earthquakes.Chars, "earthquakes.chars", 1, req.AllowUnicode)
+}
+
+// requestEarthquakes returns the earthquakes of earthquakes.period with at
+// least earthquakes.min_magnitude as symbols, strongest last so they win
+// shared cells.
+func (s *server) requestEarthquakes(req generateRequest) ([]render.Symbol, *earthquakesMeta, error) {
+	if !req.Earthquakes.Enabled {
+		return nil, nil, nil
+	}
+	chars, err := earthquakeSettings(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	url := earthquakeFeedURL(s.config().earthquakesFeedURL, req.Earthquakes.Period, req.Earthquakes.MinMagnitude)
+	feed, err := s.earthquakeFeed(url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var quakes []earthquake
+	for _, quake := range feed.quakes {
+		if quake.Magnitude >= req.Earthquakes.MinMagnitude {
+			quakes = append(quakes, quake)
+		}
+	}
+	slices.SortStableFunc(quakes, func(a, b earthquake) int {
+		return cmp.Compare(a.Magnitude, b.Magnitude)
+	})
+
+	meta := &earthquakesMeta{Feed: url, Updated: feed.updated, Count: len(quakes)}
+	symbols := make([]render.Symbol, 0, len(quakes))
+	for _, quake := range quakes {
+		symbols = append(symbols, render.Symbol{Lon: quake.Lon, Lat: quake.Lat, Ch: magnitudeChar(chars, req.Earthquakes.MinMagnitude, quake.Magnitude)})
+	}
+	if len(quakes) > 0 {
+		meta.Largest = &quakes[len(quakes)-1]
+	}
+	return symbols, meta, nil
+}
+
+// magnitudeChar draws the whole magnitude as a digit by default. A custom
+// ramp starts at the whole magnitude of minMagnitude and moves one
+// character per magnitude, the last one covering everything above.
+func magnitudeChar(chars []rune, minMagnitude float64, magnitude float64) rune {
+	if chars == nil {
+		return rune('0' + max(0, min(int(math.Floor(magnitude)), 9)))
+	}
+	i := int(math.Floor(magnitude) - math.Floor(minMagnitude))
+	return chars[max(0, min(i, len(chars)-1))]
+}
+
+// earthquakeFeedURL picks the smallest USGS summary feed that still holds
+// every earthquake of at least minMagnitude.
+func earthquakeFeedURL(base string, period string, minMagnitude float64) string {
+	level := "all"
+	switch {
+	case minMagnitude >= 4.5:
+		level = "4.5"
+	case minMagnitude >= 2.5:
+		level = "2.5"
+	case minMagnitude >= 1:
+		level = "1.0"
+	}
+	return strings.TrimSuffix(base, "/") + "/" + level + "_" + period + ".geojson"
+}
+
+// earthquakeFeed returns the cached feed, refreshed every
+// earthquakes.cache_ttl. While USGS is unreachable the last copy is used.
+func (s *server) earthquakeFeed(url string) (earthquakeFeed, error) {
+	feed, fetchedAt, err := s.earthquakes.get(url, s.config().earthquakesCacheTTL, func() (earthquakeFeed, error) {
+		body, err := fetchURL(context.Background(), url, maxEarthquakesFeedBytes)
+		if err != nil {
+			return earthquakeFeed{}, err
+		}
+		return parseEarthquakeFeed(body)
+	})
+	if fetchedAt.IsZero() {
+		// The cause names upstream hosts and addresses; callers only get
+		// the sentinel.
+		log.Printf("earthquakes: fetching %s failed: %v", url, err)
+		return earthquakeFeed{}, errEarthquakesUnavailable
+	}
+	if err != nil {
+		log.Printf("earthquakes: refreshing %s failed, using the copy fetched at %s: %v", url, fetchedAt.Format(time.RFC3339), err)
+	}
+	return feed, nil
+}
+
+// parseEarthquakeFeed reads a USGS GeoJSON summary feed. Events without a
+// magnitude are skipped.
+func parseEarthquakeFeed(body []byte) (earthquakeFeed, error) {
+	var payload struct {
+		Metadata struct {
+			Generated int64 `json:"generated"`
+		} `json:"metadata"`
+		Features []struct {
+			Properties struct {
+				Mag   *float64 `json:"mag"`
+				Place string   `json:"place"`
+				Time  int64    `json:"time"`
+			} `json:"properties"`
+			Geometry struct {
+				Coordinates []float64 `json:"coordinates"`
+			} `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return earthquakeFeed{}, fmt.Errorf("invalid earthquake feed: %w", err)
+	}
+
+	feed := earthquakeFeed{updated: time.UnixMilli(payload.Metadata.Generated).UTC()}
+	for _, f := range payload.Features {
+		coords := f.Geometry.Coordinates
+		if f.Properties.Mag == nil || len(coords) < 2 || !validLonLat(coords[0], coords[1]) {
+			continue
+		}
+		feed.quakes = append(feed.quakes, earthquake{
+			Magnitude: *f.Properties.Mag,
+			Place:     f.Properties.Place,
+			Time:      time.UnixMilli(f.Properties.Time).UTC(),
+			Lon:       coords[0],
+			Lat:       coords[1],
+		})
+	}
+	return feed, nil
+}
+
+func validLonLat(lon float64, lat float64) bool {
+	return isFinite(lon) && isFinite(lat) && lon >= -180 && lon <= 180 && lat >= -90 && lat <= 90
+}
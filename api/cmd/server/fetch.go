@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	fetchTimeout = 5 * time.Second
+	// fetchRetryAfter spaces out attempts while an upstream keeps failing,
+	// so a dead feed does not add its timeout to every request.
+	fetchRetryAfter = 30 * time.Second
+)
+
+var fetchClient = &http.Client{Timeout: fetchTimeout}
+
+// errUnavailable is wrapped by errors that come from an upstream feed a
+// layer depends on rather than from the request; they are answered with 503.
+var errUnavailable = errors.New("unavailable")
+
+// fetchURL GETs url and returns the body of a 200 response of at most
+// maxBytes.
+func fetchURL(ctx context.Context, url string, maxBytes int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "map-ascii-generator")
+
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %w", url, err)
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, fmt.Errorf("GET %s: response larger than %d bytes", url, maxBytes)
+	}
+	return body, nil
+}
+
+// cached holds the last value fetched from an upstream feed. Concurrent
+// callers wait for a single refresh instead of each fetching.
+type cached[T any] struct {
+	mu        sync.Mutex
+	key       string
+	value     T
+	fetched   time.Time
+	ok        bool
+	lastError error
+	failedAt  time.Time
+}
+
+// get returns the value if it was fetched from key less than ttl ago and
+// refreshes it otherwise. When the refresh fails, the error is returned
+// together with the last good value and its fetch time, if there is one,
+// so the caller can decide whether a stale value is still usable.
+func (c *cached[T]) get(key string, ttl time.Duration, fetch func() (T, error)) (T, time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.key != key {
+		var zero T
+		c.key, c.value, c.ok, c.lastError = key, zero, false, nil
+	}
+	if c.ok && now.Sub(c.fetched) < ttl {
+		return c.value, c.fetched, nil
+	}
+	if c.lastError != nil && now.Sub(c.failedAt) < fetchRetryAfter {
+		return c.value, c.fetched, c.lastError
+	}
+
+	value, err := fetch()
+	if err != nil {
+		c.lastError, c.failedAt = err, now
+		return c.value, c.fetched, err
+	}
+	c.value, c.fetched, c.ok, c.lastError = value, now, true, nil
+	return value, now, nil
+}
+
+// cachedSet keeps a cached value per key, e.g. one per feed URL.
+type cachedSet[T any] struct {
+	mu      sync.Mutex
+	entries map[string]*cached[T]
+}
+
+func (c *cachedSet[T]) get(key string, ttl time.Duration, fetch func() (T, error)) (T, time.Time, error) {
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]*cached[T])
+	}
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &cached[T]{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	return entry.get(key, ttl, fetch)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+
+	"map-ascii-generator/api/internal/geo"
+	"map-ascii-generator/api/internal/render"
+)
+
+const (
+	maxRoutes                = 16
+	defaultRouteChar         = '='
+	defaultRouteEndpointChar = 'o'
+	// routeStep is the spacing of great-circle samples in degrees of arc,
+	// fine enough that traced segments look curved at the widest output.
+	routeStep = 1.0
+)
+
+type routeSpec struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type routeMeta struct {
+	From airportMeta `json:"from"`
+	To   airportMeta `json:"to"`
+	distance
+}
+
+// airportMeta is a route endpoint with where its marker was drawn, like
+// meta.markers.
+type airportMeta struct {
+	IATA    string  `json:"iata"`
+	Name    string  `json:"name"`
+	City    string  `json:"city,omitempty"`
+	Country string  `json:"country,omitempty"`
+	Lon     float64 `json:"lon"`
+	Lat     float64 `json:"lat"`
+	Row     int     `json:"row"`
+	Col     int     `json:"col"`
+	Visible bool    `json:"visible"`
+}
+
+// routeLayer holds the paths and one endpoint marker per distinct airport.
+// endpoints[i] gives the marker indexes of route i's ends.
+type routeLayer struct {
+	tracks    []render.Track
+	markers   []render.Marker
+	endpoints [][2]int
+	meta      []routeMeta
+}
+
+// loadAirports reads the configured airport list, falling back to the
+// embedded one.
+func loadAirports(path string) (*geo.Airports, error) {
+	if path == "" {
+		return geo.EmbeddedAirports()
+	}
+	return geo.LoadAirportsFile(path)
+}
+
+// routeSettings validates the route options that do not need the airport
+// dataset and returns the path and endpoint characters.
+func routeSettings(req generateRequest) (rune, rune, string, error) {
+	if len(req.Routes) > maxRoutes {
+		return 0, 0, "", fmt.Errorf("routes must have at most %d entries", maxRoutes)
+	}
+	for i, route := range req.Routes {
+		if len(route.From) != 3 || len(route.To) != 3 {
+			return 0, 0, "", fmt.Errorf("routes[%d]: from and to must be 3-letter IATA codes", i)
+		}
+		if route.From == route.To {
+			return 0, 0, "", fmt.Errorf("routes[%d]: from and to must differ", i)
+		}
+	}
+
+	ch, err := parseRune(req.Route.Char, defaultRouteChar, "route.char", req.AllowUnicode)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	endpoint, endpointGlyph, err := parseGlyph(req.Route.EndpointChar, defaultRouteEndpointChar, "route.endpoint_char", req.AllowUnicode)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	return ch, endpoint, endpointGlyph, nil
+}
+
+// requestRoutes looks up the airports of every route and samples the
+// great circle between them.
+func (s *server) requestRoutes(req generateRequest) (*routeLayer, error) {
+	if len(req.Routes) == 0 {
+		return nil, nil
+	}
+
+	ch, endpoint, endpointGlyph, err := routeSettings(req)
+	if err != nil {
+		return nil, err
+	}
+
+	airports := s.airports.Load()
+	layer := &routeLayer{}
+	markerIndex := make(map[string]int)
+	resolve := func(name string, code string) (airportMeta, int, error) {
+		airport, ok := airports.Lookup(code)
+		if !ok {
+			return airportMeta{}, 0, fmt.Errorf("%s: unknown airport code %q", name, code)
+		}
+		meta := airportMeta{
+			IATA:    airport.IATA,
+			Name:    airport.Name,
+			City:    airport.City,
+			Country: airport.Country,
+			Lon:     airport.Lon,
+			Lat:     airport.Lat,
+		}
+		idx, ok := markerIndex[airport.IATA]
+		if !ok {
+			idx = len(layer.markers)
+			markerIndex[airport.IATA] = idx
+			marker := render.Marker{Lon: airport.Lon, Lat: airport.Lat, Style: render.MarkerDot, Center: endpoint, CenterGlyph: endpointGlyph}
+			if req.Route.Labels {
+				marker.Label = airport.IATA
+			}
+			layer.markers = append(layer.markers, marker)
+		}
+		return meta, idx, nil
+	}
+
+	for i, route := range req.Routes {
+		from, fromIdx, err := resolve(fmt.Sprintf("routes[%d].from", i), route.From)
+		if err != nil {
+			return nil, err
+		}
+		to, toIdx, err := resolve(fmt.Sprintf("routes[%d].to", i), route.To)
+		if err != nil {
+			return nil, err
+		}
+
+		a, b := geo.Point{from.Lon, from.Lat}, geo.Point{to.Lon, to.Lat}
+		layer.tracks = append(layer.tracks, render.Track{Points: geo.GreatCircle(a, b, routeStep), Char: ch})
+		layer.endpoints = append(layer.endpoints, [2]int{fromIdx, toIdx})
+		layer.meta = append(layer.meta, routeMeta{
+			From:     from,
+			To:       to,
+			distance: newDistance(geo.Distance(a, b)),
+		})
+	}
+	return layer, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import "map-ascii-generator/api/internal/render"
+
+// cellChange is an output cell that differs from the previous frame. Color
+// holds the cell's SGR parameters, empty for the terminal default.
+type cellChange struct {
+	Row   int    `json:"row"`
+	Col   int    `json:"col"`
+	Char  string `json:"char"`
+	Color string `json:"color"`
+}
+
+type frameDiff struct {
+	Changes []cellChange `json:"changes"`
+}
+
+// diffFrames lists the cells of next that differ from prev. It reports
+// false when the frames differ in shape, e.g. after a legend row appeared,
+// and next has to be sent whole.
+func diffFrames(prev, next [][]render.StyledCell) (frameDiff, bool) {
+	if len(prev) != len(next) {
+		return frameDiff{}, false
+	}
+	for i := range next {
+		if len(prev[i]) != len(next[i]) {
+			return frameDiff{}, false
+		}
+	}
+
+	diff := frameDiff{Changes: []cellChange{}}
+	for row := range next {
+		for col, cell := range next[row] {
+			if cell != prev[row][col] {
+				diff.Changes = append(diff.Changes, cellChange{Row: row, Col: col, Char: cell.Text, Color: cell.SGR})
+			}
+		}
+	}
+	return diff, true
+}
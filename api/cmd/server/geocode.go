@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"map-ascii-generator/api/internal/geo"
+)
+
+const (
+	defaultGeocodeLimit = 5
+	maxGeocodeLimit     = 20
+	maxPlaceLength      = 100
+)
+
+// loadCities reads the configured gazetteer, falling back to the small
+// embedded city list.
+func loadCities(path string) (*geo.Gazetteer, error) {
+	if path == "" {
+		return geo.EmbeddedGazetteer()
+	}
+	return geo.LoadGazetteerFile(path)
+}
+
+type geocodeResult struct {
+	Name       string  `json:"name"`
+	Country    string  `json:"country"`
+	Lon        float64 `json:"lon"`
+	Lat        float64 `json:"lat"`
+	Population int64   `json:"population"`
+}
+
+type geocodeResponse struct {
+	Query   string          `json:"query"`
+	Results []geocodeResult `json:"results"`
+}
+
+func (s *server) handleGeocode(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeJSONError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	if len(query) > maxPlaceLength {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("q must be at most %d bytes", maxPlaceLength))
+		return
+	}
+
+	limit := defaultGeocodeLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 1 || value > maxGeocodeLimit {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxGeocodeLimit))
+			return
+		}
+		limit = value
+	}
+
+	writeJSON(w, http.StatusOK, s.geocode(query, limit))
+}
+
+func (s *server) geocode(query string, limit int) geocodeResponse {
+	resp := geocodeResponse{Query: query, Results: []geocodeResult{}}
+	for _, city := range s.cities.Load().Search(query, limit) {
+		resp.Results = append(resp.Results, geocodeResult{
+			Name:       city.Name,
+			Country:    city.Country,
+			Lon:        city.Lon,
+			Lat:        city.Lat,
+			Population: city.Population,
+		})
+	}
+	return resp
+}
+
+// resolvePlaces replaces marker.place and markers[].place with the
+// coordinates of the most populous matching city. Unknown places are
+// rejected rather than leaving the marker at 0,0.
+func (s *server) resolvePlaces(req generateRequest) (generateRequest, error) {
+	resolve := func(name string, place string) (float64, float64, error) {
+		if len(place) > maxPlaceLength {
+			return 0, 0, fmt.Errorf("%s.place must be at most %d bytes", name, maxPlaceLength)
+		}
+		cities := s.cities.Load().Search(place, 1)
+		if len(cities) == 0 {
+			return 0, 0, fmt.Errorf("%s.place: no city matches %q (see /api/geocode)", name, place)
+		}
+		return cities[0].Lon, cities[0].Lat, nil
+	}
+
+	if place := strings.TrimSpace(req.Marker.Place); place != "" {
+		lon, lat, err := resolve("marker", place)
+		if err != nil {
+			return req, err
+		}
+		req.Marker.Lon, req.Marker.Lat = lon, lat
+	}
+
+	// Oversized lists are left for validateRequest to reject.
+	if len(req.Markers) <= maxMarkers && slices.ContainsFunc(req.Markers, func(m markerPoint) bool { return strings.TrimSpace(m.Place) != "" }) {
+		req.Markers = slices.Clone(req.Markers)
+		for i := range req.Markers {
+			place := strings.TrimSpace(req.Markers[i].Place)
+			if place == "" {
+				continue
+			}
+			lon, lat, err := resolve(fmt.Sprintf("markers[%d]", i), place)
+			if err != nil {
+				return req, err
+			}
+			req.Markers[i].Lon, req.Markers[i].Lat = lon, lat
+		}
+	}
+
+	return req, nil
+}
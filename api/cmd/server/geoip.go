@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"map-ascii-generator/api/internal/mmdb"
+)
+
+var errGeoIPDisabled = errors.New("IP geolocation is not configured (set data.geoip_file)")
+
+// loadGeoIP opens the configured MaxMind DB city database. Without one, IP
+// based features answer with errGeoIPDisabled.
+func loadGeoIP(path string) (*mmdb.Reader, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return mmdb.Open(path)
+}
+
+type ipLocation struct {
+	IP      string  `json:"ip"`
+	Lon     float64 `json:"lon"`
+	Lat     float64 `json:"lat"`
+	City    string  `json:"city,omitempty"`
+	Country string  `json:"country,omitempty"`
+}
+
+// locateIP reads the location of ip from a GeoLite2-City style record.
+// Addresses without coordinates (private ranges, country-only entries) are
+// reported as not found.
+func (s *server) locateIP(ip netip.Addr) (ipLocation, error) {
+	db := s.geoip.Load()
+	if db == nil {
+		return ipLocation{}, errGeoIPDisabled
+	}
+
+	record, found, err := db.Lookup(ip)
+	if err != nil {
+		return ipLocation{}, fmt.Errorf("geoip lookup for %s: %w", ip, err)
+	}
+	lat, latOK := recordField(record, "location", "latitude").(float64)
+	lon, lonOK := recordField(record, "location", "longitude").(float64)
+	if !found || !latOK || !lonOK {
+		return ipLocation{}, fmt.Errorf("no location found for %s", ip)
+	}
+
+	loc := ipLocation{IP: ip.Unmap().String(), Lon: lon, Lat: lat}
+	loc.City, _ = recordField(record, "city", "names", "en").(string)
+	loc.Country, _ = recordField(record, "country", "iso_code").(string)
+	return loc, nil
+}
+
+func recordField(record any, path ...string) any {
+	for _, key := range path {
+		m, ok := record.(map[string]any)
+		if !ok {
+			return nil
+		}
+		record = m[key]
+	}
+	return record
+}
+
+// resolveClientIP moves the marker to the caller's location when
+// marker.use_client_ip is set. The address comes from the same headers the
+// rate limiter uses, so it is only meaningful behind a trusted proxy.
+func (s *server) resolveClientIP(r *http.Request, req generateRequest) (generateRequest, error) {
+	if !req.Marker.UseClientIP {
+		return req, nil
+	}
+	if req.Marker.Place != "" {
+		return req, fmt.Errorf("marker.place and marker.use_client_ip cannot be combined")
+	}
+
+	loc, err := s.locateClient(r)
+	if err != nil {
+		return req, fmt.Errorf("marker.use_client_ip: %w", err)
+	}
+
+	req.Marker.Lon, req.Marker.Lat = loc.Lon, loc.Lat
+	return req, nil
+}
+
+func (s *server) locateClient(r *http.Request) (ipLocation, error) {
+	ip, err := netip.ParseAddr(clientIdentifier(r))
+	if err != nil {
+		return ipLocation{}, fmt.Errorf("client address is unknown")
+	}
+	return s.locateIP(ip)
+}
+
+// handleWhereAmI answers "curl https://host/" with a map of the caller's
+// location, like wttr.in does for weather, or with the world map when no
+// GeoIP database is configured. Output is plain text, with ANSI colors for
+// command-line clients; ?color=0 or ?color=1 overrides that and ?width=
+// sets the map width.
+func (s *server) handleWhereAmI(w http.ResponseWriter, r *http.Request) {
+	if !s.admitDuringMaintenance(w, true) {
+		return
+	}
+	limiter, clientKey, limits, ok := s.resolveClient(r)
+	if !ok {
+		http.Error(w, "invalid API key", http.StatusUnauthorized)
+		return
+	}
+	if !limiter.Allow(clientKey, time.Now()) {
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	query := r.URL.Query()
+	req := defaultGenerateRequest(limits)
+	if raw := query.Get("width"); raw != "" {
+		width, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "width must be an integer", http.StatusBadRequest)
+			return
+		}
+		req.Width = width
+	}
+
+	color := isTerminalClient(r.UserAgent())
+	if raw := query.Get("color"); raw != "" {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			http.Error(w, "color must be 0 or 1", http.StatusBadRequest)
+			return
+		}
+		color = value
+	}
+
+	// Without a GeoIP database there is nothing to mark, so the caller
+	// gets the plain world map rather than an error.
+	loc, err := s.locateClient(r)
+	switch {
+	case errors.Is(err, errGeoIPDisabled):
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	default:
+		req.Marker.Enabled = true
+		req.Marker.Lon, req.Marker.Lat = loc.Lon, loc.Lat
+		req.Footer = "You are here: " + locationCaption(loc)
+		req.AllowUnicode = true
+	}
+
+	resp, err := s.generate(r, req, limits, nil)
+	if err != nil {
+		http.Error(w, err.Error(), generateStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	// The map shows where the caller is, so no shared cache may keep it.
+	w.Header().Set("Cache-Control", "private, no-store")
+	if color {
+		_, _ = w.Write([]byte(resp.ANSI))
+	} else {
+		_, _ = w.Write([]byte(resp.Plain))
+	}
+}
+
+// locationCaption names a location as "City, CC", falling back to the
+// country or the address.
+func locationCaption(loc ipLocation) string {
+	switch {
+	case loc.City != "" && loc.Country != "":
+		return loc.City + ", " + loc.Country
+	case loc.Country != "":
+		return loc.Country
+	default:
+		return loc.IP
+	}
+}
+
+func isTerminalClient(userAgent string) bool {
+	userAgent = strings.ToLower(userAgent)
+	for _, prefix := range []string{"curl/", "wget/", "httpie/", "xh/"} {
+		if strings.HasPrefix(userAgent, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"map-ascii-generator/api/internal/geo"
+)
+
+// handleGenerateGPX renders a GPX track. The file comes either as the raw
+// request body (default options) or as the "gpx" part of a multipart form
+// with the usual JSON options in "options".
+func (s *server) handleGenerateGPX(w http.ResponseWriter, r *http.Request) {
+	limits, ok := s.admitGenerate(w, r)
+	if !ok {
+		return
+	}
+
+	body, upload, err := readGPXUpload(w, r, limits)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	req, err := parseGenerateRequest(body, limits, s.presetSet())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.GeoJSON) > 0 {
+		writeJSONError(w, http.StatusBadRequest, "geojson cannot be combined with a GPX upload")
+		return
+	}
+	if len(upload) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "missing GPX file")
+		return
+	}
+
+	track, err := geo.ParseGPX(upload)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := checkFeatureCoordinates(track); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("gpx: %v", err))
+		return
+	}
+
+	if req.Overlay.StartChar == "" {
+		req.Overlay.StartChar = "S"
+	}
+	if req.Overlay.EndChar == "" {
+		req.Overlay.EndChar = "E"
+	}
+	overlay, err := overlayFromFeatures([]geo.Feature{track}, req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.writeGenerate(w, r, req, limits, overlay)
+}
+
+func readGPXUpload(w http.ResponseWriter, r *http.Request, cfg config) ([]byte, []byte, error) {
+	if isMultipart(r) {
+		body, uploads, err := readMultipartGenerate(w, r, cfg, "gpx")
+		return body, uploads["gpx"], err
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.maxGeoJSONBytes)
+	defer r.Body.Close()
+
+	upload, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid GPX payload: %w", err)
+	}
+	return []byte("{}"), upload, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"map-ascii-generator/api/internal/render"
+)
+
+// mapGradientBands is the number of latitude bands the stops are spread
+// over, 2° each.
+const mapGradientBands = 90
+
+type mapGradient struct {
+	name  string
+	stops []string
+}
+
+// mapGradients list their stops evenly from the north to the south pole.
+var mapGradients = []mapGradient{
+	{
+		name:  "climate",
+		stops: []string{"#f4f8fb", "#cfdcd6", "#6a9a5b", "#3d8b3d", "#8fb44a", "#e9c46a", "#f2d16b", "#e9c46a", "#8fb44a", "#3d8b3d", "#6a9a5b", "#cfdcd6", "#f4f8fb"},
+	},
+	{
+		name:  "thermal",
+		stops: []string{"#3b4cc0", "#7396f5", "#b8d0f9", "#f4c6ab", "#e7745b", "#b40426", "#e7745b", "#f4c6ab", "#b8d0f9", "#7396f5", "#3b4cc0"},
+	},
+	{
+		name:  "rainbow",
+		stops: []string{"#ff0000", "#ff8c00", "#ffd700", "#32cd32", "#1e90ff", "#4b0082", "#8b00ff"},
+	},
+}
+
+func mapGradientNames() []string {
+	names := make([]string, 0, len(mapGradients))
+	for _, g := range mapGradients {
+		names = append(names, g.name)
+	}
+	return names
+}
+
+// mapGradientSettings returns the per-band land colors, nil when no
+// gradient is requested.
+func mapGradientSettings(req generateRequest) ([]render.Color, error) {
+	name, stops := req.Color.MapGradient, req.Color.MapGradientStops
+	if name == "" && len(stops) == 0 {
+		return nil, nil
+	}
+	if name != "" && len(stops) > 0 {
+		return nil, fmt.Errorf("color.map_gradient and color.map_gradient_stops cannot be combined")
+	}
+	if render.ColorMode(req.Color.Mode) != render.ColorModeTrueColor {
+		return nil, fmt.Errorf("map gradients require color.mode truecolor")
+	}
+
+	field := "color.map_gradient_stops"
+	if name != "" {
+		found := false
+		for _, g := range mapGradients {
+			if g.name == name {
+				stops, found = g.stops, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("color.map_gradient must be one of: %s", strings.Join(mapGradientNames(), ", "))
+		}
+		field = "color.map_gradient"
+	}
+	if len(stops) < 2 || len(stops) > maxRampLength {
+		return nil, fmt.Errorf("%s must have 2 to %d colors", field, maxRampLength)
+	}
+
+	colors := make([]render.Color, len(stops))
+	for i, stop := range stops {
+		color, err := render.ParseColor(stop)
+		if err != nil || !color.IsHex() {
+			return nil, fmt.Errorf("%s[%d] must be a #rrggbb hex color", field, i)
+		}
+		colors[i] = color
+	}
+	return render.Gradient(colors, mapGradientBands), nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"map-ascii-generator/api/internal/graphql"
+)
+
+// graphQLSchema covers rendering, presets and the discovery endpoints for
+// clients with limits; allow, if set, is asked before every render.
+func (s *server) graphQLSchema(r *http.Request, limits config, allow func() bool) *graphql.Schema {
+	return &graphql.Schema{Query: []graphql.Field{
+		{
+			Name:        "generate",
+			Description: "Renders a map. request takes the options of POST /api/generate; each generate field counts against the rate limit.",
+			Args:        []graphql.Arg{{Name: "request", Type: "JSON"}},
+			Type:        reflect.TypeOf(generateResponse{}),
+			Resolve: func(ctx context.Context, args map[string]any) (any, error) {
+				request, ok := args["request"]
+				if !ok {
+					request = map[string]any{}
+				}
+				if _, isObject := request.(map[string]any); !isObject {
+					return nil, fmt.Errorf("request must be an object")
+				}
+				body, err := json.Marshal(request)
+				if err != nil {
+					return nil, err
+				}
+				req, err := parseGenerateRequest(body, limits, s.presetSet())
+				if err != nil {
+					return nil, err
+				}
+				if err := s.refuseDuringMaintenance(); err != nil {
+					return nil, err
+				}
+				if allow != nil && !allow() {
+					return nil, fmt.Errorf("rate limit exceeded")
+				}
+				return s.generate(r, req, limits, nil)
+			},
+		},
+		{
+			Name: "presets",
+			Type: reflect.TypeOf([]presetInfo{}),
+			Resolve: func(ctx context.Context, args map[string]any) (any, error) {
+				return s.presetList(), nil
+			},
+		},
+		{
+			Name: "preset",
+			Args: []graphql.Arg{{Name: "name", Type: "String!"}},
+			Type: reflect.TypeOf(&presetInfo{}),
+			Resolve: func(ctx context.Context, args map[string]any) (any, error) {
+				name := args["name"].(string)
+				request, ok := s.presetSet()[name]
+				if !ok {
+					return nil, nil
+				}
+				return &presetInfo{Name: name, Request: request}, nil
+			},
+		},
+		{
+			Name: "options",
+			Type: reflect.TypeOf(optionsResponse{}),
+			Resolve: func(ctx context.Context, args map[string]any) (any, error) {
+				return s.options(), nil
+			},
+		},
+		{
+			Name: "limits",
+			Type: reflect.TypeOf(limitsResponse{}),
+			Resolve: func(ctx context.Context, args map[string]any) (any, error) {
+				return limitsFor(limits), nil
+			},
+		},
+		{
+			Name: "colors",
+			Type: reflect.TypeOf(colorsResponse{}),
+			Resolve: func(ctx context.Context, args map[string]any) (any, error) {
+				return s.colors(), nil
+			},
+		},
+		{
+			Name: "themes",
+			Type: reflect.TypeOf(themes),
+			Resolve: func(ctx context.Context, args map[string]any) (any, error) {
+				return themes, nil
+			},
+		},
+		{
+			Name: "countries",
+			Type: reflect.TypeOf([]countryInfo{}),
+			Resolve: func(ctx context.Context, args map[string]any) (any, error) {
+				return s.countryList(), nil
+			},
+		},
+		{
+			Name:        "geocode",
+			Description: "Looks up cities by name, most populous first.",
+			Args:        []graphql.Arg{{Name: "query", Type: "String!"}, {Name: "limit", Type: "Int"}},
+			Type:        reflect.TypeOf([]geocodeResult{}),
+			Resolve: func(ctx context.Context, args map[string]any) (any, error) {
+				query := strings.TrimSpace(args["query"].(string))
+				if query == "" || len(query) > maxPlaceLength {
+					return nil, fmt.Errorf("query must be 1 to %d bytes", maxPlaceLength)
+				}
+				limit := defaultGeocodeLimit
+				if value, ok := args["limit"]; ok {
+					limit = value.(int)
+				}
+				if limit < 1 || limit > maxGeocodeLimit {
+					return nil, fmt.Errorf("limit must be between 1 and %d", maxGeocodeLimit)
+				}
+				return s.geocode(query, limit).Results, nil
+			},
+		},
+	}}
+}
+
+// handleGraphQL answers GraphQL queries over GET and POST. API keys apply,
+// and every generate field counts against the rate limit.
+func (s *server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	limiter, clientKey, limits, ok := s.resolveClient(r)
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "invalid API key")
+		return
+	}
+	allow := func() bool { return limiter.Allow(clientKey, time.Now()) }
+	s.graphQLSchema(r, limits, allow).ServeHTTP(w, r)
+}
+
+// handleGraphQLSchema returns the schema in the GraphQL schema definition
+// language, in place of introspection.
+func (s *server) handleGraphQLSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(s.graphQLSchema(r, s.config(), nil).SDL()))
+}
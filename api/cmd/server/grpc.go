@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"map-ascii-generator/api/internal/grpc"
+)
+
+const grpcService = "/mapascii.v1.MapService/"
+
+// grpcServer serves the MapService of proto/map.proto. Calls go through
+// the same API keys, rate limit and validation as the HTTP API, with the
+// key sent as x-api-key metadata.
+func (s *server) grpcServer() *grpc.Server {
+	return &grpc.Server{Methods: map[string]grpc.Method{
+		grpcService + "Generate":       {Unary: s.grpcGenerate},
+		grpcService + "GenerateStream": {Stream: s.grpcGenerateStream},
+		grpcService + "Geocode":        {Unary: s.grpcGeocode},
+	}}
+}
+
+// admitGRPC is admitGenerate for gRPC calls.
+func (s *server) admitGRPC(r *http.Request) (config, error) {
+	limiter, clientKey, limits, ok := s.resolveClient(r)
+	if !ok {
+		return config{}, grpc.Errorf(grpc.Unauthenticated, "invalid API key")
+	}
+	if !limiter.Allow(clientKey, time.Now()) {
+		return config{}, grpc.Errorf(grpc.ResourceExhausted, "rate limit exceeded")
+	}
+	return limits, nil
+}
+
+func grpcGenerateError(err error) error {
+	if errors.Is(err, errUnavailable) {
+		return grpc.Errorf(grpc.Unavailable, "%s", err.Error())
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return grpc.Errorf(grpc.DeadlineExceeded, "%s", err.Error())
+	}
+	return grpc.Errorf(grpc.InvalidArgument, "%s", err.Error())
+}
+
+// decodeGRPCGenerateRequest builds a generate request from a
+// GenerateRequest message: options_json with the typed fields merged over
+// it.
+func decodeGRPCGenerateRequest(msg []byte, limits config, presets presetSet) (generateRequest, error) {
+	options := "{}"
+	fields := map[string]any{}
+	err := grpc.Decode(msg, func(f grpc.Field) error {
+		switch f.Number {
+		case 1:
+			options = f.String()
+		case 2:
+			fields["width"] = f.Int()
+		case 3:
+			fields["continent"] = f.String()
+		case 4:
+			fields["preset"] = f.String()
+		case 5:
+			fields["color"] = map[string]any{"mode": f.String()}
+		case 6:
+			marker := map[string]any{"enabled": true}
+			fields["marker"] = marker
+			return grpc.Decode(f.Data, func(f grpc.Field) error {
+				switch f.Number {
+				case 1:
+					marker["lon"] = f.Double()
+				case 2:
+					marker["lat"] = f.Double()
+				case 3:
+					marker["place"] = f.String()
+				case 4:
+					marker["label"] = f.String()
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return generateRequest{}, err
+	}
+
+	object, err := decodeJSONObject([]byte(options))
+	if err != nil {
+		return generateRequest{}, errors.New("options_json must be a JSON object")
+	}
+	// Decode options_json on its own too, so that a malformed option is
+	// reported even when a typed field overrides it.
+	var checked generateRequest
+	if err := decodeStrictJSON([]byte(options), &checked); err != nil {
+		return generateRequest{}, fmt.Errorf("options_json: %w", err)
+	}
+	body, err := json.Marshal(mergeJSONObjects(object, fields))
+	if err != nil {
+		return generateRequest{}, err
+	}
+	return parseGenerateRequest(body, limits, presets)
+}
+
+func (s *server) grpcGenerate(r *http.Request, msg []byte) ([]byte, error) {
+	if err := s.refuseDuringMaintenance(); err != nil {
+		return nil, grpcGenerateError(err)
+	}
+	limits, err := s.admitGRPC(r)
+	if err != nil {
+		return nil, err
+	}
+	req, err := decodeGRPCGenerateRequest(msg, limits, s.presetSet())
+	if err != nil {
+		return nil, grpc.Errorf(grpc.InvalidArgument, "%s", err.Error())
+	}
+	resp, err := s.generate(r, req, limits, nil)
+	if err != nil {
+		return nil, grpcGenerateError(err)
+	}
+
+	meta, err := json.Marshal(resp.Meta)
+	if err != nil {
+		return nil, err
+	}
+	var e grpc.Encoder
+	e.String(1, resp.Plain)
+	e.String(2, resp.ANSI)
+	e.Int(3, int64(resp.Meta.Width))
+	e.Int(4, int64(resp.Meta.Height))
+	e.Int(5, resp.Meta.DurationMS)
+	e.String(6, string(meta))
+	return e.Bytes(), nil
+}
+
+func (s *server) grpcGenerateStream(r *http.Request, msg []byte, send func([]byte) error) error {
+	if err := s.refuseDuringMaintenance(); err != nil {
+		return grpcGenerateError(err)
+	}
+	limits, err := s.admitGRPC(r)
+	if err != nil {
+		return err
+	}
+
+	var request []byte
+	query := url.Values{}
+	err = grpc.Decode(msg, func(f grpc.Field) error {
+		switch f.Number {
+		case 1:
+			request = f.Data
+		case 2:
+			query.Set("animation", f.String())
+		case 3:
+			query.Set("fps", strconv.FormatInt(f.Int(), 10))
+		case 4:
+			query.Set("frames", strconv.FormatInt(f.Int(), 10))
+		case 5:
+			query.Set("step", strconv.FormatFloat(f.Double(), 'g', -1, 64))
+		case 6:
+			query.Set("lon", strconv.FormatFloat(f.Double(), 'g', -1, 64))
+		case 7:
+			query.Set("lat", strconv.FormatFloat(f.Double(), 'g', -1, 64))
+		}
+		return nil
+	})
+	if err != nil {
+		return grpc.Errorf(grpc.InvalidArgument, "%s", err.Error())
+	}
+	req, err := decodeGRPCGenerateRequest(request, limits, s.presetSet())
+	if err != nil {
+		return grpc.Errorf(grpc.InvalidArgument, "%s", err.Error())
+	}
+	// Frames carry both renderings, so color follows color_mode.
+	spec, req, err := parseStreamValues(query, true, req)
+	if err != nil {
+		return grpc.Errorf(grpc.InvalidArgument, "%s", err.Error())
+	}
+
+	ticker := time.NewTicker(time.Second / time.Duration(spec.fps))
+	defer ticker.Stop()
+	deadline := time.NewTimer(maxStreamDuration)
+	defer deadline.Stop()
+
+	start := time.Now()
+	for i := 0; ; {
+		resp, err := s.generate(r, spec.frameRequest(req, i, start), limits, nil)
+		if err != nil {
+			return grpcGenerateError(err)
+		}
+		var e grpc.Encoder
+		e.Int(1, int64(i))
+		e.String(2, resp.Plain)
+		e.String(3, resp.ANSI)
+		if err := send(e.Bytes()); err != nil {
+			return err
+		}
+
+		i++
+		if spec.frames > 0 && i >= spec.frames {
+			return nil
+		}
+		select {
+		case <-r.Context().Done():
+			return r.Context().Err()
+		case <-deadline.C:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *server) grpcGeocode(r *http.Request, msg []byte) ([]byte, error) {
+	query, limit := "", int64(defaultGeocodeLimit)
+	err := grpc.Decode(msg, func(f grpc.Field) error {
+		switch f.Number {
+		case 1:
+			query = f.String()
+		case 2:
+			limit = f.Int()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, grpc.Errorf(grpc.InvalidArgument, "%s", err.Error())
+	}
+	query = strings.TrimSpace(query)
+	if query == "" || len(query) > maxPlaceLength {
+		return nil, grpc.Errorf(grpc.InvalidArgument, "query must be 1 to %d bytes", maxPlaceLength)
+	}
+	if limit < 1 || limit > maxGeocodeLimit {
+		return nil, grpc.Errorf(grpc.InvalidArgument, "limit must be between 1 and %d", maxGeocodeLimit)
+	}
+
+	var e grpc.Encoder
+	for _, result := range s.geocode(query, int(limit)).Results {
+		var place grpc.Encoder
+		place.String(1, result.Name)
+		place.String(2, result.Country)
+		place.Double(3, result.Lon)
+		place.Double(4, result.Lat)
+		place.Int(5, result.Population)
+		e.Message(1, place.Bytes())
+	}
+	return e.Bytes(), nil
+}
+
+// serveGRPC serves the gRPC API on addr with cleartext HTTP/2, for
+// internal networks; TLS, if needed, is left to a proxy in front.
+func (s *server) serveGRPC(addr string) {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           s.withUsage(s.grpcServer()),
+		Protocols:         &protocols,
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       defaultIdleTimeout,
+	}
+
+	log.Printf("grpc listening on %s", addr)
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("grpc listener failed: %v", err)
+	}
+}
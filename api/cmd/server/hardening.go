@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"map-ascii-generator/api/internal/trace"
+)
+
+// apiContentSecurityPolicy forbids everything; JSON and text responses
+// need nothing, and it keeps them from being framed or run as a page.
+const apiContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'"
+
+// playgroundContentSecurityPolicy allows the playground's own inline
+// script and style, by hash, and requests back to this server.
+var playgroundContentSecurityPolicy = fmt.Sprintf(
+	"default-src 'none'; script-src %s; style-src %s; connect-src 'self'; img-src 'self' data:; frame-ancestors 'none'; base-uri 'none'; form-action 'none'",
+	inlineHashes(playgroundHTML, "script"),
+	inlineHashes(playgroundHTML, "style"),
+)
+
+// route is an endpoint and the methods it answers. Other methods get 405
+// here, so handlers only see the methods they are registered for.
+type route struct {
+	pattern string
+	methods []string
+	handler http.HandlerFunc
+	// plain routes answer errors in plain text, for terminal clients.
+	plain bool
+}
+
+func (s *server) routes() []route {
+	get := []string{http.MethodGet}
+	post := []string{http.MethodPost}
+
+	return []route{
+		{pattern: "/{$}", methods: get, handler: s.handleRoot, plain: true},
+		{pattern: "/api/livez", methods: get, handler: s.handleLivez},
+		{pattern: "/api/readyz", methods: get, handler: s.handleReadyz},
+		{pattern: "/api/options", methods: get, handler: s.handleOptions},
+		{pattern: "/api/colors", methods: get, handler: s.handleColors},
+		{pattern: "/api/themes", methods: get, handler: s.handleThemes},
+		{pattern: "/api/countries", methods: get, handler: s.handleCountries},
+		{pattern: "/api/geocode", methods: get, handler: s.handleGeocode},
+		{pattern: "/api/locate", methods: get, handler: s.handleLocate},
+		{pattern: "/api/limits", methods: get, handler: s.handleLimits},
+		{pattern: "/api/quota", methods: get, handler: s.handleQuota},
+		{pattern: "/api/stats", methods: get, handler: s.handleStats},
+		{pattern: "/api/generate", methods: post, handler: s.handleGenerate},
+		{pattern: "/api/generate/gpx", methods: post, handler: s.handleGenerateGPX},
+		{pattern: "/api/mini", methods: get, handler: s.handleMini, plain: true},
+		{pattern: "/api/plot-ip", methods: post, handler: s.handlePlotIP},
+		{pattern: "/api/traceroute", methods: post, handler: s.handleTraceroute},
+		{pattern: "/api/stream", methods: get, handler: s.handleStream},
+		{pattern: "/api/ws", methods: get, handler: s.handleWS},
+		{pattern: "/api/share", methods: post, handler: s.handleShare},
+		{pattern: "/r/{token}", methods: get, handler: s.handleSharedRender, plain: true},
+		{pattern: "/api/history", methods: get, handler: s.handleHistory},
+		{pattern: "/api/history/{id}/render", methods: post, handler: s.handleHistoryRender},
+		{pattern: "/api/jobs", methods: post, handler: s.handleJobs},
+		{pattern: "/api/jobs/{id}", methods: get, handler: s.handleJob},
+		{pattern: "/api/presets", methods: get, handler: s.handlePresets},
+		{pattern: "/api/presets/{name}", methods: []string{http.MethodGet, http.MethodPut, http.MethodDelete}, handler: s.handlePreset},
+		{pattern: "/api/mcp", methods: post, handler: s.handleMCP},
+		{pattern: "/api/graphql", methods: []string{http.MethodGet, http.MethodPost}, handler: s.handleGraphQL},
+		{pattern: "/api/graphql/schema", methods: get, handler: s.handleGraphQLSchema},
+		{pattern: "/api/openapi.json", methods: get, handler: s.handleOpenAPI},
+		{pattern: "/integrations/discord", methods: post, handler: s.handleDiscord},
+		{pattern: "/integrations/telegram", methods: post, handler: s.handleTelegram},
+		{pattern: "/admin/masks", methods: get, handler: s.handleAdminMasks},
+		{pattern: "/admin/masks/{name}", methods: []string{http.MethodPut, http.MethodDelete}, handler: s.handleAdminMask},
+		{pattern: "/admin/ratelimit", methods: get, handler: s.handleAdminRateLimit},
+		{pattern: "/admin/usage", methods: get, handler: s.handleAdminUsage},
+		{pattern: "/admin/maintenance", methods: []string{http.MethodGet, http.MethodPut}, handler: s.handleAdminMaintenance},
+		{pattern: "/admin/keys", methods: []string{http.MethodGet, http.MethodPost}, handler: s.handleAdminKeys},
+		{pattern: "/admin/keys/{id}", methods: []string{http.MethodGet, http.MethodPatch, http.MethodDelete}, handler: s.handleAdminKey},
+		{pattern: "/admin/keys/{id}/rotate", methods: post, handler: s.handleAdminKeyRotate},
+		{pattern: "/debug/pprof/", methods: []string{http.MethodGet, http.MethodPost}, handler: s.handlePprof},
+	}
+}
+
+// basePathSegment is what a segment of base_path may hold: characters that
+// need no escaping and cannot be mistaken for a pattern wildcard.
+var basePathSegment = regexp.MustCompile(`^[A-Za-z0-9._~-]+$`)
+
+// normalizeBasePath turns base_path into "" or a prefix such as /map-api,
+// with a leading slash and no trailing one.
+func normalizeBasePath(raw string) (string, error) {
+	path := strings.Trim(strings.TrimSpace(raw), "/")
+	if path == "" {
+		return "", nil
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if !basePathSegment.MatchString(segment) || segment == "." || segment == ".." {
+			return "", fmt.Errorf("base_path must be a URL path such as /map-api, got %q", raw)
+		}
+	}
+	return "/" + path, nil
+}
+
+// newMux serves the routes in sets under base_path. The prefix itself
+// redirects to the playground at the prefix with a slash.
+func (s *server) newMux(sets routeSet) *http.ServeMux {
+	base := s.config().basePath
+	mux := http.NewServeMux()
+	for _, rt := range s.routes() {
+		if sets&routeSetOf(rt.pattern) != 0 {
+			mux.Handle(base+rt.pattern, rt.allowMethods())
+		}
+	}
+	if base != "" && sets&routesAPI != 0 {
+		mux.Handle(base, http.RedirectHandler(base+"/", http.StatusMovedPermanently))
+	}
+	return mux
+}
+
+// link is the path of a route of this server, under base_path, for
+// Location headers and links in responses.
+func (s *server) link(path string) string {
+	return s.config().basePath + path
+}
+
+func (rt route) allowMethods() http.Handler {
+	allow := strings.Join(rt.methods, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(rt.methods, r.Method) {
+			w.Header().Set("Allow", allow)
+			if rt.plain {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		span := trace.FromContext(r.Context())
+		span.SetName(r.Method + " " + rt.pattern)
+		span.SetAttributes(trace.String("http.route", rt.pattern))
+		rt.handler(w, r)
+	})
+}
+
+// withSecurityHeaders sets the headers every response carries. The HTML
+// playground replaces the Content-Security-Policy with its own. No Server
+// header is sent unless security.server_header names one.
+func (s *server) withSecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("Referrer-Policy", "no-referrer")
+		header.Set("Content-Security-Policy", apiContentSecurityPolicy)
+		if r.TLS != nil {
+			header.Set("Strict-Transport-Security", "max-age=31536000")
+		}
+		if name := s.config().serverHeader; name != "" {
+			header.Set("Server", name)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// inlineHashes returns the CSP source expressions for the contents of each
+// inline element called tag in page.
+func inlineHashes(page []byte, tag string) string {
+	pattern := regexp.MustCompile(`(?s)<` + tag + `>(.*?)</` + tag + `>`)
+	var sources []string
+	for _, match := range pattern.FindAllSubmatch(page, -1) {
+		sum := sha256.Sum256(match[1])
+		sources = append(sources, "'sha256-"+base64.StdEncoding.EncodeToString(sum[:])+"'")
+	}
+	if len(sources) == 0 {
+		return "'none'"
+	}
+	return strings.Join(sources, " ")
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"map-ascii-generator/api/internal/render"
+)
+
+const (
+	readyCheckTimeout = 2 * time.Second
+	selfTestWidth     = 20
+	readyCollection   = "readyz"
+)
+
+type readyResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// handleLivez answers as long as the process serves HTTP, for restarting
+// a wedged server. It checks nothing else, so a failing dependency does
+// not get the server restarted.
+func (s *server) handleLivez(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz answers 503 until the server can render: the land mask is
+// loaded, a small self-test render succeeds, and the state directory and
+// object storage, when configured, are reachable. Each check reports "ok"
+// or why it failed.
+func (s *server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := []struct {
+		name string
+		run  func(context.Context) error
+		skip bool
+	}{
+		{name: "mask", run: s.checkMask},
+		{name: "render", run: s.checkRender},
+		{name: "warmup", run: s.checkWarmup},
+		{name: "maintenance", run: s.checkMaintenance, skip: !s.config().maintenanceNotReady},
+		{name: "state", run: s.checkState, skip: s.state == nil},
+		{name: "storage", run: s.checkStorage, skip: s.config().storageAccessKey == ""},
+	}
+
+	resp := readyResponse{Status: "ready", Checks: make(map[string]string, len(checks))}
+	for _, check := range checks {
+		if check.skip {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+		err := check.run(ctx)
+		cancel()
+		if err != nil {
+			resp.Status = "unavailable"
+			resp.Checks[check.name] = err.Error()
+			continue
+		}
+		resp.Checks[check.name] = "ok"
+	}
+
+	status := http.StatusOK
+	if resp.Status != "ready" {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, resp)
+}
+
+func (s *server) checkMask(ctx context.Context) error {
+	mask := s.mask
+	if mask == nil || mask.Width < 2 || mask.Height < 2 || len(mask.Data) != mask.Width*mask.Height {
+		return fmt.Errorf("land mask is not loaded")
+	}
+	return nil
+}
+
+// checkRender draws the world at selfTestWidth columns, outside the render
+// slots so that a busy server still reports ready.
+func (s *server) checkRender(ctx context.Context) error {
+	canvas, err := render.RenderContext(ctx, s.mask, render.Options{
+		Width:       selfTestWidth,
+		Supersample: 1,
+		CharAspect:  miniCharAspect,
+	})
+	if err != nil {
+		return fmt.Errorf("self-test render failed: %w", err)
+	}
+	if strings.TrimSpace(canvas.Plain()) == "" {
+		return fmt.Errorf("self-test render drew no land")
+	}
+	return nil
+}
+
+func (s *server) checkWarmup(ctx context.Context) error {
+	if !s.warmedUp.Load() {
+		return fmt.Errorf("warmup renders are still running")
+	}
+	return nil
+}
+
+// checkState writes, reads back and removes a record in the state
+// directory.
+func (s *server) checkState(ctx context.Context) error {
+	now := time.Now().UTC()
+	if err := s.state.Put(readyCollection, "probe", now); err != nil {
+		return fmt.Errorf("state directory is not writable: %w", err)
+	}
+	var stored time.Time
+	ok, err := s.state.Get(readyCollection, "probe", &stored)
+	if err != nil || !ok || !stored.Equal(now) {
+		return fmt.Errorf("state directory did not return the probe record")
+	}
+	if err := s.state.Delete(readyCollection, "probe"); err != nil {
+		return fmt.Errorf("state directory: %w", err)
+	}
+	return nil
+}
+
+func (s *server) checkStorage(ctx context.Context) error {
+	storage, err := newStorage(s.config())
+	if err != nil {
+		return err
+	}
+	if err := storage.Ping(ctx); err != nil {
+		return fmt.Errorf("object storage is unreachable: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"map-ascii-generator/api/internal/render"
+	"map-ascii-generator/api/internal/storage"
+)
+
+const (
+	historyCollection        = "history"
+	defaultHistoryMaxEntries = 100
+	// historyRequestMax caps a stored request; larger ones, which carry a
+	// GeoJSON upload, are listed but cannot be rendered again.
+	historyRequestMax = 64 << 10
+)
+
+// historyEntry records one render of a client: when and where it was
+// made, a hash of the request, the response's meta and, when it can be
+// rendered again, the request itself. The map is not kept.
+type historyEntry struct {
+	ID       string          `json:"id"`
+	Time     time.Time       `json:"time"`
+	Endpoint string          `json:"endpoint"`
+	Hash     string          `json:"hash"`
+	Format   string          `json:"format,omitempty"`
+	Meta     json.RawMessage `json:"meta"`
+	Request  json.RawMessage `json:"request,omitempty"`
+}
+
+type historyItem struct {
+	historyEntry
+	// Render is where to POST to render the request again.
+	Render string `json:"render,omitempty"`
+}
+
+type historyResponse struct {
+	Renders []historyItem `json:"renders"`
+}
+
+// historyStore keeps the recent renders of each client, newest first, in
+// memory or in the state directory when there is one.
+type historyStore struct {
+	mu      sync.Mutex
+	clients map[string][]historyEntry
+	dir     storage.Store
+}
+
+func newHistoryStore(dir storage.Store) *historyStore {
+	return &historyStore{clients: make(map[string][]historyEntry), dir: dir}
+}
+
+func (h *historyStore) list(client string) ([]historyEntry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.load(client)
+}
+
+// add puts entry first in the history of client, keeping at most
+// maxEntries.
+func (h *historyStore) add(client string, entry historyEntry, maxEntries int) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries, err := h.load(client)
+	if err != nil {
+		return err
+	}
+	entries = slices.Insert(entries, 0, entry)
+	if len(entries) > maxEntries {
+		entries = entries[:maxEntries]
+	}
+	if h.dir != nil {
+		return h.dir.Put(historyCollection, client, entries)
+	}
+	h.clients[client] = entries
+	return nil
+}
+
+func (h *historyStore) load(client string) ([]historyEntry, error) {
+	if h.dir == nil {
+		return h.clients[client], nil
+	}
+	var entries []historyEntry
+	if _, err := h.dir.Get(historyCollection, client, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// historyClient is who r's renders are recorded for: only callers with an
+// API key or a token have a history.
+func historyClient(r *http.Request) (string, bool) {
+	client := requestClient(r)
+	return client, strings.HasPrefix(client, "key:") || strings.HasPrefix(client, "jwt:")
+}
+
+// recordHistory adds a successful render of req to the caller's history
+// when history.enabled is set. Failing to record is logged and does not
+// fail the render.
+func (s *server) recordHistory(r *http.Request, req generateRequest, resp generateResponse, overlay *render.Overlay) {
+	cfg := s.config()
+	client, ok := historyClient(r)
+	if !cfg.historyEnabled || !ok {
+		return
+	}
+
+	request, err := json.Marshal(req)
+	if err != nil {
+		log.Printf("history: %v", err)
+		return
+	}
+	meta, err := json.Marshal(resp.Meta)
+	if err != nil {
+		log.Printf("history: %v", err)
+		return
+	}
+	id, err := newHistoryID()
+	if err != nil {
+		log.Printf("history: %v", err)
+		return
+	}
+	sum := sha256.Sum256(request)
+	entry := historyEntry{
+		ID:       id,
+		Time:     time.Now().UTC(),
+		Endpoint: r.URL.Path,
+		Hash:     hex.EncodeToString(sum[:]),
+		Format:   req.Format,
+		Meta:     meta,
+	}
+	if overlay == nil && len(request) <= historyRequestMax {
+		entry.Request = request
+	}
+	if err := s.history.add(client, entry, max(cfg.historyMaxEntries, 1)); err != nil {
+		log.Printf("history: failed to record render for %s: %v", client, err)
+	}
+}
+
+func newHistoryID() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// historyAccess resolves the caller of a history endpoint and answers the
+// request itself when it has no history to show.
+func (s *server) historyAccess(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if !s.config().historyEnabled {
+		writeJSONError(w, http.StatusNotFound, "render history is disabled")
+		return "", false
+	}
+	if _, _, _, ok := s.resolveClient(r); !ok {
+		writeJSONError(w, http.StatusUnauthorized, "invalid API key")
+		return "", false
+	}
+	client, ok := historyClient(r)
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "render history needs an API key")
+		return "", false
+	}
+	return client, true
+}
+
+// handleHistory lists the caller's recent renders, newest first, up to
+// limit.
+func (s *server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	client, ok := s.historyAccess(w, r)
+	if !ok {
+		return
+	}
+
+	limit := s.config().historyMaxEntries
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 1 {
+			writeJSONError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = value
+	}
+
+	entries, err := s.history.list(client)
+	if err != nil {
+		log.Printf("history lookup failed: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to look up render history")
+		return
+	}
+	resp := historyResponse{Renders: make([]historyItem, 0, min(len(entries), limit))}
+	for _, entry := range entries[:min(len(entries), limit)] {
+		item := historyItem{historyEntry: entry}
+		if entry.Request != nil {
+			item.Render = s.link("/api/history/" + entry.ID + "/render")
+		}
+		resp.Renders = append(resp.Renders, item)
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleHistoryRender renders a request from the caller's history again,
+// with the caller's current limits, and answers like /api/generate. The
+// new render is recorded too.
+func (s *server) handleHistoryRender(w http.ResponseWriter, r *http.Request) {
+	client, ok := s.historyAccess(w, r)
+	if !ok {
+		return
+	}
+	limits, ok := s.admitGenerate(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := s.history.list(client)
+	if err != nil {
+		log.Printf("history lookup failed: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to look up render history")
+		return
+	}
+	i := slices.IndexFunc(entries, func(entry historyEntry) bool { return entry.ID == r.PathValue("id") })
+	if i < 0 {
+		writeJSONError(w, http.StatusNotFound, "render not found in history")
+		return
+	}
+	if entries[i].Request == nil {
+		writeJSONError(w, http.StatusConflict, "this render used an upload and cannot be rendered again")
+		return
+	}
+
+	var req generateRequest
+	if err := json.Unmarshal(entries[i].Request, &req); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("stored request: %w", err))
+		return
+	}
+	s.writeGenerate(w, r, req, limits, nil)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"map-ascii-generator/api/internal/orbit"
+	"map-ascii-generator/api/internal/render"
+)
+
+const (
+	defaultISSPositionURL = "https://api.wheretheiss.at/v1/satellites/25544"
+	defaultISSTLEURL      = "https://celestrak.org/NORAD/elements/gp.php?CATNR=25544&FORMAT=TLE"
+
+	issPositionTTL      = 10 * time.Second
+	maxISSResponseBytes = 64 * 1024
+	issTLETTL           = 6 * time.Hour
+	// maxLivePositionAge is how old a live fix may be before the TLE
+	// propagation is preferred; the ISS covers about 7.7 km per second.
+	maxLivePositionAge = time.Minute
+	// maxTLEAge bounds how far element sets are propagated. The ISS
+	// reboosts and drag varies, so older elements place it hundreds of
+	// kilometers off and soon anywhere along its orbit.
+	maxTLEAge = 14 * 24 * time.Hour
+
+	defaultISSGlyph        = 'X'
+	defaultISSTrackChar    = '~'
+	defaultISSTrackMinutes = 90
+	maxISSTrackMinutes     = 360
+)
+
+var errISSUnavailable = fmt.Errorf("ISS position %w", errUnavailable)
+
+// issSource caches what was fetched for the ISS layer between requests.
+type issSource struct {
+	position cached[issFix]
+	tle      cached[orbit.TLE]
+}
+
+type issFix struct {
+	Lon  float64
+	Lat  float64
+	Time time.Time
+}
+
+// issMeta reports where the ISS was drawn. Source is "live" for a position
+// from iss.position_url and "tle" for one propagated from orbital elements,
+// whose epoch is then given as tle_epoch.
+type issMeta struct {
+	Lon      float64    `json:"lon"`
+	Lat      float64    `json:"lat"`
+	Source   string     `json:"source"`
+	Time     time.Time  `json:"time"`
+	TLEEpoch *time.Time `json:"tle_epoch,omitempty"`
+	Row      int        `json:"row"`
+	Col      int        `json:"col"`
+	Visible  bool       `json:"visible"`
+}
+
+// issLayer is the marker and optional ground track drawn for iss.enabled.
+type issLayer struct {
+	marker render.Marker
+	track  *render.Track
+	meta   issMeta
+}
+
+// loadISSElements reads the element set configured as iss.tle_file, which
+// takes the place of iss.tle_url.
+func loadISSElements(path string) (*orbit.TLE, error) {
+	if path == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tle, err := orbit.ParseTLE(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &tle, nil
+}
+
+// issSettings validates the iss options and returns the glyph and track
+// character.
+func issSettings(req generateRequest) (rune, string, rune, error) {
+	if !req.ISS.Enabled {
+		return 0, "", 0, nil
+	}
+	glyph, glyphString, err := parseGlyph(req.ISS.Glyph, defaultISSGlyph, "iss.glyph", req.AllowUnicode)
+	if err != nil {
+		return 0, "", 0, err
+	}
+	trackChar, err := parseRune(req.ISS.TrackChar, defaultISSTrackChar, "iss.track_char", req.AllowUnicode)
+	if err != nil {
+		return 0, "", 0, err
+	}
+	if req.ISS.TrackMinutes < 1 || req.ISS.TrackMinutes > maxISSTrackMinutes {
+		return 0, "", 0, fmt.Errorf("iss.track_minutes must be between 1 and %d", maxISSTrackMinutes)
+	}
+	return glyph, glyphString, trackChar, nil
+}
+
+// requestISS locates the ISS for iss.enabled. The live position is used
+// when it can be fetched, otherwise the position is propagated from the
+// current element set; the ground track always is.
+func (s *server) requestISS(req generateRequest) (*issLayer, error) {
+	if !req.ISS.Enabled {
+		return nil, nil
+	}
+	glyph, glyphString, trackChar, err := issSettings(req)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	layer := &issLayer{marker: render.Marker{Style: render.MarkerDot, Center: glyph, CenterGlyph: glyphString}}
+
+	fix, liveErr := s.issLivePosition(now)
+	if liveErr == nil {
+		layer.meta = issMeta{Lon: fix.Lon, Lat: fix.Lat, Source: "live", Time: fix.Time}
+	}
+
+	var sat *orbit.Satellite
+	if liveErr != nil || req.ISS.Track {
+		var tleErr error
+		if sat, tleErr = s.issSatellite(now); tleErr != nil {
+			if liveErr != nil {
+				return nil, issUnavailable("position", errors.Join(liveErr, tleErr))
+			}
+			return nil, issUnavailable("iss.track", tleErr)
+		}
+	}
+
+	if liveErr != nil {
+		lon, lat, err := sat.SubPoint(now)
+		if err != nil {
+			return nil, issUnavailable("position", err)
+		}
+		epoch := sat.Epoch()
+		layer.meta = issMeta{Lon: lon, Lat: lat, Source: "tle", Time: now, TLEEpoch: &epoch}
+	}
+	layer.marker.Lon, layer.marker.Lat = layer.meta.Lon, layer.meta.Lat
+
+	if req.ISS.Track {
+		points, err := groundTrack(sat, now, req.ISS.TrackMinutes)
+		if err != nil {
+			return nil, issUnavailable("iss.track", err)
+		}
+		layer.track = &render.Track{Points: points, Char: trackChar}
+	}
+
+	return layer, nil
+}
+
+// issUnavailable logs why the ISS could not be placed and returns only the
+// sentinel: the cause names upstream hosts and addresses.
+func issUnavailable(what string, err error) error {
+	log.Printf("iss: %s unavailable: %v", what, err)
+	return errISSUnavailable
+}
+
+// issLivePosition returns the position reported by iss.position_url, unless
+// the server is offline.
+func (s *server) issLivePosition(now time.Time) (issFix, error) {
+	cfg := s.config()
+	if cfg.issOffline || cfg.issPositionURL == "" {
+		return issFix{}, fmt.Errorf("live position is disabled")
+	}
+
+	fix, _, err := s.iss.position.get(cfg.issPositionURL, issPositionTTL, func() (issFix, error) {
+		return fetchISSPosition(cfg.issPositionURL)
+	})
+	if err != nil {
+		return issFix{}, fmt.Errorf("live position: %w", err)
+	}
+	if now.Sub(fix.Time) > maxLivePositionAge {
+		return issFix{}, fmt.Errorf("live position is from %s", fix.Time.Format(time.RFC3339))
+	}
+	return fix, nil
+}
+
+// fetchISSPosition reads a wheretheiss.at style response.
+func fetchISSPosition(url string) (issFix, error) {
+	body, err := fetchURL(context.Background(), url, maxISSResponseBytes)
+	if err != nil {
+		return issFix{}, err
+	}
+
+	var payload struct {
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+		Timestamp int64    `json:"timestamp"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return issFix{}, fmt.Errorf("GET %s: %w", url, err)
+	}
+	if payload.Latitude == nil || payload.Longitude == nil || !isFinite(*payload.Latitude) || !isFinite(*payload.Longitude) {
+		return issFix{}, fmt.Errorf("GET %s: response has no latitude and longitude", url)
+	}
+
+	fix := issFix{Lon: *payload.Longitude, Lat: *payload.Latitude, Time: time.Now().UTC()}
+	if payload.Timestamp > 0 {
+		fix.Time = time.Unix(payload.Timestamp, 0).UTC()
+	}
+	return fix, nil
+}
+
+// issSatellite initializes SGP4 from iss.tle_file or, unless the server is
+// offline, from iss.tle_url. A fetched element set stays in use while the
+// feed is down, until it is older than maxTLEAge.
+func (s *server) issSatellite(now time.Time) (*orbit.Satellite, error) {
+	cfg := s.config()
+
+	var tle orbit.TLE
+	switch {
+	case s.issTLE.Load() != nil:
+		tle = *s.issTLE.Load()
+	case cfg.issOffline || cfg.issTLEURL == "":
+		return nil, fmt.Errorf("no orbital elements (set iss.tle_file)")
+	default:
+		fetched, fetchedAt, err := s.iss.tle.get(cfg.issTLEURL, issTLETTL, func() (orbit.TLE, error) {
+			body, err := fetchURL(context.Background(), cfg.issTLEURL, maxISSResponseBytes)
+			if err != nil {
+				return orbit.TLE{}, err
+			}
+			return orbit.ParseTLE(strings.TrimSpace(string(body)))
+		})
+		if fetchedAt.IsZero() {
+			return nil, fmt.Errorf("orbital elements: %w", err)
+		}
+		if err != nil {
+			log.Printf("iss: refreshing orbital elements failed, using those fetched at %s: %v", fetchedAt.Format(time.RFC3339), err)
+		}
+		tle = fetched
+	}
+
+	if age := now.Sub(tle.Epoch); age > maxTLEAge || age < -maxTLEAge {
+		return nil, fmt.Errorf("orbital elements from %s are too far from the current time to propagate", tle.Epoch.Format(time.DateOnly))
+	}
+	return orbit.NewSatellite(tle)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"map-ascii-generator/api/internal/jobs"
+)
+
+const (
+	defaultJobWorkers   = 2
+	defaultJobQueueSize = 64
+	defaultJobTTL       = time.Hour
+	maxJobFrames        = 100
+)
+
+// jobRequest is the body of POST /api/jobs: one generate request per frame.
+type jobRequest struct {
+	Frames []json.RawMessage `json:"frames"`
+}
+
+type jobResult struct {
+	Frames []generateResponse `json:"frames"`
+}
+
+type jobResponse struct {
+	ID        string          `json:"id"`
+	Status    jobs.Status     `json:"status"`
+	Created   time.Time       `json:"created"`
+	Updated   time.Time       `json:"updated"`
+	Frames    int             `json:"frames"`
+	Completed int             `json:"completed"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+func newJobResponse(job jobs.Job) jobResponse {
+	return jobResponse{
+		ID:        job.ID,
+		Status:    job.Status,
+		Created:   job.Created,
+		Updated:   job.Updated,
+		Frames:    job.Steps,
+		Completed: job.Completed,
+		Result:    job.Result,
+		Error:     job.Error,
+	}
+}
+
+// handleJobs queues a render of one or more frames and answers 202 with the
+// job to poll at /api/jobs/{id}. Every frame counts against the rate limit.
+func (s *server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if !s.admitDuringMaintenance(w, false) {
+		return
+	}
+	limiter, clientKey, limits, ok := s.resolveClient(r)
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "invalid API key")
+		return
+	}
+
+	body, err := readJSONBody(w, r, limits)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var jobReq jobRequest
+	if err := decodeStrictJSON(body, &jobReq); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(jobReq.Frames) == 0 || len(jobReq.Frames) > maxJobFrames {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("frames must have 1 to %d entries", maxJobFrames))
+		return
+	}
+
+	reqs := make([]generateRequest, len(jobReq.Frames))
+	for i, raw := range jobReq.Frames {
+		req, err := parseGenerateRequest(raw, limits, s.presetSet())
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("frames[%d]: %v", i, err))
+			return
+		}
+		if err := validateRequest(req, limits); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("frames[%d]: %v", i, err))
+			return
+		}
+		reqs[i] = req
+	}
+
+	for range reqs {
+		if !limiter.Allow(clientKey, time.Now()) {
+			writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+	}
+
+	// The job outlives the request, so it renders with a detached copy.
+	detached := r.Clone(context.WithoutCancel(r.Context()))
+	job, err := s.jobs.Submit(len(reqs), func(progress func(int)) ([]byte, error) {
+		result := jobResult{Frames: make([]generateResponse, 0, len(reqs))}
+		for i, req := range reqs {
+			resp, err := s.generate(detached, req, limits, nil)
+			if err != nil {
+				return nil, fmt.Errorf("frames[%d]: %w", i, err)
+			}
+			result.Frames = append(result.Frames, resp)
+			progress(i + 1)
+		}
+		return json.Marshal(result)
+	})
+	if errors.Is(err, jobs.ErrQueueFull) {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if err != nil {
+		log.Printf("job submit failed: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to queue job")
+		return
+	}
+
+	w.Header().Set("Location", s.link("/api/jobs/"+job.ID))
+	writeJSON(w, http.StatusAccepted, newJobResponse(job))
+}
+
+// handleJob reports a job's status, with the result once it is done. Job
+// IDs are random, so knowing one is what grants access.
+func (s *server) handleJob(w http.ResponseWriter, r *http.Request) {
+	job, ok, err := s.jobs.Get(r.PathValue("id"))
+	if err != nil {
+		log.Printf("job lookup failed: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to look up job")
+		return
+	}
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "job not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newJobResponse(job))
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"map-ascii-generator/api/internal/jwt"
+	"map-ascii-generator/api/internal/ratelimit"
+)
+
+const (
+	defaultJWTTierClaim = "tier"
+	jwtLeeway           = time.Minute
+	jwksCacheTTL        = time.Hour
+	// jwksRefreshAfter spaces out refetches of the key set for tokens
+	// signed with a kid it does not have yet.
+	jwksRefreshAfter = time.Minute
+	maxJWKSBytes     = 1 << 20
+)
+
+// jwtAuth accepts bearer JWTs from an identity provider as credentials,
+// verified with the keys at jwksURL or with a static key.
+type jwtAuth struct {
+	jwksURL   string
+	static    any
+	issuer    string
+	audience  string
+	tierClaim string
+}
+
+// newJWTAuth returns the JWT settings of cfg, or nil when neither a JWKS
+// URL nor a static key is configured.
+func newJWTAuth(cfg config) (*jwtAuth, error) {
+	sources := 0
+	for _, value := range []string{cfg.jwtJWKSURL, cfg.jwtKeyFile, cfg.jwtSecret} {
+		if value != "" {
+			sources++
+		}
+	}
+	if sources == 0 {
+		return nil, nil
+	}
+	if sources > 1 {
+		return nil, fmt.Errorf("set only one of jwt.jwks_url, jwt.key_file and jwt.secret")
+	}
+
+	auth := &jwtAuth{
+		jwksURL:   cfg.jwtJWKSURL,
+		issuer:    cfg.jwtIssuer,
+		audience:  cfg.jwtAudience,
+		tierClaim: cfg.jwtTierClaim,
+	}
+	switch {
+	case cfg.jwtKeyFile != "":
+		data, err := os.ReadFile(cfg.jwtKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read JWT key file: %w", err)
+		}
+		if auth.static, err = jwt.ParsePublicKeyPEM(data); err != nil {
+			return nil, fmt.Errorf("JWT key file %s: %w", cfg.jwtKeyFile, err)
+		}
+	case cfg.jwtSecret != "":
+		auth.static = []byte(cfg.jwtSecret)
+	}
+	return auth, nil
+}
+
+// looksLikeJWT tells a compact JWT apart from an opaque API key.
+func looksLikeJWT(credential string) bool {
+	return strings.Count(credential, ".") == 2 && strings.HasPrefix(credential, "eyJ")
+}
+
+// resolveJWT is resolveClient for a bearer JWT. The token's tier claim
+// names a tier from the keys file; without one the global limits apply.
+// Clients are rate limited by subject.
+func (s *server) resolveJWT(r *http.Request, auth *jwtAuth, raw string, cfg config) (ratelimit.Limiter, string, config, bool) {
+	claims, err := s.verifyJWT(r.Context(), auth, raw)
+	if err != nil {
+		return nil, "", config{}, false
+	}
+	subject := claims.String("sub")
+	if subject == "" {
+		return nil, "", config{}, false
+	}
+	clientKey := "jwt:" + subject
+
+	tierName := claims.String(auth.tierClaim)
+	if tierName == "" {
+		return s.limiter, clientKey, cfg, true
+	}
+	keys := s.keys.Load()
+	if keys == nil {
+		return nil, "", config{}, false
+	}
+	tier, ok := keys.Tier(tierName)
+	if !ok {
+		return nil, "", config{}, false
+	}
+	cfg = tierLimits(cfg, tier)
+	return s.tierLimiters.forTier(tier, cfg.rateAlgorithm, cfg.rateLimit, cfg.rateWindow, cfg.rateMaxClients), clientKey, cfg, true
+}
+
+func (s *server) verifyJWT(ctx context.Context, auth *jwtAuth, raw string) (jwt.Claims, error) {
+	token, err := jwt.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	key := auth.static
+	if key == nil {
+		if key, err = s.jwksKey(ctx, auth.jwksURL, token.Header.Kid); err != nil {
+			return nil, err
+		}
+	}
+	if err := token.Verify(key); err != nil {
+		return nil, err
+	}
+	if err := token.Claims.Validate(time.Now(), jwtLeeway, auth.issuer, auth.audience); err != nil {
+		return nil, err
+	}
+	return token.Claims, nil
+}
+
+// jwksKey returns the key kid from the key set at url, fetching the set
+// again when kid is new, at most once per jwksRefreshAfter.
+func (s *server) jwksKey(ctx context.Context, url string, kid string) (any, error) {
+	fetch := func() (map[string]any, error) {
+		data, err := fetchURL(ctx, url, maxJWKSBytes)
+		if err != nil {
+			return nil, fmt.Errorf("JWKS %w: %v", errUnavailable, err)
+		}
+		return jwt.ParseJWKS(data)
+	}
+
+	keys, _, err := s.jwks.get(url, jwksCacheTTL, fetch)
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	if keys, _, err = s.jwks.get(url, jwksRefreshAfter, fetch); err != nil {
+		return nil, err
+	}
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown JWT key %q", kid)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// routeSet is which routes a listener serves: the public API, the
+// playground and share links, the /admin endpoints, the /debug profiles,
+// or a mix.
+type routeSet uint8
+
+const (
+	routesAPI routeSet = 1 << iota
+	routesAdmin
+	routesDebug
+
+	routesAll = routesAPI | routesAdmin | routesDebug
+)
+
+var routeSetNames = []struct {
+	name string
+	set  routeSet
+}{
+	{"api", routesAPI},
+	{"admin", routesAdmin},
+	{"debug", routesDebug},
+}
+
+// parseRouteSet reads a list of route set names, or "all".
+func parseRouteSet(raw string) (routeSet, error) {
+	var set routeSet
+	for _, name := range splitList(raw) {
+		if strings.EqualFold(name, "all") {
+			set |= routesAll
+			continue
+		}
+		found := false
+		for _, known := range routeSetNames {
+			if strings.EqualFold(name, known.name) {
+				set |= known.set
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown route set %q, expected api, admin, debug or all", name)
+		}
+	}
+	if set == 0 {
+		return 0, fmt.Errorf("no route set given, expected api, admin, debug or all")
+	}
+	return set, nil
+}
+
+func (set routeSet) String() string {
+	var names []string
+	for _, known := range routeSetNames {
+		if set&known.set != 0 {
+			names = append(names, known.name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// routeSetOf is the set a route pattern belongs to.
+func routeSetOf(pattern string) routeSet {
+	switch {
+	case strings.HasPrefix(pattern, "/admin/"):
+		return routesAdmin
+	case strings.HasPrefix(pattern, "/debug/"):
+		return routesDebug
+	}
+	return routesAPI
+}
+
+// listenerConfig is one HTTP listener: its address, the routes it serves
+// and whether it serves them over TLS.
+type listenerConfig struct {
+	addr   string
+	routes routeSet
+	tls    bool
+}
+
+// loadListeners reads the extra listeners of the config file, listed
+// under listeners with an addr, routes and tls each. A listener serves
+// only the api routes unless routes names more.
+func loadListeners(src *configSource) ([]listenerConfig, error) {
+	var listeners []listenerConfig
+	for i := 0; ; i++ {
+		key := fmt.Sprintf("listeners.%d.", i)
+		addr := src.str("", key+"addr", "")
+		if addr == "" {
+			if src.str("", key+"routes", "") != "" {
+				return nil, fmt.Errorf("%saddr must be set", key)
+			}
+			return listeners, nil
+		}
+		routes, err := parseRouteSet(src.str("", key+"routes", "api"))
+		if err != nil {
+			return nil, fmt.Errorf("%sroutes: %w", key, err)
+		}
+		listeners = append(listeners, listenerConfig{addr: addr, routes: routes, tls: src.bool("", key+"tls", false)})
+	}
+}
+
+// httpListeners is every listener to start: listen_addr, over TLS when a
+// certificate is configured, then the listeners of the config file.
+func httpListeners(cfg config) []listenerConfig {
+	primary := listenerConfig{addr: cfg.listenAddr, routes: cfg.listenRoutes, tls: tlsEnabled(cfg)}
+	return append([]listenerConfig{primary}, cfg.listeners...)
+}
+
+// handler serves routes behind the middleware every listener shares.
+func (s *server) handler(routes routeSet) http.Handler {
+	return withRequestID(s.withTracing(s.withAccessLog(s.withStats(s.withUsage(s.withCacheHeaders(s.withSecurityHeaders(withRecovery(s.withSignatures(s.newMux(routes))))))))))
+}
+
+// serveListener serves l until it fails. tlsConfig holds the certificates
+// of TLS listeners.
+func (s *server) serveListener(l listenerConfig, tlsConfig *tls.Config) error {
+	httpServer := &http.Server{
+		Addr:              l.addr,
+		Handler:           s.handler(l.routes),
+		ReadHeaderTimeout: 5 * time.Second,
+		MaxHeaderBytes:    defaultMaxHeaderBytes,
+		ReadTimeout:       defaultReadTimeout,
+		WriteTimeout:      defaultWriteTimeout,
+		IdleTimeout:       defaultIdleTimeout,
+	}
+
+	if l.tls {
+		httpServer.TLSConfig = tlsConfig.Clone()
+		log.Printf("api listening on %s with TLS (%s)", l.addr, l.routes)
+		return httpServer.ListenAndServeTLS("", "")
+	}
+	log.Printf("api listening on %s (%s)", l.addr, l.routes)
+	return httpServer.ListenAndServe()
+}
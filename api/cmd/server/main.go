@@ -1,7 +1,11 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -9,101 +13,303 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"strconv"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	mapascii "github.com/Kivayan/map-ascii"
 
+	"map-ascii-generator/api/internal/apikey"
+	"map-ascii-generator/api/internal/geo"
+	"map-ascii-generator/api/internal/jobs"
+	"map-ascii-generator/api/internal/mmdb"
+	"map-ascii-generator/api/internal/orbit"
+	"map-ascii-generator/api/internal/raster"
 	"map-ascii-generator/api/internal/ratelimit"
+	"map-ascii-generator/api/internal/render"
+	"map-ascii-generator/api/internal/storage"
+	"map-ascii-generator/api/internal/trace"
+	"map-ascii-generator/api/internal/weather"
 )
 
 const (
-	defaultListenAddr     = ":8081"
-	defaultMinWidth       = 20
-	defaultMaxWidth       = 240
-	defaultMaxMargin      = 12
-	defaultMinSupersample = 1
-	defaultMaxSupersample = 5
-	defaultMinCharAspect  = 1.0
-	defaultMaxCharAspect  = 3.5
-	defaultRateLimit      = 20
-	defaultRateWindow     = time.Minute
-	defaultMaxBodyBytes   = 64 * 1024
-	defaultReadTimeout    = 10 * time.Second
-	defaultWriteTimeout   = 30 * time.Second
-	defaultIdleTimeout    = 60 * time.Second
+	defaultListenAddr      = ":8081"
+	defaultMinWidth        = 20
+	defaultMaxWidth        = 240
+	defaultMaxMargin       = 12
+	defaultMinSupersample  = 1
+	defaultMaxSupersample  = 5
+	defaultMinCharAspect   = 1.0
+	defaultMaxCharAspect   = 3.5
+	defaultRateLimit       = 20
+	defaultRateWindow      = time.Minute
+	defaultMaxBodyBytes    = 64 * 1024
+	defaultMaxGeoJSONBytes = 256 * 1024
+	defaultReadTimeout     = 10 * time.Second
+	defaultWriteTimeout    = 30 * time.Second
+	defaultIdleTimeout     = 60 * time.Second
+	defaultMaxHeaderBytes  = 64 * 1024
+	defaultRenderTimeout   = 10 * time.Second
+
+	defaultAutocertCacheDir = "acme-cache"
+	defaultTLSHTTPAddr      = ":80"
+
+	minRampLength = 2
+	maxRampLength = 32
+
+	maxTextLength  = 240
+	maxLabelLength = 40
+	maxMarkers     = 20
+
+	minGraticuleInterval     = 1
+	maxGraticuleInterval     = 90
+	defaultGraticuleInterval = 30
 )
 
-var allowedColorModes = map[string]struct{}{
-	"never":  {},
-	"always": {},
-}
-
-var allowedColors = map[string]struct{}{
-	"":               {},
-	"black":          {},
-	"red":            {},
-	"green":          {},
-	"yellow":         {},
-	"blue":           {},
-	"magenta":        {},
-	"cyan":           {},
-	"white":          {},
-	"bright-black":   {},
-	"bright-red":     {},
-	"bright-green":   {},
-	"bright-yellow":  {},
-	"bright-blue":    {},
-	"bright-magenta": {},
-	"bright-cyan":    {},
-	"bright-white":   {},
-}
-
-type config struct {
-	listenAddr string
-
-	minWidth       int
-	maxWidth       int
-	maxMargin      int
-	minSupersample int
-	maxSupersample int
-	minCharAspect  float64
-	maxCharAspect  float64
-
-	rateLimit    int
-	rateWindow   time.Duration
-	maxBodyBytes int64
+var colorModes = []string{"never", "always", "ansi256", "truecolor"}
+
+var hexColorModeNames = []string{"ansi256", "truecolor"}
+
+var colorNames = []string{
+	"black",
+	"red",
+	"green",
+	"yellow",
+	"blue",
+	"magenta",
+	"cyan",
+	"white",
+	"bright-black",
+	"bright-red",
+	"bright-green",
+	"bright-yellow",
+	"bright-blue",
+	"bright-magenta",
+	"bright-cyan",
+	"bright-white",
 }
 
+var allowedColorModes = stringSet(colorModes...)
+
+var hexColorModes = stringSet(hexColorModeNames...)
+
 type server struct {
 	mask    *mapascii.LandMask
-	limiter *ratelimit.FixedWindowLimiter
-	cfg     config
+	limiter ratelimit.Limiter
+
+	configPath  string
+	cfg         atomic.Pointer[config]
+	maintenance atomic.Pointer[maintenance]
+
+	keys         atomic.Pointer[apikey.Store]
+	state        storage.Store
+	tierLimiters tierLimiters
+	jwt          atomic.Pointer[jwtAuth]
+	jwks         cachedSet[map[string]any]
+
+	countries  atomic.Pointer[geo.Countries]
+	timezones  atomic.Pointer[geo.Timezones]
+	cities     atomic.Pointer[geo.Gazetteer]
+	airports   atomic.Pointer[geo.Airports]
+	elevation  atomic.Pointer[raster.Grid]
+	population atomic.Pointer[raster.Grid]
+	masks      atomic.Pointer[maskSet]
+	maskMu     sync.Mutex
+	presets    atomic.Pointer[presetSet]
+	presetMu   sync.Mutex
+	geoip      atomic.Pointer[mmdb.Reader]
+
+	iss    issSource
+	issTLE atomic.Pointer[orbit.TLE]
+
+	earthquakes cachedSet[earthquakeFeed]
+	weather     cachedSet[*weather.Grid]
+
+	jobs      *jobs.Queue
+	renders   renderSlots
+	stats     *stats
+	watchdog  renderWatchdog
+	cache     atomic.Pointer[renderCache]
+	warmedUp  atomic.Bool
+	shares    *shareStore
+	history   *historyStore
+	usage     *usageLedger
+	accessLog *accessLog
+	tracer    *trace.Tracer
+	schedules atomic.Pointer[[]schedule]
+}
+
+type markerPoint struct {
+	Lon   float64 `json:"lon"`
+	Lat   float64 `json:"lat"`
+	Place string  `json:"place"`
+	Label string  `json:"label"`
 }
 
 type generateRequest struct {
-	Width       int     `json:"width"`
-	Supersample int     `json:"supersample"`
-	CharAspect  float64 `json:"char_aspect"`
-	Margin      int     `json:"margin"`
-	Frame       bool    `json:"frame"`
-	Continent   string  `json:"continent"`
-	Marker      struct {
-		Enabled    bool    `json:"enabled"`
-		Lon        float64 `json:"lon"`
-		Lat        float64 `json:"lat"`
-		Center     string  `json:"center"`
-		Horizontal string  `json:"horizontal"`
-		Vertical   string  `json:"vertical"`
-		ArmX       int     `json:"arm_x"`
-		ArmY       int     `json:"arm_y"`
+	Width           int     `json:"width"`
+	Supersample     int     `json:"supersample"`
+	CharAspect      float64 `json:"char_aspect"`
+	Margin          int     `json:"margin"`
+	Frame           bool    `json:"frame"`
+	FrameStyle      string  `json:"frame_style"`
+	Title           string  `json:"title"`
+	Footer          string  `json:"footer"`
+	FooterAlign     string  `json:"footer_align"`
+	Continent       string  `json:"continent"`
+	CentralMeridian float64 `json:"central_meridian"`
+	Projection      string  `json:"projection"`
+	Center          struct {
+		Lon float64 `json:"lon"`
+		Lat float64 `json:"lat"`
+	} `json:"center"`
+	CenterOnMarker bool     `json:"center_on_marker"`
+	Preset         string   `json:"preset"`
+	Format         string   `json:"format"`
+	Theme          string   `json:"theme"`
+	Charset        string   `json:"charset"`
+	Ramp           string   `json:"ramp"`
+	OceanChar      string   `json:"ocean_char"`
+	SeaLevelOffset float64  `json:"sea_level_offset_m"`
+	Terrain        bool     `json:"terrain"`
+	TerrainRamp    string   `json:"terrain_ramp"`
+	TerrainLegend  bool     `json:"terrain_legend"`
+	Borders        bool     `json:"borders"`
+	BorderChar     string   `json:"border_char"`
+	Highlight      []string `json:"highlight_countries"`
+	HighlightChar  string   `json:"highlight_char"`
+	Timezones      struct {
+		Enabled bool   `json:"enabled"`
+		Char    string `json:"char"`
+	} `json:"timezones"`
+	Choropleth struct {
+		Values map[string]float64 `json:"values"`
+		Ramp   string             `json:"ramp"`
+		Scale  string             `json:"scale"`
+		Legend bool               `json:"legend"`
+	} `json:"choropleth"`
+	Weather struct {
+		Variable string   `json:"variable"`
+		Ramp     string   `json:"ramp"`
+		Min      *float64 `json:"min"`
+		Max      *float64 `json:"max"`
+		Legend   bool     `json:"legend"`
+	} `json:"weather"`
+	Layer      string `json:"layer"`
+	Mask       string `json:"mask"`
+	Population struct {
+		Ramp   string `json:"ramp"`
+		Legend bool   `json:"legend"`
+	} `json:"population"`
+	Points  []geo.Point `json:"points"`
+	Density struct {
+		Ramp      string `json:"ramp"`
+		Threshold int    `json:"threshold"`
+		Scale     string `json:"scale"`
+		Legend    bool   `json:"legend"`
+	} `json:"density"`
+	GeoJSON json.RawMessage `json:"geojson"`
+	Overlay struct {
+		PointChar string `json:"point_char"`
+		LineChar  string `json:"line_char"`
+		FillChar  string `json:"fill_char"`
+		StartChar string `json:"start_char"`
+		EndChar   string `json:"end_char"`
+	} `json:"overlay"`
+	AllowUnicode bool `json:"allow_unicode"`
+	// Lines and Cells add the map to the response row by row, as text and
+	// as cells with their colors.
+	Lines  bool `json:"lines"`
+	Cells  bool `json:"cells"`
+	Marker struct {
+		Enabled     bool    `json:"enabled"`
+		Lon         float64 `json:"lon"`
+		Lat         float64 `json:"lat"`
+		Place       string  `json:"place"`
+		UseClientIP bool    `json:"use_client_ip"`
+		Center      string  `json:"center"`
+		Horizontal  string  `json:"horizontal"`
+		Vertical    string  `json:"vertical"`
+		ArmX        int     `json:"arm_x"`
+		ArmY        int     `json:"arm_y"`
+		Style       string  `json:"style"`
+		SnapToLand  bool    `json:"snap_to_land"`
+		Label       string  `json:"label"`
+		LocalTime   bool    `json:"local_time"`
 	} `json:"marker"`
+	Markers   []markerPoint `json:"markers"`
+	Distances struct {
+		Annotate bool   `json:"annotate"`
+		Char     string `json:"char"`
+		Unit     string `json:"unit"`
+	} `json:"distances"`
+	ISS struct {
+		Enabled      bool   `json:"enabled"`
+		Glyph        string `json:"glyph"`
+		Track        bool   `json:"track"`
+		TrackChar    string `json:"track_char"`
+		TrackMinutes int    `json:"track_minutes"`
+	} `json:"iss"`
+	Satellite struct {
+		TLE         string `json:"tle"`
+		Start       string `json:"start"`
+		Minutes     int    `json:"minutes"`
+		TrackChar   string `json:"track_char"`
+		TickMinutes int    `json:"tick_minutes"`
+		TickChar    string `json:"tick_char"`
+		TickLabels  bool   `json:"tick_labels"`
+	} `json:"satellite"`
+	Earthquakes struct {
+		Enabled      bool    `json:"enabled"`
+		Period       string  `json:"period"`
+		MinMagnitude float64 `json:"min_magnitude"`
+		Chars        string  `json:"chars"`
+	} `json:"earthquakes"`
+	Celestial struct {
+		Sun       bool   `json:"sun"`
+		Moon      bool   `json:"moon"`
+		Time      string `json:"time"`
+		SunGlyph  string `json:"sun_glyph"`
+		MoonGlyph string `json:"moon_glyph"`
+	} `json:"celestial"`
+	Routes []routeSpec `json:"routes"`
+	Route  struct {
+		Char         string `json:"char"`
+		EndpointChar string `json:"endpoint_char"`
+		Labels       bool   `json:"labels"`
+	} `json:"route"`
+	Graticule struct {
+		Enabled   bool    `json:"enabled"`
+		Interval  float64 `json:"interval"`
+		LonChar   string  `json:"lon_char"`
+		LatChar   string  `json:"lat_char"`
+		CrossChar string  `json:"cross_char"`
+		OverLand  bool    `json:"over_land"`
+	} `json:"graticule"`
 	Color struct {
-		Mode        string `json:"mode"`
-		MapColor    string `json:"map_color"`
-		FrameColor  string `json:"frame_color"`
-		MarkerColor string `json:"marker_color"`
+		Mode             string   `json:"mode"`
+		MapColor         string   `json:"map_color"`
+		FrameColor       string   `json:"frame_color"`
+		MarkerColor      string   `json:"marker_color"`
+		BorderColor      string   `json:"border_color"`
+		HighlightColor   string   `json:"highlight_color"`
+		GraticuleColor   string   `json:"graticule_color"`
+		OverlayColor     string   `json:"overlay_color"`
+		FooterColor      string   `json:"footer_color"`
+		MapBg            string   `json:"map_bg"`
+		OceanBg          string   `json:"ocean_bg"`
+		FrameBg          string   `json:"frame_bg"`
+		MarkerAttrs      []string `json:"marker_attrs"`
+		LabelAttrs       []string `json:"label_attrs"`
+		FrameAttrs       []string `json:"frame_attrs"`
+		DensityColors    []string `json:"density_colors"`
+		ChoroplethColors []string `json:"choropleth_colors"`
+		WeatherColors    []string `json:"weather_colors"`
+		MapGradient      string   `json:"map_gradient"`
+		MapGradientStops []string `json:"map_gradient_stops"`
 	} `json:"color"`
 }
 
@@ -111,319 +317,1390 @@ type generateResponse struct {
 	Plain string `json:"plain"`
 	ANSI  string `json:"ansi"`
 	Meta  struct {
-		Width       int     `json:"width"`
-		Height      int     `json:"height"`
-		Supersample int     `json:"supersample"`
-		CharAspect  float64 `json:"char_aspect"`
-		Continent   string  `json:"continent,omitempty"`
-		DurationMS  int64   `json:"duration_ms"`
-		Bytes       int     `json:"bytes"`
+		Width       int              `json:"width"`
+		Height      int              `json:"height"`
+		Supersample int              `json:"supersample"`
+		CharAspect  float64          `json:"char_aspect"`
+		Continent   string           `json:"continent,omitempty"`
+		DurationMS  int64            `json:"duration_ms"`
+		Bytes       int              `json:"bytes"`
+		Markers     []markerMeta     `json:"markers,omitempty"`
+		Distances   []distanceMeta   `json:"distances,omitempty"`
+		ISS         *issMeta         `json:"iss,omitempty"`
+		Satellite   *satelliteMeta   `json:"satellite,omitempty"`
+		Celestial   *celestialMeta   `json:"celestial,omitempty"`
+		Routes      []routeMeta      `json:"routes,omitempty"`
+		Earthquakes *earthquakesMeta `json:"earthquakes,omitempty"`
+		Weather     *weatherMeta     `json:"weather,omitempty"`
 	} `json:"meta"`
+
+	// Message is the map wrapped for the chat service named by format.
+	Message string `json:"message,omitempty"`
+
+	// Lines holds the rows of Plain and Cells the cells of each row, when
+	// the request asks for them.
+	Lines []string       `json:"lines,omitempty"`
+	Cells [][]outputCell `json:"cells,omitempty"`
+	// Grid is the styled cell grid of format grid.
+	Grid [][]gridCell `json:"grid,omitempty"`
+
+	// canvas and the color settings it was drawn with, for output formats
+	// beyond plain and ANSI text.
+	canvas    *render.Canvas
+	colorMode render.ColorMode
+	palette   render.Palette
+}
+
+func (resp generateResponse) styled() [][]render.StyledCell {
+	return resp.canvas.Styled(resp.colorMode, resp.palette)
+}
+
+func (resp generateResponse) svg() string {
+	return resp.canvas.SVG(resp.colorMode, resp.palette)
+}
+
+func (resp generateResponse) png() ([]byte, error) {
+	return resp.canvas.PNG(resp.colorMode, resp.palette)
+}
+
+// outputCell is one terminal column of the output. Color holds the SGR
+// parameters ANSI uses for it, empty for the terminal default; the column
+// after a wide glyph has an empty char.
+type outputCell struct {
+	Char  string `json:"char"`
+	Color string `json:"color"`
+}
+
+// formatGrid adds the map as a grid of cells with explicit colors and
+// attributes, for web and TUI renderers.
+const formatGrid = "grid"
+
+// gridCell is a cell of format grid. FG and BG are #rrggbb, empty for the
+// terminal default.
+type gridCell struct {
+	Char  string   `json:"char"`
+	FG    string   `json:"fg"`
+	BG    string   `json:"bg"`
+	Attrs []string `json:"attrs"`
+}
+
+// markerMeta locates a drawn marker in the output text, so clients can
+// place elements over it. Hidden markers have row and col -1.
+type markerMeta struct {
+	Row         int    `json:"row"`
+	Col         int    `json:"col"`
+	Visible     bool   `json:"visible"`
+	Clipped     bool   `json:"clipped"`
+	Snapped     bool   `json:"snapped"`
+	Country     string `json:"country,omitempty"`
+	CountryName string `json:"country_name,omitempty"`
+	Continent   string `json:"continent,omitempty"`
+	Timezone    string `json:"timezone,omitempty"`
+	LocalTime   string `json:"local_time,omitempty"`
 }
 
 type optionsResponse struct {
-	Continents []string `json:"continents"`
+	Continents  []string `json:"continents"`
+	Projections []string `json:"projections"`
+	Layers      []string `json:"layers"`
+	Masks       []string `json:"masks"`
 }
 
-type errorResponse struct {
-	Error string `json:"error"`
+type colorsResponse struct {
+	Colors        []string `json:"colors"`
+	Themes        []string `json:"themes"`
+	Charsets      []string `json:"charsets"`
+	FrameStyles   []string `json:"frame_styles"`
+	ColorModes    []string `json:"color_modes"`
+	HexColorModes []string `json:"hex_color_modes"`
+	Gradients     []string `json:"gradients"`
+	Attrs         []string `json:"attrs"`
+	Defaults      struct {
+		Mode        string `json:"mode"`
+		MapColor    string `json:"map_color"`
+		FrameColor  string `json:"frame_color"`
+		MarkerColor string `json:"marker_color"`
+	} `json:"defaults"`
+}
+
+type limitsResponse struct {
+	MinWidth          int     `json:"min_width"`
+	MaxWidth          int     `json:"max_width"`
+	MinSupersample    int     `json:"min_supersample"`
+	MaxSupersample    int     `json:"max_supersample"`
+	MaxMargin         int     `json:"max_margin"`
+	MinCharAspect     float64 `json:"min_char_aspect"`
+	MaxCharAspect     float64 `json:"max_char_aspect"`
+	RateLimit         int     `json:"rate_limit"`
+	RateWindow        string  `json:"rate_window"`
+	RateWindowSeconds float64 `json:"rate_window_seconds"`
+	MaxBodyBytes      int64   `json:"max_body_bytes"`
+	MaxGeoJSONBytes   int64   `json:"max_geojson_bytes"`
 }
 
 func main() {
-	cfg := loadConfig()
+	configPath := flag.String("config", os.Getenv("API_CONFIG_FILE"), "path to a YAML or TOML config file; env vars override its values")
+	mcpStdio := flag.Bool("mcp", false, "serve the MCP tools on stdin and stdout instead of HTTP")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	if err := validateRequest(defaultGenerateRequest(cfg), cfg); err != nil {
+		log.Fatalf("invalid default render settings: %v", err)
+	}
+	if _, err := ratelimit.ParseAlgorithm(string(cfg.rateAlgorithm)); err != nil {
+		log.Fatalf("invalid rate limit settings: %v", err)
+	}
+	if err := validateAccessLogFormat(cfg.accessLogFormat); err != nil {
+		log.Fatalf("invalid access log settings: %v", err)
+	}
 
 	mask, err := mapascii.LoadEmbeddedDefaultLandMask()
 	if err != nil {
 		log.Fatalf("failed to load embedded land mask: %v", err)
 	}
 
+	var jobStore jobs.Store = jobs.NewMemory()
+	var state storage.Store
+	if cfg.stateDir != "" {
+		state, err = storage.Open(cfg.stateBackend, cfg.stateDir)
+		if err != nil {
+			log.Fatalf("failed to open state: %v", err)
+		}
+		if jobStore, err = jobs.NewPersistent(state); err != nil {
+			log.Fatalf("failed to load jobs: %v", err)
+		}
+		log.Printf("state stored in %s: backend=%s", cfg.stateDir, cfg.stateBackend)
+	}
+
 	srv := &server{
-		mask:    mask,
-		limiter: ratelimit.NewFixedWindowLimiter(cfg.rateLimit, cfg.rateWindow),
-		cfg:     cfg,
+		mask:       mask,
+		limiter:    ratelimit.New(cfg.rateAlgorithm, cfg.rateLimit, cfg.rateWindow, cfg.rateMaxClients),
+		configPath: *configPath,
+		state:      state,
+		jobs:       jobs.NewQueue(jobStore, cfg.jobWorkers, cfg.jobQueueSize, cfg.jobTTL),
+		renders:    newRenderSlots(cfg.maxRenders),
+		stats:      newStats(time.Now()),
+		history:    newHistoryStore(state),
+	}
+	if srv.usage, err = newUsageLedger(state, time.Now()); err != nil {
+		log.Fatalf("failed to load usage: %v", err)
+	}
+	if srv.shares, err = newShareStore(state); err != nil {
+		log.Fatalf("failed to set up share links: %v", err)
 	}
+	srv.cfg.Store(&cfg)
+	srv.maintenance.Store(maintenanceFromConfig(cfg))
+	srv.cache.Store(newRenderCache(cfg.cacheMaxEntries, cfg.cacheTTL))
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/api/healthz", srv.handleHealth)
-	mux.HandleFunc("/api/options", srv.handleOptions)
-	mux.HandleFunc("/api/generate", srv.handleGenerate)
+	if cfg.keysFile != "" {
+		keys, err := srv.loadKeys(cfg.keysFile)
+		if err != nil {
+			log.Fatalf("failed to load API keys: %v", err)
+		}
+		srv.keys.Store(keys)
+		tierCount, keyCount := keys.Counts()
+		log.Printf("api keys loaded from %s: tiers=%d keys=%d", cfg.keysFile, tierCount, keyCount)
+	}
+	if state != nil {
+		if err := srv.loadRateLimits(); err != nil {
+			log.Fatalf("failed to load rate limit counters: %v", err)
+		}
+		go srv.saveRateLimitsEvery(rateLimitSaveEvery)
+	}
 
-	httpServer := &http.Server{
-		Addr:              cfg.listenAddr,
-		Handler:           mux,
-		ReadHeaderTimeout: 5 * time.Second,
-		ReadTimeout:       defaultReadTimeout,
-		WriteTimeout:      defaultWriteTimeout,
-		IdleTimeout:       defaultIdleTimeout,
+	jwtAuth, err := newJWTAuth(cfg)
+	if err != nil {
+		log.Fatalf("invalid JWT settings: %v", err)
 	}
+	srv.jwt.Store(jwtAuth)
 
-	log.Printf("api listening on %s", cfg.listenAddr)
-	log.Printf("limits: width=%d..%d supersample=%d..%d margin<=%d rate=%d/%s", cfg.minWidth, cfg.maxWidth, cfg.minSupersample, cfg.maxSupersample, cfg.maxMargin, cfg.rateLimit, cfg.rateWindow)
+	countries, err := loadCountries(cfg.countriesFile)
+	if err != nil {
+		log.Fatalf("failed to load countries: %v", err)
+	}
+	srv.countries.Store(countries)
 
-	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("server failed: %v", err)
+	timezones, err := loadTimezones(cfg.timezonesFile)
+	if err != nil {
+		log.Fatalf("failed to load timezones: %v", err)
+	}
+	srv.timezones.Store(timezones)
+
+	cities, err := loadCities(cfg.citiesFile)
+	if err != nil {
+		log.Fatalf("failed to load cities: %v", err)
+	}
+	srv.cities.Store(cities)
+	log.Printf("gazetteer loaded: cities=%d", cities.Len())
+
+	airports, err := loadAirports(cfg.airportsFile)
+	if err != nil {
+		log.Fatalf("failed to load airports: %v", err)
+	}
+	srv.airports.Store(airports)
+
+	elevationGrid, err := loadElevation(cfg.elevationFile)
+	if err != nil {
+		log.Fatalf("failed to load elevation: %v", err)
+	}
+	srv.elevation.Store(elevationGrid)
+	if elevationGrid == nil {
+		log.Printf("data.elevation_file is not set and no elevation model is embedded: sea_level_offset_m and terrain are rejected")
+	}
+
+	populationGrid, err := loadPopulation(cfg.populationFile)
+	if err != nil {
+		log.Fatalf("failed to load population: %v", err)
+	}
+	srv.population.Store(populationGrid)
+	if populationGrid == nil {
+		log.Printf("data.population_file is not set and no population grid is embedded: layer population is rejected")
+	}
+
+	masks, err := loadMasks(cfg.masksDir)
+	if err != nil {
+		log.Fatalf("failed to load masks: %v", err)
+	}
+	srv.masks.Store(&masks)
+	if len(masks) > 0 {
+		log.Printf("land masks loaded from %s: masks=%d", cfg.masksDir, len(masks))
+	}
+
+	geoip, err := loadGeoIP(cfg.geoipFile)
+	if err != nil {
+		log.Fatalf("failed to load geoip database: %v", err)
+	}
+	if geoip != nil {
+		srv.geoip.Store(geoip)
+		log.Printf("geoip database loaded from %s: type=%s", cfg.geoipFile, geoip.Metadata().DatabaseType)
+	} else {
+		log.Printf("data.geoip_file is not set: GET / draws the world map without the caller's location and marker.use_client_ip is rejected")
+	}
+
+	if _, err := newWeatherSource(cfg); err != nil {
+		log.Fatalf("invalid weather settings: %v", err)
+	}
+	if _, err := discordPublicKey(cfg); err != nil {
+		log.Fatalf("invalid discord settings: %v", err)
+	}
+
+	issTLE, err := loadISSElements(cfg.issTLEFile)
+	if err != nil {
+		log.Fatalf("failed to load ISS elements: %v", err)
+	}
+	if issTLE != nil {
+		srv.issTLE.Store(issTLE)
+		log.Printf("iss elements loaded from %s: epoch=%s", cfg.issTLEFile, issTLE.Epoch.Format(time.RFC3339))
+	}
+
+	presets, err := loadPresets(cfg.presetsPath())
+	if err != nil {
+		log.Fatalf("failed to load presets: %v", err)
+	}
+	srv.presets.Store(&presets)
+	if len(presets) > 0 {
+		log.Printf("presets loaded from %s: presets=%d", cfg.presetsPath(), len(presets))
 	}
-}
 
-func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	schedules, err := loadSchedules(cfg.schedulesFile, cfg, presets)
+	if err != nil {
+		log.Fatalf("failed to load schedules: %v", err)
+	}
+	srv.schedules.Store(&schedules)
+	if len(schedules) > 0 {
+		log.Printf("schedules loaded from %s: schedules=%d", cfg.schedulesFile, len(schedules))
+	}
+	if err := srv.checkSchemas(); err != nil {
+		log.Fatalf("invalid API schemas: %v", err)
+	}
+	if *mcpStdio {
+		srv.reloadOnSIGHUP()
+		if err := srv.serveMCPStdio(); err != nil {
+			log.Fatalf("mcp failed: %v", err)
+		}
 		return
 	}
+	go srv.runSchedules()
+
+	srv.reloadOnSIGHUP()
+
+	if srv.accessLog, err = openAccessLog(cfg.accessLogFile); err != nil {
+		log.Fatalf("failed to open access log: %v", err)
+	}
+	if srv.tracer, err = newTracer(cfg); err != nil {
+		log.Fatalf("invalid tracing settings: %v", err)
+	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	tlsConfig, err := serverTLS(cfg)
+	if err != nil {
+		log.Fatalf("invalid TLS settings: %v", err)
+	}
+
+	go srv.warmup()
+	if cfg.grpcAddr != "" {
+		go srv.serveGRPC(cfg.grpcAddr)
+	}
+	if cfg.debugAddr != "" {
+		if err := validateDebugAddr(cfg.debugAddr); err != nil {
+			log.Fatalf("invalid debug listener: %v", err)
+		}
+		go serveDebug(cfg.debugAddr)
+	}
+
+	log.Printf("limits: width=%d..%d supersample=%d..%d margin<=%d rate=%d/%s", cfg.minWidth, cfg.maxWidth, cfg.minSupersample, cfg.maxSupersample, cfg.maxMargin, cfg.rateLimit, cfg.rateWindow)
+
+	listeners := httpListeners(cfg)
+	if cfg.adminToken != "" && !slices.ContainsFunc(listeners, func(l listenerConfig) bool { return l.routes&routesAdmin != 0 }) {
+		log.Printf("admin routes are not served: admin.token is set but neither listen_routes nor any listener includes admin")
+	}
+	for _, l := range listeners[1:] {
+		go func() {
+			if err := srv.serveListener(l, tlsConfig); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("listener %s failed: %v", l.addr, err)
+			}
+		}()
+	}
+	if err := srv.serveListener(listeners[0], tlsConfig); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("server failed: %v", err)
+	}
 }
 
 func (s *server) handleOptions(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	writeJSON(w, http.StatusOK, s.options())
+}
+
+func (s *server) options() optionsResponse {
+	return optionsResponse{Continents: mapascii.ContinentNames(), Projections: render.Projections(), Layers: s.layers(), Masks: s.maskNames()}
+}
+
+func (s *server) handleColors(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.colors())
+}
+
+func (s *server) colors() colorsResponse {
+	defaults := defaultGenerateRequest(s.config())
+
+	resp := colorsResponse{
+		Colors:        colorNames,
+		Themes:        themeNames(),
+		Charsets:      render.Charsets(),
+		FrameStyles:   render.FrameStyles(),
+		ColorModes:    colorModes,
+		HexColorModes: hexColorModeNames,
+		Gradients:     mapGradientNames(),
+		Attrs:         render.AttrNames(),
+	}
+	resp.Defaults.Mode = defaults.Color.Mode
+	resp.Defaults.MapColor = defaults.Color.MapColor
+	resp.Defaults.FrameColor = defaults.Color.FrameColor
+	resp.Defaults.MarkerColor = defaults.Color.MarkerColor
+	return resp
+}
+
+func (s *server) handleLimits(w http.ResponseWriter, r *http.Request) {
+	_, _, limits, ok := s.resolveClient(r)
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "invalid API key")
 		return
 	}
 
-	writeJSON(w, http.StatusOK, optionsResponse{Continents: mapascii.ContinentNames()})
+	writeJSON(w, http.StatusOK, limitsFor(limits))
+}
+
+func limitsFor(limits config) limitsResponse {
+	return limitsResponse{
+		MinWidth:          limits.minWidth,
+		MaxWidth:          limits.maxWidth,
+		MinSupersample:    limits.minSupersample,
+		MaxSupersample:    limits.maxSupersample,
+		MaxMargin:         limits.maxMargin,
+		MinCharAspect:     limits.minCharAspect,
+		MaxCharAspect:     limits.maxCharAspect,
+		RateLimit:         limits.rateLimit,
+		RateWindow:        limits.rateWindow.String(),
+		RateWindowSeconds: limits.rateWindow.Seconds(),
+		MaxBodyBytes:      limits.maxBodyBytes,
+		MaxGeoJSONBytes:   limits.maxGeoJSONBytes,
+	}
 }
 
 func (s *server) handleGenerate(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	limits, ok := s.admitGenerate(w, r)
+	if !ok {
 		return
 	}
 
-	clientKey := clientIdentifier(r)
-	if !s.limiter.Allow(clientKey, time.Now()) {
-		writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded")
+	decode := s.startSpan(r, "decode")
+	req, err := decodeGenerateRequest(w, r, limits, s.presetSet())
+	decode.SetError(err)
+	decode.End()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	req, err := decodeGenerateRequest(w, r, s.cfg.maxBodyBytes)
+	s.writeGenerate(w, r, req, limits, nil)
+}
+
+// admitGenerate applies the API key and rate limit checks shared by
+// the render endpoints and returns the caller's limits.
+func (s *server) admitGenerate(w http.ResponseWriter, r *http.Request) (config, bool) {
+	if !s.admitDuringMaintenance(w, false) {
+		return config{}, false
+	}
+	limiter, clientKey, limits, ok := s.resolveClient(r)
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "invalid API key")
+		return config{}, false
+	}
+	if !limiter.Allow(clientKey, time.Now()) {
+		writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return config{}, false
+	}
+
+	return limits, true
+}
+
+// writeGenerate validates and renders req. A non-nil overlay, built by the
+// caller from an upload, takes the place of the geojson field.
+func (s *server) writeGenerate(w http.ResponseWriter, r *http.Request, req generateRequest, limits config, overlay *render.Overlay) {
+	resp, err := s.generate(r, req, limits, overlay)
 	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, err.Error())
+		writeError(w, generateStatus(err), err)
 		return
 	}
+	s.recordHistory(r, req, resp, overlay)
 
-	if err := s.validateRequest(req); err != nil {
-		writeJSONError(w, http.StatusBadRequest, err.Error())
-		return
+	encode := s.startSpan(r, "encode", trace.String("format", req.Format))
+	defer encode.End()
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// generateStatus is the response status for an error from generate: the
+// request is at fault unless an upstream feed it depends on is down or the
+// render ran out of time.
+func generateStatus(err error) int {
+	if errors.Is(err, errUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadRequest
+}
+
+// generate validates and renders req.
+func (s *server) generate(r *http.Request, req generateRequest, limits config, overlay *render.Overlay) (generateResponse, error) {
+	if err := s.refuseDuringMaintenance(); err != nil {
+		return generateResponse{}, err
+	}
+	if req.Format == formatDiscord {
+		return s.generateDiscord(r, req, limits, overlay)
+	}
+
+	start := time.Now()
+	done := s.watchRender(r, req)
+	resp, cached, err := s.renderRequest(r, req, limits, overlay)
+	done(err)
+	if !cached {
+		s.stats.recordRender(req.Format, time.Since(start), err)
+	}
+	if err == nil {
+		s.recordUsage(r, resp)
+	}
+	return resp, err
+}
+
+// renderRequest runs the render pipeline for req, unless its result is
+// cached.
+func (s *server) renderRequest(r *http.Request, req generateRequest, limits config, overlay *render.Overlay) (generateResponse, bool, error) {
+	ctx := r.Context()
+	if limits.renderTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.renderTimeout)
+		defer cancel()
+	}
+
+	// Each step's span is ended early on success and by defer when the
+	// step fails.
+	validate := s.startSpan(r, "validate")
+	defer validate.End()
+
+	req, err := s.resolveClientIP(r, req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	req, err = s.resolvePlaces(req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	if err := validateRequest(req, limits); err != nil {
+		return generateResponse{}, false, err
+	}
+	validate.End()
+	req = canonicalRequest(req)
+
+	noteRender(r, liveRequest(req))
+	cache := s.renderCache()
+	key, cacheable := renderCacheKey(req, overlay)
+	if cacheable && cache != nil {
+		resp, hit := cache.get(key)
+		noteCache(r, hit)
+		if hit {
+			return resp, true, nil
+		}
+	}
+
+	layers := s.startSpan(r, "layers")
+	defer layers.End()
+
+	mask, err := s.requestMask(req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	viewport, continentName, err := requestViewport(req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	markers, err := requestMarkers(req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+	var times []localTime
+	if req.Marker.LocalTime {
+		times = s.localTimes(markers, time.Now())
+		labelLocalTimes(markers, times)
+	}
+
+	distances, err := requestDistances(req, markers)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	palette, err := requestPalette(req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	charset, err := render.ParseCharset(req.Charset)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	frameStyle, title, err := requestFrame(req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	footer, err := requestFooter(req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	ramp, err := parseRamp(req.Ramp, "ramp", minRampLength, req.AllowUnicode)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	oceanChar, err := parseRune(req.OceanChar, 0, "ocean_char", req.AllowUnicode)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	seaLevel, err := s.requestSeaLevel(req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	borders, err := s.requestBorders(req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	timezones, err := s.requestTimezones(req, time.Now())
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	highlight, err := s.requestHighlight(req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	choropleth, err := s.requestChoropleth(req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	field, weatherInfo, err := s.requestWeather(req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+	if field == nil {
+		if field, err = s.requestTerrain(req); err != nil {
+			return generateResponse{}, false, err
+		}
+	}
+	if field == nil {
+		if field, err = s.requestPopulation(req); err != nil {
+			return generateResponse{}, false, err
+		}
+	}
+
+	graticule, err := requestGraticule(req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	orthographic, err := requestOrthographic(req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	density, err := requestDensity(req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	if overlay == nil {
+		if overlay, err = requestOverlay(req, limits); err != nil {
+			return generateResponse{}, false, err
+		}
+	}
+
+	iss, err := s.requestISS(req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+	satellite, err := requestSatellite(req, time.Now())
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	celestial, err := requestCelestial(req, time.Now())
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	routes, err := s.requestRoutes(req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	symbols, earthquakes, err := s.requestEarthquakes(req)
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+
+	// Layers that place their own markers draw them after the requested
+	// ones; their positions are reported in their own meta fields.
+	var tracks []render.Track
+	drawn := slices.Clip(markers)
+	if iss != nil {
+		drawn = append(drawn, iss.marker)
+		if iss.track != nil {
+			tracks = append(tracks, *iss.track)
+		}
+	}
+	if satellite != nil {
+		drawn = append(drawn, satellite.ticks...)
+		tracks = append(tracks, satellite.track)
+	}
+	if celestial != nil {
+		drawn = append(drawn, celestial.markers...)
+	}
+	if routes != nil {
+		drawn = append(drawn, routes.markers...)
+		tracks = append(tracks, routes.tracks...)
+	}
+	if distances != nil {
+		drawn = append(drawn, distances.labels...)
+		tracks = append(tracks, distances.tracks...)
+	}
+
+	layers.End()
+
+	wait := s.startSpan(r, "render.wait")
+	release, err := s.renders.acquire(ctx)
+	wait.SetError(err)
+	wait.End()
+	if err != nil {
+		return generateResponse{}, false, err
+	}
+	defer release()
+
+	start := time.Now()
+	renderSpan := s.startSpan(r, "render",
+		trace.Int("width", req.Width),
+		trace.Int("supersample", req.Supersample),
+		trace.String("projection", req.Projection),
+	)
+	defer renderSpan.End()
+
+	canvas, err := render.RenderContext(ctx, mask, render.Options{
+		Width:        req.Width,
+		Supersample:  req.Supersample,
+		CharAspect:   req.CharAspect,
+		Margin:       req.Margin,
+		Frame:        req.Frame,
+		FrameStyle:   frameStyle,
+		Title:        title,
+		Footer:       footer,
+		Charset:      charset,
+		Ramp:         ramp,
+		OceanChar:    oceanChar,
+		SeaLevel:     seaLevel,
+		Borders:      borders,
+		Timezones:    timezones,
+		Highlight:    highlight,
+		Choropleth:   choropleth,
+		Field:        field,
+		Graticule:    graticule,
+		Density:      density,
+		Overlay:      overlay,
+		Tracks:       tracks,
+		Symbols:      symbols,
+		Viewport:     viewport,
+		Orthographic: orthographic,
+		Markers:      drawn,
+		Latitudes:    len(palette.MapGradient),
+	})
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("render took longer than %s: %w", limits.renderTimeout, err)
+		renderSpan.SetError(err)
+		return generateResponse{}, false, err
+	}
+	if err != nil {
+		err = fmt.Errorf("render failed: %w", err)
+		renderSpan.SetError(err)
+		return generateResponse{}, false, err
+	}
+
+	plain := canvas.Plain()
+	ansi := canvas.ANSI(render.ColorMode(req.Color.Mode), palette)
+	duration := time.Since(start)
+	renderSpan.SetAttributes(trace.Int("height", canvas.MapHeight))
+	renderSpan.End()
+
+	resp := generateResponse{
+		Plain: plain,
+		ANSI:  ansi,
+	}
+	resp.canvas, resp.colorMode, resp.palette = canvas, render.ColorMode(req.Color.Mode), palette
+	resp.Meta.Width = req.Width
+	resp.Meta.Height = canvas.MapHeight
+	resp.Meta.Supersample = req.Supersample
+	resp.Meta.CharAspect = req.CharAspect
+	resp.Meta.Continent = continentName
+	resp.Meta.DurationMS = duration.Milliseconds()
+	resp.Meta.Bytes = len(plain)
+	for i, m := range canvas.Markers[:len(markers)] {
+		meta := markerMeta{
+			Row:     m.Row,
+			Col:     m.Col,
+			Visible: m.Visible,
+			Clipped: m.Clipped,
+			Snapped: m.Snapped,
+		}
+		meta.Country, meta.CountryName, meta.Continent = s.reverseGeocode(markers[i].Lon, markers[i].Lat)
+		if times != nil {
+			meta.Timezone, meta.LocalTime = times[i].zone, times[i].time.Format(time.RFC3339)
+		}
+		resp.Meta.Markers = append(resp.Meta.Markers, meta)
+	}
+	extra := canvas.Markers[len(markers):]
+	if iss != nil {
+		m := extra[0]
+		iss.meta.Row, iss.meta.Col, iss.meta.Visible = m.Row, m.Col, m.Visible
+		resp.Meta.ISS = &iss.meta
+		extra = extra[1:]
+	}
+	if satellite != nil {
+		for i, m := range extra[:len(satellite.ticks)] {
+			tick := &satellite.meta.Ticks[i]
+			tick.Row, tick.Col, tick.Visible = m.Row, m.Col, m.Visible
+		}
+		resp.Meta.Satellite = &satellite.meta
+		extra = extra[len(satellite.ticks):]
+	}
+	if celestial != nil {
+		for i, m := range extra[:len(celestial.bodies)] {
+			body := celestial.bodies[i]
+			body.Row, body.Col, body.Visible = m.Row, m.Col, m.Visible
+		}
+		resp.Meta.Celestial = &celestial.meta
+		extra = extra[len(celestial.bodies):]
+	}
+	if routes != nil {
+		for i, ends := range routes.endpoints {
+			for j, end := range []*airportMeta{&routes.meta[i].From, &routes.meta[i].To} {
+				m := extra[ends[j]]
+				end.Row, end.Col, end.Visible = m.Row, m.Col, m.Visible
+			}
+		}
+		resp.Meta.Routes = routes.meta
+	}
+	if distances != nil {
+		resp.Meta.Distances = distances.meta
+	}
+	resp.Meta.Earthquakes = earthquakes
+	resp.Meta.Weather = weatherInfo
+
+	if req.Lines {
+		resp.Lines = strings.Split(plain, "\n")
+	}
+	if req.Format == formatGrid {
+		grid := canvas.Grid(resp.colorMode, palette)
+		resp.Grid = make([][]gridCell, len(grid))
+		for i, row := range grid {
+			resp.Grid[i] = make([]gridCell, len(row))
+			for j, cell := range row {
+				resp.Grid[i][j] = gridCell{Char: cell.Char, FG: cell.FG, BG: cell.BG, Attrs: cell.Attrs}
+			}
+		}
+	}
+	if req.Cells {
+		styled := resp.styled()
+		resp.Cells = make([][]outputCell, len(styled))
+		for i, row := range styled {
+			resp.Cells[i] = make([]outputCell, len(row))
+			for j, cell := range row {
+				resp.Cells[i][j] = outputCell{Char: cell.Text, Color: cell.SGR}
+			}
+		}
+	}
+
+	if cacheable {
+		cache.put(key, resp)
+	}
+	return resp, false, nil
+}
+
+// validateRequest reports every invalid field of req, not just the first,
+// so forms can flag them all at once.
+func validateRequest(req generateRequest, cfg config) error {
+	var errs fieldErrors
+
+	if !isFinite(req.CentralMeridian) || req.CentralMeridian < -180.0 || req.CentralMeridian > 180.0 {
+		errs.add("/central_meridian", fmt.Errorf("central_meridian must be between -180 and 180"))
+	}
+	errs.add("/sea_level_offset_m", seaLevelSettings(req))
+	viewport, continentName, viewportErr := requestViewport(req)
+	errs.add("/continent", viewportErr)
+
+	if req.Width < cfg.minWidth || req.Width > cfg.maxWidth {
+		errs.add("/width", fmt.Errorf("width must be between %d and %d", cfg.minWidth, cfg.maxWidth))
+	}
+	if req.Supersample < cfg.minSupersample || req.Supersample > cfg.maxSupersample {
+		errs.add("/supersample", fmt.Errorf("supersample must be between %d and %d", cfg.minSupersample, cfg.maxSupersample))
+	}
+	if req.Margin < 0 || req.Margin > cfg.maxMargin {
+		errs.add("/margin", fmt.Errorf("margin must be between 0 and %d", cfg.maxMargin))
+	}
+	if !isFinite(req.CharAspect) || req.CharAspect < cfg.minCharAspect || req.CharAspect > cfg.maxCharAspect {
+		errs.add("/char_aspect", fmt.Errorf("char_aspect must be between %.1f and %.1f", cfg.minCharAspect, cfg.maxCharAspect))
+	}
+
+	req.Color.Mode = strings.ToLower(strings.TrimSpace(req.Color.Mode))
+	if _, ok := allowedColorModes[req.Color.Mode]; !ok {
+		errs.add("/color/mode", fmt.Errorf("color.mode must be one of: %s", strings.Join(colorModes, ", ")))
+	}
+	errs.add("/format", validateFormat(req))
+
+	_, err := requestPalette(req)
+	errs.add("/color", err)
+	_, _, err = requestFrame(req)
+	errs.add("/frame_style", err)
+	_, err = requestFooter(req)
+	errs.add("/footer", err)
+	charset, err := render.ParseCharset(req.Charset)
+	errs.add("/charset", err)
+	if req.Ramp != "" && err == nil && charset != render.CharsetASCII {
+		errs.add("/ramp", fmt.Errorf("ramp requires charset %q", render.CharsetASCII))
+	}
+	_, err = parseRamp(req.Ramp, "ramp", minRampLength, req.AllowUnicode)
+	errs.add("/ramp", err)
+	_, err = parseRune(req.OceanChar, ' ', "ocean_char", req.AllowUnicode)
+	errs.add("/ocean_char", err)
+	_, err = parseRune(req.BorderChar, '+', "border_char", req.AllowUnicode)
+	errs.add("/border_char", err)
+	_, err = parseRune(req.HighlightChar, 0, "highlight_char", req.AllowUnicode)
+	errs.add("/highlight_char", err)
+	_, err = parseRune(req.Timezones.Char, '|', "timezones.char", req.AllowUnicode)
+	errs.add("/timezones/char", err)
+	_, _, _, err = choroplethSettings(req)
+	errs.add("/choropleth", err)
+	_, err = requestGraticule(req)
+	errs.add("/graticule", err)
+	_, err = requestOrthographic(req)
+	errs.add("/projection", err)
+	_, err = requestOverlay(req, cfg)
+	errs.add("/overlay", err)
+	_, err = requestDensity(req)
+	errs.add("/density", err)
+	_, _, _, err = issSettings(req)
+	errs.add("/iss", err)
+	_, err = requestSatellite(req, time.Now())
+	errs.add("/satellite", err)
+	_, err = requestCelestial(req, time.Now())
+	errs.add("/celestial", err)
+	_, _, _, err = routeSettings(req)
+	errs.add("/routes", err)
+	_, err = earthquakeSettings(req)
+	errs.add("/earthquakes", err)
+	_, _, _, _, _, err = weatherSettings(req)
+	errs.add("/weather", err)
+	_, _, err = terrainSettings(req)
+	errs.add("/terrain", err)
+	_, err = populationSettings(req)
+	errs.add("/population", err)
+	if req.Mask != "" {
+		errs.add("/mask", validateMaskName(req.Mask))
+	}
+
+	checkPosition := func(name string, lon float64, lat float64) {
+		pointer := jsonPointer(fieldIndexPattern.ReplaceAllString(name, ".$1"))
+		if !isFinite(lon) || lon < -180.0 || lon > 180.0 {
+			errs.add(pointer+"/lon", fmt.Errorf("%s.lon must be between -180 and 180", name))
+			return
+		}
+		if !isFinite(lat) || lat < -90.0 || lat > 90.0 {
+			errs.add(pointer+"/lat", fmt.Errorf("%s.lat must be between -90 and 90", name))
+			return
+		}
+		if continentName != "" {
+			if lon < viewport.MinLon || lon > viewport.MaxLon || lat < viewport.MinLat || lat > viewport.MaxLat {
+				errs.add(pointer, fmt.Errorf("%s coordinates must be inside the selected continent viewport", name))
+			}
+		}
+	}
+
+	if req.Marker.Enabled {
+		checkPosition("marker", req.Marker.Lon, req.Marker.Lat)
+		if req.Marker.ArmX < -1 || req.Marker.ArmY < -1 {
+			errs.add("/marker", fmt.Errorf("marker arm lengths must be -1 or greater"))
+		}
+	}
+	for i, m := range req.Markers {
+		checkPosition(fmt.Sprintf("markers[%d]", i), m.Lon, m.Lat)
+	}
+	markers, err := requestMarkers(req)
+	errs.add("/markers", err)
+	if err == nil {
+		_, err = distanceSettings(req, len(markers))
+		errs.add("/distances", err)
+	}
+
+	return errs.err()
+}
+
+func requestViewport(req generateRequest) (*mapascii.Viewport, string, error) {
+	raw := strings.TrimSpace(req.Continent)
+	if raw == "" || strings.EqualFold(raw, "world") {
+		if req.CentralMeridian != 0 {
+			viewport := render.CenteredWorldViewport(req.CentralMeridian)
+			return &viewport, "", nil
+		}
+		return nil, "", nil
+	}
+	if req.CentralMeridian != 0 {
+		return nil, "", fmt.Errorf("central_meridian only applies to the world map")
 	}
 
-	viewport, continentName, err := requestViewport(req)
+	continent, err := mapascii.ParseContinent(raw)
 	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, err.Error())
-		return
+		return nil, "", err
 	}
 
-	marker, err := requestMarkerToModel(req)
+	viewport, err := continent.Viewport()
 	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, err.Error())
-		return
+		return nil, "", err
 	}
 
-	start := time.Now()
+	return &viewport, string(continent), nil
+}
 
-	plain, err := mapascii.RenderWorldASCIIWithOptions(s.mask, req.Width, req.Supersample, req.CharAspect, marker, &mapascii.RenderOptions{
-		VerticalMarginRows: req.Margin,
-		Frame:              req.Frame,
-		ColorMode:          "never",
-		Viewport:           viewport,
-	})
-	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("render plain output failed: %v", err))
-		return
+func requestPalette(req generateRequest) (render.Palette, error) {
+	mode := strings.ToLower(strings.TrimSpace(req.Color.Mode))
+
+	var palette render.Palette
+	fields := []struct {
+		name  string
+		value string
+		dst   *render.Color
+	}{
+		{"color.map_color", req.Color.MapColor, &palette.Map},
+		{"color.frame_color", req.Color.FrameColor, &palette.Frame},
+		{"color.marker_color", req.Color.MarkerColor, &palette.Marker},
+		{"color.highlight_color", req.Color.HighlightColor, &palette.Highlight},
+		{"color.border_color", req.Color.BorderColor, &palette.Border},
+		{"color.graticule_color", req.Color.GraticuleColor, &palette.Graticule},
+		{"color.overlay_color", req.Color.OverlayColor, &palette.Overlay},
+		{"color.footer_color", req.Color.FooterColor, &palette.Footer},
+		{"color.map_bg", req.Color.MapBg, &palette.MapBg},
+		{"color.ocean_bg", req.Color.OceanBg, &palette.OceanBg},
+		{"color.frame_bg", req.Color.FrameBg, &palette.FrameBg},
 	}
-
-	ansi := plain
-	if req.Color.Mode == "always" {
-		ansi, err = mapascii.RenderWorldASCIIWithOptions(s.mask, req.Width, req.Supersample, req.CharAspect, marker, &mapascii.RenderOptions{
-			VerticalMarginRows: req.Margin,
-			Frame:              req.Frame,
-			ColorMode:          req.Color.Mode,
-			MapColor:           req.Color.MapColor,
-			FrameColor:         req.Color.FrameColor,
-			MarkerColor:        req.Color.MarkerColor,
-			Viewport:           viewport,
-		})
+	parse := func(name string, value string) (render.Color, error) {
+		color, err := render.ParseColor(value)
 		if err != nil {
-			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("render ansi output failed: %v", err))
-			return
+			return render.Color{}, fmt.Errorf("%s must be an ANSI 16 color name or a #rrggbb hex color", name)
 		}
+		if _, ok := hexColorModes[mode]; color.IsHex() && !ok {
+			return render.Color{}, fmt.Errorf("%s: hex colors require color.mode %s", name, strings.Join(hexColorModeNames, " or "))
+		}
+		return color, nil
 	}
 
-	duration := time.Since(start)
-	lonSpan := 360.0
-	latSpan := 180.0
-	if viewport != nil {
-		lonSpan = viewport.MaxLon - viewport.MinLon
-		latSpan = viewport.MaxLat - viewport.MinLat
+	for _, field := range fields {
+		color, err := parse(field.name, field.value)
+		if err != nil {
+			return render.Palette{}, err
+		}
+		*field.dst = color
 	}
-	height := int(math.Round((float64(req.Width) * latSpan / lonSpan) / req.CharAspect))
 
-	resp := generateResponse{
-		Plain: plain,
-		ANSI:  ansi,
+	scales := []struct {
+		name   string
+		values []string
+		dst    *[]render.Color
+	}{
+		{"color.density_colors", req.Color.DensityColors, &palette.Density},
+		{"color.choropleth_colors", req.Color.ChoroplethColors, &palette.Choropleth},
+		{"color.weather_colors", req.Color.WeatherColors, &palette.Field},
 	}
-	resp.Meta.Width = req.Width
-	resp.Meta.Height = height
-	resp.Meta.Supersample = req.Supersample
-	resp.Meta.CharAspect = req.CharAspect
-	resp.Meta.Continent = continentName
-	resp.Meta.DurationMS = duration.Milliseconds()
-	resp.Meta.Bytes = len(plain)
-
-	writeJSON(w, http.StatusOK, resp)
-}
-
-func (s *server) validateRequest(req generateRequest) error {
-	viewport, _, err := requestViewport(req)
-	if err != nil {
-		return err
+	for _, scale := range scales {
+		if len(scale.values) > maxRampLength {
+			return render.Palette{}, fmt.Errorf("%s must have at most %d entries", scale.name, maxRampLength)
+		}
+		for i, value := range scale.values {
+			color, err := parse(fmt.Sprintf("%s[%d]", scale.name, i), value)
+			if err != nil {
+				return render.Palette{}, err
+			}
+			if color.IsZero() {
+				return render.Palette{}, fmt.Errorf("%s[%d] must not be empty", scale.name, i)
+			}
+			*scale.dst = append(*scale.dst, color)
+		}
 	}
 
-	if req.Width < s.cfg.minWidth || req.Width > s.cfg.maxWidth {
-		return fmt.Errorf("width must be between %d and %d", s.cfg.minWidth, s.cfg.maxWidth)
+	attrFields := []struct {
+		name   string
+		values []string
+		dst    *render.Attrs
+	}{
+		{"color.marker_attrs", req.Color.MarkerAttrs, &palette.MarkerAttrs},
+		{"color.label_attrs", req.Color.LabelAttrs, &palette.LabelAttrs},
+		{"color.frame_attrs", req.Color.FrameAttrs, &palette.FrameAttrs},
 	}
-	if req.Supersample < s.cfg.minSupersample || req.Supersample > s.cfg.maxSupersample {
-		return fmt.Errorf("supersample must be between %d and %d", s.cfg.minSupersample, s.cfg.maxSupersample)
-	}
-	if req.Margin < 0 || req.Margin > s.cfg.maxMargin {
-		return fmt.Errorf("margin must be between 0 and %d", s.cfg.maxMargin)
+	for _, field := range attrFields {
+		attrs, err := render.ParseAttrs(field.values)
+		if err != nil {
+			return render.Palette{}, fmt.Errorf("%s entries must be one of: %s", field.name, strings.Join(render.AttrNames(), ", "))
+		}
+		*field.dst = attrs
 	}
-	if !isFinite(req.CharAspect) || req.CharAspect < s.cfg.minCharAspect || req.CharAspect > s.cfg.maxCharAspect {
-		return fmt.Errorf("char_aspect must be between %.1f and %.1f", s.cfg.minCharAspect, s.cfg.maxCharAspect)
+
+	gradient, err := mapGradientSettings(req)
+	if err != nil {
+		return render.Palette{}, err
 	}
+	palette.MapGradient = gradient
 
-	req.Color.Mode = strings.ToLower(strings.TrimSpace(req.Color.Mode))
-	if _, ok := allowedColorModes[req.Color.Mode]; !ok {
-		return fmt.Errorf("color.mode must be one of: never, always")
+	// Terrain errors are reported by requestTerrain.
+	if render.ColorMode(mode) == render.ColorModeTrueColor && len(palette.Field) == 0 {
+		if _, levels, err := terrainSettings(req); err == nil && levels > 0 {
+			palette.Field = render.Gradient(terrainStops, levels)
+		}
 	}
 
-	req.Color.MapColor = strings.ToLower(strings.TrimSpace(req.Color.MapColor))
-	req.Color.FrameColor = strings.ToLower(strings.TrimSpace(req.Color.FrameColor))
-	req.Color.MarkerColor = strings.ToLower(strings.TrimSpace(req.Color.MarkerColor))
+	return palette, nil
+}
 
-	if _, ok := allowedColors[req.Color.MapColor]; !ok {
-		return fmt.Errorf("color.map_color is not a supported ANSI 16 color")
-	}
-	if _, ok := allowedColors[req.Color.FrameColor]; !ok {
-		return fmt.Errorf("color.frame_color is not a supported ANSI 16 color")
+// requestOrthographic returns the globe settings, or nil for the default
+// equirectangular map. center_on_marker takes the center from the marker.
+func requestOrthographic(req generateRequest) (*render.Orthographic, error) {
+	projection, err := render.ParseProjection(req.Projection)
+	if err != nil {
+		return nil, err
 	}
-	if _, ok := allowedColors[req.Color.MarkerColor]; !ok {
-		return fmt.Errorf("color.marker_color is not a supported ANSI 16 color")
+	if projection != render.ProjectionOrthographic {
+		if req.CenterOnMarker {
+			return nil, fmt.Errorf("center_on_marker requires projection %q", render.ProjectionOrthographic)
+		}
+		return nil, nil
 	}
 
-	if req.Marker.Enabled {
-		if !isFinite(req.Marker.Lon) || req.Marker.Lon < -180.0 || req.Marker.Lon > 180.0 {
-			return fmt.Errorf("marker.lon must be between -180 and 180")
-		}
-		if !isFinite(req.Marker.Lat) || req.Marker.Lat < -90.0 || req.Marker.Lat > 90.0 {
-			return fmt.Errorf("marker.lat must be between -90 and 90")
-		}
-		if viewport != nil {
-			if req.Marker.Lon < viewport.MinLon || req.Marker.Lon > viewport.MaxLon || req.Marker.Lat < viewport.MinLat || req.Marker.Lat > viewport.MaxLat {
-				return fmt.Errorf("marker coordinates must be inside the selected continent viewport")
-			}
-		}
-		if req.Marker.ArmX < -1 || req.Marker.ArmY < -1 {
-			return fmt.Errorf("marker arm lengths must be -1 or greater")
-		}
+	if strings.TrimSpace(req.Continent) != "" && !strings.EqualFold(strings.TrimSpace(req.Continent), "world") {
+		return nil, fmt.Errorf("continent cannot be combined with projection %q", render.ProjectionOrthographic)
+	}
+	if req.CentralMeridian != 0 {
+		return nil, fmt.Errorf("central_meridian cannot be combined with projection %q; use center.lon", render.ProjectionOrthographic)
+	}
 
-		if _, err := parseASCIIRune(req.Marker.Center, 'O', "marker.center"); err != nil {
-			return err
-		}
-		if _, err := parseASCIIRune(req.Marker.Horizontal, '-', "marker.horizontal"); err != nil {
-			return err
-		}
-		if _, err := parseASCIIRune(req.Marker.Vertical, '|', "marker.vertical"); err != nil {
-			return err
+	center := render.Orthographic{CenterLon: req.Center.Lon, CenterLat: req.Center.Lat}
+	if req.CenterOnMarker {
+		if !req.Marker.Enabled {
+			return nil, fmt.Errorf("center_on_marker requires marker.enabled")
 		}
+		center = render.Orthographic{CenterLon: req.Marker.Lon, CenterLat: req.Marker.Lat}
+	}
+	if !isFinite(center.CenterLon) || center.CenterLon < -180.0 || center.CenterLon > 180.0 {
+		return nil, fmt.Errorf("center.lon must be between -180 and 180")
+	}
+	if !isFinite(center.CenterLat) || center.CenterLat < -90.0 || center.CenterLat > 90.0 {
+		return nil, fmt.Errorf("center.lat must be between -90 and 90")
 	}
 
-	return nil
+	return &center, nil
 }
 
-func requestViewport(req generateRequest) (*mapascii.Viewport, string, error) {
-	raw := strings.TrimSpace(req.Continent)
-	if raw == "" || strings.EqualFold(raw, "world") {
-		return nil, "", nil
+func requestGraticule(req generateRequest) (*render.Graticule, error) {
+	if !req.Graticule.Enabled {
+		return nil, nil
 	}
 
-	continent, err := mapascii.ParseContinent(raw)
-	if err != nil {
-		return nil, "", err
+	if !isFinite(req.Graticule.Interval) || req.Graticule.Interval < minGraticuleInterval || req.Graticule.Interval > maxGraticuleInterval {
+		return nil, fmt.Errorf("graticule.interval must be between %d and %d degrees", minGraticuleInterval, maxGraticuleInterval)
 	}
 
-	viewport, err := continent.Viewport()
+	lonChar, err := parseRune(req.Graticule.LonChar, ':', "graticule.lon_char", req.AllowUnicode)
 	if err != nil {
-		return nil, "", err
+		return nil, err
+	}
+	latChar, err := parseRune(req.Graticule.LatChar, '-', "graticule.lat_char", req.AllowUnicode)
+	if err != nil {
+		return nil, err
+	}
+	crossChar, err := parseRune(req.Graticule.CrossChar, '+', "graticule.cross_char", req.AllowUnicode)
+	if err != nil {
+		return nil, err
 	}
 
-	return &viewport, string(continent), nil
+	return &render.Graticule{
+		Interval:  req.Graticule.Interval,
+		LonChar:   lonChar,
+		LatChar:   latChar,
+		CrossChar: crossChar,
+		OverLand:  req.Graticule.OverLand,
+	}, nil
 }
 
-func requestMarkerToModel(req generateRequest) (*mapascii.Marker, error) {
-	if !req.Marker.Enabled {
+// requestMarkers returns marker (when enabled) followed by the markers
+// list. The list shares the style and characters of marker.
+func requestMarkers(req generateRequest) ([]render.Marker, error) {
+	if !req.Marker.Enabled && len(req.Markers) == 0 {
 		return nil, nil
 	}
+	if len(req.Markers) > maxMarkers {
+		return nil, fmt.Errorf("markers must have at most %d entries", maxMarkers)
+	}
+
+	style, err := render.ParseMarkerStyle(req.Marker.Style)
+	if err != nil {
+		return nil, err
+	}
 
-	center, err := parseASCIIRune(req.Marker.Center, 'O', "marker.center")
+	center, centerGlyph, err := parseGlyph(req.Marker.Center, 'O', "marker.center", req.AllowUnicode)
 	if err != nil {
 		return nil, err
 	}
-	horizontal, err := parseASCIIRune(req.Marker.Horizontal, '-', "marker.horizontal")
+	horizontal, err := parseRune(req.Marker.Horizontal, '-', "marker.horizontal", req.AllowUnicode)
 	if err != nil {
 		return nil, err
 	}
-	vertical, err := parseASCIIRune(req.Marker.Vertical, '|', "marker.vertical")
+	vertical, err := parseRune(req.Marker.Vertical, '|', "marker.vertical", req.AllowUnicode)
 	if err != nil {
 		return nil, err
 	}
+	template := render.Marker{
+		Style:       style,
+		SnapToLand:  req.Marker.SnapToLand,
+		Center:      center,
+		CenterGlyph: centerGlyph,
+		Horizontal:  horizontal,
+		Vertical:    vertical,
+		ArmX:        req.Marker.ArmX,
+		ArmY:        req.Marker.ArmY,
+	}
 
-	marker := &mapascii.Marker{
-		Lon:        req.Marker.Lon,
-		Lat:        req.Marker.Lat,
-		Center:     center,
-		Horizontal: horizontal,
-		Vertical:   vertical,
-		ArmX:       req.Marker.ArmX,
-		ArmY:       req.Marker.ArmY,
+	var markers []render.Marker
+	add := func(name string, lon float64, lat float64, rawLabel string) error {
+		label, err := parseText(rawLabel, name+".label", maxLabelLength, req.AllowUnicode)
+		if err != nil {
+			return err
+		}
+		marker := template
+		marker.Lon, marker.Lat, marker.Label = lon, lat, label
+		marker.Number = len(markers) + 1
+		markers = append(markers, marker)
+		return nil
+	}
+
+	if req.Marker.Enabled {
+		if err := add("marker", req.Marker.Lon, req.Marker.Lat, req.Marker.Label); err != nil {
+			return nil, err
+		}
+	}
+	for i, m := range req.Markers {
+		if err := add(fmt.Sprintf("markers[%d]", i), m.Lon, m.Lat, m.Label); err != nil {
+			return nil, err
+		}
+	}
+	if style == render.MarkerNumbered && len(markers) > render.MaxNumberedMarkers {
+		return nil, fmt.Errorf("marker.style %q allows at most %d markers", style, render.MaxNumberedMarkers)
 	}
 
-	return marker, nil
+	return markers, nil
 }
 
-func decodeGenerateRequest(w http.ResponseWriter, r *http.Request, maxBodyBytes int64) (generateRequest, error) {
-	req := defaultGenerateRequest()
+func decodeGenerateRequest(w http.ResponseWriter, r *http.Request, cfg config, presets presetSet) (generateRequest, error) {
+	var body []byte
+	var uploads map[string][]byte
+	if isMultipart(r) {
+		var err error
+		if body, uploads, err = readMultipartGenerate(w, r, cfg, "geojson", "points"); err != nil {
+			return generateRequest{}, err
+		}
+	} else {
+		var err error
+		if body, err = readJSONBody(w, r, cfg); err != nil {
+			return generateRequest{}, err
+		}
+	}
+
+	req, err := parseGenerateRequest(body, cfg, presets)
+	if err != nil {
+		return generateRequest{}, err
+	}
+	if req, err = fitTerminal(r, body, req, cfg, presets); err != nil {
+		return generateRequest{}, err
+	}
+	if upload, ok := uploads["geojson"]; ok {
+		if len(req.GeoJSON) > 0 {
+			return generateRequest{}, fmt.Errorf("geojson must be sent either inline or as an upload, not both")
+		}
+		req.GeoJSON = upload
+	}
+	if upload, ok := uploads["points"]; ok {
+		if len(req.Points) > 0 {
+			return generateRequest{}, fmt.Errorf("points must be sent either inline or as a CSV upload, not both")
+		}
+		points, err := parsePointsCSV(upload)
+		if err != nil {
+			return generateRequest{}, err
+		}
+		req.Points = points
+	}
+
+	return req, nil
+}
 
-	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+// readJSONBody reads a request body of at most limits.max_body_bytes.
+func readJSONBody(w http.ResponseWriter, r *http.Request, cfg config) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.maxBodyBytes)
 	defer r.Body.Close()
 
-	decoder := json.NewDecoder(r.Body)
-	decoder.DisallowUnknownFields()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON payload: %w", err)
+	}
+	return body, nil
+}
 
-	if err := decoder.Decode(&req); err != nil {
-		return generateRequest{}, fmt.Errorf("invalid JSON payload: %w", err)
+// parseGenerateRequest decodes the JSON options on top of the configured
+// defaults, after expanding a named preset, and normalizes the enum-like
+// fields.
+func parseGenerateRequest(body []byte, cfg config, presets presetSet) (generateRequest, error) {
+	body, err := presets.expand(body)
+	if err != nil {
+		return generateRequest{}, err
 	}
 
-	if err := decoder.Decode(&struct{}{}); err != io.EOF {
-		return generateRequest{}, fmt.Errorf("invalid JSON payload: trailing data")
+	req := miniDefaults(body, defaultGenerateRequest(cfg))
+	if err := decodeStrictJSON(body, &req); err != nil {
+		return generateRequest{}, err
 	}
 
+	req.Theme = strings.ToLower(strings.TrimSpace(req.Theme))
+	if req.Theme != "" {
+		if err := applyTheme(&req, body); err != nil {
+			return generateRequest{}, err
+		}
+	}
+
+	req.Format = strings.ToLower(strings.TrimSpace(req.Format))
 	req.Color.Mode = strings.ToLower(strings.TrimSpace(req.Color.Mode))
 	req.Color.MapColor = strings.ToLower(strings.TrimSpace(req.Color.MapColor))
 	req.Color.FrameColor = strings.ToLower(strings.TrimSpace(req.Color.FrameColor))
 	req.Color.MarkerColor = strings.ToLower(strings.TrimSpace(req.Color.MarkerColor))
+	req.Color.HighlightColor = strings.ToLower(strings.TrimSpace(req.Color.HighlightColor))
+	req.Color.BorderColor = strings.ToLower(strings.TrimSpace(req.Color.BorderColor))
+	req.Color.GraticuleColor = strings.ToLower(strings.TrimSpace(req.Color.GraticuleColor))
+	req.Color.OverlayColor = strings.ToLower(strings.TrimSpace(req.Color.OverlayColor))
+	req.Color.FooterColor = strings.ToLower(strings.TrimSpace(req.Color.FooterColor))
+	req.Color.MapBg = strings.ToLower(strings.TrimSpace(req.Color.MapBg))
+	req.Color.OceanBg = strings.ToLower(strings.TrimSpace(req.Color.OceanBg))
+	req.Color.FrameBg = strings.ToLower(strings.TrimSpace(req.Color.FrameBg))
+	req.Color.MapGradient = strings.ToLower(strings.TrimSpace(req.Color.MapGradient))
+	for _, scale := range [][]string{req.Color.DensityColors, req.Color.ChoroplethColors, req.Color.WeatherColors, req.Color.MapGradientStops} {
+		for i, value := range scale {
+			scale[i] = strings.ToLower(strings.TrimSpace(value))
+		}
+	}
 	req.Continent = strings.ToLower(strings.TrimSpace(req.Continent))
+	req.Charset = strings.ToLower(strings.TrimSpace(req.Charset))
+	req.Projection = strings.ToLower(strings.TrimSpace(req.Projection))
+	req.Earthquakes.Period = strings.ToLower(strings.TrimSpace(req.Earthquakes.Period))
+	req.Distances.Unit = strings.ToLower(strings.TrimSpace(req.Distances.Unit))
+	req.Layer = strings.ToLower(strings.TrimSpace(req.Layer))
+	req.Mask = strings.ToLower(strings.TrimSpace(req.Mask))
+	for i, route := range req.Routes {
+		req.Routes[i] = routeSpec{From: strings.ToUpper(strings.TrimSpace(route.From)), To: strings.ToUpper(strings.TrimSpace(route.To))}
+	}
 
 	return req, nil
 }
 
-func defaultGenerateRequest() generateRequest {
+func decodeStrictJSON(body []byte, dst any) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			err = fmt.Errorf("%s must be %s, got %s", typeErr.Field, jsonTypeName(typeErr.Type), typeErr.Value)
+			return &paramError{Name: jsonPointer(typeErr.Field), Err: fmt.Errorf("invalid JSON payload: %w", err)}
+		}
+		return fmt.Errorf("invalid JSON payload: %w", err)
+	}
+
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return fmt.Errorf("invalid JSON payload: trailing data")
+	}
+
+	return nil
+}
+
+func defaultGenerateRequest(cfg config) generateRequest {
 	var req generateRequest
-	req.Width = 120
-	req.Supersample = 3
-	req.CharAspect = 2.0
-	req.Margin = 2
-	req.Frame = true
+	req.Width = cfg.defaultWidth
+	req.Supersample = cfg.defaultSupersample
+	req.CharAspect = cfg.defaultCharAspect
+	req.Margin = cfg.defaultMargin
+	req.Frame = cfg.defaultFrame
 	req.Continent = ""
+	req.Charset = string(render.CharsetASCII)
+	req.Projection = string(render.ProjectionEquirectangular)
+	req.Density.Threshold = 1
 
 	req.Marker.Enabled = false
 	req.Marker.Center = "O"
@@ -432,10 +1709,23 @@ func defaultGenerateRequest() generateRequest {
 	req.Marker.ArmX = -1
 	req.Marker.ArmY = -1
 
-	req.Color.Mode = "always"
-	req.Color.MapColor = "green"
-	req.Color.FrameColor = "bright-white"
-	req.Color.MarkerColor = "bright-red"
+	req.ISS.TrackMinutes = defaultISSTrackMinutes
+	req.Satellite.Minutes = defaultSatelliteMinutes
+	req.Satellite.TickMinutes = defaultSatelliteTickMinutes
+	req.Earthquakes.Period = defaultEarthquakesPeriod
+	req.Earthquakes.MinMagnitude = defaultEarthquakesMinMag
+	req.Route.Labels = true
+	req.Distances.Unit = defaultDistanceUnit
+
+	req.Graticule.Interval = defaultGraticuleInterval
+	req.Graticule.LonChar = ":"
+	req.Graticule.LatChar = "-"
+	req.Graticule.CrossChar = "+"
+
+	req.Color.Mode = cfg.defaultColorMode
+	req.Color.MapColor = cfg.defaultMapColor
+	req.Color.FrameColor = cfg.defaultFrameColor
+	req.Color.MarkerColor = cfg.defaultMarkerColor
 
 	return req
 }
@@ -457,6 +1747,162 @@ func parseASCIIRune(value string, fallback rune, fieldName string) (rune, error)
 	return runes[0], nil
 }
 
+// parseRune is parseASCIIRune with an opt-in for any single printable
+// non-combining character.
+func parseRune(value string, fallback rune, fieldName string, allowUnicode bool) (rune, error) {
+	if !allowUnicode {
+		return parseASCIIRune(value, fallback, fieldName)
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return fallback, nil
+	}
+
+	runes := []rune(value)
+	if len(runes) != 1 {
+		return 0, fmt.Errorf("%s must be a single character", fieldName)
+	}
+	if !unicode.IsPrint(runes[0]) || unicode.Is(unicode.Mn, runes[0]) {
+		return 0, fmt.Errorf("%s must be a printable character", fieldName)
+	}
+	if render.GlyphWidth(value) != 1 {
+		return 0, fmt.Errorf("%s must be a single-width character", fieldName)
+	}
+
+	return runes[0], nil
+}
+
+// parseGlyph is parseRune for fields that may also hold a double-width
+// character or an emoji made of several code points. Those are returned as
+// the glyph string with a zero rune.
+func parseGlyph(value string, fallback rune, fieldName string, allowUnicode bool) (rune, string, error) {
+	if !allowUnicode {
+		r, err := parseASCIIRune(value, fallback, fieldName)
+		return r, "", err
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return fallback, "", nil
+	}
+
+	glyphs := render.SplitGlyphs(value)
+	if len(glyphs) != 1 {
+		return 0, "", fmt.Errorf("%s must be a single character", fieldName)
+	}
+	if err := checkGlyphs(glyphs, fieldName); err != nil {
+		return 0, "", err
+	}
+
+	if runes := []rune(value); len(runes) == 1 && render.GlyphWidth(value) == 1 {
+		return runes[0], "", nil
+	}
+	return 0, value, nil
+}
+
+// checkGlyphs accepts the joiners and modifiers of emoji sequences, which
+// checkPrintable rejects on their own.
+func checkGlyphs(glyphs []string, fieldName string) error {
+	for _, glyph := range glyphs {
+		first := []rune(glyph)[0]
+		if !unicode.IsPrint(first) || unicode.Is(unicode.Mn, first) {
+			return fmt.Errorf("%s must only contain printable characters", fieldName)
+		}
+	}
+	return nil
+}
+
+// parseRamp validates a land density ramp ordered from ocean to full land.
+// Only printable ASCII is accepted unless allowUnicode is set.
+func parseRamp(value string, fieldName string, minLength int, allowUnicode bool) ([]rune, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	runes := []rune(value)
+	if len(runes) < minLength || len(runes) > maxRampLength {
+		return nil, fmt.Errorf("%s must be between %d and %d characters", fieldName, minLength, maxRampLength)
+	}
+
+	if err := checkPrintable(runes, fieldName, allowUnicode); err != nil {
+		return nil, err
+	}
+	return runes, nil
+}
+
+// parseText validates free text drawn into the output, such as a title.
+func parseText(value string, fieldName string, maxLength int, allowUnicode bool) (string, error) {
+	value = strings.TrimSpace(value)
+	runes := []rune(value)
+	if len(runes) > maxLength {
+		return "", fmt.Errorf("%s must be at most %d characters", fieldName, maxLength)
+	}
+	if allowUnicode {
+		if err := checkGlyphs(render.SplitGlyphs(value), fieldName); err != nil {
+			return "", err
+		}
+		return value, nil
+	}
+	if err := checkPrintable(runes, fieldName, allowUnicode); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+func checkPrintable(runes []rune, fieldName string, allowUnicode bool) error {
+	for _, r := range runes {
+		if allowUnicode {
+			if !unicode.IsPrint(r) || unicode.Is(unicode.Mn, r) {
+				return fmt.Errorf("%s must only contain printable characters", fieldName)
+			}
+			if render.GlyphWidth(string(r)) != 1 {
+				return fmt.Errorf("%s must only contain single-width characters", fieldName)
+			}
+			continue
+		}
+		if r < 0x20 || r > 0x7e {
+			return fmt.Errorf("%s must only contain printable ASCII characters (set allow_unicode to relax)", fieldName)
+		}
+	}
+	return nil
+}
+
+// requestFrame returns the border style and title. Both only apply to
+// framed maps.
+func requestFrame(req generateRequest) (render.FrameStyle, string, error) {
+	style, err := render.ParseFrameStyle(req.FrameStyle)
+	if err != nil {
+		return "", "", err
+	}
+	title, err := parseText(req.Title, "title", maxTextLength, req.AllowUnicode)
+	if err != nil {
+		return "", "", err
+	}
+	if !req.Frame && (strings.TrimSpace(req.FrameStyle) != "" || title != "") {
+		return "", "", fmt.Errorf("frame_style and title require frame")
+	}
+	return style, title, nil
+}
+
+func requestFooter(req generateRequest) (*render.Footer, error) {
+	text, err := parseText(req.Footer, "footer", maxTextLength, req.AllowUnicode)
+	if err != nil {
+		return nil, err
+	}
+	align, err := render.ParseAlign(req.FooterAlign)
+	if err != nil {
+		return nil, fmt.Errorf("footer_%w", err)
+	}
+	if text == "" {
+		if strings.TrimSpace(req.FooterAlign) != "" {
+			return nil, fmt.Errorf("footer_align requires footer")
+		}
+		return nil, nil
+	}
+	return &render.Footer{Text: text, Align: align}, nil
+}
+
 func writeJSON(w http.ResponseWriter, statusCode int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
@@ -467,8 +1913,12 @@ func writeJSON(w http.ResponseWriter, statusCode int, payload any) {
 	}
 }
 
-func writeJSONError(w http.ResponseWriter, statusCode int, message string) {
-	writeJSON(w, statusCode, errorResponse{Error: message})
+func stringSet(values ...string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		set[value] = struct{}{}
+	}
+	return set
 }
 
 func isFinite(v float64) bool {
@@ -501,72 +1951,3 @@ func clientIdentifier(r *http.Request) string {
 
 	return "anonymous"
 }
-
-func loadConfig() config {
-	return config{
-		listenAddr:     getEnv("API_LISTEN_ADDR", defaultListenAddr),
-		minWidth:       getEnvInt("API_MIN_WIDTH", defaultMinWidth),
-		maxWidth:       getEnvInt("API_MAX_WIDTH", defaultMaxWidth),
-		maxMargin:      getEnvInt("API_MAX_MARGIN", defaultMaxMargin),
-		minSupersample: getEnvInt("API_MIN_SUPERSAMPLE", defaultMinSupersample),
-		maxSupersample: getEnvInt("API_MAX_SUPERSAMPLE", defaultMaxSupersample),
-		minCharAspect:  getEnvFloat("API_MIN_CHAR_ASPECT", defaultMinCharAspect),
-		maxCharAspect:  getEnvFloat("API_MAX_CHAR_ASPECT", defaultMaxCharAspect),
-		rateLimit:      getEnvInt("API_RATE_LIMIT", defaultRateLimit),
-		rateWindow:     getEnvDuration("API_RATE_WINDOW", defaultRateWindow),
-		maxBodyBytes:   int64(getEnvInt("API_MAX_BODY_BYTES", defaultMaxBodyBytes)),
-	}
-}
-
-func getEnv(name string, fallback string) string {
-	value := strings.TrimSpace(os.Getenv(name))
-	if value == "" {
-		return fallback
-	}
-	return value
-}
-
-func getEnvInt(name string, fallback int) int {
-	value := strings.TrimSpace(os.Getenv(name))
-	if value == "" {
-		return fallback
-	}
-
-	parsed, err := strconv.Atoi(value)
-	if err != nil {
-		log.Printf("invalid integer for %s (%q), using fallback %d", name, value, fallback)
-		return fallback
-	}
-
-	return parsed
-}
-
-func getEnvFloat(name string, fallback float64) float64 {
-	value := strings.TrimSpace(os.Getenv(name))
-	if value == "" {
-		return fallback
-	}
-
-	parsed, err := strconv.ParseFloat(value, 64)
-	if err != nil {
-		log.Printf("invalid float for %s (%q), using fallback %.2f", name, value, fallback)
-		return fallback
-	}
-
-	return parsed
-}
-
-func getEnvDuration(name string, fallback time.Duration) time.Duration {
-	value := strings.TrimSpace(os.Getenv(name))
-	if value == "" {
-		return fallback
-	}
-
-	parsed, err := time.ParseDuration(value)
-	if err != nil {
-		log.Printf("invalid duration for %s (%q), using fallback %s", name, value, fallback)
-		return fallback
-	}
-
-	return parsed
-}
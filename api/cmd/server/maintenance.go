@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultMaintenanceMessage = "The map generator is down for planned maintenance; please try again later."
+
+// maintenance is whether renders are refused, and what callers are told.
+type maintenance struct {
+	Enabled bool      `json:"enabled"`
+	Message string    `json:"message"`
+	Since   time.Time `json:"since,omitzero"`
+}
+
+type maintenanceRequest struct {
+	Enabled *bool   `json:"enabled"`
+	Message *string `json:"message"`
+}
+
+// maintenanceError refuses a render during maintenance. It is answered with
+// 503 like an unavailable feed, with the message alone as the detail.
+type maintenanceError struct {
+	message string
+}
+
+func (e maintenanceError) Error() string {
+	return e.message
+}
+
+func (e maintenanceError) Unwrap() error {
+	return errUnavailable
+}
+
+// maintenanceFromConfig is the maintenance state cfg starts or reloads with.
+func maintenanceFromConfig(cfg config) *maintenance {
+	m := &maintenance{Enabled: cfg.maintenanceEnabled, Message: cfg.maintenanceMessage}
+	if m.Message == "" {
+		m.Message = defaultMaintenanceMessage
+	}
+	if m.Enabled {
+		m.Since = time.Now().UTC()
+	}
+	return m
+}
+
+// checkMaintenance fails readiness during maintenance, when
+// maintenance.not_ready asks for it.
+func (s *server) checkMaintenance(ctx context.Context) error {
+	if m := s.maintenance.Load(); m.Enabled {
+		return fmt.Errorf("in maintenance: %s", m.Message)
+	}
+	return nil
+}
+
+// refuseDuringMaintenance returns the error that refuses a render while
+// maintenance is on.
+func (s *server) refuseDuringMaintenance() error {
+	if m := s.maintenance.Load(); m.Enabled {
+		return maintenanceError{message: m.Message}
+	}
+	return nil
+}
+
+// admitDuringMaintenance answers w with 503 and the maintenance message,
+// in plain text for plain endpoints, while maintenance is on. Render
+// endpoints call it before they count, queue or start anything.
+func (s *server) admitDuringMaintenance(w http.ResponseWriter, plain bool) bool {
+	err := s.refuseDuringMaintenance()
+	if err == nil {
+		return true
+	}
+	if plain {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	} else {
+		writeError(w, http.StatusServiceUnavailable, err)
+	}
+	return false
+}
+
+// handleAdminMaintenance shows the maintenance state and, on PUT, turns it
+// on or off and changes its message. The change lasts until a restart, or
+// a reload that changes the maintenance settings.
+func (s *server) handleAdminMaintenance(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, s.maintenance.Load())
+		return
+	}
+
+	body, err := readJSONBody(w, r, s.config())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var req maintenanceRequest
+	if err := decodeStrictJSON(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	current := s.maintenance.Load()
+	next := *current
+	if req.Enabled != nil {
+		next.Enabled = *req.Enabled
+	}
+	if req.Message != nil {
+		next.Message = strings.TrimSpace(*req.Message)
+		if next.Message == "" {
+			next.Message = maintenanceFromConfig(s.config()).Message
+		}
+	}
+	switch {
+	case !next.Enabled:
+		next.Since = time.Time{}
+	case !current.Enabled:
+		next.Since = time.Now().UTC()
+	}
+	s.maintenance.Store(&next)
+
+	switch {
+	case next.Enabled && !current.Enabled:
+		log.Printf("maintenance mode on: %s", next.Message)
+	case !next.Enabled && current.Enabled:
+		log.Printf("maintenance mode off")
+	}
+	writeJSON(w, http.StatusOK, &next)
+}
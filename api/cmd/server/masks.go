@@ -0,0 +1,298 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	mapascii "github.com/Kivayan/map-ascii"
+
+	"map-ascii-generator/api/internal/landmask"
+)
+
+const (
+	defaultMaskName = "default"
+	maxMaskBytes    = 64 << 20
+	// maxMaskPixels allows twice the resolution of the built-in
+	// 3600x1800 mask in each direction.
+	maxMaskPixels = 7200 * 3600
+	maxMasks      = 8
+)
+
+var maskNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+var maskExtensions = []string{"." + landmask.FormatPNG, "." + landmask.FormatPBM, "." + landmask.FormatPGM}
+
+type maskEntry struct {
+	mask    *mapascii.LandMask
+	format  string
+	bytes   int
+	updated time.Time
+}
+
+// maskSet is an immutable snapshot of the uploaded masks; uploads and
+// deletes swap in a modified copy under maskMu.
+type maskSet map[string]maskEntry
+
+type maskInfo struct {
+	Name    string     `json:"name"`
+	Width   int        `json:"width"`
+	Height  int        `json:"height"`
+	Format  string     `json:"format"`
+	Bytes   int        `json:"bytes,omitempty"`
+	Updated *time.Time `json:"updated,omitempty"`
+	Builtin bool       `json:"builtin,omitempty"`
+}
+
+type masksResponse struct {
+	Masks []maskInfo `json:"masks"`
+}
+
+func validateMaskName(name string) error {
+	if !maskNamePattern.MatchString(name) {
+		return fmt.Errorf("mask name must be 1 to 32 lowercase letters, digits, '-' or '_'")
+	}
+	return nil
+}
+
+// loadMasks decodes every mask file in dir, named after the file. An empty
+// dir yields an empty set.
+func loadMasks(dir string) (maskSet, error) {
+	masks := maskSet{}
+	if dir == "" {
+		return masks, nil
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read masks dir: %w", err)
+	}
+	for _, file := range files {
+		ext := strings.ToLower(filepath.Ext(file.Name()))
+		if file.IsDir() || !slices.Contains(maskExtensions, ext) {
+			continue
+		}
+		name := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+		if name == defaultMaskName || validateMaskName(name) != nil {
+			log.Printf("skipping mask file %s: invalid mask name", file.Name())
+			continue
+		}
+		if _, ok := masks[name]; ok {
+			return nil, fmt.Errorf("mask %q is defined by more than one file in %s", name, dir)
+		}
+		if len(masks) == maxMasks {
+			return nil, fmt.Errorf("masks dir %s holds more than %d masks", dir, maxMasks)
+		}
+
+		path := filepath.Join(dir, file.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read mask file: %w", err)
+		}
+		mask, format, err := landmask.Decode(data, maxMaskPixels)
+		if err != nil {
+			return nil, fmt.Errorf("mask file %s: %w", path, err)
+		}
+		info, err := file.Info()
+		if err != nil {
+			return nil, err
+		}
+		masks[name] = maskEntry{mask: mask, format: format, bytes: len(data), updated: info.ModTime().UTC()}
+	}
+	return masks, nil
+}
+
+func (s *server) maskNames() []string {
+	masks := *s.masks.Load()
+	names := make([]string, 0, len(masks)+1)
+	names = append(names, defaultMaskName)
+	for name := range masks {
+		names = append(names, name)
+	}
+	slices.Sort(names[1:])
+	return names
+}
+
+// requestMask resolves the mask field, the built-in mask when empty.
+func (s *server) requestMask(req generateRequest) (*mapascii.LandMask, error) {
+	if req.Mask == "" || req.Mask == defaultMaskName {
+		return s.mask, nil
+	}
+	entry, ok := (*s.masks.Load())[req.Mask]
+	if !ok {
+		return nil, fmt.Errorf("unknown mask %q", req.Mask)
+	}
+	return entry.mask, nil
+}
+
+func (s *server) handleAdminMasks(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	masks := *s.masks.Load()
+	resp := masksResponse{Masks: make([]maskInfo, 0, len(masks)+1)}
+	for _, name := range s.maskNames() {
+		if name == defaultMaskName {
+			resp.Masks = append(resp.Masks, maskInfo{Name: name, Width: s.mask.Width, Height: s.mask.Height, Format: landmask.FormatPNG, Builtin: true})
+			continue
+		}
+		entry, ok := masks[name]
+		if !ok {
+			continue
+		}
+		resp.Masks = append(resp.Masks, maskInfo{
+			Name:    name,
+			Width:   entry.mask.Width,
+			Height:  entry.mask.Height,
+			Format:  entry.format,
+			Bytes:   entry.bytes,
+			Updated: &entry.updated,
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleAdminMask uploads (PUT, raw file body) or deletes a named mask.
+// With a masks dir configured the change is also written there so it
+// survives restarts.
+func (s *server) handleAdminMask(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	name := r.PathValue("name")
+	if err := validateMaskName(name); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if name == defaultMaskName {
+		writeJSONError(w, http.StatusBadRequest, "the default mask cannot be replaced or deleted")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		s.putMask(w, r, name)
+	case http.MethodDelete:
+		s.deleteMask(w, name)
+	}
+}
+
+func (s *server) putMask(w http.ResponseWriter, r *http.Request, name string) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMaskBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("mask must be at most %d bytes", maxMaskBytes))
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, "failed to read mask body")
+		return
+	}
+	mask, format, err := landmask.Decode(data, maxMaskPixels)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.maskMu.Lock()
+	defer s.maskMu.Unlock()
+
+	current := *s.masks.Load()
+	previous, replaced := current[name]
+	if !replaced && len(current) >= maxMasks {
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("at most %d masks can be uploaded; delete one first", maxMasks))
+		return
+	}
+
+	if dir := s.config().masksDir; dir != "" {
+		if err := writeMaskFile(dir, name, format, data); err != nil {
+			log.Printf("failed to store mask %q: %v", name, err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to store mask")
+			return
+		}
+		if replaced && previous.format != format {
+			if err := os.Remove(maskPath(dir, name, previous.format)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("failed to remove previous mask file for %q: %v", name, err)
+			}
+		}
+	}
+
+	next := make(maskSet, len(current)+1)
+	for k, v := range current {
+		next[k] = v
+	}
+	entry := maskEntry{mask: mask, format: format, bytes: len(data), updated: time.Now().UTC()}
+	next[name] = entry
+	s.masks.Store(&next)
+	s.renderCache().purge()
+	log.Printf("mask %q uploaded: %dx%d %s", name, mask.Width, mask.Height, format)
+
+	status := http.StatusCreated
+	if replaced {
+		status = http.StatusOK
+	}
+	writeJSON(w, status, maskInfo{Name: name, Width: mask.Width, Height: mask.Height, Format: format, Bytes: entry.bytes, Updated: &entry.updated})
+}
+
+func (s *server) deleteMask(w http.ResponseWriter, name string) {
+	s.maskMu.Lock()
+	defer s.maskMu.Unlock()
+
+	current := *s.masks.Load()
+	entry, ok := current[name]
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("unknown mask %q", name))
+		return
+	}
+
+	if dir := s.config().masksDir; dir != "" {
+		if err := os.Remove(maskPath(dir, name, entry.format)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("failed to remove mask %q: %v", name, err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to remove mask")
+			return
+		}
+	}
+
+	next := make(maskSet, len(current))
+	for k, v := range current {
+		if k != name {
+			next[k] = v
+		}
+	}
+	s.masks.Store(&next)
+	s.renderCache().purge()
+	log.Printf("mask %q deleted", name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func maskPath(dir string, name string, format string) string {
+	return filepath.Join(dir, name+"."+format)
+}
+
+// writeMaskFile replaces the mask file atomically so a reload never reads a
+// partial upload.
+func writeMaskFile(dir string, name string, format string, data []byte) error {
+	tmp, err := os.CreateTemp(dir, "."+name+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), maskPath(dir, name, format))
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"map-ascii-generator/api/internal/mcp"
+	"map-ascii-generator/api/internal/openapi"
+)
+
+type geocodeArguments struct {
+	Query string `json:"query"`
+	Limit int    `json:"limit"`
+}
+
+type plotPointsArguments struct {
+	Points    []markerPoint `json:"points"`
+	Width     int           `json:"width"`
+	Continent string        `json:"continent"`
+	Style     string        `json:"style"`
+	Title     string        `json:"title"`
+}
+
+// mcpServer exposes the renderer as MCP tools for clients with limits;
+// allow, if set, is asked before every render.
+func (s *server) mcpServer(r *http.Request, limits config, allow func() bool) *mcp.Server {
+	renderMap := func(req generateRequest) (string, error) {
+		if err := s.refuseDuringMaintenance(); err != nil {
+			return "", err
+		}
+		if allow != nil && !allow() {
+			return "", fmt.Errorf("rate limit exceeded")
+		}
+		resp, err := s.generate(r, req, limits, nil)
+		if err != nil {
+			return "", err
+		}
+		meta, err := json.Marshal(resp.Meta)
+		if err != nil {
+			return "", err
+		}
+		return resp.Plain + "\n\nmeta: " + string(meta), nil
+	}
+
+	geocodeSchema := openapi.SchemaOf(reflect.TypeOf(geocodeArguments{}))
+	geocodeSchema.Property("query").Describe("City name to look up.")
+	geocodeSchema.Property("limit").Range(1, maxGeocodeLimit)
+	geocodeSchema.Required = []string{"query"}
+
+	plotSchema := openapi.SchemaOf(reflect.TypeOf(plotPointsArguments{})).Optional()
+	plotSchema.Property("points").Describe(fmt.Sprintf("Up to %d points, each with lon and lat, or a place to look up, and an optional label.", maxMarkers))
+	plotSchema.Property("width").Range(float64(limits.minWidth), float64(limits.maxWidth))
+	plotSchema.Property("style").Describe("Marker style, pin by default.")
+	plotSchema.Required = []string{"points"}
+
+	return &mcp.Server{
+		Name:    "map-ascii-generator",
+		Version: apiVersion,
+		Tools: []mcp.Tool{
+			{
+				Name:        "generate_map",
+				Description: "Render an ASCII world or continent map. Takes the same options as POST /api/generate and returns the plain text map followed by its metadata as JSON; omitted options use the server defaults.",
+				InputSchema: generateRequestSchema(limits),
+				Call: func(ctx context.Context, arguments json.RawMessage) (string, error) {
+					req, err := parseGenerateRequest(arguments, limits, s.presetSet())
+					if err != nil {
+						return "", err
+					}
+					return renderMap(req)
+				},
+			},
+			{
+				Name:        "geocode",
+				Description: "Look up cities by name, most populous first, with their coordinates.",
+				InputSchema: geocodeSchema,
+				Call: func(ctx context.Context, arguments json.RawMessage) (string, error) {
+					var args geocodeArguments
+					if err := decodeStrictJSON(arguments, &args); err != nil {
+						return "", err
+					}
+					args.Query = strings.TrimSpace(args.Query)
+					if args.Query == "" || len(args.Query) > maxPlaceLength {
+						return "", fmt.Errorf("query must be 1 to %d bytes", maxPlaceLength)
+					}
+					if args.Limit == 0 {
+						args.Limit = defaultGeocodeLimit
+					}
+					if args.Limit < 1 || args.Limit > maxGeocodeLimit {
+						return "", fmt.Errorf("limit must be between 1 and %d", maxGeocodeLimit)
+					}
+					data, err := json.Marshal(s.geocode(args.Query, args.Limit))
+					return string(data), err
+				},
+			},
+			{
+				Name:        "plot_points",
+				Description: "Render a map with a marker at each point, labeled if a label is given.",
+				InputSchema: plotSchema,
+				Call: func(ctx context.Context, arguments json.RawMessage) (string, error) {
+					var args plotPointsArguments
+					if err := decodeStrictJSON(arguments, &args); err != nil {
+						return "", err
+					}
+					if len(args.Points) == 0 {
+						return "", fmt.Errorf("points must not be empty")
+					}
+
+					req := defaultGenerateRequest(limits)
+					req.Color.Mode = "never"
+					req.Markers = args.Points
+					req.Marker.Style = "pin"
+					if args.Style != "" {
+						req.Marker.Style = args.Style
+					}
+					if args.Width != 0 {
+						req.Width = args.Width
+					}
+					req.Continent = strings.ToLower(strings.TrimSpace(args.Continent))
+					req.Title = args.Title
+					return renderMap(req)
+				},
+			},
+		},
+	}
+}
+
+// serveMCPStdio answers MCP messages on stdin and stdout, with the server's
+// limits and no rate limit.
+func (s *server) serveMCPStdio() error {
+	log.Printf("serving MCP on stdio")
+	return s.mcpServer(&http.Request{Header: http.Header{}}, s.config(), nil).ServeStdio(context.Background(), os.Stdin, os.Stdout)
+}
+
+// handleMCP serves the MCP tools over HTTP. API keys apply, and every tool
+// call that renders counts against the rate limit.
+func (s *server) handleMCP(w http.ResponseWriter, r *http.Request) {
+	limiter, clientKey, limits, ok := s.resolveClient(r)
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "invalid API key")
+		return
+	}
+	allow := func() bool { return limiter.Allow(clientKey, time.Now()) }
+	s.mcpServer(r, limits, allow).ServeHTTP(w, r)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatMini is a compact profile for shell prompts and status lines: a
+// 40x10 world without frame or margins. Options set in the request still
+// win over the profile.
+const (
+	formatMini     = "mini"
+	miniWidth      = 40
+	miniCharAspect = 2.0
+)
+
+// miniDefaults replaces the server defaults of req with the mini profile
+// when body asks for format mini.
+func miniDefaults(body []byte, req generateRequest) generateRequest {
+	var peek struct {
+		Format string `json:"format"`
+	}
+	if json.Unmarshal(body, &peek) != nil || !strings.EqualFold(strings.TrimSpace(peek.Format), formatMini) {
+		return req
+	}
+	req.Width = miniWidth
+	req.CharAspect = miniCharAspect
+	req.Margin = 0
+	req.Frame = false
+	return req
+}
+
+// handleMini serves the mini profile as plain text for
+// `curl host/api/mini?place=Oslo`, with ANSI colors for command-line
+// clients like GET /. The marker comes from place or lon and lat, and
+// label, style, continent, theme, width and color work as in a generate
+// request.
+func (s *server) handleMini(w http.ResponseWriter, r *http.Request) {
+	if !s.admitDuringMaintenance(w, true) {
+		return
+	}
+	limiter, clientKey, limits, ok := s.resolveClient(r)
+	if !ok {
+		http.Error(w, "invalid API key", http.StatusUnauthorized)
+		return
+	}
+	if !limiter.Allow(clientKey, time.Now()) {
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	query := r.URL.Query()
+	color := isTerminalClient(r.UserAgent())
+	if raw := query.Get("color"); raw != "" {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			http.Error(w, "color must be 0 or 1", http.StatusBadRequest)
+			return
+		}
+		color = value
+	}
+
+	body, err := miniQueryRequest(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req, err := parseGenerateRequest(body, limits, s.presetSet())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := s.generate(r, req, limits, nil)
+	if err != nil {
+		http.Error(w, err.Error(), generateStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if query.Get("color") == "" {
+		// The color default comes from the User-Agent.
+		w.Header().Add("Vary", "User-Agent")
+	}
+	if color {
+		_, _ = w.Write([]byte(resp.ANSI))
+	} else {
+		_, _ = w.Write([]byte(resp.Plain))
+	}
+}
+
+// miniQueryRequest turns the /api/mini query into a generate request body.
+func miniQueryRequest(query url.Values) ([]byte, error) {
+	get := func(name string) string {
+		return strings.TrimSpace(query.Get(name))
+	}
+
+	request := map[string]any{"format": formatMini}
+	for _, name := range []string{"continent", "theme"} {
+		if value := get(name); value != "" {
+			request[name] = value
+		}
+	}
+	if raw := get("width"); raw != "" {
+		width, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("width must be an integer")
+		}
+		request["width"] = width
+	}
+
+	marker := map[string]any{"label": get("label"), "style": get("style")}
+	switch rawLon, rawLat, place := get("lon"), get("lat"), get("place"); {
+	case place != "":
+		if rawLon != "" || rawLat != "" {
+			return nil, fmt.Errorf("place cannot be combined with lon and lat")
+		}
+		marker["place"] = place
+	case rawLon != "" || rawLat != "":
+		lon, errLon := strconv.ParseFloat(rawLon, 64)
+		lat, errLat := strconv.ParseFloat(rawLat, 64)
+		if errLon != nil || errLat != nil || !isFinite(lon) || !isFinite(lat) {
+			return nil, fmt.Errorf("lon and lat must both be numbers")
+		}
+		marker["lon"], marker["lat"] = lon, lat
+	default:
+		marker = nil
+	}
+	if marker != nil {
+		marker["enabled"] = true
+		request["marker"] = marker
+	}
+	return json.Marshal(request)
+}
@@ -0,0 +1,821 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	mapascii "github.com/Kivayan/map-ascii"
+
+	"map-ascii-generator/api/internal/jobs"
+	"map-ascii-generator/api/internal/openapi"
+	"map-ascii-generator/api/internal/render"
+	"map-ascii-generator/api/internal/weather"
+)
+
+const apiVersion = "1.0.0"
+
+func (s *server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	doc, err := s.openAPIDocument()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// checkSchemas builds the OpenAPI document and the MCP tool schemas once at
+// startup, so that a description naming a field that no longer exists
+// stops the server instead of failing requests.
+func (s *server) checkSchemas() error {
+	_, err := s.openAPIDocument()
+	errs := []error{err}
+	for _, tool := range s.mcpServer(&http.Request{Header: http.Header{}}, s.config(), nil).Tools {
+		if schema, ok := tool.InputSchema.(*openapi.Schema); ok {
+			errs = append(errs, schema.Err())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// generateRequestSchema describes the generate request body with the
+// limits and defaults of cfg.
+func generateRequestSchema(cfg config) *openapi.Schema {
+	generateReq := openapi.SchemaOf(reflect.TypeOf(generateRequest{})).Optional()
+	generateReq.SetDefaults(defaultGenerateRequest(cfg))
+	generateReq.Property("width").Range(float64(cfg.minWidth), float64(cfg.maxWidth))
+	generateReq.Property("supersample").Range(float64(cfg.minSupersample), float64(cfg.maxSupersample))
+	generateReq.Property("margin").Range(0, float64(cfg.maxMargin))
+	generateReq.Property("char_aspect").Range(cfg.minCharAspect, cfg.maxCharAspect)
+	generateReq.Property("continent").
+		EnumStrings(append([]string{"", "world"}, mapascii.ContinentNames()...)).
+		Describe("Empty or \"world\" renders the full world.")
+	generateReq.Property("format").
+		EnumStrings(append([]string{""}, outputFormats...)).
+		Describe("discord adds message, the map in a code block that fits Discord's 2000 characters; the width is lowered if needed. mini defaults to a 40x10 map without frame or margins and allows only marker, not markers. grid adds grid, one array per row of {char, fg, bg, attrs} per terminal column.")
+	generateReq.Property("lines").Describe("Add lines, the rows of plain as an array of strings.")
+	generateReq.Property("cells").Describe("Add cells, one array per row of {char, color} per terminal column, color holding the SGR parameters of the ansi output.")
+	generateReq.Property("preset").
+		Describe("Named preset (see /api/presets) whose request this one's fields are merged over.")
+	generateReq.Property("theme").
+		EnumStrings(append([]string{""}, themeNames()...)).
+		Describe("Named color preset (see /api/themes). Explicit color fields override it.")
+	generateReq.Property("central_meridian").
+		Range(-180, 180).
+		Describe("Longitude at the center of the world map, e.g. 150 for a Pacific-centered view. Not allowed with continent.")
+	generateReq.Property("projection").
+		EnumStrings(render.Projections()).
+		Describe("orthographic renders a globe centered on center (or the marker with center_on_marker); not allowed with continent or central_meridian.")
+	generateReq.Property("center", "lon").Range(-180, 180)
+	generateReq.Property("center", "lat").Range(-90, 90)
+	generateReq.Property("center_on_marker").Describe("Center the orthographic globe on the marker; requires marker.enabled.")
+	generateReq.Property("frame_style").
+		EnumStrings(append([]string{""}, render.FrameStyles()...)).
+		Describe("Border characters of the frame (default ascii); single, double and rounded use box-drawing characters. Requires frame.")
+	generateReq.Property("title").
+		Length(0, maxTextLength).
+		Describe("Text centered in the top frame border, cut to fit the width. Requires frame; non-ASCII needs allow_unicode.")
+	generateReq.Property("footer").
+		Length(0, maxTextLength).
+		Describe("Line of text under the map, inside the frame when framed; cut to the map width. Non-ASCII needs allow_unicode.")
+	generateReq.Property("footer_align").EnumStrings(append([]string{""}, render.Aligns()...)).Describe("Footer alignment (default left).")
+	generateReq.Property("charset").
+		EnumStrings(render.Charsets()).
+		Describe("ascii maps land coverage to a density ramp; braille packs 2x4 dots per character; blocks uses half-block characters for two rows per character.")
+	generateReq.Property("ramp").
+		Length(0, maxRampLength).
+		Describe(fmt.Sprintf("Density ramp from ocean to full land, e.g. \" .:-=+*#%%@\" (%d-%d characters, ascii charset only).", minRampLength, maxRampLength))
+	generateReq.Property("ocean_char").
+		Length(0, 1).
+		Describe("Character for ocean cells inside the map area; empty keeps spaces.")
+	generateReq.Property("sea_level_offset_m").
+		Range(-maxSeaLevelOffset, maxSeaLevelOffset).
+		Describe("Raise (or with a negative value lower) the sea by this many meters using the elevation grid; 0 keeps today's coastline.")
+	generateReq.Property("terrain").Describe("Shade land by elevation from the measured model embedded by the build or set with data.elevation_file; rejected without one. Not allowed with weather.variable.")
+	generateReq.Property("terrain_ramp").
+		Length(0, maxRampLength).
+		Describe("Terrain characters from sea level to 6000 m (default \":-=+*#%@\"); in truecolor mode an empty ramp keeps the land characters and colors them along a gradient.")
+	generateReq.Property("terrain_legend").Describe("Add a legend row for the terrain levels.")
+	generateReq.Property("layer").
+		EnumStrings(append([]string{""}, shadeLayers...)).
+		Describe("Shade land from a measured grid: population by density in people per km², from the grid embedded by the build or data.population_file; rejected without one. Not allowed with terrain or weather.variable.")
+	generateReq.Property("population", "ramp").
+		Length(0, maxRampLength).
+		Describe("Characters from under 1 to over 1500 people per km² on a log scale (default \":-=+*#%@\").")
+	generateReq.Property("population", "legend").Describe("Add a legend row for the population levels.")
+	generateReq.Property("mask").Describe("Land mask to draw, as listed by /api/options; empty or \"default\" uses the built-in mask.")
+	generateReq.Property("allow_unicode").Describe("Allow non-ASCII characters in ramp, ocean_char, border_char, highlight_char, graticule characters, title, footer and marker characters and labels.")
+	generateReq.Property("marker", "lon").Range(-180, 180)
+	generateReq.Property("marker", "lat").Range(-90, 90).Describe("Must lie inside the continent viewport when a continent is selected.")
+	generateReq.Property("marker", "arm_x").Describe("-1 draws the arm across the whole map.").Minimum = floatPtr(-1)
+	generateReq.Property("marker", "arm_y").Describe("-1 draws the arm across the whole map.").Minimum = floatPtr(-1)
+	for _, name := range []string{"horizontal", "vertical"} {
+		generateReq.Property("marker", name).Length(0, 1).Describe("Single ASCII character, or any single-width character with allow_unicode; empty uses the default.")
+	}
+	generateReq.Property("marker", "center").Describe("Single ASCII character; with allow_unicode also a double-width character or emoji, which takes two columns.")
+	generateReq.Property("marker", "style").
+		EnumStrings(append([]string{""}, render.MarkerStyles()...)).
+		Describe(fmt.Sprintf("Marker shape (default crosshair); arm_x and arm_y only apply to crosshair, and numbered draws (1) to (%d) for up to %d markers.", render.MaxNumberedMarkers, render.MaxNumberedMarkers))
+	generateReq.Property("markers").Describe(fmt.Sprintf("Additional markers (at most %d) drawn with the style and characters of marker; marker.enabled is not required.", maxMarkers))
+	placeDescription := fmt.Sprintf("City name resolved with the gazetteer (see /api/geocode), optionally followed by \", CC\"; overrides lon and lat. At most %d bytes.", maxPlaceLength)
+	generateReq.Property("marker", "place").Describe(placeDescription)
+	generateReq.Property("markers").Item().Property("place").Describe(placeDescription)
+	generateReq.Property("distances", "annotate").Describe(fmt.Sprintf("Draw the great circle between every pair of markers with its distance at the midpoint (at most %d markers).", maxAnnotatedMarkers))
+	generateReq.Property("distances", "char").Length(0, 1).Describe("Single character for annotated paths (default -); non-ASCII requires allow_unicode.")
+	generateReq.Property("distances", "unit").EnumStrings(distanceUnits).Describe("Unit of the annotation labels (default km); meta.distances always has all three.")
+	generateReq.Property("marker", "use_client_ip").Describe("Place the marker at the caller's location from the GeoIP database (data.geoip_file); cannot be combined with place.")
+	generateReq.Property("iss", "enabled").Describe("Draw the International Space Station at its live position, or one propagated from its orbital elements when the feed is unreachable.")
+	generateReq.Property("iss", "glyph").Describe("ISS character (default X); with allow_unicode also a double-width character or emoji.")
+	generateReq.Property("iss", "track").Describe("Draw the ground track for the next track_minutes, propagated from the orbital elements.")
+	generateReq.Property("iss", "track_char").Length(0, 1).Describe("Character for the ground track (default ~).")
+	generateReq.Property("iss", "track_minutes").Range(1, maxISSTrackMinutes).Describe(fmt.Sprintf("Length of the ground track (default %d, about one orbit).", defaultISSTrackMinutes))
+	generateReq.Property("satellite", "tle").Length(0, maxTLELength).Describe("Two-line element set (optionally with a name line) of a near-Earth satellite whose ground track is drawn.")
+	generateReq.Property("satellite", "start").Describe("RFC 3339 start of the ground track; empty uses the current time.")
+	generateReq.Property("satellite", "minutes").Range(1, maxSatelliteMinutes).Describe(fmt.Sprintf("Length of the ground track (default %d).", defaultSatelliteMinutes))
+	generateReq.Property("satellite", "track_char").Length(0, 1).Describe("Character for the ground track (default ~).")
+	generateReq.Property("satellite", "tick_minutes").Describe(fmt.Sprintf("Minutes between time ticks (default %d); 0 draws none. At most %d ticks.", defaultSatelliteTickMinutes, maxSatelliteTicks)).Minimum = floatPtr(0)
+	generateReq.Property("satellite", "tick_char").Describe("Character for time ticks (default +); with allow_unicode also a double-width character or emoji.")
+	generateReq.Property("satellite", "tick_labels").Describe("Label each tick with its UTC time as HH:MM.")
+	generateReq.Property("celestial", "sun").Describe("Mark the subsolar point, where the Sun is overhead.")
+	generateReq.Property("celestial", "moon").Describe("Mark the sublunar point, where the Moon is overhead.")
+	generateReq.Property("celestial", "time").Describe("RFC 3339 time to compute the sun and moon for; empty uses the time of the request.")
+	generateReq.Property("celestial", "sun_glyph").Describe("Sun character (default S); with allow_unicode also a double-width character or emoji.")
+	generateReq.Property("celestial", "moon_glyph").Describe("Moon character (default M); with allow_unicode also a double-width character or emoji.")
+	generateReq.Property("routes").Describe(fmt.Sprintf("Flight routes drawn as great circles between airports, e.g. {\"from\": \"WAW\", \"to\": \"JFK\"} (at most %d).", maxRoutes))
+	generateReq.Property("route", "char").Length(0, 1).Describe("Single character for route paths (default =); non-ASCII requires allow_unicode.")
+	generateReq.Property("route", "endpoint_char").Describe("Airport character (default o); with allow_unicode also a double-width character or emoji.")
+	generateReq.Property("route", "labels").Describe("Label airports with their IATA code (default true).")
+	generateReq.Property("earthquakes", "enabled").Describe("Plot recent earthquakes from the USGS feed (cached on the server).")
+	generateReq.Property("earthquakes", "period").EnumStrings(earthquakePeriods).Describe("How far back to include earthquakes (default day).")
+	generateReq.Property("earthquakes", "min_magnitude").Range(-1, 10).Describe("Smallest magnitude to plot (default 2.5).")
+	generateReq.Property("earthquakes", "chars").Length(0, maxRampLength).Describe("Characters per whole magnitude from min_magnitude up; empty draws the magnitude digit.")
+	generateReq.Property("weather", "variable").EnumStrings(append([]string{""}, weather.Variables()...)).Describe("Shade land by current weather from the configured source; empty disables.")
+	generateReq.Property("weather", "ramp").Length(0, maxRampLength).Describe(fmt.Sprintf("Characters from the lowest to the highest level (default %s); empty with weather_colors keeps the land characters.", defaultWeatherRamp))
+	generateReq.Property("weather", "min").Describe("Value of the first level (default -30 for temperature, 0 for cloud_cover).")
+	generateReq.Property("weather", "max").Describe("Value of the last level (default 40 for temperature, 100 for cloud_cover).")
+	generateReq.Property("weather", "legend").Describe("Add a legend row with each level's range below the map.")
+	generateReq.Property("color", "weather_colors").Describe(fmt.Sprintf("Colors for weather levels from low to high (at most %d).", maxRampLength))
+	generateReq.Property("marker", "snap_to_land").Describe("Move markers on ocean cells to the nearest land cell within a few columns.")
+	generateReq.Property("marker", "label").
+		Length(0, maxLabelLength).
+		Describe("Text written next to the marker center, moved to the other side near the map edges.")
+	generateReq.Property("marker", "local_time").Describe("Append the current local time (HH:MM) at each marker to its label.")
+	generateReq.Property("graticule", "interval").
+		Range(minGraticuleInterval, maxGraticuleInterval).
+		Describe("Spacing in degrees between latitude/longitude lines.")
+	generateReq.Property("graticule", "over_land").Describe("Draw lines over land too; by default only ocean cells are replaced.")
+	for _, name := range []string{"lon_char", "lat_char", "cross_char"} {
+		generateReq.Property("graticule", name).Length(0, 1).Describe("Single character; non-ASCII requires allow_unicode.")
+	}
+	generateReq.Property("color", "mode").EnumStrings(colorModes)
+	generateReq.Property("color", "graticule_color").Describe("Color for graticule lines; empty uses map_color.")
+	generateReq.Property("borders").Describe("Draw country borders from a coarse embedded dataset (or data.countries_file).")
+	generateReq.Property("border_char").Length(0, 1).Describe("Single character for borders (default +); non-ASCII requires allow_unicode.")
+	generateReq.Property("color", "border_color").Describe("Color for country borders and timezone lines; empty uses map_color.")
+	generateReq.Property("timezones", "enabled").Describe("Draw lines between areas with different UTC offsets right now (embedded dataset or data.timezones_file).")
+	generateReq.Property("timezones", "char").Length(0, 1).Describe("Single character for timezone lines (default |); non-ASCII requires allow_unicode.")
+	generateReq.Property("highlight_countries").Describe("ISO 3166-1 alpha-2 codes of countries to highlight (see /api/countries).")
+	generateReq.Property("highlight_char").Length(0, 1).Describe("Fill character for highlighted countries; empty keeps the land characters and only changes the color.")
+	generateReq.Property("geojson").Describe(fmt.Sprintf("GeoJSON FeatureCollection, Feature or geometry to draw on the map (at most %d bytes). May also be sent as a multipart/form-data file part named geojson.", cfg.maxGeoJSONBytes))
+	generateReq.Property("overlay", "point_char").Length(0, 1).Describe("Character for Point geometries (default o).")
+	generateReq.Property("overlay", "line_char").Length(0, 1).Describe("Character for lines and polygon outlines (default *).")
+	generateReq.Property("overlay", "fill_char").Length(0, 1).Describe("Fill character for polygon interiors; empty draws outlines only.")
+	generateReq.Property("overlay", "start_char").Length(0, 1).Describe("Marks the first line vertex when set (default S for GPX uploads).")
+	generateReq.Property("overlay", "end_char").Length(0, 1).Describe("Marks the last line vertex when set (default E for GPX uploads).")
+	generateReq.Property("points").Describe("[lon, lat] pairs drawn as a density layer. May also be sent as a CSV file part named points.")
+	generateReq.Property("density", "ramp").Length(0, maxRampLength).Describe("Characters from sparse to dense cells (default oO@).")
+	generateReq.Property("density", "threshold").Describe("Minimum number of points for a cell to be drawn.").Minimum = floatPtr(1)
+	generateReq.Property("density", "scale").EnumStrings(append([]string{""}, render.Scales()...)).Describe("Bucket spacing of the cell counts (default log).")
+	generateReq.Property("density", "legend").Describe("Add a legend row with each level's count range below the map.")
+	generateReq.Property("color", "density_colors").Describe(fmt.Sprintf("Colors for density levels from sparse to dense (at most %d); empty uses overlay_color.", maxRampLength))
+	generateReq.Property("color", "footer_color").Describe("Color for the footer text; empty uses frame_color.")
+	generateReq.Property("color", "overlay_color").Describe("Color for the GeoJSON overlay; empty uses marker_color.")
+	generateReq.Property("choropleth", "values").Describe("Numeric value per ISO 3166-1 alpha-2 country code.")
+	generateReq.Property("choropleth", "ramp").Length(0, maxRampLength).Describe("Characters from the lowest to the highest bucket (default :-=+%); empty with choropleth_colors keeps the land characters.")
+	generateReq.Property("choropleth", "scale").EnumStrings(append([]string{""}, render.Scales()...)).Describe("Bucket spacing (default linear); log requires positive values and quantile puts about as many countries in each bucket.")
+	generateReq.Property("choropleth", "legend").Describe("Add a legend row with each bucket's range below the map.")
+	generateReq.Property("color", "choropleth_colors").Describe(fmt.Sprintf("Colors for choropleth buckets from low to high (at most %d).", maxRampLength))
+	generateReq.Property("color", "highlight_color").Describe("Color for highlighted countries; empty uses map_color.")
+	for _, name := range []string{"map_bg", "ocean_bg", "frame_bg"} {
+		generateReq.Property("color", name).Describe("Background color for land cells, water cells or the frame border; same values as map_color, empty for none.")
+	}
+	for _, name := range []string{"marker_attrs", "label_attrs", "frame_attrs"} {
+		generateReq.Property("color", name).Describe("Text attributes for marker glyphs, marker labels or the frame border: " + strings.Join(render.AttrNames(), ", ") + ".")
+	}
+	generateReq.Property("color", "map_gradient").
+		EnumStrings(append([]string{""}, mapGradientNames()...)).
+		Describe("Named gradient coloring land by latitude; requires mode truecolor.")
+	generateReq.Property("color", "map_gradient_stops").Describe(fmt.Sprintf("2 to %d hex colors spread from the north to the south pole; requires mode truecolor and cannot be combined with map_gradient.", maxRampLength))
+	for _, name := range []string{"map_color", "frame_color", "marker_color"} {
+		generateReq.Property("color", name).Describe("ANSI 16 color name (see /api/colors), or a #rrggbb hex color when mode is ansi256 or truecolor.")
+	}
+	return generateReq
+}
+
+func (s *server) openAPIDocument() (map[string]any, error) {
+	cfg := s.config()
+
+	jobResp := openapi.SchemaOf(reflect.TypeOf(jobResponse{}))
+	jobResp.Property("status").EnumStrings([]string{string(jobs.StatusQueued), string(jobs.StatusRunning), string(jobs.StatusDone), string(jobs.StatusFailed)})
+	jobResp.Property("result").Describe("Set once done: {\"frames\": [GenerateResponse, ...]}, one per requested frame.")
+
+	generateReq := generateRequestSchema(cfg)
+	errorResp := openapi.SchemaOf(reflect.TypeOf(problem{}))
+	errorResp.Property("type").Describe("Always about:blank; title is the HTTP status text.")
+	errorResp.Property("invalid-params").Describe("Request fields at fault, named by JSON pointer such as /marker/lat. A failed validation lists every invalid field.")
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "ASCII World Map Generator API",
+			"version": apiVersion,
+		},
+		// The paths below are relative to base_path.
+		"servers": []any{
+			map[string]any{"url": cmp.Or(cfg.basePath, "/")},
+		},
+		"paths": map[string]any{
+			"/api/generate": map[string]any{
+				"post": map[string]any{
+					"summary": "Render an ASCII world map",
+					"description": fmt.Sprintf(
+						"Rate limited to %d requests per %s per client. Request bodies are capped at %d bytes. API keys may carry tier-specific limits.",
+						cfg.rateLimit, cfg.rateWindow, cfg.maxBodyBytes,
+					),
+					"security": []any{
+						map[string]any{},
+						map[string]any{"apiKey": []string{}},
+						map[string]any{"bearer": []string{}},
+					},
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{"schema": openapi.Ref("GenerateRequest")},
+							"multipart/form-data": map[string]any{
+								"schema": &openapi.Schema{
+									Type: "object",
+									Properties: map[string]*openapi.Schema{
+										"options": {Type: "string", Description: "GenerateRequest as JSON."},
+										"geojson": {Type: "string", Format: "binary", Description: "GeoJSON file for the overlay."},
+										"points":  {Type: "string", Format: "binary", Description: "CSV file of lon/lat points for the density layer."},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"200": jsonResponse("Rendered map", openapi.Ref("GenerateResponse")),
+						"400": errorResponseSpec("Invalid request"),
+						"401": errorResponseSpec("Invalid API key"),
+						"405": errorResponseSpec("Method not allowed"),
+						"429": errorResponseSpec("Rate limit exceeded"),
+						"503": errorResponseSpec("ISS position unavailable"),
+						"504": errorResponseSpec("Render took longer than limits.render_timeout"),
+					},
+				},
+			},
+			"/api/generate/gpx": map[string]any{
+				"post": map[string]any{
+					"summary":     "Render a GPX track",
+					"description": fmt.Sprintf("Plots tracks and routes as lines and waypoints as points. The GPX file is capped at %d bytes. Rate limited like /api/generate.", cfg.maxGeoJSONBytes),
+					"security": []any{
+						map[string]any{},
+						map[string]any{"apiKey": []string{}},
+						map[string]any{"bearer": []string{}},
+					},
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/gpx+xml": map[string]any{"schema": &openapi.Schema{Type: "string", Format: "binary"}},
+							"multipart/form-data": map[string]any{
+								"schema": &openapi.Schema{
+									Type: "object",
+									Properties: map[string]*openapi.Schema{
+										"options": {Type: "string", Description: "GenerateRequest as JSON."},
+										"gpx":     {Type: "string", Format: "binary", Description: "GPX file."},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"200": jsonResponse("Rendered map", openapi.Ref("GenerateResponse")),
+						"400": errorResponseSpec("Invalid request or GPX file"),
+						"401": errorResponseSpec("Invalid API key"),
+						"405": errorResponseSpec("Method not allowed"),
+						"429": errorResponseSpec("Rate limit exceeded"),
+						"503": errorResponseSpec("ISS position unavailable"),
+						"504": errorResponseSpec("Render took longer than limits.render_timeout"),
+					},
+				},
+			},
+			"/api/colors": map[string]any{
+				"get": map[string]any{
+					"summary": "Supported colors and color modes",
+					"responses": map[string]any{
+						"200": jsonResponse("Color capabilities", openapi.Ref("ColorsResponse")),
+					},
+				},
+			},
+			"/api/themes": map[string]any{
+				"get": map[string]any{
+					"summary": "Named color themes",
+					"responses": map[string]any{
+						"200": jsonResponse("Available themes", openapi.Ref("ThemesResponse")),
+					},
+				},
+			},
+			"/api/plot-ip": map[string]any{
+				"post": map[string]any{
+					"summary":     "Render the location of an IP address or hostname",
+					"description": fmt.Sprintf("Resolves target (hostnames via DNS, %s timeout), looks it up in the GeoIP database (data.geoip_file) and renders a map with the marker there, labelled with target unless options.marker.label is set. Rate limited like /api/generate.", resolveTimeout),
+					"security": []any{
+						map[string]any{},
+						map[string]any{"apiKey": []string{}},
+						map[string]any{"bearer": []string{}},
+					},
+					"requestBody": map[string]any{
+						"required": true,
+						"content": jsonContent(&openapi.Schema{
+							Type: "object",
+							Properties: map[string]*openapi.Schema{
+								"target":  {Type: "string", Description: "IPv4/IPv6 address or hostname."},
+								"options": openapi.Ref("GenerateRequest"),
+							},
+							Required: []string{"target"},
+						}),
+					},
+					"responses": map[string]any{
+						"200": jsonResponse("Rendered map and resolved target", openapi.Ref("PlotIPResponse")),
+						"400": errorResponseSpec("Invalid request or unresolvable hostname"),
+						"401": errorResponseSpec("Invalid API key"),
+						"405": errorResponseSpec("Method not allowed"),
+						"422": errorResponseSpec("No location for the address"),
+						"429": errorResponseSpec("Rate limit exceeded"),
+						"503": errorResponseSpec("ISS position unavailable"),
+						"504": errorResponseSpec("Render took longer than limits.render_timeout"),
+						"501": errorResponseSpec("GeoIP database not configured"),
+					},
+				},
+			},
+			"/api/traceroute": map[string]any{
+				"post": map[string]any{
+					"summary":     "Render a traceroute path",
+					"description": fmt.Sprintf("Geolocates up to %d hop addresses with the GeoIP database, joins the located hops with lines and marks each distinct location with a numbered marker (the first %d; other styles up to %d). Rate limited like /api/generate.", maxTracerouteHops, render.MaxNumberedMarkers, maxMarkers),
+					"security": []any{
+						map[string]any{},
+						map[string]any{"apiKey": []string{}},
+						map[string]any{"bearer": []string{}},
+					},
+					"requestBody": map[string]any{
+						"required": true,
+						"content": jsonContent(&openapi.Schema{
+							Type: "object",
+							Properties: map[string]*openapi.Schema{
+								"hops":    {Type: "array", Items: &openapi.Schema{Type: "string"}, Description: "Hop IP addresses in order; \"*\" or \"\" for hops that did not answer."},
+								"options": openapi.Ref("GenerateRequest"),
+							},
+							Required: []string{"hops"},
+						}),
+					},
+					"responses": map[string]any{
+						"200": jsonResponse("Rendered path and per-hop locations", openapi.Ref("TracerouteResponse")),
+						"400": errorResponseSpec("Invalid request"),
+						"401": errorResponseSpec("Invalid API key"),
+						"405": errorResponseSpec("Method not allowed"),
+						"422": errorResponseSpec("No hop could be located"),
+						"429": errorResponseSpec("Rate limit exceeded"),
+						"503": errorResponseSpec("ISS position unavailable"),
+						"504": errorResponseSpec("Render took longer than limits.render_timeout"),
+						"501": errorResponseSpec("GeoIP database not configured"),
+					},
+				},
+			},
+			"/api/countries": map[string]any{
+				"get": map[string]any{
+					"summary": "Countries available for highlighting",
+					"responses": map[string]any{
+						"200": jsonResponse("Country codes and names", openapi.Ref("CountriesResponse")),
+					},
+				},
+			},
+			"/api/geocode": map[string]any{
+				"get": map[string]any{
+					"summary":     "Look up city coordinates",
+					"description": "Searches the offline gazetteer by city name, most populous first. Exact names win over prefix matches; a trailing \", CC\" restricts results to one country.",
+					"parameters": []any{
+						map[string]any{"name": "q", "in": "query", "required": true, "schema": map[string]any{"type": "string", "maxLength": maxPlaceLength}},
+						map[string]any{"name": "limit", "in": "query", "schema": map[string]any{"type": "integer", "minimum": 1, "maximum": maxGeocodeLimit, "default": defaultGeocodeLimit}},
+					},
+					"responses": map[string]any{
+						"200": jsonResponse("Matching cities", openapi.Ref("GeocodeResponse")),
+						"400": errorResponseSpec("Missing or invalid query"),
+					},
+				},
+			},
+			"/api/locate": map[string]any{
+				"get": map[string]any{
+					"summary":     "Country at a coordinate",
+					"description": "Looks up the country and continent containing lon/lat in the border dataset. Country fields are omitted at sea.",
+					"parameters": []any{
+						map[string]any{"name": "lon", "in": "query", "required": true, "schema": map[string]any{"type": "number", "minimum": -180, "maximum": 180}},
+						map[string]any{"name": "lat", "in": "query", "required": true, "schema": map[string]any{"type": "number", "minimum": -90, "maximum": 90}},
+					},
+					"responses": map[string]any{
+						"200": jsonResponse("Containing country", openapi.Ref("LocateResponse")),
+						"400": errorResponseSpec("Missing or out-of-range coordinates"),
+					},
+				},
+			},
+			"/api/limits": map[string]any{
+				"get": map[string]any{
+					"summary":     "Effective request limits",
+					"description": "Limits for the caller, including API key tier overrides.",
+					"security": []any{
+						map[string]any{},
+						map[string]any{"apiKey": []string{}},
+						map[string]any{"bearer": []string{}},
+					},
+					"responses": map[string]any{
+						"200": jsonResponse("Configured limits", openapi.Ref("LimitsResponse")),
+						"401": errorResponseSpec("Invalid API key"),
+					},
+				},
+			},
+			"/api/quota": map[string]any{
+				"get": map[string]any{
+					"summary":     "Remaining rate-limit allowance",
+					"description": "Requests the caller has left in its current rate window and when the window resets. Asking does not count against the quota.",
+					"security": []any{
+						map[string]any{},
+						map[string]any{"apiKey": []string{}},
+						map[string]any{"bearer": []string{}},
+					},
+					"responses": map[string]any{
+						"200": jsonResponse("Current quota", openapi.Ref("QuotaResponse")),
+						"401": errorResponseSpec("Invalid API key"),
+					},
+				},
+			},
+			"/api/options": map[string]any{
+				"get": map[string]any{
+					"summary": "List selectable options",
+					"responses": map[string]any{
+						"200": jsonResponse("Available options", openapi.Ref("OptionsResponse")),
+					},
+				},
+			},
+			"/api/share": map[string]any{
+				"post": map[string]any{
+					"summary":     "Render a map behind a share link",
+					"description": fmt.Sprintf("Renders a generate request like /api/generate and keeps the result at a short signed /r/{token} link for %s, or for the shorter ttl. The link does not reveal the request.", cfg.shareTTL),
+					"security": []any{
+						map[string]any{},
+						map[string]any{"apiKey": []string{}},
+						map[string]any{"bearer": []string{}},
+					},
+					"parameters": []any{
+						map[string]any{"name": "ttl", "in": "query", "description": "How long the link works, as a duration such as 1h.", "schema": map[string]any{"type": "string", "default": cfg.shareTTL.String()}},
+					},
+					"requestBody": map[string]any{
+						"required": true,
+						"content":  jsonContent(openapi.Ref("GenerateRequest")),
+					},
+					"responses": map[string]any{
+						"201": jsonResponse("Share link created", openapi.Ref("ShareResponse")),
+						"400": errorResponseSpec("Invalid request or ttl"),
+						"401": errorResponseSpec("Invalid API key"),
+						"429": errorResponseSpec("Rate limit exceeded"),
+						"503": errorResponseSpec("A live data source is unavailable"),
+					},
+				},
+			},
+			"/r/{token}": map[string]any{
+				"get": map[string]any{
+					"summary":     "Shared map",
+					"description": "The map behind a share link, as text with ANSI colors for curl, wget and HTTPie unless color overrides it, or as a GenerateResponse to clients that accept application/json.",
+					"parameters": []any{
+						map[string]any{"name": "token", "in": "path", "required": true, "schema": map[string]any{"type": "string"}},
+						map[string]any{"name": "color", "in": "query", "schema": map[string]any{"type": "boolean"}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{"description": "Shared map", "content": map[string]any{
+							"text/plain":       map[string]any{"schema": &openapi.Schema{Type: "string"}},
+							"application/json": map[string]any{"schema": openapi.Ref("GenerateResponse")},
+						}},
+						"404": textResponse("Unknown or forged link"),
+						"410": textResponse("Expired link"),
+					},
+				},
+			},
+			"/api/history": map[string]any{
+				"get": map[string]any{
+					"summary":     "Recent renders of the caller",
+					"description": fmt.Sprintf("Renders made with the caller's API key or token through /api/generate, /api/generate/gpx and /api/share, newest first: when, the request hash, its meta and the request, without the map. Up to %d are kept per caller; history.enabled must be set.", cfg.historyMaxEntries),
+					"security": []any{
+						map[string]any{"apiKey": []string{}},
+						map[string]any{"bearer": []string{}},
+					},
+					"parameters": []any{
+						map[string]any{"name": "limit", "in": "query", "schema": map[string]any{"type": "integer", "minimum": 1, "default": cfg.historyMaxEntries}},
+					},
+					"responses": map[string]any{
+						"200": jsonResponse("Recent renders", openapi.Ref("HistoryResponse")),
+						"400": errorResponseSpec("Invalid limit"),
+						"401": errorResponseSpec("Missing or invalid API key"),
+						"404": errorResponseSpec("History is disabled"),
+					},
+				},
+			},
+			"/api/history/{id}/render": map[string]any{
+				"post": map[string]any{
+					"summary":     "Render a request from the history again",
+					"description": "Renders the stored request with the caller's current limits and answers like /api/generate. Counts against the rate limit.",
+					"security": []any{
+						map[string]any{"apiKey": []string{}},
+						map[string]any{"bearer": []string{}},
+					},
+					"parameters": []any{
+						map[string]any{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "string"}},
+					},
+					"responses": map[string]any{
+						"200": jsonResponse("Rendered map", openapi.Ref("GenerateResponse")),
+						"400": errorResponseSpec("The request is no longer valid"),
+						"401": errorResponseSpec("Missing or invalid API key"),
+						"404": errorResponseSpec("Unknown render or history disabled"),
+						"409": errorResponseSpec("The render used an upload"),
+						"429": errorResponseSpec("Rate limit exceeded"),
+					},
+				},
+			},
+			"/api/jobs": map[string]any{
+				"post": map[string]any{
+					"summary":     "Queue an asynchronous render",
+					"description": fmt.Sprintf("Validates 1 to %d frames, each a generate request, and renders them in the background. Every frame counts against the rate limit; poll the job at the Location header.", maxJobFrames),
+					"security": []any{
+						map[string]any{},
+						map[string]any{"apiKey": []string{}},
+						map[string]any{"bearer": []string{}},
+					},
+					"requestBody": map[string]any{
+						"required": true,
+						"content": jsonContent(&openapi.Schema{
+							Type: "object",
+							Properties: map[string]*openapi.Schema{
+								"frames": {Type: "array", Items: openapi.Ref("GenerateRequest")},
+							},
+							Required: []string{"frames"},
+						}),
+					},
+					"responses": map[string]any{
+						"202": jsonResponse("Job queued", openapi.Ref("JobResponse")),
+						"400": errorResponseSpec("Invalid request"),
+						"401": errorResponseSpec("Invalid API key"),
+						"405": errorResponseSpec("Method not allowed"),
+						"429": errorResponseSpec("Rate limit exceeded"),
+						"503": errorResponseSpec("Job queue is full"),
+					},
+				},
+			},
+			"/api/jobs/{id}": map[string]any{
+				"get": map[string]any{
+					"summary":     "Job status and result",
+					"description": "Finished jobs are kept for the configured jobs.ttl.",
+					"parameters": []any{
+						map[string]any{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "string"}},
+					},
+					"responses": map[string]any{
+						"200": jsonResponse("Job", openapi.Ref("JobResponse")),
+						"404": errorResponseSpec("Unknown or expired job"),
+					},
+				},
+			},
+			"/api/presets": map[string]any{
+				"get": map[string]any{
+					"summary": "List render presets",
+					"responses": map[string]any{
+						"200": jsonResponse("Stored presets", openapi.Ref("PresetsResponse")),
+					},
+				},
+			},
+			"/api/presets/{name}": map[string]any{
+				"parameters": []any{
+					map[string]any{"name": "name", "in": "path", "required": true, "schema": map[string]any{"type": "string", "pattern": presetNamePattern.String()}},
+				},
+				"get": map[string]any{
+					"summary": "Get a render preset",
+					"responses": map[string]any{
+						"200": jsonResponse("Preset", openapi.Ref("PresetResponse")),
+						"404": errorResponseSpec("Unknown preset"),
+					},
+				},
+				"put": map[string]any{
+					"summary":     "Store a render preset",
+					"description": fmt.Sprintf("Takes the admin token as a bearer token. The body is a generate request, which must not name a preset itself; up to %d presets can be stored.", maxPresets),
+					"security":    []any{map[string]any{"bearer": []string{}}},
+					"requestBody": map[string]any{
+						"required": true,
+						"content":  jsonContent(openapi.Ref("GenerateRequest")),
+					},
+					"responses": map[string]any{
+						"200": jsonResponse("Preset replaced", openapi.Ref("PresetResponse")),
+						"201": jsonResponse("Preset created", openapi.Ref("PresetResponse")),
+						"400": errorResponseSpec("Invalid preset"),
+						"401": errorResponseSpec("Invalid admin token"),
+						"404": errorResponseSpec("No admin token configured"),
+						"409": errorResponseSpec("Too many presets"),
+					},
+				},
+				"delete": map[string]any{
+					"summary":     "Delete a render preset",
+					"description": "Takes the admin token as a bearer token.",
+					"security":    []any{map[string]any{"bearer": []string{}}},
+					"responses": map[string]any{
+						"204": map[string]any{"description": "Preset deleted"},
+						"401": errorResponseSpec("Invalid admin token"),
+						"404": errorResponseSpec("Unknown preset, or no admin token configured"),
+					},
+				},
+			},
+			"/api/stream": map[string]any{
+				"get": map[string]any{
+					"summary":     "Animation stream",
+					"description": "Server-sent events with one rendered map per frame event, each line in its own data field. Streams end after frames frames or 10 minutes and count as one request against the rate limit.",
+					"security": []any{
+						map[string]any{},
+						map[string]any{"apiKey": []string{}},
+						map[string]any{"bearer": []string{}},
+					},
+					"parameters": []any{
+						map[string]any{"name": "animation", "in": "query", "schema": map[string]any{"type": "string", "enum": streamAnimations, "default": streamRotate}},
+						map[string]any{"name": "fps", "in": "query", "schema": map[string]any{"type": "integer", "minimum": 1, "maximum": maxStreamFPS, "default": defaultStreamFPS}},
+						map[string]any{"name": "frames", "in": "query", "schema": map[string]any{"type": "integer", "minimum": 1}},
+						map[string]any{"name": "step", "in": "query", "description": "Degrees of rotation (rotate) or minutes (sun) per frame.", "schema": map[string]any{"type": "number"}},
+						map[string]any{"name": "lon", "in": "query", "schema": map[string]any{"type": "number", "minimum": -180, "maximum": 180}},
+						map[string]any{"name": "lat", "in": "query", "schema": map[string]any{"type": "number", "minimum": -90, "maximum": 90, "default": defaultRotateLat}},
+						map[string]any{"name": "width", "in": "query", "schema": map[string]any{"type": "integer"}},
+						map[string]any{"name": "color", "in": "query", "schema": map[string]any{"type": "boolean"}},
+						map[string]any{"name": "diff", "in": "query", "description": "Send frames after the first as diff events listing the changed cells.", "schema": map[string]any{"type": "boolean"}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{"description": "Event stream", "content": map[string]any{"text/event-stream": map[string]any{"schema": &openapi.Schema{Type: "string"}}}},
+						"400": errorResponseSpec("Invalid parameters"),
+						"401": errorResponseSpec("Invalid API key"),
+						"429": errorResponseSpec("Rate limit exceeded"),
+					},
+				},
+			},
+			"/api/ws": map[string]any{
+				"get": map[string]any{
+					"summary":     "Live map over WebSocket",
+					"description": "Upgrades to a WebSocket. The first text message is a generate request and later ones update it with marker ({lon, lat}) or markers; each is answered with {\"type\":\"frame\",\"frame\":<generate response>} or {\"type\":\"error\",\"error\":...} and counts against the rate limit.",
+					"security": []any{
+						map[string]any{},
+						map[string]any{"apiKey": []string{}},
+						map[string]any{"bearer": []string{}},
+					},
+					"parameters": []any{
+						map[string]any{"name": "diff", "in": "query", "description": "Answer with {\"type\":\"diff\",\"diff\":{\"changes\":[...]}} after the first frame.", "schema": map[string]any{"type": "boolean"}},
+					},
+					"responses": map[string]any{
+						"101": map[string]any{"description": "Switching to the WebSocket protocol"},
+						"400": errorResponseSpec("Not a WebSocket upgrade"),
+						"401": errorResponseSpec("Invalid API key"),
+					},
+				},
+			},
+			"/": map[string]any{
+				"get": map[string]any{
+					"summary":     "Map of the caller's location",
+					"description": "Plain-text map with a marker at the caller's GeoIP location and a caption. ANSI colors are used for curl, wget and HTTPie unless color overrides it.",
+					"parameters": []any{
+						map[string]any{"name": "width", "in": "query", "schema": map[string]any{"type": "integer"}},
+						map[string]any{"name": "color", "in": "query", "schema": map[string]any{"type": "boolean"}},
+					},
+					"responses": map[string]any{
+						"200": textResponse("Rendered map"),
+						"400": textResponse("Invalid parameters"),
+						"422": textResponse("No location for the caller's address"),
+						"501": textResponse("GeoIP database not configured"),
+					},
+				},
+			},
+			"/api/mini": map[string]any{
+				"get": map[string]any{
+					"summary":     "Compact map for prompts and status lines",
+					"description": "Plain-text map in the mini format, 40x10 without frame or margins, with an optional marker from place or lon/lat. ANSI colors are used for curl, wget and HTTPie unless color overrides it.",
+					"parameters": []any{
+						map[string]any{"name": "place", "in": "query", "schema": map[string]any{"type": "string", "maxLength": maxPlaceLength}},
+						map[string]any{"name": "lon", "in": "query", "schema": map[string]any{"type": "number", "minimum": -180, "maximum": 180}},
+						map[string]any{"name": "lat", "in": "query", "schema": map[string]any{"type": "number", "minimum": -90, "maximum": 90}},
+						map[string]any{"name": "label", "in": "query", "schema": map[string]any{"type": "string"}},
+						map[string]any{"name": "style", "in": "query", "schema": map[string]any{"type": "string", "enum": render.MarkerStyles()}},
+						map[string]any{"name": "continent", "in": "query", "schema": map[string]any{"type": "string"}},
+						map[string]any{"name": "theme", "in": "query", "schema": map[string]any{"type": "string"}},
+						map[string]any{"name": "width", "in": "query", "schema": map[string]any{"type": "integer", "default": miniWidth}},
+						map[string]any{"name": "color", "in": "query", "schema": map[string]any{"type": "boolean"}},
+					},
+					"responses": map[string]any{
+						"200": textResponse("Rendered map"),
+						"400": textResponse("Invalid parameters"),
+						"401": textResponse("Invalid API key"),
+						"429": textResponse("Rate limit exceeded"),
+					},
+				},
+			},
+			"/api/stats": map[string]any{
+				"get": map[string]any{
+					"summary":     "Runtime statistics",
+					"description": "Render counts, durations, cache hits and bytes served since start and over a rolling window.",
+					"parameters": []any{
+						map[string]any{"name": "window", "in": "query", "description": "Rolling window, 1m to 60m.", "schema": map[string]any{"type": "string", "default": "5m"}},
+					},
+					"responses": map[string]any{
+						"200": jsonResponse("Statistics", openapi.Ref("StatsResponse")),
+						"400": errorResponseSpec("Invalid window"),
+					},
+				},
+			},
+			"/api/livez": map[string]any{
+				"get": map[string]any{
+					"summary": "Liveness check",
+					"responses": map[string]any{
+						"200": jsonResponse("Server is running", &openapi.Schema{
+							Type:       "object",
+							Properties: map[string]*openapi.Schema{"status": {Type: "string"}},
+						}),
+					},
+				},
+			},
+			"/api/readyz": map[string]any{
+				"get": map[string]any{
+					"summary":     "Readiness check",
+					"description": "Checks the land mask, a self-test render, and the state directory and object storage when configured.",
+					"responses": map[string]any{
+						"200": jsonResponse("Server is ready", openapi.Ref("ReadyResponse")),
+						"503": jsonResponse("A check failed", openapi.Ref("ReadyResponse")),
+					},
+				},
+			},
+			"/api/openapi.json": map[string]any{
+				"get": map[string]any{
+					"summary": "This OpenAPI document",
+					"responses": map[string]any{
+						"200": map[string]any{"description": "OpenAPI 3 document"},
+					},
+				},
+			},
+		},
+		"components": map[string]any{
+			"schemas": map[string]any{
+				"GenerateRequest":    generateReq,
+				"GenerateResponse":   openapi.SchemaOf(reflect.TypeOf(generateResponse{})),
+				"PlotIPResponse":     openapi.SchemaOf(reflect.TypeOf(plotIPResponse{})),
+				"TracerouteResponse": openapi.SchemaOf(reflect.TypeOf(tracerouteResponse{})),
+				"OptionsResponse":    openapi.SchemaOf(reflect.TypeOf(optionsResponse{})),
+				"LimitsResponse":     openapi.SchemaOf(reflect.TypeOf(limitsResponse{})),
+				"QuotaResponse":      openapi.SchemaOf(reflect.TypeOf(quotaResponse{})),
+				"ColorsResponse":     openapi.SchemaOf(reflect.TypeOf(colorsResponse{})),
+				"ThemesResponse":     openapi.SchemaOf(reflect.TypeOf(themesResponse{})),
+				"CountriesResponse":  openapi.SchemaOf(reflect.TypeOf(countriesResponse{})),
+				"GeocodeResponse":    openapi.SchemaOf(reflect.TypeOf(geocodeResponse{})),
+				"LocateResponse":     openapi.SchemaOf(reflect.TypeOf(locateResponse{})),
+				"JobResponse":        jobResp,
+				"PresetResponse":     openapi.SchemaOf(reflect.TypeOf(presetInfo{})),
+				"PresetsResponse":    openapi.SchemaOf(reflect.TypeOf(presetsResponse{})),
+				"ReadyResponse":      openapi.SchemaOf(reflect.TypeOf(readyResponse{})),
+				"StatsResponse":      openapi.SchemaOf(reflect.TypeOf(statsResponse{})),
+				"ShareResponse":      openapi.SchemaOf(reflect.TypeOf(shareResponse{})),
+				"HistoryResponse":    openapi.SchemaOf(reflect.TypeOf(historyResponse{})),
+				"Error":              errorResp,
+			},
+			"securitySchemes": map[string]any{
+				"apiKey": map[string]any{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}, errors.Join(jobResp.Err(), generateReq.Err(), errorResp.Err())
+}
+
+func jsonContent(schema *openapi.Schema) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+func jsonResponse(description string, schema *openapi.Schema) map[string]any {
+	return map[string]any{"description": description, "content": jsonContent(schema)}
+}
+
+func textResponse(description string) map[string]any {
+	return map[string]any{"description": description, "content": map[string]any{"text/plain": map[string]any{"schema": &openapi.Schema{Type: "string"}}}}
+}
+
+func errorResponseSpec(description string) map[string]any {
+	return map[string]any{"description": description, "content": map[string]any{"application/problem+json": map[string]any{"schema": openapi.Ref("Error")}}}
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"map-ascii-generator/api/internal/geo"
+	"map-ascii-generator/api/internal/render"
+)
+
+// requestOverlay parses the optional geojson field. Coordinates are checked
+// here so a bad file fails with a clear message instead of odd output.
+func requestOverlay(req generateRequest, cfg config) (*render.Overlay, error) {
+	if len(req.GeoJSON) == 0 || string(req.GeoJSON) == "null" {
+		return nil, nil
+	}
+	if int64(len(req.GeoJSON)) > cfg.maxGeoJSONBytes {
+		return nil, fmt.Errorf("geojson must be at most %d bytes", cfg.maxGeoJSONBytes)
+	}
+
+	features, err := geo.ParseFeatures(req.GeoJSON)
+	if err != nil {
+		return nil, fmt.Errorf("geojson: %w", err)
+	}
+	for i, feature := range features {
+		if err := checkFeatureCoordinates(feature); err != nil {
+			return nil, fmt.Errorf("geojson feature %d: %w", i, err)
+		}
+	}
+
+	return overlayFromFeatures(features, req)
+}
+
+func overlayFromFeatures(features []geo.Feature, req generateRequest) (*render.Overlay, error) {
+	pointChar, err := parseRune(req.Overlay.PointChar, 'o', "overlay.point_char", req.AllowUnicode)
+	if err != nil {
+		return nil, err
+	}
+	lineChar, err := parseRune(req.Overlay.LineChar, '*', "overlay.line_char", req.AllowUnicode)
+	if err != nil {
+		return nil, err
+	}
+	fillChar, err := parseRune(req.Overlay.FillChar, 0, "overlay.fill_char", req.AllowUnicode)
+	if err != nil {
+		return nil, err
+	}
+	startChar, err := parseRune(req.Overlay.StartChar, 0, "overlay.start_char", req.AllowUnicode)
+	if err != nil {
+		return nil, err
+	}
+	endChar, err := parseRune(req.Overlay.EndChar, 0, "overlay.end_char", req.AllowUnicode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &render.Overlay{
+		Features:  features,
+		PointChar: pointChar,
+		LineChar:  lineChar,
+		FillChar:  fillChar,
+		StartChar: startChar,
+		EndChar:   endChar,
+	}, nil
+}
+
+func checkFeatureCoordinates(feature geo.Feature) error {
+	check := func(points []geo.Point) error {
+		for _, p := range points {
+			if !isFinite(p.Lon()) || p.Lon() < -180.0 || p.Lon() > 180.0 || !isFinite(p.Lat()) || p.Lat() < -90.0 || p.Lat() > 90.0 {
+				return fmt.Errorf("coordinate [%v, %v] is outside lon -180..180 / lat -90..90", p.Lon(), p.Lat())
+			}
+		}
+		return nil
+	}
+
+	if err := check(feature.Points); err != nil {
+		return err
+	}
+	for _, line := range feature.Lines {
+		if err := check(line); err != nil {
+			return err
+		}
+	}
+	for _, poly := range feature.Polygons {
+		for _, ring := range poly {
+			if err := check(ring); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// readMultipartGenerate reads a multipart/form-data request with an optional
+// "options" part holding the JSON request and file parts named after
+// uploadFields. Each part has its own size cap.
+func readMultipartGenerate(w http.ResponseWriter, r *http.Request, cfg config, uploadFields ...string) ([]byte, map[string][]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.maxBodyBytes+cfg.maxGeoJSONBytes)
+	defer r.Body.Close()
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid multipart payload: %w", err)
+	}
+
+	var body []byte
+	uploads := make(map[string][]byte)
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid multipart payload: %w", err)
+		}
+
+		name := part.FormName()
+		switch {
+		case name == "options":
+			body, err = readPart(part, cfg.maxBodyBytes, name)
+		case slices.Contains(uploadFields, name):
+			uploads[name], err = readPart(part, cfg.maxGeoJSONBytes, name)
+		default:
+			err = fmt.Errorf("unexpected multipart field %q (expected options, %s)", name, strings.Join(uploadFields, ", "))
+		}
+		part.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if body == nil {
+		body = []byte("{}")
+	}
+	return body, uploads, nil
+}
+
+func readPart(part io.Reader, limit int64, name string) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(part, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid multipart payload: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s must be at most %d bytes", name, limit)
+	}
+	return data, nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+	"strings"
+)
+
+//go:embed playground.html
+var playgroundHTML []byte
+
+// handleRoot serves the playground to browsers and a map to everything
+// else, so "curl https://host/" keeps working.
+func (s *server) handleRoot(w http.ResponseWriter, r *http.Request) {
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Content-Security-Policy", playgroundContentSecurityPolicy)
+		_, _ = w.Write(playgroundHTML)
+		return
+	}
+	s.handleWhereAmI(w, r)
+}
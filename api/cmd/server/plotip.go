@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+const (
+	maxHostnameLength = 253
+	resolveTimeout    = 3 * time.Second
+)
+
+type plotIPRequest struct {
+	Target  string          `json:"target"`
+	Options json.RawMessage `json:"options"`
+}
+
+type plotIPTarget struct {
+	Query     string   `json:"query"`
+	Addresses []string `json:"addresses,omitempty"`
+	ipLocation
+}
+
+type plotIPResponse struct {
+	generateResponse
+	Target plotIPTarget `json:"target"`
+}
+
+// handlePlotIP resolves an IP address or hostname, geolocates it and renders
+// a map with the marker there. options takes the same fields as
+// /api/generate.
+func (s *server) handlePlotIP(w http.ResponseWriter, r *http.Request) {
+	limits, ok := s.admitGenerate(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := readJSONBody(w, r, limits)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var plot plotIPRequest
+	if err := decodeStrictJSON(body, &plot); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	plot.Target = strings.TrimSpace(plot.Target)
+	if plot.Target == "" {
+		writeJSONError(w, http.StatusBadRequest, "target is required")
+		return
+	}
+
+	req, err := parseOptions(plot.Options, limits, s.presetSet())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Marker.Place != "" || req.Marker.UseClientIP {
+		writeJSONError(w, http.StatusBadRequest, "options: marker.place and marker.use_client_ip cannot be combined with target")
+		return
+	}
+
+	ip, addresses, err := resolveTarget(r.Context(), plot.Target)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	loc, err := s.locateIP(ip)
+	if err != nil {
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, errGeoIPDisabled) {
+			status = http.StatusNotImplemented
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	req.Marker.Enabled = true
+	req.Marker.Lon, req.Marker.Lat = loc.Lon, loc.Lat
+	if req.Marker.Label == "" && len(plot.Target) <= maxLabelLength {
+		req.Marker.Label = plot.Target
+	}
+
+	resp, err := s.generate(r, req, limits, nil)
+	if err != nil {
+		writeError(w, generateStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, plotIPResponse{
+		generateResponse: resp,
+		Target:           plotIPTarget{Query: plot.Target, Addresses: addresses, ipLocation: loc},
+	})
+}
+
+// parseOptions reads the generate request embedded as "options" in the
+// bodies of endpoints that build part of the request themselves.
+func parseOptions(raw json.RawMessage, limits config, presets presetSet) (generateRequest, error) {
+	if len(raw) == 0 {
+		raw = json.RawMessage("{}")
+	}
+	req, err := parseGenerateRequest(raw, limits, presets)
+	if err != nil {
+		return generateRequest{}, fmt.Errorf("options: %w", err)
+	}
+	return req, nil
+}
+
+// resolveTarget returns the address to plot for an IP literal or hostname,
+// preferring IPv4 because GeoIP coverage is better there, and every address
+// the hostname resolved to.
+func resolveTarget(ctx context.Context, target string) (netip.Addr, []string, error) {
+	if ip, err := netip.ParseAddr(target); err == nil {
+		return ip, nil, nil
+	}
+	if !isHostname(target) {
+		return netip.Addr{}, nil, fmt.Errorf("target must be an IP address or hostname")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", target)
+	if err != nil || len(ips) == 0 {
+		return netip.Addr{}, nil, fmt.Errorf("target: cannot resolve %q", target)
+	}
+
+	chosen := ips[0]
+	addresses := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		ip = ip.Unmap()
+		addresses = append(addresses, ip.String())
+		if ip.Is4() && !chosen.Unmap().Is4() {
+			chosen = ip
+		}
+	}
+	return chosen.Unmap(), addresses, nil
+}
+
+func isHostname(value string) bool {
+	value = strings.TrimSuffix(value, ".")
+	if value == "" || len(value) > maxHostnameLength {
+		return false
+	}
+	for _, label := range strings.Split(value, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"map-ascii-generator/api/internal/raster"
+	"map-ascii-generator/api/internal/render"
+)
+
+const (
+	layerPopulation       = "population"
+	defaultPopulationRamp = ":-=+*#%@"
+	// populationTop is the density in people per km² where the last level
+	// starts; the levels below it are spaced evenly on a log scale from 1.
+	populationTop = 5000.0
+)
+
+// shadeLayers are the values of the layer field. Each shades land cells
+// from a measured grid, so it is only available once one is loaded.
+var shadeLayers = []string{layerPopulation}
+
+// errPopulationDisabled is returned for the population layer when neither
+// data.population_file nor the build provides a grid.
+var errPopulationDisabled = errors.New("no population grid is configured (set data.population_file)")
+
+// loadPopulation reads the configured population grid, falling back to the
+// one embedded by the Docker build. It returns nil when there is neither.
+func loadPopulation(path string) (*raster.Grid, error) {
+	if path == "" {
+		return raster.EmbeddedPopulation()
+	}
+	return raster.LoadFile(path)
+}
+
+// layers lists the shade layers whose grid is loaded.
+func (s *server) layers() []string {
+	if s.population.Load() == nil {
+		return []string{}
+	}
+	return shadeLayers
+}
+
+// populationEdges puts the first level below 1 person per km² and spreads
+// the rest logarithmically up to populationTop.
+func populationEdges(levels int) []float64 {
+	edges := make([]float64, levels+1)
+	for i := 1; i <= levels; i++ {
+		t := 1.0
+		if levels > 1 {
+			t = float64(i-1) / float64(levels-1)
+		}
+		edges[i] = roundSignificant(math.Pow(populationTop, t), 2)
+	}
+	return edges
+}
+
+// populationSettings validates the layer options and returns the ramp, nil
+// when no layer is selected.
+func populationSettings(req generateRequest) ([]rune, error) {
+	if req.Layer == "" {
+		return nil, nil
+	}
+	if !slices.Contains(shadeLayers, req.Layer) {
+		return nil, fmt.Errorf("layer must be one of: %s", strings.Join(shadeLayers, ", "))
+	}
+	if req.Weather.Variable != "" || req.Terrain {
+		return nil, fmt.Errorf("layer %q cannot be combined with weather.variable or terrain", req.Layer)
+	}
+
+	ramp, err := parseRamp(req.Population.Ramp, "population.ramp", 2, req.AllowUnicode)
+	if err != nil {
+		return nil, err
+	}
+	if len(ramp) == 0 {
+		ramp = []rune(defaultPopulationRamp)
+	}
+	return ramp, nil
+}
+
+// requestPopulation shades land by population density.
+func (s *server) requestPopulation(req generateRequest) (*render.Field, error) {
+	ramp, err := populationSettings(req)
+	if err != nil || ramp == nil {
+		return nil, err
+	}
+	population := s.population.Load()
+	if population == nil {
+		return nil, fmt.Errorf("layer %q: %w", req.Layer, errPopulationDisabled)
+	}
+	return &render.Field{
+		Sample: population.Sample,
+		Edges:  populationEdges(len(ramp)),
+		Ramp:   ramp,
+		Levels: len(ramp),
+		Legend: req.Population.Legend,
+	}, nil
+}
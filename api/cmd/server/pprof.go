@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"path"
+	"time"
+)
+
+// pprofContentSecurityPolicy lets the profile index use its inline style.
+const pprofContentSecurityPolicy = "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'"
+
+// pprofHandler serves the net/http/pprof profiles under /debug/pprof/.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// handlePprof serves the profiles on listeners with the debug routes to
+// callers with the admin token. CPU profiles and traces lift the write
+// deadline of their response so that it does not cut them short; the
+// debug listener, which has no write timeout, is the place for long ones.
+func (s *server) handlePprof(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	if name := path.Base(r.URL.Path); name == "profile" || name == "trace" {
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	w.Header().Set("Content-Security-Policy", pprofContentSecurityPolicy)
+	http.StripPrefix(s.config().basePath, pprofHandler()).ServeHTTP(w, r)
+}
+
+// validateDebugAddr accepts only loopback addresses, since the debug
+// listener serves profiles without a token.
+func validateDebugAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("debug_addr: %w", err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("debug_addr must be a loopback address such as 127.0.0.1:6060, got %q", addr)
+	}
+	return nil
+}
+
+// serveDebug serves the profiles without a token on a loopback address,
+// with no write timeout so long CPU profiles can finish.
+func serveDebug(addr string) {
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           withRequestID(withRecovery(pprofHandler())),
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       defaultIdleTimeout,
+	}
+
+	log.Printf("pprof listening on %s", addr)
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("debug listener failed: %v", err)
+	}
+}
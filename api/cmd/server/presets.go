@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const maxPresets = 100
+
+var presetNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// presetSet is an immutable snapshot of the stored presets, each a generate
+// request body; changes swap in a modified copy under presetMu.
+type presetSet map[string]json.RawMessage
+
+type presetInfo struct {
+	Name    string          `json:"name"`
+	Request json.RawMessage `json:"request"`
+}
+
+type presetsResponse struct {
+	Presets []presetInfo `json:"presets"`
+}
+
+func validatePresetName(name string) error {
+	if !presetNamePattern.MatchString(name) {
+		return fmt.Errorf("preset name must be 1 to 64 lowercase letters, digits, '-' or '_'")
+	}
+	return nil
+}
+
+// loadPresets reads the presets file, a JSON object of name to request. A
+// missing file yields an empty set, so the first save creates it.
+func loadPresets(path string) (presetSet, error) {
+	presets := presetSet{}
+	if path == "" {
+		return presets, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return presets, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read presets file: %w", err)
+	}
+	if err := json.Unmarshal(data, &presets); err != nil {
+		return nil, fmt.Errorf("parse presets file %s: %w", path, err)
+	}
+	for name, body := range presets {
+		if err := validatePresetName(name); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := checkPresetBody(body); err != nil {
+			return nil, fmt.Errorf("%s: preset %q: %w", path, name, err)
+		}
+	}
+	return presets, nil
+}
+
+// presetsPath is the presets file, by default presets.json in the state
+// directory. Without either presets are kept in memory.
+func (c config) presetsPath() string {
+	if c.presetsFile == "" && c.stateDir != "" {
+		return filepath.Join(c.stateDir, "presets.json")
+	}
+	return c.presetsFile
+}
+
+func (s *server) presetSet() presetSet {
+	return *s.presets.Load()
+}
+
+// expand applies the preset a request body names: the body's fields are
+// merged over the preset's, objects field by field. Bodies without a
+// preset are returned as they are.
+func (p presetSet) expand(body []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		// Left for the strict decode to report.
+		return body, nil
+	}
+	raw, ok := fields["preset"]
+	if !ok {
+		return body, nil
+	}
+	var name string
+	if err := json.Unmarshal(raw, &name); err != nil {
+		return nil, fmt.Errorf("preset must be a string")
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return body, nil
+	}
+
+	preset, ok := p[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown preset %q", name)
+	}
+	base, err := decodeJSONObject(preset)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := decodeJSONObject(body)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergeJSONObjects(base, overrides))
+}
+
+func decodeJSONObject(data []byte) (map[string]any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var object map[string]any
+	if err := decoder.Decode(&object); err != nil {
+		return nil, fmt.Errorf("invalid JSON payload: %w", err)
+	}
+	return object, nil
+}
+
+func mergeJSONObjects(base map[string]any, overrides map[string]any) map[string]any {
+	for key, value := range overrides {
+		nested, isObject := value.(map[string]any)
+		current, wasObject := base[key].(map[string]any)
+		if isObject && wasObject {
+			base[key] = mergeJSONObjects(current, nested)
+			continue
+		}
+		base[key] = value
+	}
+	return base
+}
+
+// checkPresetBody rejects bodies that are not JSON objects or that name a
+// preset themselves.
+func checkPresetBody(body []byte) error {
+	object, err := decodeJSONObject(body)
+	if err != nil {
+		return err
+	}
+	if _, ok := object["preset"]; ok {
+		return fmt.Errorf("a preset cannot reference another preset")
+	}
+	return nil
+}
+
+func (s *server) handlePresets(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, presetsResponse{Presets: s.presetList()})
+}
+
+func (s *server) presetList() []presetInfo {
+	presets := s.presetSet()
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	list := make([]presetInfo, 0, len(names))
+	for _, name := range names {
+		list = append(list, presetInfo{Name: name, Request: presets[name]})
+	}
+	return list
+}
+
+// handlePreset returns a preset, or with the admin token stores (PUT, a
+// generate request body) or deletes one. With a presets file configured
+// changes are written there so they survive restarts.
+func (s *server) handlePreset(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := validatePresetName(name); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		body, ok := s.presetSet()[name]
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, fmt.Sprintf("unknown preset %q", name))
+			return
+		}
+		writeJSON(w, http.StatusOK, presetInfo{Name: name, Request: body})
+	case http.MethodPut:
+		if s.requireAdmin(w, r) {
+			s.putPreset(w, r, name)
+		}
+	case http.MethodDelete:
+		if s.requireAdmin(w, r) {
+			s.deletePreset(w, name)
+		}
+	}
+}
+
+func (s *server) putPreset(w http.ResponseWriter, r *http.Request, name string) {
+	cfg := s.config()
+	body, err := readJSONBody(w, r, cfg)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := checkPresetBody(body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	req, err := parseGenerateRequest(body, cfg, nil)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := validateRequest(req, cfg); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid JSON payload: %v", err))
+		return
+	}
+
+	s.presetMu.Lock()
+	defer s.presetMu.Unlock()
+
+	current := s.presetSet()
+	_, replaced := current[name]
+	if !replaced && len(current) >= maxPresets {
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("at most %d presets can be stored; delete one first", maxPresets))
+		return
+	}
+
+	next := make(presetSet, len(current)+1)
+	for k, v := range current {
+		next[k] = v
+	}
+	next[name] = compact.Bytes()
+	if err := s.savePresets(next); err != nil {
+		log.Printf("failed to store preset %q: %v", name, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to store preset")
+		return
+	}
+	s.presets.Store(&next)
+	log.Printf("preset %q saved", name)
+
+	status := http.StatusCreated
+	if replaced {
+		status = http.StatusOK
+	}
+	writeJSON(w, status, presetInfo{Name: name, Request: next[name]})
+}
+
+func (s *server) deletePreset(w http.ResponseWriter, name string) {
+	s.presetMu.Lock()
+	defer s.presetMu.Unlock()
+
+	current := s.presetSet()
+	if _, ok := current[name]; !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("unknown preset %q", name))
+		return
+	}
+
+	next := make(presetSet, len(current))
+	for k, v := range current {
+		if k != name {
+			next[k] = v
+		}
+	}
+	if err := s.savePresets(next); err != nil {
+		log.Printf("failed to remove preset %q: %v", name, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to remove preset")
+		return
+	}
+	s.presets.Store(&next)
+	log.Printf("preset %q deleted", name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// savePresets replaces the presets file atomically, if one is configured.
+func (s *server) savePresets(presets presetSet) error {
+	path := s.config().presetsPath()
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(presets, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".presets-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// problem is an RFC 7807 problem details body. Type is always about:blank,
+// so Title is the status text; Detail says what went wrong and
+// InvalidParams lists the request fields at fault, when known.
+type problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail"`
+	InvalidParams []invalidParam `json:"invalid-params,omitempty"`
+}
+
+// invalidParam names a request field by JSON pointer, e.g. /marker/lat.
+type invalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// paramError is an error about the request field at the JSON pointer
+// Name.
+type paramError struct {
+	Name string
+	Err  error
+}
+
+func (e *paramError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *paramError) Unwrap() error {
+	return e.Err
+}
+
+// fieldErrors collects every problem with a request, each a paramError.
+type fieldErrors []error
+
+// add records err, if any, for the request field its message starts with,
+// such as marker.style or markers[2].lat, or else for pointer.
+func (e *fieldErrors) add(pointer string, err error) {
+	if err == nil {
+		return
+	}
+	if path, ok := requestField(err.Error()); ok {
+		pointer = jsonPointer(path)
+	}
+	*e = append(*e, &paramError{Name: pointer, Err: err})
+}
+
+// err returns the collected problems as one error, or nil without any.
+func (e fieldErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e fieldErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e fieldErrors) Unwrap() []error {
+	return e
+}
+
+var fieldIndexPattern = regexp.MustCompile(`\[(\d+)\]`)
+
+// requestField returns the dotted path of the generate request field that
+// message starts with, with list indexes as path segments.
+func requestField(message string) (string, bool) {
+	token, _, _ := strings.Cut(message, " ")
+	path := fieldIndexPattern.ReplaceAllString(strings.TrimRight(token, ":,"), ".$1")
+
+	t := reflect.TypeFor[generateRequest]()
+	for _, part := range strings.Split(path, ".") {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Slice, reflect.Array:
+			if _, err := strconv.Atoi(part); err != nil {
+				return "", false
+			}
+			t = t.Elem()
+		case reflect.Struct:
+			field, ok := jsonField(t, part)
+			if !ok {
+				return "", false
+			}
+			t = field.Type
+		default:
+			return "", false
+		}
+	}
+	return path, true
+}
+
+// jsonField finds the field of struct type t that JSON names name.
+func jsonField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if tag == name && field.IsExported() {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// jsonPointer turns a dotted field path such as marker.lat into /marker/lat.
+func jsonPointer(path string) string {
+	replacer := strings.NewReplacer("~", "~0", "/", "~1")
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		parts[i] = replacer.Replace(part)
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// jsonTypeName names the JSON type a Go type decodes from.
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	default:
+		return t.String()
+	}
+}
+
+func writeProblem(w http.ResponseWriter, statusCode int, detail string, params []invalidParam) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(statusCode)
+
+	body := problem{Type: "about:blank", Title: http.StatusText(statusCode), Status: statusCode, Detail: detail, InvalidParams: params}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("failed to write JSON response: %v", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, statusCode int, message string) {
+	writeProblem(w, statusCode, message, nil)
+}
+
+// writeError writes err as a problem whose invalid params are the
+// paramErrors found in err.
+func writeError(w http.ResponseWriter, statusCode int, err error) {
+	writeProblem(w, statusCode, err.Error(), invalidParams(err))
+}
+
+func invalidParams(err error) []invalidParam {
+	switch e := err.(type) {
+	case *paramError:
+		return []invalidParam{{Name: e.Name, Reason: e.Err.Error()}}
+	case interface{ Unwrap() []error }:
+		var params []invalidParam
+		for _, inner := range e.Unwrap() {
+			params = append(params, invalidParams(inner)...)
+		}
+		return params
+	case interface{ Unwrap() error }:
+		return invalidParams(e.Unwrap())
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"map-ascii-generator/api/internal/ratelimit"
+)
+
+// adminTopClients is how many of the busiest clients /admin/ratelimit
+// lists per limiter.
+const adminTopClients = 10
+
+type quotaResponse struct {
+	Limit        int     `json:"limit"`
+	Remaining    int     `json:"remaining"`
+	Window       string  `json:"window"`
+	Reset        string  `json:"reset"`
+	ResetSeconds float64 `json:"reset_seconds"`
+}
+
+type rateLimitStatsResponse struct {
+	Limiters []limiterStats `json:"limiters"`
+}
+
+type limiterStats struct {
+	Name               string        `json:"name"`
+	Buckets            int           `json:"buckets"`
+	MaxBuckets         int           `json:"max_buckets"`
+	RejectedLastMinute int           `json:"rejected_last_minute"`
+	RejectedTotal      uint64        `json:"rejected_total"`
+	TopClients         []clientCount `json:"top_clients"`
+}
+
+type clientCount struct {
+	Client   string `json:"client"`
+	Requests int    `json:"requests"`
+}
+
+// handleQuota tells the caller how many requests it has left in its rate
+// window. Asking does not count against the quota.
+func (s *server) handleQuota(w http.ResponseWriter, r *http.Request) {
+	limiter, clientKey, limits, ok := s.resolveClient(r)
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "invalid API key")
+		return
+	}
+
+	now := time.Now()
+	quota := limiter.Quota(clientKey, now)
+	writeJSON(w, http.StatusOK, quotaResponse{
+		Limit:        quota.Limit,
+		Remaining:    quota.Remaining,
+		Window:       limits.rateWindow.String(),
+		Reset:        quota.Reset.UTC().Format(time.RFC3339),
+		ResetSeconds: quota.Reset.Sub(now).Seconds(),
+	})
+}
+
+// handleAdminRateLimit reports the state of the global limiter and of each
+// API key tier's.
+func (s *server) handleAdminRateLimit(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	now := time.Now()
+	resp := rateLimitStatsResponse{Limiters: []limiterStats{s.limiterStats("global", s.limiter, now)}}
+	for _, tier := range s.tierLimiters.snapshot() {
+		resp.Limiters = append(resp.Limiters, s.limiterStats("tier:"+tier.name, tier.limiter, now))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *server) limiterStats(name string, limiter ratelimit.Limiter, now time.Time) limiterStats {
+	stats := limiter.Stats(now, adminTopClients)
+	out := limiterStats{
+		Name:               name,
+		Buckets:            stats.Buckets,
+		MaxBuckets:         stats.MaxBuckets,
+		RejectedLastMinute: stats.RejectedLastMinute,
+		RejectedTotal:      stats.RejectedTotal,
+		TopClients:         make([]clientCount, 0, len(stats.Top)),
+	}
+	for _, c := range stats.Top {
+		out.TopClients = append(out.TopClients, clientCount{Client: s.clientLabel(c.Key), Requests: c.Requests})
+	}
+	return out
+}
+
+// clientLabel names a rate-limit key for display: API keys by their name
+// rather than their ID.
+func (s *server) clientLabel(clientKey string) string {
+	id, ok := strings.CutPrefix(clientKey, "key:")
+	if !ok {
+		return clientKey
+	}
+	if keys := s.keys.Load(); keys != nil {
+		if k, ok := keys.Get(id); ok && !k.Revoked {
+			return "key:" + k.Name
+		}
+	}
+	return "key:(removed)"
+}
+
+// namedLimiter is a tier's limiter for reporting.
+type namedLimiter struct {
+	name    string
+	window  time.Duration
+	limiter ratelimit.Limiter
+}
+
+// snapshot returns the tier limiters created so far, by tier name.
+func (t *tierLimiters) snapshot() []namedLimiter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	limiters := make([]namedLimiter, 0, len(t.limiters))
+	for name, tier := range t.limiters {
+		limiters = append(limiters, namedLimiter{name: name, window: tier.window, limiter: tier.limiter})
+	}
+	slices.SortFunc(limiters, func(a namedLimiter, b namedLimiter) int {
+		return strings.Compare(a.name, b.name)
+	})
+	return limiters
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"map-ascii-generator/api/internal/ratelimit"
+)
+
+const (
+	rateLimitCollection = "ratelimit"
+	rateLimitRecord     = "counters"
+	rateLimitSaveEvery  = time.Minute
+	globalLimiterName   = "global"
+)
+
+// rateLimitState is the rate limit counters saved in the state directory,
+// by limiter: the global one and "tier:<name>". API keys are counted, and
+// so saved, by ID.
+type rateLimitState struct {
+	Algorithm ratelimit.Algorithm     `json:"algorithm"`
+	Limiters  map[string]savedLimiter `json:"limiters"`
+}
+
+type savedLimiter struct {
+	Window   time.Duration       `json:"window"`
+	Counters []ratelimit.Counter `json:"counters"`
+}
+
+// loadRateLimits restores the counters saved before a restart, so that a
+// restart does not hand every client a fresh window. Counters of another
+// algorithm or window, and of API keys that no longer exist, are dropped;
+// tier limiters take theirs when they are first used.
+func (s *server) loadRateLimits() error {
+	var saved rateLimitState
+	ok, err := s.state.Get(rateLimitCollection, rateLimitRecord, &saved)
+	if err != nil || !ok {
+		return err
+	}
+	cfg := s.config()
+	if saved.Algorithm != cfg.rateAlgorithm {
+		return nil
+	}
+
+	now := time.Now()
+	tiers := make(map[string]savedLimiter)
+	for name, limiter := range saved.Limiters {
+		limiter.Counters = s.knownKeys(limiter.Counters)
+		if name == globalLimiterName {
+			if limiter.Window == cfg.rateWindow {
+				s.limiter.Restore(limiter.Counters, now)
+			}
+		} else if tier, ok := strings.CutPrefix(name, "tier:"); ok {
+			tiers[tier] = limiter
+		}
+	}
+	s.tierLimiters.restoreLater(tiers)
+	return nil
+}
+
+// saveRateLimits writes the counters of every limiter to the state
+// directory.
+func (s *server) saveRateLimits() error {
+	now := time.Now()
+	cfg := s.config()
+	state := rateLimitState{
+		Algorithm: cfg.rateAlgorithm,
+		Limiters: map[string]savedLimiter{
+			globalLimiterName: {Window: cfg.rateWindow, Counters: s.limiter.Counters(now)},
+		},
+	}
+	for name, saved := range s.tierLimiters.pending() {
+		state.Limiters["tier:"+name] = saved
+	}
+	for _, tier := range s.tierLimiters.snapshot() {
+		state.Limiters["tier:"+tier.name] = savedLimiter{Window: tier.window, Counters: tier.limiter.Counters(now)}
+	}
+	return s.state.Put(rateLimitCollection, rateLimitRecord, state)
+}
+
+func (s *server) saveRateLimitsEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.saveRateLimits(); err != nil {
+			log.Printf("rate limit save failed: %v", err)
+		}
+	}
+}
+
+// knownKeys drops the counters of API keys that no longer exist.
+func (s *server) knownKeys(counters []ratelimit.Counter) []ratelimit.Counter {
+	keys := s.keys.Load()
+	out := counters[:0:0]
+	for _, c := range counters {
+		if id, ok := strings.CutPrefix(c.Key, "key:"); ok {
+			if keys == nil {
+				continue
+			}
+			if _, ok := keys.Get(id); !ok {
+				continue
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+// requestIDPattern is what an incoming request ID must look like to be
+// kept; anything else is replaced, so IDs are safe to log.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type requestIDContext struct{}
+
+// withRequestID gives every request an ID, the caller's X-Request-Id if it
+// sent a usable one, and echoes it in the response.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDContext{}, id)))
+	})
+}
+
+// requestID returns the ID withRequestID gave r, or "-" without one.
+func requestID(r *http.Request) string {
+	if id, ok := r.Context().Value(requestIDContext{}).(string); ok {
+		return id
+	}
+	return "-"
+}
+
+func newRequestID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// withRecovery turns a panic in a handler into a logged stack trace and a
+// 500 response, so a bug in one render does not take the connection down
+// with it. If the response had already started it is cut off instead.
+func withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := &trackingWriter{ResponseWriter: w}
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			log.Printf("panic serving %s %s (request %s): %v\n%s", r.Method, r.URL.Path, requestID(r), err, debug.Stack())
+			if tw.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			writeJSONError(tw, http.StatusInternalServerError, fmt.Sprintf("internal server error (request %s)", requestID(r)))
+		}()
+		next.ServeHTTP(tw, r)
+	})
+}
+
+// trackingWriter records the status and size of a response.
+type trackingWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *trackingWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= http.StatusOK {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *trackingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the flush and hijack support
+// of the underlying writer.
+func (w *trackingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
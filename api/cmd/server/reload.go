@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+
+	"map-ascii-generator/api/internal/apikey"
+	"map-ascii-generator/api/internal/ratelimit"
+)
+
+func (s *server) config() config {
+	return *s.cfg.Load()
+}
+
+func (s *server) renderCache() *renderCache {
+	return s.cache.Load()
+}
+
+func (s *server) reloadOnSIGHUP() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		for range signals {
+			if err := s.reload(); err != nil {
+				log.Printf("reload failed, keeping previous settings: %v", err)
+			}
+		}
+	}()
+}
+
+// reload re-reads the config file, environment, keys and schedules files and datasets. Requests already
+// in flight keep the config snapshot they started with; listener and TLS
+// settings only take effect after a restart.
+func (s *server) reload() error {
+	current := s.config()
+
+	next, err := loadConfig(s.configPath)
+	if err != nil {
+		return err
+	}
+	if err := validateRequest(defaultGenerateRequest(next), next); err != nil {
+		return fmt.Errorf("invalid default render settings: %w", err)
+	}
+	if _, err := ratelimit.ParseAlgorithm(string(next.rateAlgorithm)); err != nil {
+		return err
+	}
+	if _, err := newWeatherSource(next); err != nil {
+		return err
+	}
+	if _, err := discordPublicKey(next); err != nil {
+		return err
+	}
+
+	if next.listenAddr != current.listenAddr || next.listenRoutes != current.listenRoutes || !slices.Equal(next.listeners, current.listeners) || next.grpcAddr != current.grpcAddr || next.tlsCertFile != current.tlsCertFile || next.tlsKeyFile != current.tlsKeyFile ||
+		next.tlsAutocertHost != current.tlsAutocertHost || next.tlsHTTPAddr != current.tlsHTTPAddr {
+		log.Printf("reload: listener and TLS changes require a restart and were ignored")
+	}
+	if next.jobWorkers != current.jobWorkers || next.jobQueueSize != current.jobQueueSize || next.jobTTL != current.jobTTL {
+		log.Printf("reload: job queue changes require a restart and were ignored")
+	}
+	next.jobWorkers, next.jobQueueSize, next.jobTTL = current.jobWorkers, current.jobQueueSize, current.jobTTL
+	if next.maxRenders != current.maxRenders {
+		log.Printf("reload: max_concurrent_renders changes require a restart and were ignored")
+	}
+	next.maxRenders = current.maxRenders
+	if next.rateAlgorithm != current.rateAlgorithm {
+		log.Printf("reload: rate limit algorithm changes require a restart and were ignored")
+	}
+	next.rateAlgorithm = current.rateAlgorithm
+	if next.stateDir != current.stateDir {
+		log.Printf("reload: state directory changes require a restart and were ignored")
+	}
+	next.stateDir = current.stateDir
+	if next.stateBackend != current.stateBackend {
+		log.Printf("reload: state backend changes require a restart and were ignored")
+	}
+	next.stateBackend = current.stateBackend
+	if next.stateSecret != current.stateSecret {
+		log.Printf("reload: state secret changes require a restart and were ignored")
+	}
+	next.stateSecret = current.stateSecret
+	if next.basePath != current.basePath {
+		log.Printf("reload: base_path changes require a restart and were ignored")
+	}
+	next.basePath = current.basePath
+	next.listenAddr = current.listenAddr
+	next.listenRoutes = current.listenRoutes
+	next.listeners = current.listeners
+	next.grpcAddr = current.grpcAddr
+	next.tlsCertFile = current.tlsCertFile
+	next.tlsKeyFile = current.tlsKeyFile
+	next.tlsHTTPAddr = current.tlsHTTPAddr
+	next.tlsAutocertHost = current.tlsAutocertHost
+	next.tlsAutocertEmail = current.tlsAutocertEmail
+	next.tlsAutocertCacheDir = current.tlsAutocertCacheDir
+	next.tlsACMEDirectory = current.tlsACMEDirectory
+
+	jwtAuth, err := newJWTAuth(next)
+	if err != nil {
+		return err
+	}
+	keys, err := s.reloadKeys(next.keysFile)
+	if err != nil {
+		return err
+	}
+
+	countries, err := loadCountries(next.countriesFile)
+	if err != nil {
+		return err
+	}
+
+	timezones, err := loadTimezones(next.timezonesFile)
+	if err != nil {
+		return err
+	}
+
+	cities, err := loadCities(next.citiesFile)
+	if err != nil {
+		return err
+	}
+
+	airports, err := loadAirports(next.airportsFile)
+	if err != nil {
+		return err
+	}
+
+	elevationGrid, err := loadElevation(next.elevationFile)
+	if err != nil {
+		return err
+	}
+
+	populationGrid, err := loadPopulation(next.populationFile)
+	if err != nil {
+		return err
+	}
+
+	// Without a masks dir, uploaded masks only live in memory and are kept.
+	var masks maskSet
+	if next.masksDir != "" {
+		if masks, err = loadMasks(next.masksDir); err != nil {
+			return err
+		}
+	}
+
+	geoip, err := loadGeoIP(next.geoipFile)
+	if err != nil {
+		return err
+	}
+
+	issTLE, err := loadISSElements(next.issTLEFile)
+	if err != nil {
+		return err
+	}
+
+	// Likewise presets saved without a presets file are kept.
+	presets := s.presetSet()
+	if next.presetsPath() != "" {
+		if presets, err = loadPresets(next.presetsPath()); err != nil {
+			return err
+		}
+	}
+
+	schedules, err := loadSchedules(next.schedulesFile, next, presets)
+	if err != nil {
+		return err
+	}
+
+	s.limiter.SetLimits(next.rateLimit, next.rateWindow)
+	s.limiter.SetMaxBuckets(next.rateMaxClients)
+	if current := s.keys.Load(); keys != nil && current != nil && current.Path() == keys.Path() {
+		keys.Adopt(current)
+	}
+	s.keys.Store(keys)
+	s.jwt.Store(jwtAuth)
+	s.countries.Store(countries)
+	s.timezones.Store(timezones)
+	s.cities.Store(cities)
+	s.airports.Store(airports)
+	s.elevation.Store(elevationGrid)
+	s.population.Store(populationGrid)
+	if masks != nil {
+		s.maskMu.Lock()
+		s.masks.Store(&masks)
+		s.maskMu.Unlock()
+	}
+	if next.presetsPath() != "" {
+		s.presetMu.Lock()
+		s.presets.Store(&presets)
+		s.presetMu.Unlock()
+	}
+	s.geoip.Store(geoip)
+	s.issTLE.Store(issTLE)
+	s.schedules.Store(&schedules)
+	s.cfg.Store(&next)
+	// A switch made at /admin/maintenance survives reloads that leave the
+	// maintenance settings alone.
+	if next.maintenanceEnabled != current.maintenanceEnabled || next.maintenanceMessage != current.maintenanceMessage {
+		s.maintenance.Store(maintenanceFromConfig(next))
+	}
+	s.cache.Store(newRenderCache(next.cacheMaxEntries, next.cacheTTL))
+	go s.warmup()
+
+	log.Printf("config reloaded: width=%d..%d supersample=%d..%d margin<=%d rate=%d/%s", next.minWidth, next.maxWidth, next.minSupersample, next.maxSupersample, next.maxMargin, next.rateLimit, next.rateWindow)
+	return nil
+}
+
+// reloadKeys reads the keys file at path into a new store, leaving the
+// serving one alone until the reload commits. A store read from the file
+// already in use adopts its managed keys then.
+func (s *server) reloadKeys(path string) (*apikey.Store, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	var keys *apikey.Store
+	var err error
+	if current := s.keys.Load(); current != nil && current.Path() == path {
+		keys, err = apikey.LoadFile(path)
+	} else {
+		keys, err = s.loadKeys(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tiers, count := keys.Counts()
+	log.Printf("keys read from %s: tiers=%d keys=%d", path, tiers, count)
+	return keys, nil
+}
+
+// loadKeys reads the keys file along with the keys managed through the
+// admin API, which are kept in the state directory when there is one.
+func (s *server) loadKeys(path string) (*apikey.Store, error) {
+	keys, err := apikey.LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if s.state != nil {
+		if err := keys.UseStorage(s.state, s.config().stateSecret); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
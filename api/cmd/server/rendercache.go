@@ -0,0 +1,314 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"map-ascii-generator/api/internal/render"
+)
+
+const (
+	defaultCacheMaxEntries = 256
+	defaultCacheTTL        = time.Hour
+	defaultCacheMaxAge     = 5 * time.Minute
+
+	// Coordinates are kept to 4 decimals, about 11 m, far below a cell
+	// at the widest map, and char_aspect to 2.
+	coordDecimals  = 4
+	aspectDecimals = 2
+)
+
+// renderCache keeps recent render results by request, least recently used
+// first out. Data a render depends on, like masks and datasets, can change
+// on reload or upload, which purges it.
+type renderCache struct {
+	mu      sync.Mutex
+	max     int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type cacheEntry struct {
+	key     string
+	resp    generateResponse
+	expires time.Time
+}
+
+// newRenderCache returns a cache of up to maxEntries results, or nil,
+// which caches nothing, when maxEntries is 0.
+func newRenderCache(maxEntries int, ttl time.Duration) *renderCache {
+	if maxEntries <= 0 || ttl <= 0 {
+		return nil
+	}
+	return &renderCache{max: maxEntries, ttl: ttl, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+func (c *renderCache) get(key string) (generateResponse, bool) {
+	if c == nil {
+		return generateResponse{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return generateResponse{}, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return generateResponse{}, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.resp, true
+}
+
+func (c *renderCache) put(key string, resp generateResponse) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{key: key, resp: resp, expires: time.Now().Add(c.ttl)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *renderCache) purge() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+func (c *renderCache) len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// renderCacheKey identifies the result of req, which must be validated
+// and have its places resolved. Requests whose result depends on the time
+// or on live feeds, and renders with an uploaded overlay, are not cached.
+func renderCacheKey(req generateRequest, overlay *render.Overlay) (string, bool) {
+	if overlay != nil || liveRequest(req) {
+		return "", false
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), true
+}
+
+// canonicalRequest rewrites a validated req so that requests that draw
+// the same map are equal: option names are trimmed and lowercased like
+// their parsers read them, country codes sorted, coordinates and
+// char_aspect rounded, and the settings of features that are off
+// cleared. The map is drawn from the result, so a cached map is exactly
+// what its request would render.
+func canonicalRequest(req generateRequest) generateRequest {
+	canonical := func(value string) string {
+		return strings.ToLower(strings.TrimSpace(value))
+	}
+	req.FrameStyle = canonical(req.FrameStyle)
+	req.FooterAlign = canonical(req.FooterAlign)
+	req.Marker.Style = canonical(req.Marker.Style)
+	req.Density.Scale = canonical(req.Density.Scale)
+	req.Choropleth.Scale = canonical(req.Choropleth.Scale)
+	for _, attrs := range []*[]string{&req.Color.MarkerAttrs, &req.Color.LabelAttrs, &req.Color.FrameAttrs} {
+		names := make([]string, len(*attrs))
+		for i, name := range *attrs {
+			names[i] = canonical(name)
+		}
+		slices.Sort(names)
+		*attrs = slices.Compact(names)
+	}
+
+	codes := make([]string, len(req.Highlight))
+	for i, code := range req.Highlight {
+		codes[i] = strings.ToUpper(strings.TrimSpace(code))
+	}
+	slices.Sort(codes)
+	req.Highlight = slices.Compact(codes)
+
+	req.CharAspect = round(req.CharAspect, aspectDecimals)
+	req.CentralMeridian = round(req.CentralMeridian, coordDecimals)
+	req.Center.Lon, req.Center.Lat = round(req.Center.Lon, coordDecimals), round(req.Center.Lat, coordDecimals)
+	req.Marker.Lon, req.Marker.Lat = round(req.Marker.Lon, coordDecimals), round(req.Marker.Lat, coordDecimals)
+	markers := slices.Clone(req.Markers)
+	for i := range markers {
+		markers[i].Lon, markers[i].Lat = round(markers[i].Lon, coordDecimals), round(markers[i].Lat, coordDecimals)
+	}
+	req.Markers = markers
+
+	if req.Projection != string(render.ProjectionOrthographic) {
+		req.Center.Lon, req.Center.Lat = 0, 0
+	}
+	defaults := defaultGenerateRequest(config{})
+	if !req.Marker.Enabled && len(req.Markers) == 0 {
+		req.Marker = defaults.Marker
+	}
+	if !req.Graticule.Enabled {
+		req.Graticule = defaults.Graticule
+	}
+	if !req.Borders {
+		req.BorderChar = ""
+	}
+	if len(req.Highlight) == 0 {
+		req.HighlightChar = ""
+	}
+	if !req.Terrain {
+		req.TerrainRamp, req.TerrainLegend = "", false
+	}
+	return req
+}
+
+func round(value float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(value*scale) / scale
+}
+
+// liveRequest reports whether the map of req depends on the current time
+// or a live feed, so it must be drawn afresh every time.
+func liveRequest(req generateRequest) bool {
+	switch {
+	case req.Marker.UseClientIP, req.Marker.LocalTime:
+		return true
+	case req.Timezones.Enabled:
+		return true
+	case req.ISS.Enabled, req.Earthquakes.Enabled, req.Weather.Variable != "":
+		return true
+	case req.Satellite.TLE != "" && req.Satellite.Start == "":
+		return true
+	case (req.Celestial.Sun || req.Celestial.Moon) && req.Celestial.Time == "":
+		return true
+	}
+	return false
+}
+
+// cacheStatus collects what the renders of a request were, for the
+// caching headers of its response.
+type cacheStatus struct {
+	rendered bool
+	live     bool
+	looked   bool
+	missed   bool
+}
+
+type cacheStatusContext struct{}
+
+func requestCacheStatus(r *http.Request) *cacheStatus {
+	status, ok := r.Context().Value(cacheStatusContext{}).(*cacheStatus)
+	if !ok {
+		// A detached job or warmup render: nothing to answer.
+		return &cacheStatus{}
+	}
+	return status
+}
+
+// noteRender records a render of r, live when its map changes over time.
+func noteRender(r *http.Request, live bool) {
+	status := requestCacheStatus(r)
+	status.rendered = true
+	status.live = status.live || live
+}
+
+func noteCache(r *http.Request, hit bool) {
+	status := requestCacheStatus(r)
+	status.looked = true
+	status.missed = status.missed || !hit
+}
+
+// withCacheHeaders sets the caching headers of successful responses with
+// a map, just before the response starts. X-Cache is HIT when every map
+// came from the render cache and MISS when any was rendered. Cache-Control
+// lets browsers and CDNs keep the response for cache.max_age, or forbids
+// storing it when a map is live. Handlers that set Cache-Control
+// themselves keep theirs.
+func (s *server) withCacheHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := &cacheStatus{}
+		r = r.WithContext(context.WithValue(r.Context(), cacheStatusContext{}, status))
+		next.ServeHTTP(&cacheStatusWriter{ResponseWriter: w, status: status, maxAge: s.config().cacheMaxAge}, r)
+	})
+}
+
+type cacheStatusWriter struct {
+	http.ResponseWriter
+	status  *cacheStatus
+	maxAge  time.Duration
+	started bool
+}
+
+func (w *cacheStatusWriter) start(code int) {
+	if w.started {
+		return
+	}
+	w.started = true
+	if !w.status.rendered || code != http.StatusOK {
+		return
+	}
+
+	header := w.Header()
+	switch {
+	case !w.status.looked:
+	case w.status.missed:
+		header.Set("X-Cache", "MISS")
+	default:
+		header.Set("X-Cache", "HIT")
+	}
+	if header.Get("Cache-Control") != "" {
+		return
+	}
+	switch {
+	case w.status.live:
+		header.Set("Cache-Control", "no-store")
+	case w.maxAge > 0:
+		header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(w.maxAge.Seconds())))
+		header.Set("Expires", time.Now().Add(w.maxAge).UTC().Format(http.TimeFormat))
+	}
+}
+
+func (w *cacheStatusWriter) WriteHeader(code int) {
+	w.start(code)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheStatusWriter) Write(b []byte) (int, error) {
+	w.start(http.StatusOK)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *cacheStatusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// errRenderBusy means every render slot stayed taken until the request's
+// deadline; it is answered with 503 like an unavailable feed.
+var errRenderBusy = fmt.Errorf("render capacity %w", errUnavailable)
+
+// renderSlots caps the renders running at once across all clients, so a
+// burst from many distinct clients, each within its own rate limit, cannot
+// starve the process of CPU. A nil renderSlots has no cap.
+type renderSlots chan struct{}
+
+func defaultMaxRenders() int {
+	return runtime.NumCPU()
+}
+
+func newRenderSlots(n int) renderSlots {
+	if n <= 0 {
+		return nil
+	}
+	return make(renderSlots, n)
+}
+
+// acquire waits for a free slot until ctx is done and returns the function
+// that frees it.
+func (s renderSlots) acquire(ctx context.Context) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	select {
+	case s <- struct{}{}:
+		return func() { <-s }, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, errRenderBusy
+		}
+		return nil, ctx.Err()
+	}
+}
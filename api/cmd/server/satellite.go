@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"map-ascii-generator/api/internal/geo"
+	"map-ascii-generator/api/internal/orbit"
+	"map-ascii-generator/api/internal/render"
+)
+
+const (
+	maxTLELength                 = 300
+	defaultSatelliteMinutes      = 90
+	maxSatelliteMinutes          = 1440
+	defaultSatelliteTickMinutes  = 15
+	maxSatelliteTicks            = 48
+	defaultSatelliteTrackChar    = '~'
+	defaultSatelliteTickChar     = '+'
+	satelliteTickLabelTimeLayout = "15:04"
+)
+
+// satelliteMeta describes the drawn ground track. Ticks are listed in time
+// order with where they were drawn, like meta.markers.
+type satelliteMeta struct {
+	Name          string          `json:"name,omitempty"`
+	CatalogNumber int             `json:"catalog_number"`
+	Epoch         time.Time       `json:"epoch"`
+	Start         time.Time       `json:"start"`
+	End           time.Time       `json:"end"`
+	Ticks         []satelliteTick `json:"ticks,omitempty"`
+}
+
+type satelliteTick struct {
+	Time    time.Time `json:"time"`
+	Lon     float64   `json:"lon"`
+	Lat     float64   `json:"lat"`
+	Row     int       `json:"row"`
+	Col     int       `json:"col"`
+	Visible bool      `json:"visible"`
+}
+
+// satelliteLayer is the ground track and tick markers for satellite.tle.
+type satelliteLayer struct {
+	track render.Track
+	ticks []render.Marker
+	meta  satelliteMeta
+}
+
+// requestSatellite propagates the satellite from satellite.tle over
+// satellite.minutes from satellite.start, or from now when start is empty.
+func requestSatellite(req generateRequest, now time.Time) (*satelliteLayer, error) {
+	if strings.TrimSpace(req.Satellite.TLE) == "" {
+		return nil, nil
+	}
+	if len(req.Satellite.TLE) > maxTLELength {
+		return nil, fmt.Errorf("satellite.tle must be at most %d bytes", maxTLELength)
+	}
+	tle, err := orbit.ParseTLE(req.Satellite.TLE)
+	if err != nil {
+		return nil, fmt.Errorf("satellite.tle: %w", err)
+	}
+	sat, err := orbit.NewSatellite(tle)
+	if err != nil {
+		return nil, fmt.Errorf("satellite.tle: %w", err)
+	}
+
+	start := now.UTC()
+	if raw := strings.TrimSpace(req.Satellite.Start); raw != "" {
+		if start, err = time.Parse(time.RFC3339, raw); err != nil {
+			return nil, fmt.Errorf("satellite.start must be an RFC 3339 timestamp")
+		}
+		start = start.UTC()
+	}
+
+	minutes, tickMinutes := req.Satellite.Minutes, req.Satellite.TickMinutes
+	if minutes < 1 || minutes > maxSatelliteMinutes {
+		return nil, fmt.Errorf("satellite.minutes must be between 1 and %d", maxSatelliteMinutes)
+	}
+	if tickMinutes < 0 || tickMinutes > 0 && minutes/tickMinutes+1 > maxSatelliteTicks {
+		return nil, fmt.Errorf("satellite.tick_minutes must be 0 or leave at most %d ticks over satellite.minutes", maxSatelliteTicks)
+	}
+	trackChar, err := parseRune(req.Satellite.TrackChar, defaultSatelliteTrackChar, "satellite.track_char", req.AllowUnicode)
+	if err != nil {
+		return nil, err
+	}
+	tickChar, tickGlyph, err := parseGlyph(req.Satellite.TickChar, defaultSatelliteTickChar, "satellite.tick_char", req.AllowUnicode)
+	if err != nil {
+		return nil, err
+	}
+
+	points, err := groundTrack(sat, start, minutes)
+	if err != nil {
+		return nil, fmt.Errorf("satellite.tle: %w", err)
+	}
+
+	layer := &satelliteLayer{
+		track: render.Track{Points: points, Char: trackChar},
+		meta: satelliteMeta{
+			Name:          tle.Name,
+			CatalogNumber: tle.CatalogNumber,
+			Epoch:         tle.Epoch,
+			Start:         start,
+			End:           start.Add(time.Duration(minutes) * time.Minute),
+		},
+	}
+	for minute := 0; tickMinutes > 0 && minute <= minutes; minute += tickMinutes {
+		at := start.Add(time.Duration(minute) * time.Minute)
+		tick := render.Marker{Lon: points[minute].Lon(), Lat: points[minute].Lat(), Style: render.MarkerDot, Center: tickChar, CenterGlyph: tickGlyph}
+		if req.Satellite.TickLabels {
+			tick.Label = at.Format(satelliteTickLabelTimeLayout)
+		}
+		layer.ticks = append(layer.ticks, tick)
+		layer.meta.Ticks = append(layer.meta.Ticks, satelliteTick{Time: at, Lon: tick.Lon, Lat: tick.Lat})
+	}
+	return layer, nil
+}
+
+// groundTrack samples the sub-satellite point every minute from start, so
+// point i is i minutes after start.
+func groundTrack(sat *orbit.Satellite, start time.Time, minutes int) ([]geo.Point, error) {
+	points := make([]geo.Point, 0, minutes+1)
+	for minute := 0; minute <= minutes; minute++ {
+		lon, lat, err := sat.SubPoint(start.Add(time.Duration(minute) * time.Minute))
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, geo.Point{lon, lat})
+	}
+	return points, nil
+}
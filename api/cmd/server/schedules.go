@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"map-ascii-generator/api/internal/cron"
+	"map-ascii-generator/api/internal/simpleyaml"
+)
+
+const (
+	webhookTimeout = 10 * time.Second
+	// discordMaxContent is the longest message Discord accepts.
+	discordMaxContent = 2000
+)
+
+const (
+	webhookHTTP    = "http"
+	webhookSlack   = "slack"
+	webhookDiscord = "discord"
+)
+
+var webhookFormats = []string{webhookHTTP, webhookSlack, webhookDiscord}
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// schedule renders request whenever cron matches, posts the result to
+// webhook and uploads it to object storage, whichever are set.
+type schedule struct {
+	name     string
+	cron     cron.Schedule
+	location *time.Location
+	request  json.RawMessage
+	webhook  string
+	format   string
+	color    bool
+	upload   *scheduleUpload
+}
+
+// scheduleDelivery is the body posted to plain HTTP webhooks.
+type scheduleDelivery struct {
+	Schedule string           `json:"schedule"`
+	Time     time.Time        `json:"time"`
+	Result   generateResponse `json:"result"`
+}
+
+// loadSchedules reads the schedules file; the requests are checked against
+// cfg, but each run renders with the settings current at that time.
+func loadSchedules(path string, cfg config, presets presetSet) ([]schedule, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read schedules file: %w", err)
+	}
+	doc, err := simpleyaml.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse schedules file %s: %w", path, err)
+	}
+
+	rawSchedules, ok := doc["schedules"].([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: schedules must be a list", path)
+	}
+	schedules := make([]schedule, 0, len(rawSchedules))
+	for idx, raw := range rawSchedules {
+		fields, ok := raw.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: schedules[%d] must be a mapping", path, idx)
+		}
+		sc, err := parseSchedule(fields, cfg, presets)
+		if err != nil {
+			return nil, fmt.Errorf("%s: schedules[%d]: %w", path, idx, err)
+		}
+		if slices.ContainsFunc(schedules, func(other schedule) bool { return other.name == sc.name }) {
+			return nil, fmt.Errorf("%s: schedules[%d]: duplicate name %q", path, idx, sc.name)
+		}
+		schedules = append(schedules, sc)
+	}
+	return schedules, nil
+}
+
+func parseSchedule(fields map[string]any, cfg config, presets presetSet) (schedule, error) {
+	field := func(name string) string {
+		value, _ := fields[name].(string)
+		return strings.TrimSpace(value)
+	}
+
+	sc := schedule{name: field("name"), webhook: field("webhook"), format: strings.ToLower(field("format"))}
+	if sc.name == "" {
+		return schedule{}, fmt.Errorf("name must not be empty")
+	}
+
+	var err error
+	if sc.cron, err = cron.Parse(field("cron")); err != nil {
+		return schedule{}, err
+	}
+
+	sc.location = time.UTC
+	if tz := field("timezone"); tz != "" {
+		if sc.location, err = time.LoadLocation(tz); err != nil {
+			return schedule{}, fmt.Errorf("unknown timezone %q", tz)
+		}
+	}
+
+	sc.request = json.RawMessage(field("request"))
+	if len(sc.request) == 0 {
+		sc.request = json.RawMessage("{}")
+	}
+	req, err := parseGenerateRequest(sc.request, cfg, presets)
+	if err != nil {
+		return schedule{}, fmt.Errorf("request: %w", err)
+	}
+	if err := validateRequest(req, cfg); err != nil {
+		return schedule{}, fmt.Errorf("request: %w", err)
+	}
+
+	if rawUpload, ok := fields["upload"]; ok {
+		upload, ok := rawUpload.(map[string]any)
+		if !ok {
+			return schedule{}, fmt.Errorf("upload must be a mapping")
+		}
+		if sc.upload, err = parseScheduleUpload(upload, cfg); err != nil {
+			return schedule{}, fmt.Errorf("upload: %w", err)
+		}
+	}
+	if sc.webhook == "" && sc.upload == nil {
+		return schedule{}, fmt.Errorf("a webhook or an upload is required")
+	}
+
+	if sc.webhook != "" {
+		target, err := url.Parse(sc.webhook)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return schedule{}, fmt.Errorf("webhook must be an http or https URL")
+		}
+	}
+	if sc.format == "" {
+		sc.format = webhookHTTP
+	}
+	if !slices.Contains(webhookFormats, sc.format) {
+		return schedule{}, fmt.Errorf("format must be one of: %s", strings.Join(webhookFormats, ", "))
+	}
+	if raw := field("color"); raw != "" {
+		if sc.color, err = strconv.ParseBool(raw); err != nil {
+			return schedule{}, fmt.Errorf("color must be true or false")
+		}
+	}
+
+	return sc, nil
+}
+
+// runSchedules starts every schedule that matches at the top of each
+// minute. Reloaded schedules apply from the next minute on.
+func (s *server) runSchedules() {
+	for {
+		next := time.Now().Truncate(time.Minute).Add(time.Minute)
+		time.Sleep(time.Until(next))
+
+		schedules := s.schedules.Load()
+		if schedules == nil {
+			continue
+		}
+		for _, sc := range *schedules {
+			if sc.cron.Matches(next.In(sc.location)) {
+				go s.runSchedule(sc, next)
+			}
+		}
+	}
+}
+
+func (s *server) runSchedule(sc schedule, at time.Time) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("schedule %s: panic: %v\n%s", sc.name, p, debug.Stack())
+		}
+	}()
+
+	cfg := s.config()
+	req, err := parseGenerateRequest(sc.request, cfg, s.presetSet())
+	if err != nil {
+		log.Printf("schedule %s: %v", sc.name, err)
+		return
+	}
+	// Scheduled renders have no client, so marker.use_client_ip fails.
+	resp, err := s.generate(&http.Request{Header: http.Header{}}, req, cfg, nil)
+	if err != nil {
+		log.Printf("schedule %s: render failed: %v", sc.name, err)
+		return
+	}
+
+	if sc.webhook != "" {
+		if err := postWebhook(sc, at, resp); err != nil {
+			log.Printf("schedule %s: %v", sc.name, err)
+		} else {
+			log.Printf("schedule %s: delivered to %s webhook", sc.name, sc.format)
+		}
+	}
+	if sc.upload != nil {
+		keys, err := uploadSchedule(cfg, sc, at, resp)
+		if err != nil {
+			log.Printf("schedule %s: %v", sc.name, err)
+		}
+		if len(keys) > 0 {
+			log.Printf("schedule %s: uploaded %s", sc.name, strings.Join(keys, ", "))
+		}
+	}
+}
+
+func postWebhook(sc schedule, at time.Time, resp generateResponse) error {
+	payload, err := webhookPayload(sc, at, resp)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	post, err := http.NewRequestWithContext(ctx, http.MethodPost, sc.webhook, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	post.Header.Set("Content-Type", "application/json")
+	post.Header.Set("User-Agent", "map-ascii-generator")
+
+	result, err := webhookClient.Do(post)
+	if err != nil {
+		// The error repeats the URL, which often embeds a token.
+		return fmt.Errorf("webhook request failed")
+	}
+	result.Body.Close()
+	if result.StatusCode < 200 || result.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", result.Status)
+	}
+	return nil
+}
+
+// webhookPayload formats resp for the schedule's webhook: a code block
+// message for Slack and Discord, the full response otherwise.
+func webhookPayload(sc schedule, at time.Time, resp generateResponse) ([]byte, error) {
+	switch sc.format {
+	case webhookSlack:
+		return json.Marshal(map[string]string{"text": "```\n" + resp.Plain + "\n```"})
+	case webhookDiscord:
+		content := discordMessage(resp, sc.color)
+		if n := utf8.RuneCountInString(content); n > discordMaxContent {
+			return nil, fmt.Errorf("message is %d characters, Discord allows %d; use a smaller width", n, discordMaxContent)
+		}
+		return json.Marshal(map[string]string{"content": content})
+	default:
+		return json.Marshal(scheduleDelivery{Schedule: sc.name, Time: at.UTC(), Result: resp})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"map-ascii-generator/api/internal/raster"
+	"map-ascii-generator/api/internal/render"
+)
+
+const maxSeaLevelOffset = 500
+
+// errElevationDisabled is returned for features that need an elevation
+// model when neither data.elevation_file nor the build provides one.
+var errElevationDisabled = errors.New("no elevation model is configured (set data.elevation_file)")
+
+// loadElevation reads the configured elevation grid, falling back to the
+// one embedded by the Docker build. It returns nil when there is neither.
+func loadElevation(path string) (*raster.Grid, error) {
+	if path == "" {
+		return raster.EmbeddedElevation()
+	}
+	return raster.LoadFile(path)
+}
+
+func seaLevelSettings(req generateRequest) error {
+	if !isFinite(req.SeaLevelOffset) || req.SeaLevelOffset < -maxSeaLevelOffset || req.SeaLevelOffset > maxSeaLevelOffset {
+		return fmt.Errorf("sea_level_offset_m must be between %d and %d", -maxSeaLevelOffset, maxSeaLevelOffset)
+	}
+	return nil
+}
+
+// requestSeaLevel returns nil when the sea stays where the land mask has it.
+func (s *server) requestSeaLevel(req generateRequest) (*render.SeaLevel, error) {
+	if err := seaLevelSettings(req); err != nil {
+		return nil, err
+	}
+	if req.SeaLevelOffset == 0 {
+		return nil, nil
+	}
+	elevation := s.elevation.Load()
+	if elevation == nil {
+		return nil, fmt.Errorf("sea_level_offset_m: %w", errElevationDisabled)
+	}
+	return &render.SeaLevel{Elevation: elevation.Sample, Offset: req.SeaLevelOffset}, nil
+}
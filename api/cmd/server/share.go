@@ -0,0 +1,276 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"map-ascii-generator/api/internal/storage"
+)
+
+// A share token is a random ID, the expiry as Unix seconds and a truncated
+// HMAC-SHA256 of both, base64url encoded into 30 characters. The render
+// parameters stay on the server, and a forged or altered token is rejected
+// without a lookup.
+const (
+	shareCollection = "shares"
+	shareIDBytes    = 8
+	shareMACBytes   = 10
+	shareTokenBytes = shareIDBytes + 4 + shareMACBytes
+
+	defaultShareTTL   = 24 * time.Hour
+	shareSweepEvery   = 10 * time.Minute
+	shareMinRemaining = time.Second
+)
+
+type shareResponse struct {
+	URL     string    `json:"url"`
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// sharedRender is a render kept for a share link until it expires.
+type sharedRender struct {
+	Expires time.Time        `json:"expires"`
+	Render  generateResponse `json:"render"`
+}
+
+// shareStore keeps shared renders in memory, and in the state directory
+// when there is one so that links survive a restart. Expired renders are
+// swept every shareSweepEvery.
+type shareStore struct {
+	mu      sync.Mutex
+	renders map[string]sharedRender
+	dir     storage.Store
+	// key signs tokens when share.secret is not set.
+	key []byte
+}
+
+func newShareStore(dir storage.Store) (*shareStore, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	st := &shareStore{renders: make(map[string]sharedRender), dir: dir, key: key}
+	go st.sweep()
+	return st, nil
+}
+
+func (st *shareStore) put(id string, shared sharedRender) error {
+	if st.dir != nil {
+		return st.dir.Put(shareCollection, id, shared)
+	}
+	st.mu.Lock()
+	st.renders[id] = shared
+	st.mu.Unlock()
+	return nil
+}
+
+func (st *shareStore) get(id string) (sharedRender, bool, error) {
+	if st.dir != nil {
+		var shared sharedRender
+		ok, err := st.dir.Get(shareCollection, id, &shared)
+		return shared, ok, err
+	}
+	st.mu.Lock()
+	shared, ok := st.renders[id]
+	st.mu.Unlock()
+	return shared, ok, nil
+}
+
+// expire deletes the renders that expired before now.
+func (st *shareStore) expire(now time.Time) error {
+	if st.dir == nil {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		for id, shared := range st.renders {
+			if now.After(shared.Expires) {
+				delete(st.renders, id)
+			}
+		}
+		return nil
+	}
+
+	ids, err := st.dir.Keys(shareCollection)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		shared, ok, err := st.get(id)
+		if err != nil || !ok || !now.After(shared.Expires) {
+			continue
+		}
+		if err := st.dir.Delete(shareCollection, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (st *shareStore) sweep() {
+	ticker := time.NewTicker(shareSweepEvery)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if err := st.expire(now); err != nil {
+			log.Printf("share sweep failed: %v", err)
+		}
+	}
+}
+
+// shareKey signs share tokens: share.secret, or a key drawn at startup,
+// whose links end with the process.
+func (s *server) shareKey() []byte {
+	if secret := s.config().shareSecret; secret != "" {
+		return []byte(secret)
+	}
+	return s.shares.key
+}
+
+func shareMAC(key []byte, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return mac.Sum(nil)[:shareMACBytes]
+}
+
+func newShareToken(key []byte, expires time.Time) (token string, id string, err error) {
+	raw := make([]byte, shareTokenBytes)
+	if _, err := rand.Read(raw[:shareIDBytes]); err != nil {
+		return "", "", err
+	}
+	binary.BigEndian.PutUint32(raw[shareIDBytes:], uint32(expires.Unix()))
+	copy(raw[shareIDBytes+4:], shareMAC(key, raw[:shareIDBytes+4]))
+	return base64.RawURLEncoding.EncodeToString(raw), hex.EncodeToString(raw[:shareIDBytes]), nil
+}
+
+// parseShareToken checks the signature of token and returns the ID of its
+// render and when it expires.
+func parseShareToken(key []byte, token string) (string, time.Time, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != shareTokenBytes {
+		return "", time.Time{}, false
+	}
+	if !hmac.Equal(raw[shareIDBytes+4:], shareMAC(key, raw[:shareIDBytes+4])) {
+		return "", time.Time{}, false
+	}
+	expires := time.Unix(int64(binary.BigEndian.Uint32(raw[shareIDBytes:])), 0).UTC()
+	return hex.EncodeToString(raw[:shareIDBytes]), expires, true
+}
+
+// handleShare renders a generate request like /api/generate and keeps the
+// result behind a signed link at /r/{token} for share.ttl, or for the
+// shorter ttl query parameter.
+func (s *server) handleShare(w http.ResponseWriter, r *http.Request) {
+	limits, ok := s.admitGenerate(w, r)
+	if !ok {
+		return
+	}
+
+	cfg := s.config()
+	ttl := cfg.shareTTL
+	if raw := r.URL.Query().Get("ttl"); raw != "" {
+		value, err := time.ParseDuration(raw)
+		if err != nil || value <= 0 || value > cfg.shareTTL {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("ttl must be a duration between 1s and %s", cfg.shareTTL))
+			return
+		}
+		ttl = value
+	}
+
+	req, err := decodeGenerateRequest(w, r, limits, s.presetSet())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	resp, err := s.generate(r, req, limits, nil)
+	if err != nil {
+		writeError(w, generateStatus(err), err)
+		return
+	}
+	s.recordHistory(r, req, resp, nil)
+
+	expires := time.Now().Add(ttl).Truncate(time.Second).UTC()
+	token, id, err := newShareToken(s.shareKey(), expires)
+	if err == nil {
+		err = s.shares.put(id, sharedRender{Expires: expires, Render: resp})
+	}
+	if err != nil {
+		log.Printf("share store failed: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to store the shared render")
+		return
+	}
+
+	path := s.link("/r/" + token)
+	w.Header().Set("Location", path)
+	writeJSON(w, http.StatusCreated, shareResponse{
+		URL:     strings.TrimSuffix(cfg.shareBaseURL, "/") + path,
+		Token:   token,
+		Expires: expires,
+	})
+}
+
+// handleSharedRender serves a shared render as text, in color for terminal
+// clients or with color=1, or as the generate response to clients that
+// accept JSON. Links stay cacheable until they expire.
+func (s *server) handleSharedRender(w http.ResponseWriter, r *http.Request) {
+	id, expires, ok := parseShareToken(s.shareKey(), r.PathValue("token"))
+	if !ok {
+		http.Error(w, "share link not found", http.StatusNotFound)
+		return
+	}
+	remaining := time.Until(expires)
+	if remaining < shareMinRemaining {
+		http.Error(w, "share link expired", http.StatusGone)
+		return
+	}
+
+	color := isTerminalClient(r.UserAgent())
+	rawColor := r.URL.Query().Get("color")
+	if rawColor != "" {
+		value, err := strconv.ParseBool(rawColor)
+		if err != nil {
+			http.Error(w, "color must be 0 or 1", http.StatusBadRequest)
+			return
+		}
+		color = value
+	}
+
+	shared, ok, err := s.shares.get(id)
+	if err != nil {
+		log.Printf("share lookup failed: %v", err)
+		http.Error(w, "failed to look up the shared render", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "share link not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(remaining.Seconds())))
+	w.Header().Set("Expires", expires.Format(http.TimeFormat))
+	w.Header().Add("Vary", "Accept")
+	if rawColor == "" {
+		w.Header().Add("Vary", "User-Agent")
+	}
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeJSON(w, http.StatusOK, shared.Render)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if color {
+		_, _ = w.Write([]byte(shared.Render.ANSI))
+	} else {
+		_, _ = w.Write([]byte(shared.Render.Plain))
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// statsSlots is how many minutes of history the rolling window can
+	// cover.
+	statsSlots          = 60
+	defaultStatsWindow  = 5 * time.Minute
+	defaultStatsFormat  = "default"
+	histogramBuckets    = 96
+	histogramBase       = 100 * time.Microsecond
+	histogramPerDoubled = 4
+)
+
+// histogram counts durations in buckets that grow by a quarter power of
+// two from histogramBase, about 19% apart, up to half an hour. Quantiles
+// are interpolated within a bucket.
+type histogram [histogramBuckets]uint64
+
+func histogramBucket(d time.Duration) int {
+	if d <= histogramBase {
+		return 0
+	}
+	i := int(math.Ceil(math.Log2(float64(d)/float64(histogramBase)) * histogramPerDoubled))
+	return min(i, histogramBuckets-1)
+}
+
+// bucketBound is the upper bound of bucket i.
+func bucketBound(i int) float64 {
+	return float64(histogramBase) * math.Pow(2, float64(i)/histogramPerDoubled)
+}
+
+// quantile returns the q quantile of the n durations in h, at most
+// longest.
+func (h *histogram) quantile(q float64, n uint64, longest time.Duration) time.Duration {
+	if n == 0 {
+		return 0
+	}
+	rank := q * float64(n)
+	var seen float64
+	for i, count := range h {
+		if count == 0 {
+			continue
+		}
+		if seen+float64(count) >= rank {
+			lower := 0.0
+			if i > 0 {
+				lower = bucketBound(i - 1)
+			}
+			d := time.Duration(lower + (bucketBound(i)-lower)*(rank-seen)/float64(count))
+			return min(d, longest)
+		}
+		seen += float64(count)
+	}
+	return longest
+}
+
+// statsCounts are the counters kept since start and for each minute.
+type statsCounts struct {
+	requests    uint64
+	bytes       int64
+	renders     uint64
+	failed      uint64
+	cacheHits   uint64
+	cacheMisses uint64
+	formats     map[string]uint64
+	durations   histogram
+	durationSum time.Duration
+	durationMax time.Duration
+}
+
+func (c *statsCounts) add(o *statsCounts) {
+	c.requests += o.requests
+	c.bytes += o.bytes
+	c.renders += o.renders
+	c.failed += o.failed
+	c.cacheHits += o.cacheHits
+	c.cacheMisses += o.cacheMisses
+	for format, n := range o.formats {
+		c.formats[format] += n
+	}
+	for i, n := range o.durations {
+		c.durations[i] += n
+	}
+	c.durationSum += o.durationSum
+	c.durationMax = max(c.durationMax, o.durationMax)
+}
+
+func newStatsCounts() *statsCounts {
+	return &statsCounts{formats: make(map[string]uint64)}
+}
+
+// stats keeps operational counters for GET /api/stats: totals since start,
+// and per-minute slots for a rolling window over the last hour.
+type stats struct {
+	start time.Time
+
+	mu    sync.Mutex
+	total *statsCounts
+	slots [statsSlots]*statsCounts
+	// minutes holds the minute, counted from the Unix epoch, each slot is
+	// for; a slot for an older minute is stale.
+	minutes [statsSlots]int64
+}
+
+func newStats(now time.Time) *stats {
+	return &stats{start: now, total: newStatsCounts()}
+}
+
+// slot returns the counters of the minute of now, clearing a stale slot.
+// The caller holds mu.
+func (st *stats) slot(now time.Time) *statsCounts {
+	minute := now.Unix() / 60
+	i := minute % statsSlots
+	if st.slots[i] == nil || st.minutes[i] != minute {
+		st.slots[i], st.minutes[i] = newStatsCounts(), minute
+	}
+	return st.slots[i]
+}
+
+func (st *stats) update(now time.Time, apply func(*statsCounts)) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	apply(st.total)
+	apply(st.slot(now))
+}
+
+// recordRender counts a run of the render pipeline for a request in
+// format: a render and how long it took, or a failure.
+func (st *stats) recordRender(format string, took time.Duration, err error) {
+	if format == "" {
+		format = defaultStatsFormat
+	}
+	bucket := histogramBucket(took)
+	st.update(time.Now(), func(c *statsCounts) {
+		if err != nil {
+			c.failed++
+			return
+		}
+		c.renders++
+		c.formats[format]++
+		c.durations[bucket]++
+		c.durationSum += took
+		c.durationMax = max(c.durationMax, took)
+	})
+}
+
+// recordResponse counts an answered request, its body size and whether it
+// was served from a cache, as the X-Cache header says.
+func (st *stats) recordResponse(bytes int64, cache string) {
+	st.update(time.Now(), func(c *statsCounts) {
+		c.requests++
+		c.bytes += bytes
+		switch strings.ToLower(cache) {
+		case "hit":
+			c.cacheHits++
+		case "miss":
+			c.cacheMisses++
+		}
+	})
+}
+
+// window sums the slots of the minutes within d of now, the current one
+// included.
+func (st *stats) window(now time.Time, d time.Duration) *statsCounts {
+	minutes := int64(max(d.Round(time.Minute)/time.Minute, 1))
+	current := now.Unix() / 60
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sum := newStatsCounts()
+	for i, slot := range st.slots {
+		if slot != nil && current-st.minutes[i] < minutes {
+			sum.add(slot)
+		}
+	}
+	return sum
+}
+
+func (st *stats) sinceStart() *statsCounts {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sum := newStatsCounts()
+	sum.add(st.total)
+	return sum
+}
+
+type statsResponse struct {
+	Started       string    `json:"started"`
+	UptimeSeconds float64   `json:"uptime_seconds"`
+	SinceStart    statsView `json:"since_start"`
+	Window        statsView `json:"window"`
+	CacheEntries  int       `json:"cache_entries"`
+}
+
+type statsView struct {
+	Seconds     float64           `json:"seconds"`
+	Requests    uint64            `json:"requests"`
+	BytesServed int64             `json:"bytes_served"`
+	Renders     uint64            `json:"renders"`
+	Failed      uint64            `json:"failed"`
+	Formats     map[string]uint64 `json:"formats"`
+	DurationMS  durationStats     `json:"duration_ms"`
+	Cache       cacheStats        `json:"cache"`
+}
+
+type durationStats struct {
+	Avg float64 `json:"avg"`
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+type cacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	// HitRatio is hits over lookups, or 0 before the first lookup.
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+func (c *statsCounts) view(span time.Duration) statsView {
+	view := statsView{
+		Seconds:     math.Round(span.Seconds()),
+		Requests:    c.requests,
+		BytesServed: c.bytes,
+		Renders:     c.renders,
+		Failed:      c.failed,
+		Formats:     c.formats,
+		Cache:       cacheStats{Hits: c.cacheHits, Misses: c.cacheMisses},
+	}
+	if lookups := c.cacheHits + c.cacheMisses; lookups > 0 {
+		view.Cache.HitRatio = float64(c.cacheHits) / float64(lookups)
+	}
+	if c.renders > 0 {
+		view.DurationMS = durationStats{
+			Avg: milliseconds(c.durationSum / time.Duration(c.renders)),
+			P50: milliseconds(c.durations.quantile(0.50, c.renders, c.durationMax)),
+			P90: milliseconds(c.durations.quantile(0.90, c.renders, c.durationMax)),
+			P95: milliseconds(c.durations.quantile(0.95, c.renders, c.durationMax)),
+			P99: milliseconds(c.durations.quantile(0.99, c.renders, c.durationMax)),
+			Max: milliseconds(c.durationMax),
+		}
+	}
+	return view
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// withStats counts every answered request and the bytes of its body.
+func (s *server) withStats(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := &trackingWriter{ResponseWriter: w}
+		defer func() {
+			s.stats.recordResponse(tw.bytes, tw.Header().Get("X-Cache"))
+		}()
+		next.ServeHTTP(tw, r)
+	})
+}
+
+// handleStats reports render counts, durations, cache hits and bytes
+// served since start and over the last window, 5 minutes unless the window
+// query parameter asks for 1 to 60.
+func (s *server) handleStats(w http.ResponseWriter, r *http.Request) {
+	window := defaultStatsWindow
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < time.Minute || d > statsSlots*time.Minute {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("window must be a duration between 1m and %dm", statsSlots))
+			return
+		}
+		window = d.Round(time.Minute)
+	}
+
+	now := time.Now()
+	uptime := now.Sub(s.stats.start)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, statsResponse{
+		Started:       s.stats.start.UTC().Format(time.RFC3339),
+		UptimeSeconds: math.Round(uptime.Seconds()),
+		SinceStart:    s.stats.sinceStart().view(uptime),
+		Window:        s.stats.window(now, window).view(min(window, uptime)),
+		CacheEntries:  s.renderCache().len(),
+	})
+}
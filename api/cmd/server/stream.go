@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"map-ascii-generator/api/internal/render"
+)
+
+const (
+	streamRotate = "rotate"
+	streamSun    = "sun"
+
+	defaultStreamFPS = 2
+	maxStreamFPS     = 10
+	// maxStreamDuration ends streams that run without a frames limit.
+	maxStreamDuration  = 10 * time.Minute
+	streamWriteTimeout = 10 * time.Second
+
+	defaultRotateStep    = 10.0
+	defaultRotateLat     = 20.0
+	defaultSunStepMinute = 30.0
+)
+
+var streamAnimations = []string{streamRotate, streamSun}
+
+// streamSpec is an animation parsed from the /api/stream query.
+type streamSpec struct {
+	animation string
+	fps       int
+	frames    int
+	step      float64
+	lon       float64
+	lat       float64
+	color     bool
+	diff      bool
+}
+
+func parseStreamQuery(r *http.Request, req generateRequest) (streamSpec, generateRequest, error) {
+	return parseStreamValues(r.URL.Query(), isTerminalClient(r.UserAgent()), req)
+}
+
+// parseStreamValues parses animation settings from query, with color the
+// default for the color parameter.
+func parseStreamValues(query url.Values, color bool, req generateRequest) (streamSpec, generateRequest, error) {
+	spec := streamSpec{animation: streamRotate, fps: defaultStreamFPS, lat: defaultRotateLat, color: color}
+
+	if raw := strings.ToLower(strings.TrimSpace(query.Get("animation"))); raw != "" {
+		if !slices.Contains(streamAnimations, raw) {
+			return streamSpec{}, req, fmt.Errorf("animation must be one of: %s", strings.Join(streamAnimations, ", "))
+		}
+		spec.animation = raw
+	}
+	spec.step = defaultRotateStep
+	if spec.animation == streamSun {
+		spec.step = defaultSunStepMinute
+	}
+
+	if raw := query.Get("width"); raw != "" {
+		width, err := strconv.Atoi(raw)
+		if err != nil {
+			return streamSpec{}, req, fmt.Errorf("width must be an integer")
+		}
+		req.Width = width
+	}
+
+	ints := []struct {
+		name     string
+		dst      *int
+		min, max int
+	}{
+		{"fps", &spec.fps, 1, maxStreamFPS},
+		{"frames", &spec.frames, 1, maxStreamFPS * int(maxStreamDuration/time.Second)},
+	}
+	for _, p := range ints {
+		raw := query.Get(p.name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < p.min || value > p.max {
+			return streamSpec{}, req, fmt.Errorf("%s must be an integer between %d and %d", p.name, p.min, p.max)
+		}
+		*p.dst = value
+	}
+
+	floats := []struct {
+		name     string
+		dst      *float64
+		min, max float64
+	}{
+		{"step", &spec.step, -180, 180},
+		{"lon", &spec.lon, -180, 180},
+		{"lat", &spec.lat, -90, 90},
+	}
+	if spec.animation == streamSun {
+		floats[0].min, floats[0].max = -1440, 1440
+	}
+	for _, p := range floats {
+		raw := query.Get(p.name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || !isFinite(value) || value < p.min || value > p.max {
+			return streamSpec{}, req, fmt.Errorf("%s must be a number between %g and %g", p.name, p.min, p.max)
+		}
+		*p.dst = value
+	}
+
+	bools := []struct {
+		name string
+		dst  *bool
+	}{
+		{"color", &spec.color},
+		{"diff", &spec.diff},
+	}
+	for _, p := range bools {
+		raw := query.Get(p.name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return streamSpec{}, req, fmt.Errorf("%s must be 0 or 1", p.name)
+		}
+		*p.dst = value
+	}
+	if !spec.color {
+		req.Color.Mode = string(render.ColorModeNever)
+	}
+	return spec, req, nil
+}
+
+// frameRequest returns the request for frame i of the animation.
+func (spec streamSpec) frameRequest(req generateRequest, i int, start time.Time) generateRequest {
+	switch spec.animation {
+	case streamSun:
+		req.Celestial.Sun = true
+		req.Celestial.Moon = true
+		at := start.Add(time.Duration(float64(i) * spec.step * float64(time.Minute)))
+		req.Celestial.Time = at.UTC().Format(time.RFC3339)
+	default:
+		req.Projection = string(render.ProjectionOrthographic)
+		req.Center.Lon = math.Mod(spec.lon+float64(i)*spec.step+540, 360) - 180
+		req.Center.Lat = spec.lat
+	}
+	return req
+}
+
+// handleStream sends an animation as server-sent events, one rendered frame
+// per "frame" event with every line of the map in its own data field. With
+// diff=1, frames after the first are "diff" events listing the changed cells
+// as JSON. The stream counts as a single request against the rate limit.
+func (s *server) handleStream(w http.ResponseWriter, r *http.Request) {
+	if !s.admitDuringMaintenance(w, false) {
+		return
+	}
+	limiter, clientKey, limits, ok := s.resolveClient(r)
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "invalid API key")
+		return
+	}
+	if !limiter.Allow(clientKey, time.Now()) {
+		writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return
+	}
+
+	spec, req, err := parseStreamQuery(r, defaultGenerateRequest(limits))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	start := time.Now()
+	first, err := s.generate(r, spec.frameRequest(req, 0, start), limits, nil)
+	if err != nil {
+		writeError(w, generateStatus(err), err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(time.Second / time.Duration(spec.fps))
+	defer ticker.Stop()
+	deadline := time.NewTimer(maxStreamDuration)
+	defer deadline.Stop()
+
+	resp := first
+	var prev [][]render.StyledCell
+	for i := 0; ; {
+		event, data := "frame", resp.Plain
+		if spec.color {
+			data = resp.ANSI
+		}
+		if spec.diff {
+			cells := resp.styled()
+			if diff, ok := diffFrames(prev, cells); prev != nil && ok {
+				payload, err := json.Marshal(diff)
+				if err != nil {
+					return
+				}
+				event, data = "diff", string(payload)
+			}
+			prev = cells
+		}
+		_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if err := writeEvent(w, event, strconv.Itoa(i), data); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		i++
+		if spec.frames > 0 && i >= spec.frames {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-deadline.C:
+			return
+		case <-ticker.C:
+		}
+
+		if resp, err = s.generate(r, spec.frameRequest(req, i, start), limits, nil); err != nil {
+			_ = writeEvent(w, "error", "", err.Error())
+			_ = rc.Flush()
+			return
+		}
+	}
+}
+
+// writeEvent writes one server-sent event, splitting data into one data
+// field per line.
+func writeEvent(w http.ResponseWriter, event string, id string, data string) error {
+	var b strings.Builder
+	if id != "" {
+		b.WriteString("id: " + id + "\n")
+	}
+	b.WriteString("event: " + event + "\n")
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	_, err := w.Write([]byte(b.String()))
+	return err
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTelegramAPIURL = "https://api.telegram.org"
+	// telegramMaxText is the longest message text Telegram accepts.
+	telegramMaxText = 4096
+	// Telegram's apps fit about this many monospace columns on a phone.
+	defaultTelegramWidth   = 40
+	telegramTimeout        = 10 * time.Second
+	maxTelegramUpdateBytes = 64 << 10
+)
+
+var telegramClient = &http.Client{Timeout: telegramTimeout}
+
+type telegramUpdate struct {
+	Message *struct {
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		Text     string `json:"text"`
+		Location *struct {
+			Latitude  float64 `json:"latitude"`
+			Longitude float64 `json:"longitude"`
+		} `json:"location"`
+	} `json:"message"`
+}
+
+// handleTelegram is the webhook of a Telegram bot: it answers location
+// messages with a map marking the location and "/map <place>" with a map
+// marking the place, as monospace text. Replies are sent with the Bot API
+// using telegram.bot_token; when telegram.webhook_secret is set, updates
+// must carry it as Telegram's secret token header.
+func (s *server) handleTelegram(w http.ResponseWriter, r *http.Request) {
+	cfg := s.config()
+	if cfg.telegramBotToken == "" {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if cfg.telegramSecret != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Telegram-Bot-Api-Secret-Token")), []byte(cfg.telegramSecret)) != 1 {
+		writeJSONError(w, http.StatusUnauthorized, "invalid secret token")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxTelegramUpdateBytes))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid update")
+		return
+	}
+	var update telegramUpdate
+	if err := json.Unmarshal(body, &update); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid update")
+		return
+	}
+	// Other updates are acknowledged so Telegram does not resend them.
+	w.WriteHeader(http.StatusOK)
+
+	message := update.Message
+	if message == nil {
+		return
+	}
+	req := defaultGenerateRequest(cfg)
+	req.Width = min(max(defaultTelegramWidth, cfg.minWidth), cfg.maxWidth)
+	req.Color.Mode = "never"
+	switch {
+	case message.Location != nil:
+		req.Marker.Enabled = true
+		req.Marker.Lon, req.Marker.Lat = message.Location.Longitude, message.Location.Latitude
+	case isTelegramCommand(message.Text, "start"), isTelegramCommand(message.Text, "help"):
+		if err := sendTelegramMessage(cfg, message.Chat.ID, "Send a location, or /map &lt;place&gt; for a map marking a city."); err != nil {
+			log.Printf("telegram: %v", err)
+		}
+		return
+	case isTelegramCommand(message.Text, "map"):
+		_, place, _ := strings.Cut(strings.TrimSpace(message.Text), " ")
+		if place = strings.TrimSpace(place); place != "" {
+			req.Marker.Enabled = true
+			req.Marker.Place = place
+		}
+	default:
+		return
+	}
+
+	chat := message.Chat.ID
+	text := ""
+	if !s.limiter.Allow("telegram:"+strconv.FormatInt(chat, 10), time.Now()) {
+		text = "Rate limit exceeded, try again later."
+	} else if resp, err := s.generateMessage(r, req, cfg, nil, "Telegram", telegramMaxText, telegramMessage); err != nil {
+		text = html.EscapeString("Error: " + err.Error())
+	} else {
+		text = resp.Message
+	}
+
+	if err := sendTelegramMessage(cfg, chat, text); err != nil {
+		log.Printf("telegram: %v", err)
+	}
+}
+
+// isTelegramCommand reports whether text is /name, in groups possibly
+// addressed as /name@bot.
+func isTelegramCommand(text string, name string) bool {
+	command, _, _ := strings.Cut(strings.TrimSpace(text), " ")
+	command, _, _ = strings.Cut(command, "@")
+	return command == "/"+name
+}
+
+func telegramMessage(resp generateResponse) string {
+	return "<pre>" + html.EscapeString(resp.Plain) + "</pre>"
+}
+
+func sendTelegramMessage(cfg config, chat int64, text string) error {
+	payload, err := json.Marshal(map[string]any{"chat_id": chat, "text": text, "parse_mode": "HTML"})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), telegramTimeout)
+	defer cancel()
+	endpoint := strings.TrimSuffix(cfg.telegramAPIURL, "/") + "/bot" + cfg.telegramBotToken + "/sendMessage"
+	post, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("invalid telegram.api_url")
+	}
+	post.Header.Set("Content-Type", "application/json")
+
+	result, err := telegramClient.Do(post)
+	if err != nil {
+		// The error repeats the URL, which holds the bot token.
+		return fmt.Errorf("sendMessage request failed")
+	}
+	defer result.Body.Close()
+	if result.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(result.Body, 512))
+		return fmt.Errorf("sendMessage answered %s: %s", result.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
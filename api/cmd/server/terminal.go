@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"map-ascii-generator/api/internal/render"
+)
+
+// Terminal clients such as curl wrappers send their size in these headers
+// to get a map that fits when the request leaves out width.
+const (
+	terminalColsHeader = "X-Terminal-Cols"
+	terminalRowsHeader = "X-Terminal-Rows"
+	maxTerminalSize    = 10000
+)
+
+// fitTerminal sizes req for the terminal described by the X-Terminal-Cols
+// and X-Terminal-Rows headers, unless the request, with its preset
+// expanded, sets width. A char_aspect in the request is kept; otherwise it
+// may be raised up to the limit to fit the rows. One row is left for the
+// shell prompt.
+func fitTerminal(r *http.Request, body []byte, req generateRequest, cfg config, presets presetSet) (generateRequest, error) {
+	cols, err := terminalHeader(r, terminalColsHeader)
+	if err != nil || cols == 0 {
+		return req, err
+	}
+	rows, err := terminalHeader(r, terminalRowsHeader)
+	if err != nil {
+		return req, err
+	}
+
+	expanded, err := presets.expand(body)
+	if err != nil {
+		return req, err
+	}
+	fields, err := decodeJSONObject(expanded)
+	if err != nil {
+		return req, err
+	}
+	if _, ok := fields["width"]; ok {
+		return req, nil
+	}
+
+	var height func(width int, charAspect float64) int
+	if req.Projection == string(render.ProjectionOrthographic) {
+		height = render.GlobeHeight
+	} else {
+		viewport, _, err := requestViewport(req)
+		if err != nil {
+			// Left for validateRequest to report.
+			return req, nil
+		}
+		if viewport == nil {
+			world := render.WorldViewport()
+			viewport = &world
+		}
+		height = func(width int, charAspect float64) int {
+			return render.MapHeight(width, charAspect, *viewport)
+		}
+	}
+
+	if req.Frame {
+		cols -= 2
+	}
+	if rows > 0 {
+		rows -= 2*req.Margin + 1
+		if req.Frame {
+			rows -= 2
+		}
+		if strings.TrimSpace(req.Footer) != "" {
+			rows--
+		}
+		rows = max(rows, 1)
+	}
+	maxAspect := cfg.maxCharAspect
+	if _, ok := fields["char_aspect"]; ok {
+		maxAspect = req.CharAspect
+	}
+	width, charAspect := render.FitTerminal(cols, rows, req.CharAspect, maxAspect, height)
+	req.Width = min(max(width, cfg.minWidth), cfg.maxWidth)
+	req.CharAspect = charAspect
+	return req, nil
+}
+
+// terminalHeader returns the size in the named header, or 0 without one.
+func terminalHeader(r *http.Request, name string) (int, error) {
+	raw := strings.TrimSpace(r.Header.Get(name))
+	if raw == "" {
+		return 0, nil
+	}
+	size, err := strconv.Atoi(raw)
+	if err != nil || size < 1 || size > maxTerminalSize {
+		return 0, fmt.Errorf("%s must be between 1 and %d", name, maxTerminalSize)
+	}
+	return size, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"map-ascii-generator/api/internal/render"
+)
+
+const (
+	defaultTerrainRamp = ":-=+*#%@"
+	// terrainGradientLevels is the number of colors used in truecolor mode
+	// when no terrain_ramp is given.
+	terrainGradientLevels = 24
+	// terrainTop is the upper edge of the last level in meters; higher
+	// ground shares it.
+	terrainTop = 6000.0
+)
+
+// terrainStops are hypsometric tints from lowland green over tan and brown
+// to snow.
+var terrainStops = []render.Color{
+	render.RGB(0x3b, 0x7d, 0x3a),
+	render.RGB(0x9d, 0xb5, 0x62),
+	render.RGB(0xd8, 0xc8, 0x7e),
+	render.RGB(0xa8, 0x7a, 0x4f),
+	render.RGB(0x7d, 0x66, 0x5a),
+	render.RGB(0xf2, 0xf2, 0xf2),
+}
+
+// terrainEdges spreads levels from sea level to terrainTop with bands that
+// widen with height, so lowland relief stays visible next to mountains.
+// Edges are rounded to two significant digits for the legend.
+func terrainEdges(levels int) []float64 {
+	edges := make([]float64, levels+1)
+	for i := range edges {
+		t := float64(i) / float64(levels)
+		edges[i] = roundSignificant(terrainTop*t*t, 2)
+	}
+	return edges
+}
+
+func roundSignificant(v float64, digits int) float64 {
+	if v == 0 {
+		return 0
+	}
+	scale := math.Pow(10, math.Floor(math.Log10(math.Abs(v)))-float64(digits-1))
+	return math.Round(v/scale) * scale
+}
+
+// terrainSettings validates the terrain options and returns the ramp and
+// number of levels, zero when terrain is off. In truecolor mode an empty
+// terrain_ramp keeps the land characters and colors them along a gradient.
+func terrainSettings(req generateRequest) ([]rune, int, error) {
+	if !req.Terrain {
+		return nil, 0, nil
+	}
+	if req.Weather.Variable != "" {
+		return nil, 0, fmt.Errorf("terrain cannot be combined with weather.variable")
+	}
+
+	ramp, err := parseRamp(req.TerrainRamp, "terrain_ramp", 1, req.AllowUnicode)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(ramp) == 0 && render.ColorMode(req.Color.Mode) == render.ColorModeTrueColor {
+		return nil, terrainGradientLevels, nil
+	}
+	if len(ramp) == 0 {
+		ramp = []rune(defaultTerrainRamp)
+	}
+	return ramp, len(ramp), nil
+}
+
+// requestTerrain shades land by elevation from the loaded grid.
+func (s *server) requestTerrain(req generateRequest) (*render.Field, error) {
+	ramp, levels, err := terrainSettings(req)
+	if err != nil || levels == 0 {
+		return nil, err
+	}
+	elevation := s.elevation.Load()
+	if elevation == nil {
+		return nil, fmt.Errorf("terrain: %w", errElevationDisabled)
+	}
+	return &render.Field{
+		Sample: elevation.Sample,
+		Edges:  terrainEdges(levels),
+		Ramp:   ramp,
+		Levels: levels,
+		Legend: req.TerrainLegend,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type theme struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Colors      themeColors `json:"colors"`
+	HexColors   themeColors `json:"hex_colors"`
+}
+
+type themeColors struct {
+	MapColor    string `json:"map_color"`
+	FrameColor  string `json:"frame_color"`
+	MarkerColor string `json:"marker_color"`
+}
+
+type themesResponse struct {
+	Themes []theme `json:"themes"`
+}
+
+// themes carry ANSI 16 names for the "always" mode and hex values used when
+// the request asks for ansi256 or truecolor output.
+var themes = []theme{
+	{
+		Name:        "matrix",
+		Description: "Green phosphor terminal",
+		Colors:      themeColors{MapColor: "bright-green", FrameColor: "green", MarkerColor: "bright-white"},
+		HexColors:   themeColors{MapColor: "#00ff41", FrameColor: "#008f11", MarkerColor: "#e8ffe8"},
+	},
+	{
+		Name:        "ocean",
+		Description: "Sea blues with a sandy marker",
+		Colors:      themeColors{MapColor: "cyan", FrameColor: "blue", MarkerColor: "bright-yellow"},
+		HexColors:   themeColors{MapColor: "#4fb3bf", FrameColor: "#1f6fb2", MarkerColor: "#ffd166"},
+	},
+	{
+		Name:        "sunset",
+		Description: "Warm oranges and magentas",
+		Colors:      themeColors{MapColor: "yellow", FrameColor: "magenta", MarkerColor: "bright-red"},
+		HexColors:   themeColors{MapColor: "#ffb347", FrameColor: "#c94b7b", MarkerColor: "#ff5e5b"},
+	},
+	{
+		Name:        "mono",
+		Description: "Grayscale only",
+		Colors:      themeColors{MapColor: "white", FrameColor: "bright-black", MarkerColor: "bright-white"},
+		HexColors:   themeColors{MapColor: "#d0d0d0", FrameColor: "#808080", MarkerColor: "#ffffff"},
+	},
+	{
+		Name:        "colorblind-safe",
+		Description: "Okabe-Ito colors distinguishable with common color vision deficiencies",
+		Colors:      themeColors{MapColor: "blue", FrameColor: "white", MarkerColor: "yellow"},
+		HexColors:   themeColors{MapColor: "#0072b2", FrameColor: "#999999", MarkerColor: "#e69f00"},
+	},
+}
+
+func themeNames() []string {
+	names := make([]string, 0, len(themes))
+	for _, t := range themes {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+func findTheme(name string) (theme, bool) {
+	for _, t := range themes {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return theme{}, false
+}
+
+func (s *server) handleThemes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, themesResponse{Themes: themes})
+}
+
+// applyTheme fills the colors of req from its theme. Colors set explicitly in
+// the request body take precedence over the theme.
+func applyTheme(req *generateRequest, body []byte) error {
+	t, ok := findTheme(req.Theme)
+	if !ok {
+		return fmt.Errorf("theme must be one of: %s", strings.Join(themeNames(), ", "))
+	}
+
+	var explicit struct {
+		Color struct {
+			MapColor    *string `json:"map_color"`
+			FrameColor  *string `json:"frame_color"`
+			MarkerColor *string `json:"marker_color"`
+		} `json:"color"`
+	}
+	if err := json.Unmarshal(body, &explicit); err != nil {
+		return fmt.Errorf("invalid JSON payload: %w", err)
+	}
+
+	colors := t.Colors
+	if _, ok := hexColorModes[strings.ToLower(strings.TrimSpace(req.Color.Mode))]; ok {
+		colors = t.HexColors
+	}
+
+	if explicit.Color.MapColor == nil {
+		req.Color.MapColor = colors.MapColor
+	}
+	if explicit.Color.FrameColor == nil {
+		req.Color.FrameColor = colors.FrameColor
+	}
+	if explicit.Color.MarkerColor == nil {
+		req.Color.MarkerColor = colors.MarkerColor
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"time"
+
+	"map-ascii-generator/api/internal/geo"
+	"map-ascii-generator/api/internal/render"
+)
+
+// loadTimezones reads the configured zone polygons, falling back to the
+// coarse embedded dataset.
+func loadTimezones(path string) (*geo.Timezones, error) {
+	if path == "" {
+		return geo.EmbeddedTimezones()
+	}
+	return geo.LoadTimezonesFile(path)
+}
+
+// offsetRegions groups zones by their UTC offset at one instant, so lines
+// only separate areas whose clocks differ and follow DST changes.
+type offsetRegions struct {
+	zones *geo.Timezones
+	// ids holds each zone's offset in minutes shifted to be non-negative.
+	ids []int
+}
+
+func newOffsetRegions(zones *geo.Timezones, at time.Time) offsetRegions {
+	ids := make([]int, zones.Len())
+	for i := range ids {
+		_, offset := at.In(zones.Zone(i).Location).Zone()
+		ids[i] = offset/60 + 24*60
+	}
+	return offsetRegions{zones: zones, ids: ids}
+}
+
+func (r offsetRegions) Locate(lon float64, lat float64) int {
+	idx := r.zones.Locate(lon, lat)
+	if idx < 0 {
+		return -1
+	}
+	return r.ids[idx]
+}
+
+func (s *server) requestTimezones(req generateRequest, now time.Time) (*render.Borders, error) {
+	if !req.Timezones.Enabled {
+		return nil, nil
+	}
+
+	ch, err := parseRune(req.Timezones.Char, '|', "timezones.char", req.AllowUnicode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &render.Borders{Regions: newOffsetRegions(s.timezones.Load(), now), Char: ch}, nil
+}
+
+type localTime struct {
+	zone string
+	time time.Time
+}
+
+// localTimes resolves the zone of every marker. Points outside the zone
+// polygons, which includes the sea, use the nautical offset for their
+// longitude.
+func (s *server) localTimes(markers []render.Marker, now time.Time) []localTime {
+	zones := s.timezones.Load()
+	times := make([]localTime, len(markers))
+	for i, m := range markers {
+		loc := geo.NauticalZone(m.Lon)
+		if idx := zones.Locate(m.Lon, m.Lat); idx >= 0 {
+			loc = zones.Zone(idx).Location
+		}
+		times[i] = localTime{zone: loc.String(), time: now.In(loc)}
+	}
+	return times
+}
+
+// labelLocalTimes appends the local time to each marker's label.
+func labelLocalTimes(markers []render.Marker, times []localTime) {
+	for i := range markers {
+		clock := times[i].time.Format("15:04")
+		if markers[i].Label == "" {
+			markers[i].Label = clock
+		} else {
+			markers[i].Label += " " + clock
+		}
+	}
+}
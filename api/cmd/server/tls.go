@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"map-ascii-generator/api/internal/acme"
+)
+
+// tlsEnabled reports whether cfg configures a certificate, so that
+// listen_addr serves HTTPS.
+func tlsEnabled(cfg config) bool {
+	return cfg.tlsAutocertHost != "" || cfg.tlsCertFile != "" || cfg.tlsKeyFile != ""
+}
+
+// serverTLS returns the TLS settings the HTTPS listeners share, static
+// certificates or ACME-managed ones, or nil when no certificate is
+// configured. With ACME it also starts the certificate manager and the
+// challenge listener.
+func serverTLS(cfg config) (*tls.Config, error) {
+	switch {
+	case cfg.tlsAutocertHost != "":
+		manager := &acme.Manager{
+			Host:         cfg.tlsAutocertHost,
+			Email:        cfg.tlsAutocertEmail,
+			DirectoryURL: cfg.tlsACMEDirectory,
+			CacheDir:     cfg.tlsAutocertCacheDir,
+		}
+
+		challengeServer := &http.Server{
+			Addr:              cfg.tlsHTTPAddr,
+			Handler:           manager.HTTPHandler(http.HandlerFunc(redirectToHTTPS)),
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       defaultReadTimeout,
+			WriteTimeout:      defaultWriteTimeout,
+			IdleTimeout:       defaultIdleTimeout,
+		}
+		go func() {
+			log.Printf("acme challenge and redirect listener on %s", cfg.tlsHTTPAddr)
+			if err := challengeServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("challenge listener failed: %v", err)
+			}
+		}()
+		go manager.Run(context.Background())
+
+		log.Printf("tls: automatic certificates for %s (cache %s)", cfg.tlsAutocertHost, cfg.tlsAutocertCacheDir)
+		return &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: manager.GetCertificate,
+		}, nil
+
+	case cfg.tlsCertFile != "" || cfg.tlsKeyFile != "":
+		if cfg.tlsCertFile == "" || cfg.tlsKeyFile == "" {
+			return nil, fmt.Errorf("API_TLS_CERT_FILE and API_TLS_KEY_FILE must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.tlsCertFile, cfg.tlsKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("tls: using certificate %s", cfg.tlsCertFile)
+		return &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}, nil
+
+	default:
+		return nil, nil
+	}
+}
+
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"map-ascii-generator/api/internal/geo"
+	"map-ascii-generator/api/internal/render"
+)
+
+const maxTracerouteHops = 64
+
+type tracerouteRequest struct {
+	Hops    []string        `json:"hops"`
+	Options json.RawMessage `json:"options"`
+}
+
+type tracerouteHop struct {
+	Hop     int    `json:"hop"`
+	IP      string `json:"ip,omitempty"`
+	Located bool   `json:"located"`
+	// Stop is the 1-based index of the drawn location; consecutive hops in
+	// the same place share one stop. 0 when the hop was not located.
+	Stop    int     `json:"stop,omitempty"`
+	Lon     float64 `json:"lon,omitempty"`
+	Lat     float64 `json:"lat,omitempty"`
+	City    string  `json:"city,omitempty"`
+	Country string  `json:"country,omitempty"`
+}
+
+type tracerouteResponse struct {
+	generateResponse
+	Hops []tracerouteHop `json:"hops"`
+}
+
+// handleTraceroute plots a path the client measured itself, e.g. the
+// addresses from traceroute -n. Each hop is geolocated; hops without a
+// location (timeouts given as "*" or "", private ranges) are skipped, the
+// rest are joined by lines and marked with numbered markers.
+func (s *server) handleTraceroute(w http.ResponseWriter, r *http.Request) {
+	limits, ok := s.admitGenerate(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := readJSONBody(w, r, limits)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var trace tracerouteRequest
+	if err := decodeStrictJSON(body, &trace); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(trace.Hops) == 0 || len(trace.Hops) > maxTracerouteHops {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("hops must have 1 to %d entries", maxTracerouteHops))
+		return
+	}
+
+	req, err := parseOptions(trace.Options, limits, s.presetSet())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Marker.Enabled || len(req.Markers) > 0 || len(req.GeoJSON) > 0 {
+		writeJSONError(w, http.StatusBadRequest, "options: marker.enabled, markers and geojson cannot be combined with hops")
+		return
+	}
+	if strings.TrimSpace(req.Marker.Style) == "" {
+		req.Marker.Style = string(render.MarkerNumbered)
+	}
+	style, err := render.ParseMarkerStyle(req.Marker.Style)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("options: %v", err))
+		return
+	}
+	maxStops := maxMarkers
+	if style == render.MarkerNumbered {
+		maxStops = render.MaxNumberedMarkers
+	}
+
+	hops, stops, err := s.locateHops(trace.Hops)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errGeoIPDisabled) {
+			status = http.StatusNotImplemented
+		}
+		writeError(w, status, err)
+		return
+	}
+	if len(stops) == 0 {
+		writeJSONError(w, http.StatusUnprocessableEntity, "none of the hops could be located")
+		return
+	}
+
+	// Stops beyond the marker limit are still on the line, just unmarked.
+	for _, stop := range stops[:min(len(stops), maxStops)] {
+		req.Markers = append(req.Markers, markerPoint{Lon: stop.Lon(), Lat: stop.Lat()})
+	}
+	path := geo.Feature{Points: stops}
+	if len(stops) > 1 {
+		path = geo.Feature{Lines: [][]geo.Point{stops}}
+	}
+	overlay, err := overlayFromFeatures([]geo.Feature{path}, req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := s.generate(r, req, limits, overlay)
+	if err != nil {
+		writeError(w, generateStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tracerouteResponse{generateResponse: resp, Hops: hops})
+}
+
+// locateHops geolocates every hop and returns the distinct consecutive
+// locations in path order.
+func (s *server) locateHops(raw []string) ([]tracerouteHop, []geo.Point, error) {
+	hops := make([]tracerouteHop, 0, len(raw))
+	var stops []geo.Point
+	for i, value := range raw {
+		hop := tracerouteHop{Hop: i + 1}
+		value = strings.TrimSpace(value)
+		if value == "" || value == "*" {
+			hops = append(hops, hop)
+			continue
+		}
+
+		ip, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("hops[%d]: %q is not an IP address", i, value)
+		}
+		hop.IP = ip.Unmap().String()
+
+		loc, err := s.locateIP(ip)
+		if errors.Is(err, errGeoIPDisabled) {
+			return nil, nil, err
+		}
+		if err == nil {
+			point := geo.Point{loc.Lon, loc.Lat}
+			if len(stops) == 0 || stops[len(stops)-1] != point {
+				stops = append(stops, point)
+			}
+			hop.Located, hop.Stop = true, len(stops)
+			hop.Lon, hop.Lat, hop.City, hop.Country = loc.Lon, loc.Lat, loc.City, loc.Country
+		}
+		hops = append(hops, hop)
+	}
+	return hops, stops, nil
+}
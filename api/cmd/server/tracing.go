@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"map-ascii-generator/api/internal/trace"
+)
+
+const defaultTracingServiceName = "map-ascii-api"
+
+// newTracer exports spans to tracing.otlp_endpoint; without one tracing
+// is off and the tracer is nil.
+func newTracer(cfg config) (*trace.Tracer, error) {
+	if cfg.tracingEndpoint == "" {
+		return nil, nil
+	}
+	if cfg.tracingSampleRatio < 0 || cfg.tracingSampleRatio > 1 {
+		return nil, fmt.Errorf("tracing.sample_ratio must be between 0 and 1")
+	}
+	headers, err := trace.ParseHeaders(cfg.tracingHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("tracing.headers: %w", err)
+	}
+
+	log.Printf("tracing: exporting to %s as %s, sample ratio %g", cfg.tracingEndpoint, cfg.tracingServiceName, cfg.tracingSampleRatio)
+	exporter := trace.NewExporter(cfg.tracingEndpoint, headers, cfg.tracingServiceName)
+	return trace.New(exporter, cfg.tracingSampleRatio), nil
+}
+
+// withTracing wraps each request in a server span, named after its route
+// once the mux has matched one.
+func (s *server) withTracing(next http.Handler) http.Handler {
+	if s.tracer == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := s.tracer.StartServer(r, r.Method,
+			trace.String("http.request.method", r.Method),
+			trace.String("url.path", r.URL.Path),
+			trace.String("user_agent.original", r.UserAgent()),
+			trace.String("http.request.id", requestID(r)),
+		)
+		if span == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		tw := &trackingWriter{ResponseWriter: w}
+		defer func() {
+			status := tw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			span.SetAttributes(trace.Int("http.response.status_code", status))
+			if status >= http.StatusInternalServerError {
+				span.SetError(errors.New(http.StatusText(status)))
+			}
+			span.End()
+		}()
+		next.ServeHTTP(tw, r.WithContext(ctx))
+	})
+}
+
+// startSpan begins a span for a step of handling r.
+func (s *server) startSpan(r *http.Request, name string, attrs ...trace.Attr) *trace.Span {
+	_, span := s.tracer.Start(r.Context(), name, attrs...)
+	return span
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"map-ascii-generator/api/internal/objstore"
+)
+
+const (
+	defaultStorageRegion = "us-east-1"
+	uploadTimeout        = 30 * time.Second
+)
+
+// uploadFormats maps the output formats to their extension and content
+// type.
+var uploadFormats = map[string]struct {
+	ext         string
+	contentType string
+}{
+	"txt": {"txt", "text/plain; charset=utf-8"},
+	"ans": {"ans", "text/plain; charset=utf-8"},
+	"svg": {"svg", "image/svg+xml"},
+	"png": {"png", "image/png"},
+}
+
+var uploadFormatNames = []string{"txt", "ans", "svg", "png"}
+
+// scheduleUpload stores a schedule's renders in a bucket, one object per
+// format under key plus the format's extension.
+type scheduleUpload struct {
+	bucket  string
+	key     string
+	formats []string
+}
+
+func parseScheduleUpload(fields map[string]any, cfg config) (*scheduleUpload, error) {
+	if _, err := newStorage(cfg); err != nil {
+		return nil, err
+	}
+
+	bucket, _ := fields["bucket"].(string)
+	key, _ := fields["key"].(string)
+	upload := &scheduleUpload{bucket: strings.TrimSpace(bucket), key: strings.Trim(strings.TrimSpace(key), "/")}
+	if upload.bucket == "" {
+		return nil, fmt.Errorf("bucket must not be empty")
+	}
+	if upload.key == "" {
+		upload.key = "{name}/{date}"
+	}
+	if strings.Contains(upload.key, "..") {
+		return nil, fmt.Errorf("key must not contain ..")
+	}
+
+	switch raw := fields["formats"].(type) {
+	case nil:
+		upload.formats = []string{"txt"}
+	case []any:
+		for _, item := range raw {
+			name, _ := item.(string)
+			name = strings.ToLower(strings.TrimSpace(name))
+			if _, ok := uploadFormats[name]; !ok {
+				return nil, fmt.Errorf("formats entries must be one of: %s", strings.Join(uploadFormatNames, ", "))
+			}
+			if !slices.Contains(upload.formats, name) {
+				upload.formats = append(upload.formats, name)
+			}
+		}
+		if len(upload.formats) == 0 {
+			return nil, fmt.Errorf("formats must not be empty")
+		}
+	default:
+		return nil, fmt.Errorf("formats must be a list")
+	}
+
+	return upload, nil
+}
+
+func newStorage(cfg config) (*objstore.S3, error) {
+	return objstore.NewS3(cfg.storageEndpoint, cfg.storageRegion, cfg.storageAccessKey, cfg.storageSecretKey, cfg.storagePathStyle)
+}
+
+// objectKey fills in the key template for a run at at, in the schedule's
+// time zone.
+func (u *scheduleUpload) objectKey(sc schedule, at time.Time) string {
+	local := at.In(sc.location)
+	return strings.NewReplacer(
+		"{name}", sc.name,
+		"{date}", local.Format("2006-01-02"),
+		"{time}", local.Format("1504"),
+		"{year}", local.Format("2006"),
+		"{month}", local.Format("01"),
+		"{day}", local.Format("02"),
+	).Replace(u.key)
+}
+
+// uploadSchedule stores each format of resp and returns the keys written.
+func uploadSchedule(cfg config, sc schedule, at time.Time, resp generateResponse) ([]string, error) {
+	storage, err := newStorage(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+
+	base := path.Clean(sc.upload.objectKey(sc, at))
+	var keys []string
+	for _, name := range sc.upload.formats {
+		format := uploadFormats[name]
+		var body []byte
+		switch name {
+		case "txt":
+			body = []byte(resp.Plain + "\n")
+		case "ans":
+			body = []byte(resp.ANSI + "\n")
+		case "svg":
+			body = []byte(resp.svg())
+		case "png":
+			if body, err = resp.png(); err != nil {
+				return keys, err
+			}
+		}
+
+		key := base + "." + format.ext
+		if err := storage.Put(ctx, sc.upload.bucket, key, body, format.contentType); err != nil {
+			return keys, fmt.Errorf("upload failed: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
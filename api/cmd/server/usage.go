@@ -0,0 +1,233 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"map-ascii-generator/api/internal/storage"
+)
+
+const (
+	usageCollection        = "usage"
+	usageRecord            = "clients"
+	usageSaveEvery         = time.Minute
+	defaultUsageMaxClients = 10000
+	// usageOther collects the clients beyond usage.max_clients.
+	usageOther = "(other)"
+)
+
+// usageCounts is what one client has used.
+type usageCounts struct {
+	Requests  int64     `json:"requests"`
+	Renders   int64     `json:"renders"`
+	Cells     int64     `json:"cells"`
+	Bytes     int64     `json:"bytes"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+type usageRow struct {
+	Client string `json:"client"`
+	// Name is the name of an API key client.
+	Name string `json:"name,omitempty"`
+	usageCounts
+}
+
+type usageResponse struct {
+	Since   time.Time  `json:"since"`
+	Clients []usageRow `json:"clients"`
+}
+
+// usageLedger counts requests, renders, cells and bytes per client, by IP
+// address, API key ID or token subject. With a state directory the counts
+// are saved every usageSaveEvery and carried over restarts.
+type usageLedger struct {
+	mu      sync.Mutex
+	since   time.Time
+	clients map[string]*usageCounts
+	dir     storage.Store
+	dirty   bool
+}
+
+type usageState struct {
+	Since   time.Time               `json:"since"`
+	Clients map[string]*usageCounts `json:"clients"`
+}
+
+func newUsageLedger(dir storage.Store, now time.Time) (*usageLedger, error) {
+	u := &usageLedger{since: now.UTC(), clients: make(map[string]*usageCounts), dir: dir}
+	if dir == nil {
+		return u, nil
+	}
+
+	var saved usageState
+	ok, err := dir.Get(usageCollection, usageRecord, &saved)
+	if err != nil {
+		return nil, err
+	}
+	if ok && saved.Clients != nil {
+		u.since, u.clients = saved.Since, saved.Clients
+	}
+	go u.saveEvery(usageSaveEvery)
+	return u, nil
+}
+
+// add applies change to the counts of client, or of usageOther once
+// maxClients are counted.
+func (u *usageLedger) add(client string, maxClients int, change func(*usageCounts)) {
+	if client == "" {
+		return
+	}
+	now := time.Now().UTC()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	counts, ok := u.clients[client]
+	if !ok && len(u.clients) >= maxClients {
+		client = usageOther
+		counts, ok = u.clients[client]
+	}
+	if !ok {
+		counts = &usageCounts{FirstSeen: now}
+		u.clients[client] = counts
+	}
+	change(counts)
+	counts.LastSeen = now
+	u.dirty = true
+}
+
+func (u *usageLedger) rows() (time.Time, []usageRow) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	rows := make([]usageRow, 0, len(u.clients))
+	for client, counts := range u.clients {
+		rows = append(rows, usageRow{Client: client, usageCounts: *counts})
+	}
+	slices.SortFunc(rows, func(a usageRow, b usageRow) int {
+		return cmp.Or(cmp.Compare(b.Requests, a.Requests), cmp.Compare(a.Client, b.Client))
+	})
+	return u.since, rows
+}
+
+func (u *usageLedger) save() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.dirty {
+		return nil
+	}
+	if err := u.dir.Put(usageCollection, usageRecord, usageState{Since: u.since, Clients: u.clients}); err != nil {
+		return err
+	}
+	u.dirty = false
+	return nil
+}
+
+func (u *usageLedger) saveEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := u.save(); err != nil {
+			log.Printf("usage save failed: %v", err)
+		}
+	}
+}
+
+// usageClient is who r is accounted to: the client it was rate limited as,
+// or its address for endpoints without a rate limit. Renders the server
+// makes itself, such as warmup and scheduled renders, have no client.
+func usageClient(r *http.Request) string {
+	if client := requestClient(r); client != "" {
+		return client
+	}
+	if r.RemoteAddr == "" {
+		return ""
+	}
+	return clientIdentifier(r)
+}
+
+// recordUsage counts a successful render of resp for the client of r.
+func (s *server) recordUsage(r *http.Request, resp generateResponse) {
+	s.usage.add(usageClient(r), s.config().usageMaxClients, func(counts *usageCounts) {
+		counts.Renders++
+		counts.Cells += int64(resp.Meta.Width) * int64(resp.Meta.Height)
+	})
+}
+
+// withUsage counts every request and the bytes of its response for its
+// client. Requests that did not come through the access log, like gRPC
+// calls, get a place to note their client.
+func (s *server) withUsage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(accessEntryContext{}).(*accessEntry); !ok {
+			r = r.WithContext(context.WithValue(r.Context(), accessEntryContext{}, &accessEntry{}))
+		}
+		tw := &trackingWriter{ResponseWriter: w}
+		defer func() {
+			s.usage.add(usageClient(r), s.config().usageMaxClients, func(counts *usageCounts) {
+				counts.Requests++
+				counts.Bytes += tw.bytes
+			})
+		}()
+		next.ServeHTTP(tw, r)
+	})
+}
+
+// handleAdminUsage exports the usage of every client as JSON, or as CSV
+// with format=csv or an Accept of text/csv, busiest first.
+func (s *server) handleAdminUsage(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		format = "csv"
+	}
+	if format != "" && format != "csv" && format != "json" {
+		writeJSONError(w, http.StatusBadRequest, "format must be csv or json")
+		return
+	}
+
+	since, rows := s.usage.rows()
+	keys := s.keys.Load()
+	for i := range rows {
+		if id, ok := strings.CutPrefix(rows[i].Client, "key:"); ok && keys != nil {
+			if k, ok := keys.Get(id); ok {
+				rows[i].Name = k.Name
+			}
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if format != "csv" {
+		writeJSON(w, http.StatusOK, usageResponse{Since: since, Clients: rows})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="usage.csv"`)
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{"client", "name", "requests", "renders", "cells", "bytes", "first_seen", "last_seen"})
+	for _, row := range rows {
+		_ = out.Write([]string{
+			row.Client,
+			row.Name,
+			strconv.FormatInt(row.Requests, 10),
+			strconv.FormatInt(row.Renders, 10),
+			strconv.FormatInt(row.Cells, 10),
+			strconv.FormatInt(row.Bytes, 10),
+			row.FirstSeen.Format(time.RFC3339),
+			row.LastSeen.Format(time.RFC3339),
+		})
+	}
+	out.Flush()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// warmupBodies returns the generate requests to render into the cache at
+// startup: the default request, the default request at each of
+// cache.warmup_widths, and each preset of cache.warmup_presets. They are
+// written the way clients send them, so the cache keys match.
+func warmupBodies(cfg config) ([]string, error) {
+	bodies := []string{"{}"}
+	for _, field := range splitList(cfg.cacheWarmupWidths) {
+		width, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("cache.warmup_widths: invalid width %q", field)
+		}
+		bodies = append(bodies, fmt.Sprintf(`{"width":%d}`, width))
+	}
+	for _, name := range splitList(cfg.cacheWarmupPresets) {
+		body, _ := json.Marshal(map[string]string{"preset": name})
+		bodies = append(bodies, string(body))
+	}
+	return bodies, nil
+}
+
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// warmup renders the warmup requests into the render cache, one after
+// another so it leaves CPU to the first clients, and marks the server
+// warmed up. Requests that fail, such as a preset that no longer exists,
+// are logged and skipped.
+func (s *server) warmup() {
+	defer s.warmedUp.Store(true)
+
+	cfg := s.config()
+	if !cfg.cacheWarmup || s.renderCache() == nil {
+		return
+	}
+	if s.maintenance.Load().Enabled {
+		log.Printf("warmup skipped: in maintenance")
+		return
+	}
+	bodies, err := warmupBodies(cfg)
+	if err != nil {
+		log.Printf("warmup skipped: %v", err)
+		return
+	}
+
+	start := time.Now()
+	r, _ := http.NewRequest(http.MethodPost, "/api/generate", nil)
+	warmed := 0
+	for _, body := range bodies {
+		req, err := parseGenerateRequest([]byte(body), cfg, s.presetSet())
+		if err == nil {
+			_, err = s.generate(r, req, cfg, nil)
+		}
+		if err != nil {
+			log.Printf("warmup render %s failed: %v", body, err)
+			continue
+		}
+		warmed++
+	}
+	log.Printf("warmup: %d of %d renders cached in %s", warmed, len(bodies), time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSlowRenderThreshold = 2 * time.Second
+	// slowProfileMax caps a CPU profile of a slow render that keeps going.
+	slowProfileMax = 30 * time.Second
+	// slowParamsMax caps the logged parameters, which can carry a GeoJSON
+	// upload.
+	slowParamsMax = 8 << 10
+)
+
+// renderWatchdog notices renders that run past slow_render.threshold. It
+// profiles one slow render at a time, as the CPU profiler only runs once
+// per process.
+type renderWatchdog struct {
+	profiling atomic.Bool
+}
+
+// watchRender starts watching a render of req and returns the function to
+// call when it is done. A render that took longer than the threshold is
+// logged with its parameters; with slow_render.profile_dir set, a CPU
+// profile is captured from the moment it crosses the threshold until it
+// ends.
+func (s *server) watchRender(r *http.Request, req generateRequest) func(error) {
+	cfg := s.config()
+	threshold := cfg.slowRenderThreshold
+	if threshold <= 0 {
+		return func(error) {}
+	}
+
+	start := time.Now()
+	finished := make(chan struct{})
+	timer := time.AfterFunc(threshold, func() {
+		if cfg.slowRenderProfileDir != "" {
+			s.profileSlowRender(cfg.slowRenderProfileDir, requestID(r), finished)
+		}
+	})
+	return func(err error) {
+		timer.Stop()
+		close(finished)
+		took := time.Since(start)
+		if took < threshold {
+			return
+		}
+		outcome := "ok"
+		if err != nil {
+			outcome = err.Error()
+		}
+		log.Printf("slow render: request %s took %s (threshold %s), result: %s, params: %s",
+			requestID(r), took.Round(time.Millisecond), threshold, outcome, slowRenderParams(req))
+	}
+}
+
+// profileSlowRender writes a CPU profile until finished is closed or
+// slowProfileMax passes, unless another profile is being taken.
+func (s *server) profileSlowRender(dir string, id string, finished <-chan struct{}) {
+	if !s.watchdog.profiling.CompareAndSwap(false, true) {
+		return
+	}
+	defer s.watchdog.profiling.Store(false)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("slow render profile: %v", err)
+		return
+	}
+	path := filepath.Join(dir, fmt.Sprintf("slow-render-%s-%s.pprof", time.Now().UTC().Format("20060102T150405Z"), id))
+	file, err := os.Create(path)
+	if err != nil {
+		log.Printf("slow render profile: %v", err)
+		return
+	}
+	defer file.Close()
+	if err := pprof.StartCPUProfile(file); err != nil {
+		// A CPU profile from /debug/pprof is already running.
+		log.Printf("slow render profile: %v", err)
+		_ = os.Remove(path)
+		return
+	}
+
+	select {
+	case <-finished:
+	case <-time.After(slowProfileMax):
+	}
+	pprof.StopCPUProfile()
+	log.Printf("slow render profile of request %s written to %s", id, path)
+}
+
+// slowRenderParams is req as JSON for the log, cut at slowParamsMax bytes.
+func slowRenderParams(req generateRequest) string {
+	params, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Sprintf("%+v", req)
+	}
+	if len(params) > slowParamsMax {
+		return fmt.Sprintf("%s... (%d bytes)", params[:slowParamsMax], len(params))
+	}
+	return string(params)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"map-ascii-generator/api/internal/render"
+	"map-ascii-generator/api/internal/weather"
+)
+
+const (
+	defaultWeatherSource   = "open-meteo"
+	defaultWeatherGridStep = 15.0
+	defaultWeatherCacheTTL = time.Hour
+	defaultWeatherRamp     = ".:-=+*#%@"
+	// maxWeatherBytes bounds one provider response; a batch of 100
+	// Open-Meteo locations is about 40 KiB.
+	maxWeatherBytes = 1 << 20
+)
+
+var errWeatherUnavailable = fmt.Errorf("weather data %w", errUnavailable)
+
+// weatherMeta describes the shading: the variable, the range spread over
+// the levels and when the grid was fetched from the source.
+type weatherMeta struct {
+	Source   string    `json:"source"`
+	Variable string    `json:"variable"`
+	Unit     string    `json:"unit"`
+	Min      float64   `json:"min"`
+	Max      float64   `json:"max"`
+	Fetched  time.Time `json:"fetched"`
+}
+
+// newWeatherSource returns the provider configured as weather.source, or
+// nil when it is "none". New providers implement weather.Source and are
+// added here.
+func newWeatherSource(cfg config) (weather.Source, error) {
+	if cfg.weatherGridStep <= 0 || math.Mod(180, cfg.weatherGridStep) != 0 {
+		return nil, fmt.Errorf("weather.grid_step must divide 180 degrees, got %v", cfg.weatherGridStep)
+	}
+	get := func(ctx context.Context, url string) ([]byte, error) {
+		return fetchURL(ctx, url, maxWeatherBytes)
+	}
+
+	switch cfg.weatherSource {
+	case "none":
+		return nil, nil
+	case "open-meteo":
+		return weather.OpenMeteo{URL: cfg.weatherURL, Get: get}, nil
+	default:
+		return nil, fmt.Errorf("unknown weather.source %q (supported: open-meteo, none)", cfg.weatherSource)
+	}
+}
+
+// weatherSettings validates the weather options and returns the variable,
+// ramp, number of levels and shaded range.
+func weatherSettings(req generateRequest) (weather.Variable, []rune, int, float64, float64, error) {
+	variable, err := weather.ParseVariable(req.Weather.Variable)
+	if err != nil || variable == "" {
+		return "", nil, 0, 0, 0, err
+	}
+
+	lo, hi := variable.Range()
+	if req.Weather.Min != nil {
+		lo = *req.Weather.Min
+	}
+	if req.Weather.Max != nil {
+		hi = *req.Weather.Max
+	}
+	if !isFinite(lo) || !isFinite(hi) || lo >= hi {
+		return "", nil, 0, 0, 0, fmt.Errorf("weather.min must be below weather.max")
+	}
+
+	ramp, err := parseRamp(req.Weather.Ramp, "weather.ramp", 1, req.AllowUnicode)
+	if err != nil {
+		return "", nil, 0, 0, 0, err
+	}
+	if len(ramp) == 0 && len(req.Color.WeatherColors) > 0 {
+		return variable, nil, len(req.Color.WeatherColors), lo, hi, nil
+	}
+	if len(ramp) == 0 {
+		ramp = []rune(defaultWeatherRamp)
+	}
+	return variable, ramp, len(ramp), lo, hi, nil
+}
+
+// requestWeather shades land by weather.variable from the configured
+// source. Grids are cached for weather.cache_ttl and the last one is kept
+// while the source is down.
+func (s *server) requestWeather(req generateRequest) (*render.Field, *weatherMeta, error) {
+	variable, ramp, levels, lo, hi, err := weatherSettings(req)
+	if err != nil || variable == "" {
+		return nil, nil, err
+	}
+
+	cfg := s.config()
+	src, err := newWeatherSource(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if src == nil {
+		return nil, nil, fmt.Errorf("%w: weather.source is none", errWeatherUnavailable)
+	}
+
+	key := fmt.Sprintf("%s %s %s %v", src.Name(), cfg.weatherURL, variable, cfg.weatherGridStep)
+	grid, fetchedAt, err := s.weather.get(key, cfg.weatherCacheTTL, func() (*weather.Grid, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 4*fetchTimeout)
+		defer cancel()
+		return weather.Fetch(ctx, src, variable, cfg.weatherGridStep)
+	})
+	if fetchedAt.IsZero() {
+		// The cause names upstream hosts and addresses; callers only get
+		// the sentinel.
+		log.Printf("weather: fetching %s failed: %v", key, err)
+		return nil, nil, errWeatherUnavailable
+	}
+	if err != nil {
+		log.Printf("weather: refreshing %s failed, using the grid fetched at %s: %v", key, fetchedAt.Format(time.RFC3339), err)
+	}
+
+	field := &render.Field{Sample: grid.Sample, Min: lo, Max: hi, Ramp: ramp, Levels: levels, Legend: req.Weather.Legend}
+	meta := &weatherMeta{Source: src.Name(), Variable: string(variable), Unit: variable.Unit(), Min: lo, Max: hi, Fetched: grid.Fetched}
+	return field, meta, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"map-ascii-generator/api/internal/render"
+	"map-ascii-generator/api/internal/websocket"
+)
+
+const (
+	// wsIdleTimeout closes connections that send no message for this long.
+	wsIdleTimeout  = 5 * time.Minute
+	wsWriteTimeout = 10 * time.Second
+)
+
+// wsUpdate changes the markers of the current request. Fields left out
+// keep their value, so an empty object re-renders as is, e.g. to move the
+// ISS.
+type wsUpdate struct {
+	Marker *struct {
+		Lon float64 `json:"lon"`
+		Lat float64 `json:"lat"`
+	} `json:"marker"`
+	Markers *[]markerPoint `json:"markers"`
+}
+
+func (u wsUpdate) apply(req generateRequest) generateRequest {
+	if u.Marker != nil {
+		req.Marker.Enabled = true
+		req.Marker.Lon, req.Marker.Lat = u.Marker.Lon, u.Marker.Lat
+		req.Marker.Place = ""
+		req.Marker.UseClientIP = false
+	}
+	if u.Markers != nil {
+		req.Markers = *u.Markers
+	}
+	return req
+}
+
+// wsMessage is sent for every client message: the rendered frame or its
+// diff, or the error that left the previous frame in place.
+type wsMessage struct {
+	Type  string            `json:"type"`
+	Frame *generateResponse `json:"frame,omitempty"`
+	Diff  *frameDiff        `json:"diff,omitempty"`
+	Error string            `json:"error,omitempty"`
+}
+
+// handleWS renders live maps over a WebSocket. The first message is a
+// generate request and later ones are wsUpdate objects; each is answered
+// with the re-rendered frame and counts as one request against the rate
+// limit. With ?diff=1, frames after the first only list the changed cells.
+func (s *server) handleWS(w http.ResponseWriter, r *http.Request) {
+	if !s.admitDuringMaintenance(w, false) {
+		return
+	}
+	limiter, clientKey, limits, ok := s.resolveClient(r)
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "invalid API key")
+		return
+	}
+
+	diff := false
+	if raw := r.URL.Query().Get("diff"); raw != "" {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "diff must be 0 or 1")
+			return
+		}
+		diff = value
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(limits.maxBodyBytes)
+
+	var current *generateRequest
+	var prev [][]render.StyledCell
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(wsIdleTimeout))
+		data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		message := wsMessage{Type: "frame"}
+		next, err := parseWSMessage(data, current, limits, s.presetSet())
+		switch {
+		case err != nil:
+			message = wsMessage{Type: "error", Error: err.Error()}
+		case !limiter.Allow(clientKey, time.Now()):
+			message = wsMessage{Type: "error", Error: "rate limit exceeded"}
+		default:
+			resp, err := s.generate(r, next, limits, nil)
+			if err != nil {
+				message = wsMessage{Type: "error", Error: err.Error()}
+				break
+			}
+			current, message.Frame = &next, &resp
+			if !diff {
+				break
+			}
+			cells := resp.styled()
+			if changes, ok := diffFrames(prev, cells); prev != nil && ok {
+				message = wsMessage{Type: "diff", Diff: &changes}
+			}
+			prev = cells
+		}
+
+		payload, err := json.Marshal(message)
+		if err != nil {
+			return
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := conn.WriteText(payload); err != nil {
+			return
+		}
+	}
+}
+
+// parseWSMessage reads a full generate request until one has rendered, and
+// updates to it afterwards.
+func parseWSMessage(data []byte, current *generateRequest, limits config, presets presetSet) (generateRequest, error) {
+	if current == nil {
+		return parseGenerateRequest(data, limits, presets)
+	}
+
+	var update wsUpdate
+	if err := decodeStrictJSON(data, &update); err != nil {
+		return generateRequest{}, err
+	}
+	return update.apply(*current), nil
+}
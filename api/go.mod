@@ -1,5 +1,5 @@
 module map-ascii-generator/api
 
-go 1.22
+go 1.24
 
 require github.com/Kivayan/map-ascii v0.3.0
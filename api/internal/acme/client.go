@@ -0,0 +1,319 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const LetsEncryptURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+type directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+type problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+func (p problem) Error() string {
+	return fmt.Sprintf("acme: %s (%s)", p.Detail, p.Type)
+}
+
+type order struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+}
+
+type authorization struct {
+	Status     string      `json:"status"`
+	Identifier identifier  `json:"identifier"`
+	Challenges []challenge `json:"challenges"`
+}
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type challenge struct {
+	Type   string   `json:"type"`
+	URL    string   `json:"url"`
+	Token  string   `json:"token"`
+	Status string   `json:"status"`
+	Error  *problem `json:"error,omitempty"`
+}
+
+// client speaks the subset of RFC 8555 needed for http-01 issuance.
+type client struct {
+	http *http.Client
+	key  *ecdsa.PrivateKey
+	dir  directory
+	kid  string
+
+	nonces []string
+}
+
+func newClient(ctx context.Context, httpClient *http.Client, directoryURL string, key *ecdsa.PrivateKey) (*client, error) {
+	c := &client{http: httpClient, key: key}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, directoryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch acme directory: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch acme directory: unexpected status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&c.dir); err != nil {
+		return nil, fmt.Errorf("decode acme directory: %w", err)
+	}
+
+	return c, nil
+}
+
+func (c *client) register(ctx context.Context, email string) error {
+	payload := map[string]any{"termsOfServiceAgreed": true}
+	if email != "" {
+		payload["contact"] = []string{"mailto:" + email}
+	}
+
+	resp, err := c.post(ctx, c.dir.NewAccount, payload, nil)
+	if err != nil {
+		return fmt.Errorf("register acme account: %w", err)
+	}
+	c.kid = resp.Header.Get("Location")
+	if c.kid == "" {
+		return fmt.Errorf("register acme account: missing account URL")
+	}
+
+	return nil
+}
+
+func (c *client) newOrder(ctx context.Context, host string) (order, string, error) {
+	var o order
+	payload := map[string]any{"identifiers": []identifier{{Type: "dns", Value: host}}}
+	resp, err := c.post(ctx, c.dir.NewOrder, payload, &o)
+	if err != nil {
+		return order{}, "", fmt.Errorf("create acme order: %w", err)
+	}
+
+	return o, resp.Header.Get("Location"), nil
+}
+
+func (c *client) fetch(ctx context.Context, url string, out any) (*http.Response, error) {
+	// POST-as-GET: an empty payload signals a read request.
+	return c.post(ctx, url, nil, out)
+}
+
+func (c *client) post(ctx context.Context, url string, payload any, out any) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, body, err := c.postOnce(ctx, url, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode >= 400 {
+			var p problem
+			if json.Unmarshal(body, &p) != nil || p.Type == "" {
+				return nil, fmt.Errorf("acme: unexpected status %d", resp.StatusCode)
+			}
+			if p.Type == "urn:ietf:params:acme:error:badNonce" && attempt < 2 {
+				continue
+			}
+			return nil, p
+		}
+
+		if out != nil {
+			if b, ok := out.(*[]byte); ok {
+				*b = body
+			} else if err := json.Unmarshal(body, out); err != nil {
+				return nil, fmt.Errorf("decode acme response: %w", err)
+			}
+		}
+
+		return resp, nil
+	}
+}
+
+func (c *client) postOnce(ctx context.Context, url string, payload any) (*http.Response, []byte, error) {
+	nonce, err := c.nonce(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := c.sign(url, nonce, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/jose+json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if next := resp.Header.Get("Replay-Nonce"); next != "" {
+		c.nonces = append(c.nonces, next)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp, data, nil
+}
+
+func (c *client) nonce(ctx context.Context) (string, error) {
+	if n := len(c.nonces); n > 0 {
+		nonce := c.nonces[n-1]
+		c.nonces = c.nonces[:n-1]
+		return nonce, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.dir.NewNonce, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetch acme nonce: %w", err)
+	}
+	resp.Body.Close()
+
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", fmt.Errorf("fetch acme nonce: missing Replay-Nonce header")
+	}
+
+	return nonce, nil
+}
+
+func (c *client) sign(url string, nonce string, payload any) ([]byte, error) {
+	protected := map[string]any{"alg": "ES256", "nonce": nonce, "url": url}
+	if c.kid != "" {
+		protected["kid"] = c.kid
+	} else {
+		protected["jwk"] = jwk(c.key)
+	}
+
+	header, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+
+	encodedPayload := ""
+	if payload != nil {
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		encodedPayload = b64(raw)
+	}
+
+	signingInput := b64(header) + "." + encodedPayload
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return json.Marshal(map[string]string{
+		"protected": b64(header),
+		"payload":   encodedPayload,
+		"signature": b64(signature),
+	})
+}
+
+func (c *client) keyAuthorization(token string) string {
+	return token + "." + thumbprint(c.key)
+}
+
+func (c *client) waitStatus(ctx context.Context, url string, out any, status func() string, want string) error {
+	deadline := time.Now().Add(2 * time.Minute)
+	for {
+		if _, err := c.fetch(ctx, url, out); err != nil {
+			return err
+		}
+
+		switch current := status(); current {
+		case want:
+			return nil
+		case "invalid", "revoked", "expired", "deactivated":
+			return fmt.Errorf("acme: %s became %s", url, current)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("acme: timed out waiting for %s", url)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func jwk(key *ecdsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"crv": "P-256",
+		"kty": "EC",
+		"x":   b64(padded(key.X)),
+		"y":   b64(padded(key.Y)),
+	}
+}
+
+func thumbprint(key *ecdsa.PrivateKey) string {
+	k := jwk(key)
+	// RFC 7638 requires the members in lexicographic order without whitespace.
+	canonical := fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, k["crv"], k["kty"], k["x"], k["y"])
+	sum := sha256.Sum256([]byte(canonical))
+	return b64(sum[:])
+}
+
+func padded(v *big.Int) []byte {
+	out := make([]byte, 32)
+	v.FillBytes(out)
+	return out
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func isHTTP01(ch challenge) bool {
+	return strings.EqualFold(ch.Type, "http-01")
+}
@@ -0,0 +1,306 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	renewBefore   = 30 * 24 * time.Hour
+	checkInterval = 12 * time.Hour
+	challengePath = "/.well-known/acme-challenge/"
+)
+
+// Manager obtains and renews a certificate for a single host using the
+// http-01 challenge. HTTPHandler must be reachable on port 80 for the host.
+type Manager struct {
+	Host         string
+	Email        string
+	DirectoryURL string
+	CacheDir     string
+	HTTPClient   *http.Client
+
+	mu     sync.Mutex
+	issue  sync.Mutex
+	cert   *tls.Certificate
+	tokens map[string]string
+}
+
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if hello.ServerName != "" && !strings.EqualFold(hello.ServerName, m.Host) {
+		return nil, fmt.Errorf("acme: no certificate for %q", hello.ServerName)
+	}
+
+	m.mu.Lock()
+	cert := m.cert
+	m.mu.Unlock()
+	if cert != nil {
+		return cert, nil
+	}
+
+	ctx, cancel := context.WithTimeout(hello.Context(), 5*time.Minute)
+	defer cancel()
+
+	return m.ensure(ctx)
+}
+
+func (m *Manager) HTTPHandler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, challengePath) {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		token := strings.TrimPrefix(r.URL.Path, challengePath)
+		m.mu.Lock()
+		keyAuth, ok := m.tokens[token]
+		m.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(keyAuth))
+	})
+}
+
+// Run loads or obtains the certificate and renews it until ctx is cancelled.
+func (m *Manager) Run(ctx context.Context) {
+	for {
+		if _, err := m.ensure(ctx); err != nil {
+			log.Printf("acme: certificate for %s not available: %v", m.Host, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(checkInterval):
+		}
+	}
+}
+
+func (m *Manager) ensure(ctx context.Context) (*tls.Certificate, error) {
+	m.issue.Lock()
+	defer m.issue.Unlock()
+
+	m.mu.Lock()
+	cert := m.cert
+	m.mu.Unlock()
+
+	if cert == nil {
+		if cached, err := m.loadCached(); err == nil {
+			cert = cached
+		}
+	}
+	if cert != nil && time.Until(cert.Leaf.NotAfter) > renewBefore {
+		m.setCert(cert)
+		return cert, nil
+	}
+
+	issued, err := m.obtain(ctx)
+	if err != nil {
+		if cert != nil && time.Now().Before(cert.Leaf.NotAfter) {
+			m.setCert(cert)
+			return cert, nil
+		}
+		return nil, err
+	}
+
+	m.setCert(issued)
+	log.Printf("acme: issued certificate for %s valid until %s", m.Host, issued.Leaf.NotAfter.Format(time.RFC3339))
+	return issued, nil
+}
+
+func (m *Manager) setCert(cert *tls.Certificate) {
+	m.mu.Lock()
+	m.cert = cert
+	m.mu.Unlock()
+}
+
+func (m *Manager) obtain(ctx context.Context) (*tls.Certificate, error) {
+	accountKey, err := m.loadOrCreateKey("account.key")
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := m.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	directoryURL := m.DirectoryURL
+	if directoryURL == "" {
+		directoryURL = LetsEncryptURL
+	}
+
+	c, err := newClient(ctx, httpClient, directoryURL, accountKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.register(ctx, m.Email); err != nil {
+		return nil, err
+	}
+
+	o, orderURL, err := c.newOrder(ctx, m.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, authzURL := range o.Authorizations {
+		if err := m.authorize(ctx, c, authzURL); err != nil {
+			return nil, err
+		}
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: m.Host},
+		DNSNames: []string{m.Host},
+	}, certKey)
+	if err != nil {
+		return nil, fmt.Errorf("create CSR: %w", err)
+	}
+
+	if _, err := c.post(ctx, o.Finalize, map[string]string{"csr": b64(csr)}, &o); err != nil {
+		return nil, fmt.Errorf("finalize acme order: %w", err)
+	}
+	if err := c.waitStatus(ctx, orderURL, &o, func() string { return o.Status }, "valid"); err != nil {
+		return nil, err
+	}
+
+	var chainPEM []byte
+	if _, err := c.fetch(ctx, o.Certificate, &chainPEM); err != nil {
+		return nil, fmt.Errorf("download certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(certKey)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	if err := m.writeCache(m.Host+".crt", chainPEM); err != nil {
+		log.Printf("acme: failed to cache certificate: %v", err)
+	}
+	if err := m.writeCache(m.Host+".key", keyPEM); err != nil {
+		log.Printf("acme: failed to cache certificate key: %v", err)
+	}
+
+	return parseKeyPair(chainPEM, keyPEM)
+}
+
+func (m *Manager) authorize(ctx context.Context, c *client, authzURL string) error {
+	var authz authorization
+	if _, err := c.fetch(ctx, authzURL, &authz); err != nil {
+		return fmt.Errorf("fetch authorization: %w", err)
+	}
+	if authz.Status == "valid" {
+		return nil
+	}
+
+	var ch *challenge
+	for i := range authz.Challenges {
+		if isHTTP01(authz.Challenges[i]) {
+			ch = &authz.Challenges[i]
+			break
+		}
+	}
+	if ch == nil {
+		return fmt.Errorf("acme: no http-01 challenge offered for %s", authz.Identifier.Value)
+	}
+
+	m.mu.Lock()
+	if m.tokens == nil {
+		m.tokens = make(map[string]string)
+	}
+	m.tokens[ch.Token] = c.keyAuthorization(ch.Token)
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.tokens, ch.Token)
+		m.mu.Unlock()
+	}()
+
+	if _, err := c.post(ctx, ch.URL, map[string]any{}, nil); err != nil {
+		return fmt.Errorf("accept challenge: %w", err)
+	}
+
+	return c.waitStatus(ctx, authzURL, &authz, func() string { return authz.Status }, "valid")
+}
+
+func (m *Manager) loadCached() (*tls.Certificate, error) {
+	certPEM, err := os.ReadFile(filepath.Join(m.CacheDir, m.Host+".crt"))
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := os.ReadFile(filepath.Join(m.CacheDir, m.Host+".key"))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseKeyPair(certPEM, keyPEM)
+}
+
+func (m *Manager) loadOrCreateKey(name string) (*ecdsa.PrivateKey, error) {
+	path := filepath.Join(m.CacheDir, name)
+	if data, err := os.ReadFile(path); err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("acme: invalid PEM in %s", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.writeCache(name, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (m *Manager) writeCache(name string, data []byte) error {
+	if err := os.MkdirAll(m.CacheDir, 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(m.CacheDir, name), data, 0o600)
+}
+
+func parseKeyPair(certPEM []byte, keyPEM []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &cert, nil
+}
@@ -0,0 +1,349 @@
+package apikey
+
+import (
+	"cmp"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"map-ascii-generator/api/internal/storage"
+)
+
+// collection holds the managed keys in storage, by ID.
+const collection = "api_keys"
+
+var (
+	ErrNotFound    = errors.New("unknown API key")
+	ErrUnknownTier = errors.New("unknown tier")
+	ErrRevoked     = errors.New("API key is revoked")
+)
+
+// idLength is the length of a key ID in hex digits.
+const idLength = 12
+
+// Hash is the hex SHA-256 hash of key, which storage keeps instead of the
+// key.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ID identifies a key without revealing it: a prefix of its hash.
+func ID(key string) string {
+	return Hash(key)[:idLength]
+}
+
+func (k Key) ID() string {
+	if k.Key == "" && len(k.hash) >= idLength {
+		return k.hash[:idLength]
+	}
+	return ID(k.Key)
+}
+
+// storedKey is a managed key as storage keeps it: the key by its hash, and
+// the secret encrypted by the sealer.
+type storedKey struct {
+	Hash   string `json:"hash"`
+	Name   string `json:"name"`
+	Tier   string `json:"tier"`
+	Secret string `json:"sealed_secret,omitempty"`
+	Limits Limits `json:"limits"`
+
+	Revoked bool      `json:"revoked,omitempty"`
+	Created time.Time `json:"created,omitzero"`
+
+	// Key and PlainSecret are how earlier versions stored keys. Such
+	// records are rewritten without them when they are loaded.
+	Key         string `json:"key,omitempty"`
+	PlainSecret string `json:"secret,omitempty"`
+}
+
+// apply overrides tier's limits with the key's. A key with its own rate
+// limit gets a tier name of its own, so it is counted separately.
+func (k Key) apply(tier Tier) Tier {
+	if k.Limits.RateLimit > 0 || k.Limits.RateWindow > 0 {
+		tier.Name += "/key:" + k.ID()
+	}
+	if k.Limits.RateLimit > 0 {
+		tier.RateLimit = k.Limits.RateLimit
+	}
+	if k.Limits.RateWindow > 0 {
+		tier.RateWindow = k.Limits.RateWindow
+	}
+	if k.Limits.MaxWidth > 0 {
+		tier.MaxWidth = k.Limits.MaxWidth
+	}
+	if k.Limits.MaxSupersample > 0 {
+		tier.MaxSupersample = k.Limits.MaxSupersample
+	}
+	return tier
+}
+
+// UseStorage loads the managed keys kept in dir and saves later changes
+// there. Without it changes only last until the process exits. The
+// secrets of signed keys are stored encrypted with stateSecret; without
+// one, signed keys cannot be stored.
+func (s *Store) UseStorage(dir storage.Store, stateSecret string) error {
+	sealer, err := newSealer(stateSecret)
+	if err != nil {
+		return err
+	}
+	ids, err := dir.Keys(collection)
+	if err != nil {
+		return fmt.Errorf("list stored API keys: %w", err)
+	}
+
+	managed := make(map[string]Key, len(ids))
+	var plain []Key
+	for _, id := range ids {
+		var stored storedKey
+		ok, err := dir.Get(collection, id, &stored)
+		if err != nil {
+			return fmt.Errorf("read stored API key %s: %w", id, err)
+		}
+		if stored.Key != "" {
+			stored.Hash = Hash(stored.Key)
+		}
+		if !ok || len(stored.Hash) != sha256.Size*2 || stored.Hash[:idLength] != id {
+			continue
+		}
+
+		k := Key{Name: stored.Name, Tier: stored.Tier, Limits: stored.Limits, Managed: true, Revoked: stored.Revoked, Created: stored.Created, hash: stored.Hash}
+		if stored.Key != "" {
+			_, inFile := s.keys[stored.Key]
+			k.Secret, k.Managed = stored.PlainSecret, !inFile
+			plain = append(plain, k)
+		} else if stored.Secret != "" {
+			// A signed key whose secret cannot be read would accept
+			// unsigned requests, so it stops the load.
+			if sealer == nil {
+				return fmt.Errorf("stored API key %s is signed, and no state secret is set to decrypt its secret", id)
+			}
+			if k.Secret, err = sealer.open(id, stored.Secret); err != nil {
+				return fmt.Errorf("stored API key %s: %w", id, err)
+			}
+		}
+		managed[id] = k
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = dir
+	s.sealer = sealer
+	s.managed = managed
+	for _, k := range plain {
+		if err := s.save(k); err != nil {
+			return fmt.Errorf("rewrite stored API key %s without its plain key: %w", k.ID(), err)
+		}
+	}
+	return nil
+}
+
+// Adopt takes over the managed keys of old, and where they are saved, so
+// that a store read from the same keys file can replace old without losing
+// them. Call it just before the swap, so no change made to old is missed.
+func (s *Store) Adopt(old *Store) {
+	old.mu.RLock()
+	managed, state, sealer := maps.Clone(old.managed), old.state, old.sealer
+	old.mu.RUnlock()
+
+	s.mu.Lock()
+	s.managed, s.state, s.sealer = managed, state, sealer
+	s.mu.Unlock()
+}
+
+// Keys lists every key, revoked ones included, by name and then ID.
+func (s *Store) Keys() []Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]Key, 0, len(s.keys)+len(s.managed))
+	for key := range s.keys {
+		k, _ := s.lookup(key)
+		keys = append(keys, k)
+	}
+	keys = append(keys, s.managedOnly()...)
+	slices.SortFunc(keys, func(a Key, b Key) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.ID(), b.ID()))
+	})
+	return keys
+}
+
+// Get returns the key with the given ID.
+func (s *Store) Get(id string) (Key, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	k, ok := s.byID(id)
+	return k, ok
+}
+
+// Create adds a new key with a random value, and a random secret when
+// signed is set.
+func (s *Store) Create(name string, tier string, limits Limits, signed bool) (Key, error) {
+	k := Key{Name: name, Tier: tier, Limits: limits, Managed: true, Created: time.Now().UTC()}
+	if signed {
+		k.Secret = randomToken()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tiers[tier]; !ok {
+		return Key{}, fmt.Errorf("%w %q", ErrUnknownTier, tier)
+	}
+	k.Key = s.newKey()
+	k.hash = Hash(k.Key)
+	if err := s.save(k); err != nil {
+		return Key{}, err
+	}
+	return k, nil
+}
+
+// Update changes the key with the given ID with change, which may edit
+// anything but the key itself. Revoked keys cannot be changed.
+func (s *Store) Update(id string, change func(*Key)) (Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.byID(id)
+	if !ok {
+		return Key{}, ErrNotFound
+	}
+	if k.Revoked {
+		return Key{}, ErrRevoked
+	}
+
+	value := k.Key
+	change(&k)
+	k.Key = value
+	if _, ok := s.tiers[k.Tier]; !ok {
+		return Key{}, fmt.Errorf("%w %q", ErrUnknownTier, k.Tier)
+	}
+	if err := s.save(k); err != nil {
+		return Key{}, err
+	}
+	return k, nil
+}
+
+// Revoke disables the key with the given ID for good. It stays listed so
+// the revocation outlives reloads of a keys file that still has it.
+func (s *Store) Revoke(id string) (Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.byID(id)
+	if !ok {
+		return Key{}, ErrNotFound
+	}
+	if k.Revoked {
+		return k, nil
+	}
+
+	k.Revoked = true
+	if err := s.save(k); err != nil {
+		return Key{}, err
+	}
+	return k, nil
+}
+
+// Rotate replaces the key with the given ID by a new one with the same
+// name, tier and limits, and a new secret if it had one, and revokes it.
+func (s *Store) Rotate(id string) (Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.byID(id)
+	if !ok {
+		return Key{}, ErrNotFound
+	}
+	if old.Revoked {
+		return Key{}, ErrRevoked
+	}
+
+	k := Key{Key: s.newKey(), Name: old.Name, Tier: old.Tier, Limits: old.Limits, Managed: true, Created: time.Now().UTC()}
+	k.hash = Hash(k.Key)
+	if old.Secret != "" {
+		k.Secret = randomToken()
+	}
+	if err := s.save(k); err != nil {
+		return Key{}, err
+	}
+	old.Revoked = true
+	if err := s.save(old); err != nil {
+		return Key{}, err
+	}
+	return k, nil
+}
+
+// byID finds a key of the keys file, with any changes made to it, or else
+// a managed key. Managed keys read from storage come without the key.
+func (s *Store) byID(id string) (Key, bool) {
+	for key := range s.keys {
+		if ID(key) == id {
+			return s.lookup(key)
+		}
+	}
+	k, ok := s.managed[id]
+	return k, ok
+}
+
+// managedOnly lists the managed keys that are not in the keys file.
+func (s *Store) managedOnly() []Key {
+	inFile := make(map[string]bool, len(s.keys))
+	for key := range s.keys {
+		inFile[Hash(key)] = true
+	}
+	var keys []Key
+	for _, k := range s.managed {
+		if !inFile[k.hash] {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// newKey returns a random key whose ID is not taken yet.
+func (s *Store) newKey() string {
+	for {
+		key := randomToken()
+		if _, taken := s.byID(ID(key)); !taken {
+			return key
+		}
+	}
+}
+
+// save records k, in storage first when there is one. Only the key's hash
+// is kept, and the secret of a managed key is encrypted; keys from the keys
+// file keep their secret there.
+func (s *Store) save(k Key) error {
+	id := k.ID()
+	if s.state != nil {
+		stored := storedKey{Hash: k.hash, Name: k.Name, Tier: k.Tier, Limits: k.Limits, Revoked: k.Revoked, Created: k.Created}
+		if k.Secret != "" && k.Managed {
+			if s.sealer == nil {
+				return ErrNoStateSecret
+			}
+			stored.Secret = s.sealer.seal(id, k.Secret)
+		}
+		if err := s.state.Put(collection, id, stored); err != nil {
+			return fmt.Errorf("store API key %s: %w", id, err)
+		}
+	}
+	if s.managed == nil {
+		s.managed = make(map[string]Key)
+	}
+	k.Key = ""
+	s.managed[id] = k
+	return nil
+}
+
+func randomToken() string {
+	return rand.Text()
+}
@@ -0,0 +1,229 @@
+package apikey
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"map-ascii-generator/api/internal/simpleyaml"
+	"map-ascii-generator/api/internal/storage"
+)
+
+// Limits are the quota settings of a tier or key; zero fields are unset.
+type Limits struct {
+	RateLimit      int           `json:"rate_limit,omitempty"`
+	RateWindow     time.Duration `json:"rate_window,omitempty"`
+	MaxWidth       int           `json:"max_width,omitempty"`
+	MaxSupersample int           `json:"max_supersample,omitempty"`
+}
+
+type Tier struct {
+	Name string
+	Limits
+}
+
+type Key struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+	Tier string `json:"tier"`
+	// Secret, when set, is the HMAC key requests made with Key must be
+	// signed with.
+	Secret string `json:"secret,omitempty"`
+	// Limits override the tier's for this key alone.
+	Limits Limits `json:"limits"`
+
+	// Managed keys were created through the admin API rather than listed
+	// in the keys file.
+	Managed bool      `json:"-"`
+	Revoked bool      `json:"revoked,omitempty"`
+	Created time.Time `json:"created,omitzero"`
+
+	// hash is Hash(Key). Managed keys read back from storage know only
+	// their hash, so Key is empty until a request presents it.
+	hash string
+}
+
+type Store struct {
+	mu   sync.RWMutex
+	path string
+
+	tiers map[string]Tier
+	keys  map[string]Key
+
+	// managed holds the admin API's keys by ID; they take precedence
+	// over the keys file and survive reloads.
+	managed map[string]Key
+	state   storage.Store
+	sealer  *sealer
+}
+
+func LoadFile(path string) (*Store, error) {
+	s := &Store{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) Reload() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("read keys file: %w", err)
+	}
+
+	tiers, keys, err := parse(data)
+	if err != nil {
+		return fmt.Errorf("parse keys file %s: %w", s.path, err)
+	}
+
+	s.mu.Lock()
+	s.tiers = tiers
+	s.keys = keys
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Lookup returns the key and its tier with the key's own limits applied.
+// Revoked keys and keys whose tier no longer exists are not found.
+func (s *Store) Lookup(key string) (Key, Tier, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	k, ok := s.lookup(key)
+	if !ok || k.Revoked {
+		return Key{}, Tier{}, false
+	}
+	tier, ok := s.tiers[k.Tier]
+	if !ok {
+		return Key{}, Tier{}, false
+	}
+
+	return k, k.apply(tier), true
+}
+
+func (s *Store) lookup(key string) (Key, bool) {
+	hash := Hash(key)
+	file, inFile := s.keys[key]
+	k, ok := s.managed[hash[:idLength]]
+	if !ok || k.hash != hash {
+		k, ok = file, inFile
+	}
+	// The keys file keeps the secrets of its keys; storage does not.
+	if inFile {
+		k.Secret = file.Secret
+	}
+	k.Key, k.hash, k.Managed = key, hash, !inFile
+	return k, ok
+}
+
+// Tier returns the tier called name.
+func (s *Store) Tier(name string) (Tier, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tier, ok := s.tiers[name]
+	return tier, ok
+}
+
+func (s *Store) Counts() (tiers int, keys int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.tiers), len(s.keys) + len(s.managedOnly())
+}
+
+func parse(data []byte) (map[string]Tier, map[string]Key, error) {
+	doc, err := simpleyaml.Parse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tiers := make(map[string]Tier)
+	rawTiers, ok := doc["tiers"].(map[string]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("tiers must be a mapping of tier name to limits")
+	}
+	for name, raw := range rawTiers {
+		fields, ok := raw.(map[string]any)
+		if !ok {
+			return nil, nil, fmt.Errorf("tier %q must be a mapping", name)
+		}
+
+		tier := Tier{Name: name}
+		if tier.RateLimit, err = intField(fields, "rate_limit"); err != nil {
+			return nil, nil, fmt.Errorf("tier %q: %w", name, err)
+		}
+		if tier.MaxWidth, err = intField(fields, "max_width"); err != nil {
+			return nil, nil, fmt.Errorf("tier %q: %w", name, err)
+		}
+		if tier.MaxSupersample, err = intField(fields, "max_supersample"); err != nil {
+			return nil, nil, fmt.Errorf("tier %q: %w", name, err)
+		}
+		if window, ok := fields["rate_window"].(string); ok && window != "" {
+			if tier.RateWindow, err = time.ParseDuration(window); err != nil {
+				return nil, nil, fmt.Errorf("tier %q: invalid rate_window %q", name, window)
+			}
+		}
+
+		tiers[name] = tier
+	}
+
+	keys := make(map[string]Key)
+	rawKeys, ok := doc["keys"].([]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("keys must be a list")
+	}
+	for idx, raw := range rawKeys {
+		fields, ok := raw.(map[string]any)
+		if !ok {
+			return nil, nil, fmt.Errorf("keys[%d] must be a mapping", idx)
+		}
+
+		key := Key{
+			Key:    stringField(fields, "key"),
+			Name:   stringField(fields, "name"),
+			Tier:   stringField(fields, "tier"),
+			Secret: stringField(fields, "secret"),
+		}
+		if key.Key == "" {
+			return nil, nil, fmt.Errorf("keys[%d]: key must not be empty", idx)
+		}
+		if _, exists := keys[key.Key]; exists {
+			return nil, nil, fmt.Errorf("keys[%d]: duplicate key", idx)
+		}
+		if _, ok := tiers[key.Tier]; !ok {
+			return nil, nil, fmt.Errorf("keys[%d]: unknown tier %q", idx, key.Tier)
+		}
+
+		keys[key.Key] = key
+	}
+
+	return tiers, keys, nil
+}
+
+func stringField(fields map[string]any, name string) string {
+	value, _ := fields[name].(string)
+	return strings.TrimSpace(value)
+}
+
+func intField(fields map[string]any, name string) (int, error) {
+	value := stringField(fields, name)
+	if value == "" {
+		return 0, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,88 @@
+package configfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"map-ascii-generator/api/internal/simpleyaml"
+)
+
+// Load reads a YAML (.yaml/.yml) or TOML (.toml) file and flattens it into
+// dotted keys such as "limits.max_width" or "listeners.0.addr".
+func Load(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+
+	var doc map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		doc, err = simpleyaml.Parse(data)
+	case ".toml":
+		doc, err = parseTOML(data)
+	default:
+		return nil, fmt.Errorf("config file must be .yaml, .yml or .toml: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+
+	flat := make(map[string]string)
+	flatten("", doc, flat)
+	return flat, nil
+}
+
+// Keys returns the sorted keys of a flattened config.
+func Keys(flat map[string]string) []string {
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func flatten(prefix string, value any, out map[string]string) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			flatten(join(prefix, key), child, out)
+		}
+	case []any:
+		if allScalars(v) {
+			parts := make([]string, 0, len(v))
+			for _, item := range v {
+				parts = append(parts, fmt.Sprint(item))
+			}
+			out[prefix] = strings.Join(parts, ",")
+			return
+		}
+		for idx, child := range v {
+			flatten(join(prefix, strconv.Itoa(idx)), child, out)
+		}
+	default:
+		out[prefix] = fmt.Sprint(v)
+	}
+}
+
+func allScalars(items []any) bool {
+	for _, item := range items {
+		switch item.(type) {
+		case map[string]any, []any:
+			return false
+		}
+	}
+	return true
+}
+
+func join(prefix string, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,189 @@
+package configfile
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML handles the TOML subset needed for config files: [tables],
+// [[arrays of tables]], dotted table names, key = value pairs with strings,
+// numbers, booleans and single-line arrays of scalars.
+func parseTOML(data []byte) (map[string]any, error) {
+	root := map[string]any{}
+	current := root
+
+	for idx, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		lineNum := idx + 1
+		text := strings.TrimSpace(stripTOMLComment(raw))
+		if text == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[[") {
+			if !strings.HasSuffix(text, "]]") {
+				return nil, fmt.Errorf("line %d: malformed array table header", lineNum)
+			}
+			path := splitTableName(text[2 : len(text)-2])
+			parent, err := tableAt(root, path[:len(path)-1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			last := path[len(path)-1]
+			list, _ := parent[last].([]any)
+			if parent[last] != nil && list == nil {
+				return nil, fmt.Errorf("line %d: %q is not an array of tables", lineNum, last)
+			}
+			current = map[string]any{}
+			parent[last] = append(list, current)
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+			if !strings.HasSuffix(text, "]") {
+				return nil, fmt.Errorf("line %d: malformed table header", lineNum)
+			}
+			table, err := tableAt(root, splitTableName(text[1:len(text)-1]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			current = table
+			continue
+		}
+
+		key, rawValue, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNum)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"`)
+		if key == "" {
+			return nil, fmt.Errorf("line %d: empty key", lineNum)
+		}
+		if _, exists := current[key]; exists {
+			return nil, fmt.Errorf("line %d: duplicate key %q", lineNum, key)
+		}
+
+		value, err := parseTOMLValue(strings.TrimSpace(rawValue))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		current[key] = value
+	}
+
+	return root, nil
+}
+
+func splitTableName(name string) []string {
+	parts := strings.Split(name, ".")
+	for i := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(parts[i]), `"`)
+	}
+	return parts
+}
+
+func tableAt(root map[string]any, path []string) (map[string]any, error) {
+	current := root
+	for _, part := range path {
+		switch next := current[part].(type) {
+		case nil:
+			table := map[string]any{}
+			current[part] = table
+			current = table
+		case map[string]any:
+			current = next
+		case []any:
+			// Dotted names under [[x]] refer to the most recent element.
+			table, ok := next[len(next)-1].(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%q is not a table", part)
+			}
+			current = table
+		default:
+			return nil, fmt.Errorf("%q is not a table", part)
+		}
+	}
+	return current, nil
+}
+
+func parseTOMLValue(raw string) (any, error) {
+	switch {
+	case raw == "":
+		return nil, fmt.Errorf("missing value")
+	case strings.HasPrefix(raw, `"`):
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", raw)
+		}
+		return value, nil
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return nil, fmt.Errorf("invalid literal string %s", raw)
+		}
+		return raw[1 : len(raw)-1], nil
+	case strings.HasPrefix(raw, "["):
+		if !strings.HasSuffix(raw, "]") {
+			return nil, fmt.Errorf("arrays must be on a single line")
+		}
+		items := []any{}
+		inner := strings.TrimSpace(raw[1 : len(raw)-1])
+		if inner == "" {
+			return items, nil
+		}
+		for _, part := range splitArray(inner) {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			item, err := parseTOMLValue(part)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case raw == "true" || raw == "false":
+		return raw, nil
+	default:
+		if _, err := strconv.ParseFloat(strings.ReplaceAll(raw, "_", ""), 64); err != nil {
+			return nil, fmt.Errorf("unsupported value %s (quote strings)", raw)
+		}
+		return strings.ReplaceAll(raw, "_", ""), nil
+	}
+}
+
+func splitArray(inner string) []string {
+	var parts []string
+	var quote rune
+	start := 0
+	for i, r := range inner {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			parts = append(parts, inner[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, inner[start:])
+}
+
+func stripTOMLComment(s string) string {
+	var quote rune
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return s[:i]
+		}
+	}
+	return s
+}
@@ -0,0 +1,130 @@
+package geo
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// airportsCSV lists major passenger airports in the OurAirports column
+// layout, so the full airports.csv from OurAirports can replace it.
+//
+//go:embed airports.csv
+var airportsCSV []byte
+
+type Airport struct {
+	IATA    string
+	Name    string
+	City    string
+	Country string
+	Lon     float64
+	Lat     float64
+}
+
+// Airports indexes airports by IATA code.
+type Airports struct {
+	byCode map[string]Airport
+}
+
+func EmbeddedAirports() (*Airports, error) {
+	return ParseAirports(airportsCSV)
+}
+
+func LoadAirportsFile(path string) (*Airports, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read airports file: %w", err)
+	}
+	airports, err := ParseAirports(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse airports file %s: %w", path, err)
+	}
+	return airports, nil
+}
+
+// ParseAirports reads a CSV file with a header row naming at least the
+// iata_code, name, latitude_deg and longitude_deg columns; municipality and
+// iso_country are optional. Rows without an IATA code and closed airports
+// (type "closed") are skipped, and the first row wins for repeated codes.
+func ParseAirports(data []byte) (*Airports, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"iata_code", "name", "latitude_deg", "longitude_deg"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing %s column", name)
+		}
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	a := &Airports{byCode: make(map[string]Airport)}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		code := strings.ToUpper(field(record, "iata_code"))
+		if len(code) != 3 || field(record, "type") == "closed" {
+			continue
+		}
+		if _, ok := a.byCode[code]; ok {
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+		airport := Airport{
+			IATA:    code,
+			Name:    field(record, "name"),
+			City:    field(record, "municipality"),
+			Country: strings.ToUpper(field(record, "iso_country")),
+		}
+		lat, lon := field(record, "latitude_deg"), field(record, "longitude_deg")
+		if airport.Lat, err = strconv.ParseFloat(lat, 64); err != nil || airport.Lat < -90 || airport.Lat > 90 {
+			return nil, fmt.Errorf("line %d: invalid latitude %q", line, lat)
+		}
+		if airport.Lon, err = strconv.ParseFloat(lon, 64); err != nil || airport.Lon < -180 || airport.Lon > 180 {
+			return nil, fmt.Errorf("line %d: invalid longitude %q", line, lon)
+		}
+		a.byCode[code] = airport
+	}
+
+	if len(a.byCode) == 0 {
+		return nil, fmt.Errorf("no airports with an IATA code found")
+	}
+
+	return a, nil
+}
+
+func (a *Airports) Len() int {
+	return len(a.byCode)
+}
+
+// Lookup finds an airport by IATA code, ignoring case.
+func (a *Airports) Lookup(code string) (Airport, bool) {
+	airport, ok := a.byCode[strings.ToUpper(strings.TrimSpace(code))]
+	return airport, ok
+}
@@ -0,0 +1,254 @@
+package geo
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// citiesTSV is the gazetteer built into the binary: capitals and major
+// cities with a few common alternate spellings in the repository, which
+// the Docker build replaces with a pinned GeoNames extract.
+//
+//go:embed cities.tsv
+var citiesTSV []byte
+
+type City struct {
+	Name       string
+	Country    string
+	Lon        float64
+	Lat        float64
+	Population int64
+}
+
+// Gazetteer looks up cities by folded name: lower case, without diacritics
+// and with runs of spaces collapsed.
+type Gazetteer struct {
+	cities []City
+	byName map[string][]int
+	names  []string
+}
+
+func EmbeddedGazetteer() (*Gazetteer, error) {
+	return ParseGazetteer(citiesTSV)
+}
+
+func LoadGazetteerFile(path string) (*Gazetteer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read cities file: %w", err)
+	}
+	g, err := ParseGazetteer(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse cities file %s: %w", path, err)
+	}
+	return g, nil
+}
+
+// ParseGazetteer reads tab-separated city rows in either the embedded layout
+// (name, alternate names, country, lat, lon, population) or the GeoNames
+// cities dump layout (cities15000.txt and friends). GeoNames alternate names
+// are not indexed, only the name and its ASCII form, to keep memory small.
+// Empty lines and lines starting with # are skipped.
+func ParseGazetteer(data []byte) (*Gazetteer, error) {
+	g := &Gazetteer{byName: make(map[string][]int)}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		city, names, err := parseCityRow(strings.Split(text, "\t"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		g.add(city, names)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(g.cities) == 0 {
+		return nil, fmt.Errorf("no cities found")
+	}
+
+	g.names = make([]string, 0, len(g.byName))
+	for name := range g.byName {
+		g.names = append(g.names, name)
+	}
+	sort.Strings(g.names)
+	return g, nil
+}
+
+func parseCityRow(fields []string) (City, []string, error) {
+	var name, country, lat, lon, population string
+	var names []string
+	switch {
+	case len(fields) >= 15:
+		name, lat, lon, country, population = fields[1], fields[4], fields[5], fields[8], fields[14]
+		names = []string{fields[1], fields[2]}
+	case len(fields) == 6:
+		name, country, lat, lon, population = fields[0], fields[2], fields[3], fields[4], fields[5]
+		names = append([]string{fields[0]}, strings.Split(fields[1], ",")...)
+	default:
+		return City{}, nil, fmt.Errorf("expected 6 or at least 15 tab-separated fields, got %d", len(fields))
+	}
+
+	city := City{Name: strings.TrimSpace(name), Country: strings.ToUpper(strings.TrimSpace(country))}
+	if city.Name == "" {
+		return City{}, nil, fmt.Errorf("empty city name")
+	}
+
+	var err error
+	if city.Lat, err = strconv.ParseFloat(strings.TrimSpace(lat), 64); err != nil || city.Lat < -90 || city.Lat > 90 {
+		return City{}, nil, fmt.Errorf("invalid latitude %q", lat)
+	}
+	if city.Lon, err = strconv.ParseFloat(strings.TrimSpace(lon), 64); err != nil || city.Lon < -180 || city.Lon > 180 {
+		return City{}, nil, fmt.Errorf("invalid longitude %q", lon)
+	}
+	if population = strings.TrimSpace(population); population != "" {
+		if city.Population, err = strconv.ParseInt(population, 10, 64); err != nil {
+			return City{}, nil, fmt.Errorf("invalid population %q", population)
+		}
+	}
+
+	return city, names, nil
+}
+
+func (g *Gazetteer) add(city City, names []string) {
+	idx := len(g.cities)
+	g.cities = append(g.cities, city)
+	for _, name := range names {
+		key := FoldName(name)
+		if key == "" {
+			continue
+		}
+		if list := g.byName[key]; len(list) > 0 && list[len(list)-1] == idx {
+			continue
+		}
+		g.byName[key] = append(g.byName[key], idx)
+	}
+}
+
+func (g *Gazetteer) Len() int {
+	return len(g.cities)
+}
+
+// Search returns up to limit cities whose name matches query, most populous
+// first. Exact name matches win over prefix matches. A trailing ", CC"
+// restricts results to the country with that ISO alpha-2 code.
+func (g *Gazetteer) Search(query string, limit int) []City {
+	country := ""
+	if i := strings.LastIndex(query, ","); i >= 0 {
+		if code := strings.TrimSpace(query[i+1:]); len(code) == 2 {
+			query, country = query[:i], strings.ToUpper(code)
+		}
+	}
+
+	key := FoldName(query)
+	if key == "" || limit <= 0 {
+		return nil
+	}
+
+	matches := g.filter(g.byName[key], country)
+	if len(matches) == 0 {
+		start := sort.SearchStrings(g.names, key)
+		var prefixed []int
+		for _, name := range g.names[start:] {
+			if !strings.HasPrefix(name, key) {
+				break
+			}
+			prefixed = append(prefixed, g.byName[name]...)
+		}
+		matches = g.filter(prefixed, country)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return g.cities[matches[i]].Population > g.cities[matches[j]].Population
+	})
+
+	results := make([]City, 0, min(limit, len(matches)))
+	for _, idx := range matches[:min(limit, len(matches))] {
+		results = append(results, g.cities[idx])
+	}
+	return results
+}
+
+// filter drops duplicate indexes and, when country is set, cities elsewhere.
+func (g *Gazetteer) filter(indexes []int, country string) []int {
+	seen := make(map[int]bool, len(indexes))
+	var out []int
+	for _, idx := range indexes {
+		if seen[idx] || (country != "" && g.cities[idx].Country != country) {
+			continue
+		}
+		seen[idx] = true
+		out = append(out, idx)
+	}
+	return out
+}
+
+var foldReplacer = strings.NewReplacer(
+	"ß", "ss", "æ", "ae", "œ", "oe", "ø", "o", "đ", "d", "ł", "l", "þ", "th", "ı", "i",
+	"'", "", "’", "", ".", "", "-", " ",
+)
+
+// FoldName normalizes a place name for matching: "  São  Paulo" and
+// "sao paulo" fold to the same key.
+func FoldName(name string) string {
+	name = foldReplacer.Replace(strings.ToLower(name))
+	name = strings.Map(func(r rune) rune {
+		if base, ok := latinBase[r]; ok {
+			return base
+		}
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return r
+	}, name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// latinBase maps precomposed Latin letters to their unaccented base letter.
+var latinBase = buildLatinBase(map[rune]string{
+	'a': "àáâãäåāăą",
+	'c': "çćĉċč",
+	'd': "ď",
+	'e': "èéêëēĕėęě",
+	'g': "ĝğġģ",
+	'h': "ĥħ",
+	'i': "ìíîïĩīĭįİ",
+	'j': "ĵ",
+	'k': "ķ",
+	'l': "ĺļľŀ",
+	'n': "ñńņňŉ",
+	'o': "òóôõöōŏő",
+	'r': "ŕŗř",
+	's': "śŝşšș",
+	't': "ţťŧț",
+	'u': "ùúûüũūŭůűų",
+	'w': "ŵ",
+	'y': "ýÿŷ",
+	'z': "źżž",
+})
+
+func buildLatinBase(groups map[rune]string) map[rune]rune {
+	table := make(map[rune]rune)
+	for base, letters := range groups {
+		for _, r := range letters {
+			table[r] = base
+		}
+	}
+	return table
+}
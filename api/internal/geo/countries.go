@@ -0,0 +1,159 @@
+package geo
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// countriesGeoJSON is a coarse, hand-simplified admin-0 dataset. Coastlines
+// are deliberately loose because only land cells are ever tested against it;
+// land borders are shared between neighbours so they line up exactly.
+//
+//go:embed countries.geojson
+var countriesGeoJSON []byte
+
+type Country struct {
+	Code      string
+	Name      string
+	Continent string
+	Polygons  []Polygon
+	bounds    Bounds
+}
+
+// Countries indexes country polygons by ISO 3166-1 alpha-2 code.
+type Countries struct {
+	list   []Country
+	byCode map[string]int
+}
+
+func EmbeddedCountries() (*Countries, error) {
+	return ParseCountries(countriesGeoJSON)
+}
+
+func LoadCountriesFile(path string) (*Countries, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read countries file: %w", err)
+	}
+	countries, err := ParseCountries(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse countries file %s: %w", path, err)
+	}
+	return countries, nil
+}
+
+// ParseCountries builds a country index from a GeoJSON feature collection.
+// The code is read from iso_a2 (or ISO_A2, falling back to ISO_A2_EH for
+// Natural Earth's "-99" entries), the name from name, NAME or ADMIN and the
+// continent, when present, from continent or CONTINENT.
+// Features without polygons or a usable code are skipped.
+func ParseCountries(data []byte) (*Countries, error) {
+	features, err := ParseFeatures(data)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Countries{byCode: make(map[string]int)}
+	for _, feature := range features {
+		code := strings.ToUpper(propertyString(feature.Properties, "iso_a2", "ISO_A2", "ISO_A2_EH"))
+		if len(code) != 2 || len(feature.Polygons) == 0 {
+			continue
+		}
+
+		if idx, ok := c.byCode[code]; ok {
+			existing := &c.list[idx]
+			existing.Polygons = append(existing.Polygons, feature.Polygons...)
+			existing.bounds = polygonBounds(existing.Polygons)
+			continue
+		}
+
+		name := propertyString(feature.Properties, "name", "NAME", "ADMIN")
+		if name == "" {
+			name = code
+		}
+		c.byCode[code] = len(c.list)
+		c.list = append(c.list, Country{
+			Code:      code,
+			Name:      name,
+			Continent: propertyString(feature.Properties, "continent", "CONTINENT"),
+			Polygons:  feature.Polygons,
+			bounds:    polygonBounds(feature.Polygons),
+		})
+	}
+
+	if len(c.list) == 0 {
+		return nil, fmt.Errorf("no country polygons with an ISO alpha-2 code found")
+	}
+
+	return c, nil
+}
+
+func propertyString(props map[string]any, keys ...string) string {
+	for _, key := range keys {
+		value, ok := props[key].(string)
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if value != "" && value != "-99" {
+			return value
+		}
+	}
+	return ""
+}
+
+func polygonBounds(polygons []Polygon) Bounds {
+	b := emptyBounds()
+	for _, poly := range polygons {
+		if len(poly) == 0 || len(poly[0]) == 0 {
+			continue
+		}
+		pb := poly.Bounds()
+		b.extend(Point{pb.MinLon, pb.MinLat})
+		b.extend(Point{pb.MaxLon, pb.MaxLat})
+	}
+	return b
+}
+
+func (c *Countries) Len() int {
+	return len(c.list)
+}
+
+func (c *Countries) Country(idx int) Country {
+	return c.list[idx]
+}
+
+// Lookup returns the index of the country with the given ISO code.
+func (c *Countries) Lookup(code string) (int, bool) {
+	idx, ok := c.byCode[strings.ToUpper(strings.TrimSpace(code))]
+	return idx, ok
+}
+
+// Codes returns all ISO codes in sorted order.
+func (c *Countries) Codes() []string {
+	codes := make([]string, 0, len(c.list))
+	for _, country := range c.list {
+		codes = append(codes, country.Code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Locate returns the index of the first country containing lon/lat, or -1.
+func (c *Countries) Locate(lon float64, lat float64) int {
+	for i := range c.list {
+		country := &c.list[i]
+		if !country.bounds.Contains(lon, lat) {
+			continue
+		}
+		for _, poly := range country.Polygons {
+			if poly.Contains(lon, lat) {
+				return i
+			}
+		}
+	}
+	return -1
+}
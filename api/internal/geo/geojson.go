@@ -0,0 +1,200 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Point is a lon/lat pair in degrees.
+type Point [2]float64
+
+func (p Point) Lon() float64 { return p[0] }
+func (p Point) Lat() float64 { return p[1] }
+
+// Polygon is an outer ring followed by optional holes.
+type Polygon [][]Point
+
+// Feature is a GeoJSON feature reduced to the geometry kinds the renderer
+// understands. Geometry collections are flattened into the same feature.
+type Feature struct {
+	Properties map[string]any
+	Points     []Point
+	Lines      [][]Point
+	Polygons   []Polygon
+}
+
+type rawGeoJSON struct {
+	Type        string          `json:"type"`
+	Features    []rawGeoJSON    `json:"features"`
+	Geometry    *rawGeoJSON     `json:"geometry"`
+	Geometries  []rawGeoJSON    `json:"geometries"`
+	Properties  map[string]any  `json:"properties"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// ParseFeatures decodes a FeatureCollection, a single Feature or a bare
+// geometry into a flat list of features.
+func ParseFeatures(data []byte) ([]Feature, error) {
+	var doc rawGeoJSON
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+
+	switch doc.Type {
+	case "FeatureCollection":
+		features := make([]Feature, 0, len(doc.Features))
+		for i, raw := range doc.Features {
+			feature, err := parseFeature(raw)
+			if err != nil {
+				return nil, fmt.Errorf("feature %d: %w", i, err)
+			}
+			features = append(features, feature)
+		}
+		return features, nil
+	case "Feature":
+		feature, err := parseFeature(doc)
+		if err != nil {
+			return nil, err
+		}
+		return []Feature{feature}, nil
+	default:
+		var feature Feature
+		if err := addGeometry(&feature, doc); err != nil {
+			return nil, err
+		}
+		return []Feature{feature}, nil
+	}
+}
+
+func parseFeature(raw rawGeoJSON) (Feature, error) {
+	if raw.Type != "Feature" {
+		return Feature{}, fmt.Errorf("expected type Feature, got %q", raw.Type)
+	}
+
+	feature := Feature{Properties: raw.Properties}
+	if raw.Geometry == nil {
+		return feature, nil
+	}
+	if err := addGeometry(&feature, *raw.Geometry); err != nil {
+		return Feature{}, err
+	}
+	return feature, nil
+}
+
+func addGeometry(feature *Feature, geom rawGeoJSON) error {
+	switch geom.Type {
+	case "Point":
+		var p Point
+		if err := decodeCoordinates(geom, &p); err != nil {
+			return err
+		}
+		feature.Points = append(feature.Points, p)
+	case "MultiPoint":
+		var ps []Point
+		if err := decodeCoordinates(geom, &ps); err != nil {
+			return err
+		}
+		feature.Points = append(feature.Points, ps...)
+	case "LineString":
+		var line []Point
+		if err := decodeCoordinates(geom, &line); err != nil {
+			return err
+		}
+		feature.Lines = append(feature.Lines, line)
+	case "MultiLineString":
+		var lines [][]Point
+		if err := decodeCoordinates(geom, &lines); err != nil {
+			return err
+		}
+		feature.Lines = append(feature.Lines, lines...)
+	case "Polygon":
+		var poly Polygon
+		if err := decodeCoordinates(geom, &poly); err != nil {
+			return err
+		}
+		feature.Polygons = append(feature.Polygons, poly)
+	case "MultiPolygon":
+		var polys []Polygon
+		if err := decodeCoordinates(geom, &polys); err != nil {
+			return err
+		}
+		feature.Polygons = append(feature.Polygons, polys...)
+	case "GeometryCollection":
+		for _, child := range geom.Geometries {
+			if err := addGeometry(feature, child); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported geometry type %q", geom.Type)
+	}
+
+	return nil
+}
+
+func decodeCoordinates(geom rawGeoJSON, dst any) error {
+	if err := json.Unmarshal(geom.Coordinates, dst); err != nil {
+		return fmt.Errorf("invalid %s coordinates: %w", geom.Type, err)
+	}
+	return nil
+}
+
+// Contains reports whether lon/lat lies inside the outer ring and outside
+// every hole, using the even-odd rule.
+func (p Polygon) Contains(lon float64, lat float64) bool {
+	if len(p) == 0 || !ringContains(p[0], lon, lat) {
+		return false
+	}
+	for _, hole := range p[1:] {
+		if ringContains(hole, lon, lat) {
+			return false
+		}
+	}
+	return true
+}
+
+func ringContains(ring []Point, lon float64, lat float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.Lat() > lat) != (b.Lat() > lat) {
+			x := a.Lon() + (lat-a.Lat())*(b.Lon()-a.Lon())/(b.Lat()-a.Lat())
+			if lon < x {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+// Bounds is a lon/lat bounding box.
+type Bounds struct {
+	MinLon, MinLat, MaxLon, MaxLat float64
+}
+
+func emptyBounds() Bounds {
+	return Bounds{MinLon: math.Inf(1), MinLat: math.Inf(1), MaxLon: math.Inf(-1), MaxLat: math.Inf(-1)}
+}
+
+func (b *Bounds) extend(p Point) {
+	b.MinLon = math.Min(b.MinLon, p.Lon())
+	b.MinLat = math.Min(b.MinLat, p.Lat())
+	b.MaxLon = math.Max(b.MaxLon, p.Lon())
+	b.MaxLat = math.Max(b.MaxLat, p.Lat())
+}
+
+// Bounds returns the bounding box of the outer ring.
+func (p Polygon) Bounds() Bounds {
+	b := emptyBounds()
+	if len(p) > 0 {
+		for _, pt := range p[0] {
+			b.extend(pt)
+		}
+	}
+	return b
+}
+
+func (b Bounds) Contains(lon float64, lat float64) bool {
+	return lon >= b.MinLon && lon <= b.MaxLon && lat >= b.MinLat && lat <= b.MaxLat
+}
@@ -0,0 +1,62 @@
+package geo
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+type gpxPoint struct {
+	Lat float64 `xml:"lat,attr"`
+	Lon float64 `xml:"lon,attr"`
+}
+
+type gpxDocument struct {
+	XMLName   xml.Name   `xml:"gpx"`
+	Waypoints []gpxPoint `xml:"wpt"`
+	Routes    []struct {
+		Points []gpxPoint `xml:"rtept"`
+	} `xml:"rte"`
+	Tracks []struct {
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// ParseGPX reads a GPX 1.0/1.1 file into a single feature: every track
+// segment and route becomes a line and waypoints become points.
+func ParseGPX(data []byte) (Feature, error) {
+	var doc gpxDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return Feature{}, fmt.Errorf("invalid GPX: %w", err)
+	}
+
+	var feature Feature
+	for _, trk := range doc.Tracks {
+		for _, seg := range trk.Segments {
+			if line := gpxLine(seg.Points); len(line) > 0 {
+				feature.Lines = append(feature.Lines, line)
+			}
+		}
+	}
+	for _, rte := range doc.Routes {
+		if line := gpxLine(rte.Points); len(line) > 0 {
+			feature.Lines = append(feature.Lines, line)
+		}
+	}
+	feature.Points = gpxLine(doc.Waypoints)
+
+	if len(feature.Lines) == 0 && len(feature.Points) == 0 {
+		return Feature{}, fmt.Errorf("GPX file has no track, route or waypoint points")
+	}
+
+	return feature, nil
+}
+
+func gpxLine(points []gpxPoint) []Point {
+	line := make([]Point, 0, len(points))
+	for _, p := range points {
+		line = append(line, Point{p.Lon, p.Lat})
+	}
+	return line
+}
@@ -0,0 +1,68 @@
+package geo
+
+import "math"
+
+// EarthRadiusKM is the mean Earth radius used for great-circle distances.
+const EarthRadiusKM = 6371.0088
+
+// Distance is the great-circle distance between a and b in kilometers.
+func Distance(a Point, b Point) float64 {
+	lat1, lat2 := a.Lat()*math.Pi/180, b.Lat()*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon() - a.Lon()) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EarthRadiusKM * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// GreatCircle samples the shortest path from a to b at most step degrees of
+// arc apart, including both ends. Longitudes stay within ±180, so callers
+// drawing the path must split it where it crosses the antimeridian. The
+// path between antipodal points is undefined; they are joined directly.
+func GreatCircle(a Point, b Point, step float64) []Point {
+	va, vb := unitVector(a), unitVector(b)
+	dot := va[0]*vb[0] + va[1]*vb[1] + va[2]*vb[2]
+	angle := math.Acos(math.Max(-1, math.Min(1, dot)))
+	sinAngle := math.Sin(angle)
+	if angle == 0 || sinAngle < 1e-9 || step <= 0 {
+		return []Point{a, b}
+	}
+
+	segments := int(math.Ceil(angle * 180 / math.Pi / step))
+	points := make([]Point, 0, segments+1)
+	points = append(points, a)
+	for i := 1; i < segments; i++ {
+		f := float64(i) / float64(segments)
+		wa := math.Sin((1-f)*angle) / sinAngle
+		wb := math.Sin(f*angle) / sinAngle
+		x := wa*va[0] + wb*vb[0]
+		y := wa*va[1] + wb*vb[1]
+		z := wa*va[2] + wb*vb[2]
+		points = append(points, Point{math.Atan2(y, x) * 180 / math.Pi, math.Atan2(z, math.Hypot(x, y)) * 180 / math.Pi})
+	}
+	return append(points, b)
+}
+
+func unitVector(p Point) [3]float64 {
+	lon, lat := p.Lon()*math.Pi/180, p.Lat()*math.Pi/180
+	return [3]float64{math.Cos(lat) * math.Cos(lon), math.Cos(lat) * math.Sin(lon), math.Sin(lat)}
+}
+
+// InitialBearing is the compass direction in degrees, from 0 up to 360,
+// in which the great circle from a to b leaves a.
+func InitialBearing(a Point, b Point) float64 {
+	lat1, lat2 := a.Lat()*math.Pi/180, b.Lat()*math.Pi/180
+	dLon := (b.Lon() - a.Lon()) * math.Pi / 180
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+// Midpoint is the point halfway along the great circle from a to b.
+func Midpoint(a Point, b Point) Point {
+	va, vb := unitVector(a), unitVector(b)
+	x, y, z := va[0]+vb[0], va[1]+vb[1], va[2]+vb[2]
+	if math.Abs(x)+math.Abs(y)+math.Abs(z) < 1e-12 {
+		return a
+	}
+	return Point{math.Atan2(y, x) * 180 / math.Pi, math.Atan2(z, math.Hypot(x, y)) * 180 / math.Pi}
+}
@@ -0,0 +1,105 @@
+package geo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const (
+	shapeNull     = 0
+	shapePolygon  = 5
+	shapePolygonZ = 15
+	shapePolygonM = 25
+)
+
+// ParseShapefile reads the polygons of an ESRI .shp file in lon/lat
+// degrees. Rings are grouped by winding: clockwise rings start a polygon and
+// counter-clockwise rings are holes in the polygon before them.
+func ParseShapefile(data []byte) ([]Polygon, error) {
+	if len(data) < 100 || binary.BigEndian.Uint32(data[0:4]) != 9994 {
+		return nil, fmt.Errorf("not a shapefile")
+	}
+	switch shapeType := binary.LittleEndian.Uint32(data[32:36]); shapeType {
+	case shapePolygon, shapePolygonZ, shapePolygonM:
+	default:
+		return nil, fmt.Errorf("shapefile must contain polygons, got shape type %d", shapeType)
+	}
+
+	var polygons []Polygon
+	for offset := 100; offset+8 <= len(data); {
+		number := binary.BigEndian.Uint32(data[offset : offset+4])
+		length := int(binary.BigEndian.Uint32(data[offset+4:offset+8])) * 2
+		start := offset + 8
+		offset = start + length
+		if length < 4 || offset > len(data) {
+			return nil, fmt.Errorf("shapefile record %d is truncated", number)
+		}
+
+		record, err := parseShapeRecord(data[start:offset])
+		if err != nil {
+			return nil, fmt.Errorf("shapefile record %d: %w", number, err)
+		}
+		polygons = append(polygons, record...)
+	}
+	return polygons, nil
+}
+
+func parseShapeRecord(content []byte) ([]Polygon, error) {
+	shapeType := binary.LittleEndian.Uint32(content[0:4])
+	if shapeType == shapeNull {
+		return nil, nil
+	}
+	if shapeType != shapePolygon && shapeType != shapePolygonZ && shapeType != shapePolygonM {
+		return nil, fmt.Errorf("unexpected shape type %d", shapeType)
+	}
+	if len(content) < 44 {
+		return nil, fmt.Errorf("polygon header is truncated")
+	}
+
+	numParts := int(binary.LittleEndian.Uint32(content[36:40]))
+	numPoints := int(binary.LittleEndian.Uint32(content[40:44]))
+	pointsStart := 44 + numParts*4
+	if numParts < 0 || numPoints < 0 || pointsStart+numPoints*16 > len(content) {
+		return nil, fmt.Errorf("polygon has %d parts and %d points but only %d bytes", numParts, numPoints, len(content))
+	}
+
+	var polygons []Polygon
+	for part := 0; part < numParts; part++ {
+		first := int(binary.LittleEndian.Uint32(content[44+part*4:]))
+		last := numPoints
+		if part+1 < numParts {
+			last = int(binary.LittleEndian.Uint32(content[44+(part+1)*4:]))
+		}
+		if first < 0 || first > last || last > numPoints {
+			return nil, fmt.Errorf("part %d has invalid point range %d..%d", part, first, last)
+		}
+
+		ring := make([]Point, 0, last-first)
+		for i := first; i < last; i++ {
+			at := pointsStart + i*16
+			lon := math.Float64frombits(binary.LittleEndian.Uint64(content[at:]))
+			lat := math.Float64frombits(binary.LittleEndian.Uint64(content[at+8:]))
+			ring = append(ring, Point{lon, lat})
+		}
+		if len(ring) < 3 {
+			continue
+		}
+
+		if ringArea(ring) < 0 || len(polygons) == 0 {
+			polygons = append(polygons, Polygon{ring})
+		} else {
+			polygons[len(polygons)-1] = append(polygons[len(polygons)-1], ring)
+		}
+	}
+	return polygons, nil
+}
+
+// ringArea is the shoelace sum, negative for clockwise rings.
+func ringArea(ring []Point) float64 {
+	area := 0.0
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		area += ring[j].Lon()*ring[i].Lat() - ring[i].Lon()*ring[j].Lat()
+	}
+	return area / 2
+}
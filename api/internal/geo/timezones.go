@@ -0,0 +1,125 @@
+package geo
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	// Zone lookups should not depend on the host having zoneinfo installed.
+	_ "time/tzdata"
+)
+
+// timezonesGeoJSON assigns an IANA zone to each embedded country polygon,
+// cutting countries that span several zones along straight lines. It covers
+// land only and is meant for an overview; a timezone-boundary-builder
+// release can replace it.
+//
+//go:embed timezones.geojson
+var timezonesGeoJSON []byte
+
+type Timezone struct {
+	ID       string
+	Location *time.Location
+	Polygons []Polygon
+	bounds   Bounds
+}
+
+type Timezones struct {
+	list []Timezone
+}
+
+func EmbeddedTimezones() (*Timezones, error) {
+	return ParseTimezones(timezonesGeoJSON)
+}
+
+func LoadTimezonesFile(path string) (*Timezones, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read timezones file: %w", err)
+	}
+	zones, err := ParseTimezones(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse timezones file %s: %w", path, err)
+	}
+	return zones, nil
+}
+
+// ParseTimezones builds a zone index from a GeoJSON feature collection with
+// the IANA name in tzid (or TZID). Features sharing a name are merged, and
+// names the bundled tz database does not know are an error.
+func ParseTimezones(data []byte) (*Timezones, error) {
+	features, err := ParseFeatures(data)
+	if err != nil {
+		return nil, err
+	}
+
+	z := &Timezones{}
+	byID := make(map[string]int)
+	for _, feature := range features {
+		id := propertyString(feature.Properties, "tzid", "TZID")
+		if id == "" || len(feature.Polygons) == 0 {
+			continue
+		}
+
+		if idx, ok := byID[id]; ok {
+			existing := &z.list[idx]
+			existing.Polygons = append(existing.Polygons, feature.Polygons...)
+			existing.bounds = polygonBounds(existing.Polygons)
+			continue
+		}
+
+		loc, err := time.LoadLocation(id)
+		if err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", id)
+		}
+		byID[id] = len(z.list)
+		z.list = append(z.list, Timezone{
+			ID:       id,
+			Location: loc,
+			Polygons: feature.Polygons,
+			bounds:   polygonBounds(feature.Polygons),
+		})
+	}
+
+	if len(z.list) == 0 {
+		return nil, fmt.Errorf("no time zone polygons with a tzid found")
+	}
+
+	return z, nil
+}
+
+func (z *Timezones) Len() int {
+	return len(z.list)
+}
+
+func (z *Timezones) Zone(idx int) Timezone {
+	return z.list[idx]
+}
+
+// Locate returns the index of the first zone containing lon/lat, or -1.
+func (z *Timezones) Locate(lon float64, lat float64) int {
+	for i := range z.list {
+		zone := &z.list[i]
+		if !zone.bounds.Contains(lon, lat) {
+			continue
+		}
+		for _, poly := range zone.Polygons {
+			if poly.Contains(lon, lat) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// NauticalZone is the fixed-offset zone for open sea at lon: one hour per
+// 15 degrees, centered on multiples of 15.
+func NauticalZone(lon float64) *time.Location {
+	hours := int(math.Round(lon / 15))
+	if hours == 0 {
+		return time.UTC
+	}
+	return time.FixedZone(fmt.Sprintf("UTC%+d", hours), hours*3600)
+}
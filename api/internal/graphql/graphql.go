@@ -0,0 +1,588 @@
+// Package graphql executes GraphQL queries against a schema derived from Go
+// types: each root field has a resolver, and the fields of the objects it
+// returns are those encoding/json would write. Mutations, subscriptions
+// and introspection are not supported; SDL describes the schema instead.
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const maxRequestBytes = 1 << 20
+
+// Field is a root field of the Query type.
+type Field struct {
+	Name        string
+	Description string
+	Args        []Arg
+	// Type is the Go type Resolve returns.
+	Type    reflect.Type
+	Resolve func(ctx context.Context, args map[string]any) (any, error)
+}
+
+// Arg is an argument of a root field. Type is String, Int, Float, Boolean
+// or JSON, any value as plain Go values, with a trailing ! if required.
+// Absent optional arguments are left out of the args map.
+type Arg struct {
+	Name string
+	Type string
+}
+
+type Schema struct {
+	Query []Field
+
+	once  sync.Once
+	types types
+	roots map[string]*typeInfo
+}
+
+type Error struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+type Response struct {
+	Data   *object `json:"data,omitempty"`
+	Errors []Error `json:"errors,omitempty"`
+}
+
+func (s *Schema) init() {
+	s.once.Do(func() {
+		s.types = types{byType: map[reflect.Type]*typeInfo{}}
+		s.roots = map[string]*typeInfo{}
+		for _, field := range s.Query {
+			s.roots[field.Name] = s.types.of(field.Type, exported(field.Name))
+		}
+	})
+}
+
+func requestError(format string, args ...any) Response {
+	return Response{Errors: []Error{{Message: fmt.Sprintf(format, args...)}}}
+}
+
+// Execute runs the query operation named operationName, or the only one in
+// query.
+func (s *Schema) Execute(ctx context.Context, query string, operationName string, variables map[string]any) Response {
+	s.init()
+	doc, err := parse(query)
+	if err != nil {
+		return requestError("%s", err)
+	}
+
+	var op *operation
+	for _, candidate := range doc.operations {
+		if candidate.name == operationName || operationName == "" && len(doc.operations) == 1 {
+			op = candidate
+		}
+	}
+	if op == nil {
+		if operationName == "" {
+			return requestError("operationName is required for documents with several operations")
+		}
+		return requestError("unknown operation %q", operationName)
+	}
+	if op.kind != "query" {
+		return requestError("only queries are supported, not %s", op.kind)
+	}
+
+	vars := map[string]any{}
+	for _, def := range op.variables {
+		value, ok := variables[def.name]
+		if !ok && def.hasDefault {
+			value, ok = def.defaultVal, true
+		}
+		if !ok || value == nil {
+			if def.nonNull {
+				return requestError("variable $%s is required", def.name)
+			}
+			if !ok {
+				continue
+			}
+		}
+		vars[def.name] = value
+	}
+
+	e := &executor{schema: s, doc: doc, vars: vars, defined: map[string]bool{}}
+	for _, def := range op.variables {
+		e.defined[def.name] = true
+	}
+	if err := e.validate(nil, op.selections, map[string]bool{}); err != nil {
+		return requestError("%s", err)
+	}
+
+	data, err := e.executeRoot(ctx, op.selections)
+	if err != nil {
+		return requestError("%s", err)
+	}
+	return Response{Data: data, Errors: e.errors}
+}
+
+type executor struct {
+	schema  *Schema
+	doc     *document
+	vars    map[string]any
+	defined map[string]bool
+	errors  []Error
+}
+
+// validate checks selections against the object type parent, or Query when
+// parent is nil, before anything runs.
+func (e *executor) validate(parent *typeInfo, selections []*selection, spreads map[string]bool) error {
+	typeName := "Query"
+	if parent != nil {
+		typeName = parent.name
+	}
+	for _, sel := range selections {
+		switch {
+		case sel.spread != "":
+			frag, ok := e.doc.fragments[sel.spread]
+			if !ok {
+				return fmt.Errorf("unknown fragment %q", sel.spread)
+			}
+			if spreads[sel.spread] {
+				return fmt.Errorf("fragment %q spreads itself", sel.spread)
+			}
+			spreads[sel.spread] = true
+			err := e.validate(parent, frag.selections, spreads)
+			delete(spreads, sel.spread)
+			if err != nil {
+				return err
+			}
+			continue
+		case sel.inline:
+			if err := e.validate(parent, sel.selections, spreads); err != nil {
+				return err
+			}
+			continue
+		case sel.name == "__typename":
+			if len(sel.selections) > 0 || len(sel.arguments) > 0 {
+				return fmt.Errorf("field \"__typename\" takes no arguments or selections")
+			}
+			continue
+		}
+
+		var fieldType *typeInfo
+		if parent == nil {
+			root, ok := e.schema.roots[sel.name]
+			if !ok {
+				return fmt.Errorf("cannot query field %q on type \"Query\"", sel.name)
+			}
+			fieldType = root
+			if err := e.validateArguments(sel); err != nil {
+				return err
+			}
+		} else {
+			field, ok := parent.field(sel.name)
+			if !ok {
+				return fmt.Errorf("cannot query field %q on type %q", sel.name, typeName)
+			}
+			fieldType = field.typ
+			if len(sel.arguments) > 0 {
+				return fmt.Errorf("field %q on type %q takes no arguments", sel.name, typeName)
+			}
+		}
+
+		for fieldType.elem != nil {
+			fieldType = fieldType.elem
+		}
+		if fieldType.scalar {
+			if len(sel.selections) > 0 {
+				return fmt.Errorf("field %q of type %s must not have a selection", sel.name, fieldType.name)
+			}
+			continue
+		}
+		if len(sel.selections) == 0 {
+			return fmt.Errorf("field %q of type %s must have a selection of subfields", sel.name, fieldType.name)
+		}
+		if err := e.validate(fieldType, sel.selections, spreads); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *executor) validateArguments(sel *selection) error {
+	field := e.schema.Query[slices.IndexFunc(e.schema.Query, func(f Field) bool { return f.Name == sel.name })]
+	for _, arg := range sel.arguments {
+		if !slices.ContainsFunc(field.Args, func(a Arg) bool { return a.Name == arg.name }) {
+			return fmt.Errorf("unknown argument %q on field \"Query.%s\"", arg.name, sel.name)
+		}
+		if err := e.checkVariables(arg.value); err != nil {
+			return err
+		}
+	}
+	for _, arg := range field.Args {
+		if strings.HasSuffix(arg.Type, "!") && !slices.ContainsFunc(sel.arguments, func(a argument) bool { return a.name == arg.Name }) {
+			return fmt.Errorf("field \"Query.%s\" argument %q of type %s is required", sel.name, arg.Name, arg.Type)
+		}
+	}
+	return nil
+}
+
+func (e *executor) checkVariables(value any) error {
+	switch v := value.(type) {
+	case variable:
+		if !e.defined[string(v)] {
+			return fmt.Errorf("variable $%s is not defined", v)
+		}
+	case []any:
+		for _, item := range v {
+			if err := e.checkVariables(item); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		for _, item := range v {
+			if err := e.checkVariables(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// collect groups selections by response key in order, applying fragments
+// and the skip and include directives.
+func (e *executor) collect(selections []*selection, keys []string, groups map[string][]*selection) ([]string, error) {
+	for _, sel := range selections {
+		include, err := e.included(sel.directives)
+		if err != nil {
+			return nil, err
+		}
+		if !include {
+			continue
+		}
+		switch {
+		case sel.spread != "":
+			if keys, err = e.collect(e.doc.fragments[sel.spread].selections, keys, groups); err != nil {
+				return nil, err
+			}
+		case sel.inline:
+			if keys, err = e.collect(sel.selections, keys, groups); err != nil {
+				return nil, err
+			}
+		default:
+			key := sel.key()
+			if _, ok := groups[key]; !ok {
+				keys = append(keys, key)
+			} else if groups[key][0].name != sel.name {
+				return nil, fmt.Errorf("fields %q and %q both answer as %q", groups[key][0].name, sel.name, key)
+			}
+			groups[key] = append(groups[key], sel)
+		}
+	}
+	return keys, nil
+}
+
+func (e *executor) included(directives []directive) (bool, error) {
+	for _, d := range directives {
+		if d.name != "skip" && d.name != "include" {
+			return false, fmt.Errorf("unknown directive @%s", d.name)
+		}
+		if len(d.arguments) != 1 || d.arguments[0].name != "if" {
+			return false, fmt.Errorf("directive @%s needs the argument if", d.name)
+		}
+		value, _ := e.resolveValue(d.arguments[0].value).(bool)
+		if d.name == "skip" && value || d.name == "include" && !value {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// resolveValue replaces variables and enum values in a value from the
+// syntax tree with plain values.
+func (e *executor) resolveValue(value any) any {
+	switch v := value.(type) {
+	case variable:
+		return e.vars[string(v)]
+	case enum:
+		return string(v)
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = e.resolveValue(item)
+		}
+		return list
+	case map[string]any:
+		object := make(map[string]any, len(v))
+		for key, item := range v {
+			object[key] = e.resolveValue(item)
+		}
+		return object
+	}
+	return value
+}
+
+func (e *executor) executeRoot(ctx context.Context, selections []*selection) (*object, error) {
+	groups := map[string][]*selection{}
+	keys, err := e.collect(selections, nil, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &object{}
+	for _, key := range keys {
+		sel := groups[key][0]
+		if sel.name == "__typename" {
+			data.set(key, "Query")
+			continue
+		}
+		field := e.schema.Query[slices.IndexFunc(e.schema.Query, func(f Field) bool { return f.Name == sel.name })]
+		path := []any{key}
+
+		args, err := e.arguments(field, sel)
+		if err != nil {
+			e.fail(path, err)
+			data.set(key, nil)
+			continue
+		}
+		result, err := field.Resolve(ctx, args)
+		if err != nil {
+			e.fail(path, err)
+			data.set(key, nil)
+			continue
+		}
+		value, err := e.complete(reflect.ValueOf(result), e.schema.roots[sel.name], subselections(groups[key]), path)
+		if err != nil {
+			return nil, err
+		}
+		data.set(key, value)
+	}
+	return data, nil
+}
+
+func (e *executor) arguments(field Field, sel *selection) (map[string]any, error) {
+	args := map[string]any{}
+	for _, arg := range sel.arguments {
+		if name, ok := arg.value.(variable); ok {
+			if _, set := e.vars[string(name)]; !set {
+				continue
+			}
+		}
+		value := e.resolveValue(arg.value)
+		def := field.Args[slices.IndexFunc(field.Args, func(a Arg) bool { return a.Name == arg.name })]
+		coerced, err := coerce(value, strings.TrimSuffix(def.Type, "!"))
+		if err != nil {
+			return nil, fmt.Errorf("argument %q: %w", arg.name, err)
+		}
+		if coerced == nil && strings.HasSuffix(def.Type, "!") {
+			return nil, fmt.Errorf("argument %q must not be null", arg.name)
+		}
+		if coerced != nil {
+			args[arg.name] = coerced
+		}
+	}
+	for _, def := range field.Args {
+		if _, ok := args[def.Name]; !ok && strings.HasSuffix(def.Type, "!") {
+			return nil, fmt.Errorf("argument %q is required", def.Name)
+		}
+	}
+	return args, nil
+}
+
+func coerce(value any, typeName string) (any, error) {
+	if value == nil || typeName == "JSON" {
+		return value, nil
+	}
+	switch typeName {
+	case "String":
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return nil, errors.New("must be a string")
+	case "Boolean":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		return nil, errors.New("must be a boolean")
+	case "Int":
+		switch n := value.(type) {
+		case json.Number:
+			if i, err := n.Int64(); err == nil && i >= -1<<31 && i < 1<<31 {
+				return int(i), nil
+			}
+		case float64:
+			if n == float64(int32(n)) {
+				return int(n), nil
+			}
+		}
+		return nil, errors.New("must be a 32-bit integer")
+	case "Float":
+		switch n := value.(type) {
+		case json.Number:
+			if f, err := n.Float64(); err == nil {
+				return f, nil
+			}
+		case float64:
+			return n, nil
+		}
+		return nil, errors.New("must be a number")
+	}
+	return nil, fmt.Errorf("unknown type %s", typeName)
+}
+
+func subselections(fields []*selection) []*selection {
+	var selections []*selection
+	for _, field := range fields {
+		selections = append(selections, field.selections...)
+	}
+	return selections
+}
+
+func (e *executor) fail(path []any, err error) {
+	e.errors = append(e.errors, Error{Message: err.Error(), Path: slices.Clone(path)})
+}
+
+// complete shapes a resolved Go value as the selections ask.
+func (e *executor) complete(v reflect.Value, t *typeInfo, selections []*selection, path []any) (any, error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	switch {
+	case t.scalar:
+		return v.Interface(), nil
+	case t.elem != nil:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		list := make([]any, v.Len())
+		for i := range list {
+			item, err := e.complete(v.Index(i), t.elem, selections, append(path, i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = item
+		}
+		return list, nil
+	}
+
+	groups := map[string][]*selection{}
+	keys, err := e.collect(selections, nil, groups)
+	if err != nil {
+		return nil, err
+	}
+	result := &object{}
+	for _, key := range keys {
+		sel := groups[key][0]
+		if sel.name == "__typename" {
+			result.set(key, t.name)
+			continue
+		}
+		field, _ := t.field(sel.name)
+		value, err := e.complete(v.FieldByIndex(field.index), field.typ, subselections(groups[key]), append(path, key))
+		if err != nil {
+			return nil, err
+		}
+		result.set(key, value)
+	}
+	return result, nil
+}
+
+// object is a JSON object that keeps its keys in selection order.
+type object struct {
+	keys   []string
+	values map[string]any
+}
+
+func (o *object) set(key string, value any) {
+	if o.values == nil {
+		o.values = map[string]any{}
+	}
+	o.keys = append(o.keys, key)
+	o.values[key] = value
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		value, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// ServeHTTP answers queries sent as JSON in a POST body or as query, and
+// optionally operationName and variables, URL parameters of a GET.
+// Requests that fail before execution get 400.
+func (s *Schema) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query         string         `json:"query"`
+		OperationName string         `json:"operationName"`
+		Variables     map[string]any `json:"variables"`
+	}
+	switch r.Method {
+	case http.MethodGet:
+		params := r.URL.Query()
+		req.Query, req.OperationName = params.Get("query"), params.Get("operationName")
+		if raw := params.Get("variables"); raw != "" {
+			decoder := json.NewDecoder(strings.NewReader(raw))
+			decoder.UseNumber()
+			if err := decoder.Decode(&req.Variables); err != nil {
+				writeResponse(w, http.StatusBadRequest, requestError("variables must be a JSON object"))
+				return
+			}
+		}
+	case http.MethodPost:
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+		if err != nil {
+			writeResponse(w, http.StatusRequestEntityTooLarge, requestError("request body larger than %d bytes", maxRequestBytes))
+			return
+		}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&req); err != nil {
+			writeResponse(w, http.StatusBadRequest, requestError("request body must be a JSON object with a query"))
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeResponse(w, http.StatusMethodNotAllowed, requestError("method not allowed"))
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		writeResponse(w, http.StatusBadRequest, requestError("query is required"))
+		return
+	}
+
+	resp := s.Execute(r.Context(), req.Query, req.OperationName, req.Variables)
+	status := http.StatusOK
+	if resp.Data == nil {
+		status = http.StatusBadRequest
+	}
+	writeResponse(w, status, resp)
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
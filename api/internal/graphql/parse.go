@@ -0,0 +1,593 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	kind       string
+	name       string
+	variables  []variableDefinition
+	selections []*selection
+}
+
+type variableDefinition struct {
+	name       string
+	nonNull    bool
+	defaultVal any
+	hasDefault bool
+}
+
+type fragment struct {
+	typeCondition string
+	selections    []*selection
+}
+
+// selection is a field, a fragment spread (spread set) or an inline
+// fragment (inline set).
+type selection struct {
+	alias      string
+	name       string
+	arguments  []argument
+	directives []directive
+	selections []*selection
+
+	spread string
+	inline bool
+}
+
+func (s *selection) key() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+type argument struct {
+	name  string
+	value any
+}
+
+type directive struct {
+	name      string
+	arguments []argument
+}
+
+// Values in the syntax tree are nil, bool, string, json.Number, []any,
+// map[string]any, enum or variable.
+type (
+	enum     string
+	variable string
+)
+
+type token struct {
+	kind  byte // punctuator, 'n'ame, 's'tring, '0' number, or 0 at the end
+	value string
+	pos   int
+}
+
+type parser struct {
+	src string
+	pos int
+	tok token
+}
+
+func parse(src string) (*document, error) {
+	p := &parser{src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	doc := &document{fragments: map[string]*fragment{}}
+	for p.tok.kind != 0 {
+		switch {
+		case p.tok.kind == '{':
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &operation{kind: "query", selections: selections})
+		case p.tok.kind == 'n' && p.tok.value == "fragment":
+			if err := p.fragment(doc); err != nil {
+				return nil, err
+			}
+		case p.tok.kind == 'n' && (p.tok.value == "query" || p.tok.value == "mutation" || p.tok.value == "subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("syntax error: document has no operation")
+	}
+	return doc, nil
+}
+
+func (p *parser) operation() (*operation, error) {
+	op := &operation{kind: p.tok.value}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == 'n' {
+		op.name = p.tok.value
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if p.tok.kind == '(' {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		for p.tok.kind != ')' {
+			def, err := p.variableDefinition()
+			if err != nil {
+				return nil, err
+			}
+			op.variables = append(op.variables, def)
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	selections, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.selections = selections
+	return op, nil
+}
+
+func (p *parser) variableDefinition() (variableDefinition, error) {
+	if p.tok.kind != '$' {
+		return variableDefinition{}, p.unexpected()
+	}
+	if err := p.next(); err != nil {
+		return variableDefinition{}, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return variableDefinition{}, err
+	}
+	def := variableDefinition{name: name}
+	if err := p.expect(':'); err != nil {
+		return variableDefinition{}, err
+	}
+	if def.nonNull, err = p.typeRef(); err != nil {
+		return variableDefinition{}, err
+	}
+	if p.tok.kind == '=' {
+		if err := p.next(); err != nil {
+			return variableDefinition{}, err
+		}
+		if def.defaultVal, err = p.value(true); err != nil {
+			return variableDefinition{}, err
+		}
+		def.hasDefault = true
+	}
+	if _, err := p.directives(); err != nil {
+		return variableDefinition{}, err
+	}
+	return def, nil
+}
+
+// typeRef skips a type reference, reporting whether it is non-null.
+func (p *parser) typeRef() (bool, error) {
+	if p.tok.kind == '[' {
+		if err := p.next(); err != nil {
+			return false, err
+		}
+		if _, err := p.typeRef(); err != nil {
+			return false, err
+		}
+		if err := p.expect(']'); err != nil {
+			return false, err
+		}
+	} else if _, err := p.name(); err != nil {
+		return false, err
+	}
+	if p.tok.kind == '!' {
+		return true, p.next()
+	}
+	return false, nil
+}
+
+func (p *parser) fragment(doc *document) error {
+	if err := p.next(); err != nil {
+		return err
+	}
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	if name == "on" {
+		return fmt.Errorf("syntax error: fragment cannot be named \"on\"")
+	}
+	if p.tok.kind != 'n' || p.tok.value != "on" {
+		return p.unexpected()
+	}
+	if err := p.next(); err != nil {
+		return err
+	}
+	typeCondition, err := p.name()
+	if err != nil {
+		return err
+	}
+	if _, err := p.directives(); err != nil {
+		return err
+	}
+	selections, err := p.selectionSet()
+	if err != nil {
+		return err
+	}
+	if _, ok := doc.fragments[name]; ok {
+		return fmt.Errorf("there can be only one fragment named %q", name)
+	}
+	doc.fragments[name] = &fragment{typeCondition: typeCondition, selections: selections}
+	return nil
+}
+
+func (p *parser) selectionSet() ([]*selection, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	var selections []*selection
+	for p.tok.kind != '}' {
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, sel)
+	}
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("syntax error: empty selection set")
+	}
+	return selections, p.next()
+}
+
+func (p *parser) selection() (*selection, error) {
+	sel := &selection{}
+	var err error
+	if p.tok.kind == '.' {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == 'n' && p.tok.value != "on" {
+			sel.spread = p.tok.value
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			sel.directives, err = p.directives()
+			return sel, err
+		}
+		sel.inline = true
+		if p.tok.kind == 'n' {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if _, err := p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if sel.directives, err = p.directives(); err != nil {
+			return nil, err
+		}
+		sel.selections, err = p.selectionSet()
+		return sel, err
+	}
+
+	if sel.name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == ':' {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		sel.alias = sel.name
+		if sel.name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if sel.arguments, err = p.arguments(false); err != nil {
+		return nil, err
+	}
+	if sel.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == '{' {
+		sel.selections, err = p.selectionSet()
+	}
+	return sel, err
+}
+
+func (p *parser) arguments(constant bool) ([]argument, error) {
+	if p.tok.kind != '(' {
+		return nil, nil
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	var arguments []argument
+	for p.tok.kind != ')' {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+		value, err := p.value(constant)
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, argument{name: name, value: value})
+	}
+	return arguments, p.next()
+}
+
+func (p *parser) directives() ([]directive, error) {
+	var directives []directive
+	for p.tok.kind == '@' {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		arguments, err := p.arguments(false)
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, directive{name: name, arguments: arguments})
+	}
+	return directives, nil
+}
+
+func (p *parser) value(constant bool) (any, error) {
+	tok := p.tok
+	switch tok.kind {
+	case '$':
+		if constant {
+			return nil, p.unexpected()
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return variable(name), err
+	case 's':
+		return tok.value, p.next()
+	case '0':
+		return json.Number(tok.value), p.next()
+	case 'n':
+		var value any
+		switch tok.value {
+		case "true", "false":
+			value = tok.value == "true"
+		case "null":
+			value = nil
+		default:
+			value = enum(tok.value)
+		}
+		return value, p.next()
+	case '[':
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		list := []any{}
+		for p.tok.kind != ']' {
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, p.next()
+	case '{':
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		object := map[string]any{}
+		for p.tok.kind != '}' {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(':'); err != nil {
+				return nil, err
+			}
+			if object[name], err = p.value(constant); err != nil {
+				return nil, err
+			}
+		}
+		return object, p.next()
+	}
+	return nil, p.unexpected()
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != 'n' {
+		return "", p.unexpected()
+	}
+	name := p.tok.value
+	return name, p.next()
+}
+
+func (p *parser) expect(kind byte) error {
+	if p.tok.kind != kind {
+		return p.unexpected()
+	}
+	return p.next()
+}
+
+func (p *parser) unexpected() error {
+	if p.tok.kind == 0 {
+		return fmt.Errorf("syntax error: unexpected end of document")
+	}
+	return fmt.Errorf("syntax error: unexpected %q at offset %d", p.src[p.tok.pos:p.pos], p.tok.pos)
+}
+
+// next reads the next token, skipping whitespace, commas and comments.
+func (p *parser) next() error {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		if strings.HasPrefix(p.src[p.pos:], "\uFEFF") {
+			p.pos += len("\uFEFF")
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != ',' {
+			break
+		}
+		p.pos++
+	}
+
+	start := p.pos
+	p.tok = token{pos: start}
+	if p.pos >= len(p.src) {
+		return nil
+	}
+	c := p.src[p.pos]
+	switch {
+	case strings.IndexByte("!$&()[]{}:=@|", c) >= 0:
+		p.pos++
+		p.tok.kind = c
+	case c == '.':
+		if !strings.HasPrefix(p.src[p.pos:], "...") {
+			return fmt.Errorf("syntax error: unexpected \".\" at offset %d", start)
+		}
+		p.pos += 3
+		p.tok.kind = '.'
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok.kind, p.tok.value = 'n', p.src[start:p.pos]
+	case c == '-' || isDigit(c):
+		return p.number()
+	case c == '"':
+		return p.string()
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		return fmt.Errorf("syntax error: unexpected character %q at offset %d", r, start)
+	}
+	return nil
+}
+
+func (p *parser) number() error {
+	start := p.pos
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	digits := func() {
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.pos++
+		}
+	}
+	digits()
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		p.pos++
+		digits()
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		p.pos++
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		digits()
+	}
+	raw := p.src[start:p.pos]
+	if !json.Valid([]byte(raw)) {
+		return fmt.Errorf("syntax error: invalid number %q at offset %d", raw, start)
+	}
+	p.tok.kind, p.tok.value = '0', raw
+	return nil
+}
+
+func (p *parser) string() error {
+	start := p.pos
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		end := strings.Index(p.src[p.pos+3:], `"""`)
+		if end < 0 {
+			return fmt.Errorf("syntax error: unterminated string at offset %d", start)
+		}
+		raw := p.src[p.pos+3 : p.pos+3+end]
+		p.pos += end + 6
+		p.tok.kind, p.tok.value = 's', blockString(raw)
+		return nil
+	}
+
+	p.pos++
+	for p.pos < len(p.src) && p.src[p.pos] != '"' && p.src[p.pos] != '\n' {
+		if p.src[p.pos] == '\\' {
+			p.pos++
+		}
+		p.pos++
+	}
+	if p.pos >= len(p.src) || p.src[p.pos] != '"' {
+		return fmt.Errorf("syntax error: unterminated string at offset %d", start)
+	}
+	p.pos++
+	// GraphQL strings escape like JSON ones.
+	var value string
+	if err := json.Unmarshal([]byte(p.src[start:p.pos]), &value); err != nil {
+		return fmt.Errorf("syntax error: invalid string at offset %d", start)
+	}
+	p.tok.kind, p.tok.value = 's', value
+	return nil
+}
+
+// blockString removes the common indentation and surrounding blank lines of
+// a """block string""".
+func blockString(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, `\"""`, `"""`), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if n := len(line) - len(trimmed); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		if len(lines[i]) >= indent {
+			lines[i] = lines[i][indent:]
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,168 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+	timeType       = reflect.TypeOf(time.Time{})
+	marshalerType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// typeInfo is the GraphQL type of a Go type: a scalar, a list of elem, or
+// an object with fields.
+type typeInfo struct {
+	name   string
+	scalar bool
+	elem   *typeInfo
+	fields []objectField
+}
+
+type objectField struct {
+	name  string
+	index []int
+	typ   *typeInfo
+}
+
+func (t *typeInfo) String() string {
+	if t.elem != nil {
+		return "[" + t.elem.String() + "]"
+	}
+	return t.name
+}
+
+func (t *typeInfo) field(name string) (objectField, bool) {
+	idx := slices.IndexFunc(t.fields, func(f objectField) bool { return f.name == name })
+	if idx < 0 {
+		return objectField{}, false
+	}
+	return t.fields[idx], true
+}
+
+// types maps Go types to GraphQL types. Object types are named after their
+// Go type, capitalized; anonymous structs after the enclosing type and
+// field.
+type types struct {
+	byType  map[reflect.Type]*typeInfo
+	objects []*typeInfo
+}
+
+func (ts *types) of(t reflect.Type, name string) *typeInfo {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if info, ok := ts.byType[t]; ok {
+		return info
+	}
+
+	switch {
+	case t == rawMessageType || t.Kind() == reflect.Map || t.Kind() == reflect.Interface ||
+		t.Kind() == reflect.Struct && t != timeType && t.Implements(marshalerType):
+		return &typeInfo{name: "JSON", scalar: true}
+	case t == timeType:
+		return &typeInfo{name: "String", scalar: true}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &typeInfo{name: "Boolean", scalar: true}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &typeInfo{name: "Int", scalar: true}
+	case reflect.Float32, reflect.Float64:
+		return &typeInfo{name: "Float", scalar: true}
+	case reflect.String:
+		return &typeInfo{name: "String", scalar: true}
+	case reflect.Slice, reflect.Array:
+		return &typeInfo{elem: ts.of(t.Elem(), name)}
+	case reflect.Struct:
+		if t.Name() != "" {
+			name = exported(t.Name())
+		}
+		info := &typeInfo{name: name}
+		ts.byType[t] = info
+		ts.objects = append(ts.objects, info)
+		ts.addFields(info, t, nil)
+		return info
+	}
+	return &typeInfo{name: "JSON", scalar: true}
+}
+
+// addFields adds the fields of t that encoding/json would write, promoting
+// those of untagged embedded structs.
+func (ts *types) addFields(info *typeInfo, t reflect.Type, index []int) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			ts.addFields(info, field.Type, append(slices.Clone(index), i))
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		info.fields = append(info.fields, objectField{
+			name:  name,
+			index: append(slices.Clone(index), i),
+			typ:   ts.of(field.Type, info.name+exported(camelCase(name))),
+		})
+	}
+}
+
+func exported(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func camelCase(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		parts[i] = exported(parts[i])
+	}
+	return strings.Join(parts, "")
+}
+
+// SDL returns the schema in the GraphQL schema definition language.
+func (s *Schema) SDL() string {
+	s.init()
+	var b strings.Builder
+	b.WriteString("scalar JSON\n\ntype Query {\n")
+	for _, field := range s.Query {
+		if field.Description != "" {
+			fmt.Fprintf(&b, "  %q\n", field.Description)
+		}
+		b.WriteString("  " + field.Name)
+		if len(field.Args) > 0 {
+			args := make([]string, 0, len(field.Args))
+			for _, arg := range field.Args {
+				args = append(args, arg.Name+": "+arg.Type)
+			}
+			b.WriteString("(" + strings.Join(args, ", ") + ")")
+		}
+		b.WriteString(": " + s.types.of(field.Type, exported(field.Name)).String() + "\n")
+	}
+	b.WriteString("}\n")
+
+	for _, object := range s.types.objects {
+		b.WriteString("\ntype " + object.name + " {\n")
+		for _, field := range object.fields {
+			b.WriteString("  " + field.name + ": " + field.typ.String() + "\n")
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
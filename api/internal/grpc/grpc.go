@@ -0,0 +1,200 @@
+// Package grpc serves unary and server-streaming gRPC methods over the
+// standard library's HTTP/2 server, with a hand-written protobuf wire codec
+// instead of generated code. Compression is not supported.
+package grpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxMessageBytes     = 4 << 20
+	messageWriteTimeout = 10 * time.Second
+)
+
+// Status codes.
+type Code int
+
+const (
+	OK                Code = 0
+	Canceled          Code = 1
+	InvalidArgument   Code = 3
+	DeadlineExceeded  Code = 4
+	NotFound          Code = 5
+	ResourceExhausted Code = 8
+	Unimplemented     Code = 12
+	Internal          Code = 13
+	Unavailable       Code = 14
+	Unauthenticated   Code = 16
+)
+
+// Status is an error carrying a gRPC status code.
+type Status struct {
+	Code    Code
+	Message string
+}
+
+func (s *Status) Error() string {
+	return s.Message
+}
+
+func Errorf(code Code, format string, args ...any) error {
+	return &Status{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Method handles one RPC. Unary methods return their answer; streaming
+// methods call send for every message and return nil.
+type Method struct {
+	Unary  func(r *http.Request, req []byte) ([]byte, error)
+	Stream func(r *http.Request, req []byte, send func([]byte) error) error
+}
+
+// Server routes requests for /Service/Method to Methods, keyed by the
+// full path.
+type Server struct {
+	Methods map[string]Method
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !isGRPC(r.Header.Get("Content-Type")) {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc+proto")
+	w.WriteHeader(http.StatusOK)
+	err := s.serve(w, r)
+
+	var status *Status
+	switch {
+	case err == nil:
+		status = &Status{Code: OK}
+	case errors.As(err, &status):
+	case errors.Is(err, context.DeadlineExceeded):
+		status = &Status{Code: DeadlineExceeded, Message: "deadline exceeded"}
+	case errors.Is(err, context.Canceled):
+		status = &Status{Code: Canceled, Message: "canceled"}
+	default:
+		status = &Status{Code: Internal, Message: err.Error()}
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(int(status.Code)))
+	if status.Message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", encodeMessage(status.Message))
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) error {
+	method, ok := s.Methods[r.URL.Path]
+	if !ok {
+		return Errorf(Unimplemented, "unknown method %s", r.URL.Path)
+	}
+	if encoding := r.Header.Get("Grpc-Encoding"); encoding != "" && encoding != "identity" {
+		return Errorf(Unimplemented, "compression %s is not supported", encoding)
+	}
+
+	if timeout, ok := parseTimeout(r.Header.Get("Grpc-Timeout")); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	req, err := readMessage(r.Body)
+	if err != nil {
+		return err
+	}
+
+	send := func(msg []byte) error {
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		rc := http.NewResponseController(w)
+		_ = rc.SetWriteDeadline(time.Now().Add(messageWriteTimeout))
+		if err := writeMessage(w, msg); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	switch {
+	case method.Unary != nil:
+		resp, err := method.Unary(r, req)
+		if err != nil {
+			return err
+		}
+		return send(resp)
+	case method.Stream != nil:
+		return method.Stream(r, req, send)
+	}
+	return Errorf(Unimplemented, "unknown method %s", r.URL.Path)
+}
+
+func isGRPC(contentType string) bool {
+	return contentType == "application/grpc" || strings.HasPrefix(contentType, "application/grpc+proto") || strings.HasPrefix(contentType, "application/grpc;")
+}
+
+// readMessage reads the single request message of a unary or
+// server-streaming call.
+func readMessage(body io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(body, header[:]); err != nil {
+		return nil, Errorf(InvalidArgument, "missing request message")
+	}
+	if header[0] != 0 {
+		return nil, Errorf(Unimplemented, "compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxMessageBytes {
+		return nil, Errorf(ResourceExhausted, "request message larger than %d bytes", maxMessageBytes)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(body, msg); err != nil {
+		return nil, Errorf(InvalidArgument, "truncated request message")
+	}
+	return msg, nil
+}
+
+func writeMessage(w io.Writer, msg []byte) error {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	_, err := w.Write(append(frame, msg...))
+	return err
+}
+
+// parseTimeout parses a grpc-timeout header such as "500m" or "10S".
+func parseTimeout(raw string) (time.Duration, bool) {
+	if len(raw) < 2 || len(raw) > 9 {
+		return 0, false
+	}
+	value, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+	if err != nil || value < 0 {
+		return 0, false
+	}
+	units := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second, 'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond}
+	unit, ok := units[raw[len(raw)-1]]
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(value) * unit, true
+}
+
+// encodeMessage percent-encodes a status message as grpc-message requires.
+func encodeMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,144 @@
+package grpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Protobuf wire types.
+const (
+	WireVarint  = 0
+	WireFixed64 = 1
+	WireBytes   = 2
+	WireFixed32 = 5
+)
+
+var errMalformed = errors.New("malformed protobuf message")
+
+// Encoder appends protobuf fields to a message. Like proto3, it leaves out
+// fields holding their zero value.
+type Encoder struct {
+	buf []byte
+}
+
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+func (e *Encoder) tag(field int, wire int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(field)<<3|uint64(wire))
+}
+
+func (e *Encoder) Int(field int, v int64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, WireVarint)
+	e.buf = binary.AppendUvarint(e.buf, uint64(v))
+}
+
+func (e *Encoder) Bool(field int, v bool) {
+	if v {
+		e.Int(field, 1)
+	}
+}
+
+func (e *Encoder) Double(field int, v float64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, WireFixed64)
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(v))
+}
+
+func (e *Encoder) String(field int, v string) {
+	if v == "" {
+		return
+	}
+	e.tag(field, WireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// Message appends an embedded message, which is written even when empty.
+func (e *Encoder) Message(field int, v []byte) {
+	e.tag(field, WireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// Field is one decoded field. Varint and fixed values are in Uint, length
+// delimited ones in Data.
+type Field struct {
+	Number int
+	Wire   int
+	Uint   uint64
+	Data   []byte
+}
+
+func (f Field) Int() int64 {
+	return int64(f.Uint)
+}
+
+func (f Field) Bool() bool {
+	return f.Uint != 0
+}
+
+func (f Field) Double() float64 {
+	if f.Wire == WireFixed32 {
+		return float64(math.Float32frombits(uint32(f.Uint)))
+	}
+	return math.Float64frombits(f.Uint)
+}
+
+func (f Field) String() string {
+	return string(f.Data)
+}
+
+// Decode calls fn for every field of msg in order.
+func Decode(msg []byte, fn func(Field) error) error {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 || key>>3 == 0 || key>>3 > math.MaxInt32 {
+			return errMalformed
+		}
+		msg = msg[n:]
+
+		f := Field{Number: int(key >> 3), Wire: int(key & 7)}
+		switch f.Wire {
+		case WireVarint:
+			f.Uint, n = binary.Uvarint(msg)
+			if n <= 0 {
+				return errMalformed
+			}
+			msg = msg[n:]
+		case WireFixed64:
+			if len(msg) < 8 {
+				return errMalformed
+			}
+			f.Uint = binary.LittleEndian.Uint64(msg)
+			msg = msg[8:]
+		case WireFixed32:
+			if len(msg) < 4 {
+				return errMalformed
+			}
+			f.Uint = uint64(binary.LittleEndian.Uint32(msg))
+			msg = msg[4:]
+		case WireBytes:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || size > uint64(len(msg)-n) {
+				return errMalformed
+			}
+			f.Data = msg[n : n+int(size)]
+			msg = msg[n+int(size):]
+		default:
+			return errMalformed
+		}
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
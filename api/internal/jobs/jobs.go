@@ -0,0 +1,215 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusQueued  Status = "queued"
+	StatusRunning Status = "running"
+	StatusDone    Status = "done"
+	StatusFailed  Status = "failed"
+)
+
+// ErrQueueFull is returned by Submit when every queue slot is taken.
+var ErrQueueFull = errors.New("job queue is full")
+
+type Job struct {
+	ID      string
+	Status  Status
+	Created time.Time
+	Updated time.Time
+	// Steps is the number of units of work, Completed how many are done.
+	Steps     int
+	Completed int
+	// Result is the JSON result of a done job.
+	Result []byte
+	Error  string
+}
+
+// Finished reports whether the job is done or failed.
+func (j Job) Finished() bool {
+	return j.Status == StatusDone || j.Status == StatusFailed
+}
+
+// Store keeps job records. Implementations must be safe for concurrent use.
+type Store interface {
+	Put(job Job) error
+	Get(id string) (Job, bool, error)
+	// Expire deletes finished jobs last updated before cutoff and returns
+	// how many it removed.
+	Expire(cutoff time.Time) (int, error)
+}
+
+// Memory is a Store that loses its jobs on restart.
+type Memory struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+func NewMemory() *Memory {
+	return &Memory{jobs: make(map[string]Job)}
+}
+
+func (m *Memory) Put(job Job) error {
+	m.mu.Lock()
+	m.jobs[job.ID] = job
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Memory) Get(id string) (Job, bool, error) {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	m.mu.Unlock()
+	return job, ok, nil
+}
+
+func (m *Memory) Expire(cutoff time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := 0
+	for id, job := range m.jobs {
+		if job.Finished() && job.Updated.Before(cutoff) {
+			delete(m.jobs, id)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Func does the work of a job, calling progress after each step, and
+// returns the JSON result.
+type Func func(progress func(completed int)) ([]byte, error)
+
+type task struct {
+	id  string
+	run Func
+}
+
+// Queue runs submitted jobs on a fixed number of workers and expires
+// finished jobs after a TTL.
+type Queue struct {
+	store Store
+	tasks chan task
+	ttl   time.Duration
+}
+
+func NewQueue(store Store, workers int, depth int, ttl time.Duration) *Queue {
+	if workers <= 0 {
+		workers = 1
+	}
+	if depth <= 0 {
+		depth = 1
+	}
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+
+	q := &Queue{store: store, tasks: make(chan task, depth), ttl: ttl}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	go q.sweep()
+	return q
+}
+
+// Submit queues run as a job of steps steps.
+func (q *Queue) Submit(steps int, run Func) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	now := time.Now().UTC()
+	job := Job{ID: id, Status: StatusQueued, Created: now, Updated: now, Steps: steps}
+	if err := q.store.Put(job); err != nil {
+		return Job{}, err
+	}
+
+	select {
+	case q.tasks <- task{id: id, run: run}:
+		return job, nil
+	default:
+		job.Status, job.Error = StatusFailed, ErrQueueFull.Error()
+		_ = q.store.Put(job)
+		return Job{}, ErrQueueFull
+	}
+}
+
+func (q *Queue) Get(id string) (Job, bool, error) {
+	return q.store.Get(id)
+}
+
+func (q *Queue) work() {
+	for t := range q.tasks {
+		q.update(t.id, func(job *Job) { job.Status = StatusRunning })
+
+		result, err := q.run(t)
+
+		q.update(t.id, func(job *Job) {
+			if err != nil {
+				job.Status, job.Error = StatusFailed, err.Error()
+				return
+			}
+			job.Status, job.Result, job.Completed = StatusDone, result, job.Steps
+		})
+	}
+}
+
+// run runs t, turning a panic into a failed job so one bad job cannot stop
+// the worker or the process.
+func (q *Queue) run(t task) (result []byte, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("job %s: panic: %v\n%s", t.id, p, debug.Stack())
+			result, err = nil, fmt.Errorf("job failed unexpectedly")
+		}
+	}()
+
+	return t.run(func(completed int) {
+		q.update(t.id, func(job *Job) { job.Completed = completed })
+	})
+}
+
+func (q *Queue) update(id string, change func(job *Job)) {
+	job, ok, err := q.store.Get(id)
+	if err != nil || !ok {
+		log.Printf("job %s: lookup failed: ok=%t err=%v", id, ok, err)
+		return
+	}
+	change(&job)
+	job.Updated = time.Now().UTC()
+	if err := q.store.Put(job); err != nil {
+		log.Printf("job %s: store failed: %v", id, err)
+	}
+}
+
+func (q *Queue) sweep() {
+	ticker := time.NewTicker(max(q.ttl/4, time.Second))
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if _, err := q.store.Expire(now.Add(-q.ttl)); err != nil {
+			log.Printf("job sweep failed: %v", err)
+		}
+	}
+}
+
+func newID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
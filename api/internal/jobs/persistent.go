@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"time"
+
+	"map-ascii-generator/api/internal/storage"
+)
+
+const collection = "jobs"
+
+// Persistent is a Store that keeps jobs in persistent storage, so results
+// can still be fetched after a restart.
+type Persistent struct {
+	dir storage.Store
+}
+
+// NewPersistent opens the jobs in dir. Jobs that were queued or running
+// when the server stopped are marked failed, as nothing will resume them.
+func NewPersistent(dir storage.Store) (*Persistent, error) {
+	p := &Persistent{dir: dir}
+
+	ids, err := dir.Keys(collection)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		job, ok, err := p.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || job.Finished() {
+			continue
+		}
+		job.Status, job.Error, job.Updated = StatusFailed, "interrupted by a server restart", time.Now().UTC()
+		if err := p.Put(job); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *Persistent) Put(job Job) error {
+	return p.dir.Put(collection, job.ID, job)
+}
+
+func (p *Persistent) Get(id string) (Job, bool, error) {
+	var job Job
+	ok, err := p.dir.Get(collection, id, &job)
+	return job, ok, err
+}
+
+func (p *Persistent) Expire(cutoff time.Time) (int, error) {
+	ids, err := p.dir.Keys(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, id := range ids {
+		job, ok, err := p.Get(id)
+		if err != nil || !ok || !job.Finished() || !job.Updated.Before(cutoff) {
+			continue
+		}
+		if err := p.dir.Delete(collection, id); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,170 @@
+// Package jwt verifies JSON Web Tokens in compact form signed with RS256,
+// ES256, EdDSA or HS256, with keys from a JWKS document or a PEM file. It
+// does not issue tokens.
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+type Header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// Claims is the decoded payload of a token.
+type Claims map[string]any
+
+type Token struct {
+	Header Header
+	Claims Claims
+
+	signed    []byte
+	signature []byte
+}
+
+// Parse decodes token without verifying it.
+func Parse(token string) (*Token, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token must have three parts")
+	}
+
+	var t Token
+	if err := decodePart(parts[0], &t.Header); err != nil {
+		return nil, fmt.Errorf("token header: %w", err)
+	}
+	if err := decodePart(parts[1], &t.Claims); err != nil {
+		return nil, fmt.Errorf("token claims: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("token signature: %w", err)
+	}
+	t.signed, t.signature = []byte(parts[0]+"."+parts[1]), signature
+	return &t, nil
+}
+
+func decodePart(part string, out any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Verify checks the signature with key: an *rsa.PublicKey for RS256, an
+// *ecdsa.PublicKey on P-256 for ES256, an ed25519.PublicKey for EdDSA or a
+// []byte secret for HS256. The token's alg must match the key type.
+func (t *Token) Verify(key any) error {
+	digest := sha256.Sum256(t.signed)
+	switch t.Header.Alg {
+	case "RS256":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("alg RS256 needs an RSA key")
+		}
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], t.signature); err != nil {
+			return fmt.Errorf("invalid signature")
+		}
+	case "ES256":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok || k.Curve != elliptic.P256() {
+			return fmt.Errorf("alg ES256 needs a P-256 key")
+		}
+		if len(t.signature) != 64 {
+			return fmt.Errorf("invalid signature")
+		}
+		r, s := new(big.Int).SetBytes(t.signature[:32]), new(big.Int).SetBytes(t.signature[32:])
+		if !ecdsa.Verify(k, digest[:], r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+	case "EdDSA":
+		k, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("alg EdDSA needs an Ed25519 key")
+		}
+		if !ed25519.Verify(k, t.signed, t.signature) {
+			return fmt.Errorf("invalid signature")
+		}
+	case "HS256":
+		k, ok := key.([]byte)
+		if !ok {
+			return fmt.Errorf("alg HS256 needs a shared secret")
+		}
+		mac := hmac.New(sha256.New, k)
+		mac.Write(t.signed)
+		if !hmac.Equal(mac.Sum(nil), t.signature) {
+			return fmt.Errorf("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported alg %q", t.Header.Alg)
+	}
+	return nil
+}
+
+// Validate checks the time claims at now, allowing leeway for clock skew,
+// and iss and aud when issuer or audience are set. A token without exp is
+// refused.
+func (c Claims) Validate(now time.Time, leeway time.Duration, issuer string, audience string) error {
+	exp, ok := c.time("exp")
+	if !ok {
+		return fmt.Errorf("token has no exp claim")
+	}
+	if now.After(exp.Add(leeway)) {
+		return fmt.Errorf("token expired")
+	}
+	if nbf, ok := c.time("nbf"); ok && now.Add(leeway).Before(nbf) {
+		return fmt.Errorf("token not valid yet")
+	}
+	if issuer != "" && c.String("iss") != issuer {
+		return fmt.Errorf("token issuer is not %q", issuer)
+	}
+	if audience != "" && !c.hasAudience(audience) {
+		return fmt.Errorf("token audience does not include %q", audience)
+	}
+	return nil
+}
+
+// String returns the claim name if it is a string.
+func (c Claims) String(name string) string {
+	value, _ := c[name].(string)
+	return value
+}
+
+func (c Claims) time(name string) (time.Time, bool) {
+	seconds, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+// hasAudience reports whether aud, a string or a list of strings,
+// includes audience.
+func (c Claims) hasAudience(audience string) bool {
+	switch aud := c["aud"].(type) {
+	case string:
+		return aud == audience
+	case []any:
+		for _, value := range aud {
+			if value == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
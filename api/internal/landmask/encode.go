@@ -0,0 +1,52 @@
+package landmask
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
+
+	mapascii "github.com/Kivayan/map-ascii"
+)
+
+// Encode writes mask in one of the formats Decode reads. PBM keeps pixels
+// that are at least half land.
+func Encode(w io.Writer, mask *mapascii.LandMask, format string) error {
+	switch format {
+	case FormatPNG:
+		img := image.NewGray(image.Rect(0, 0, mask.Width, mask.Height))
+		for i, v := range mask.Data {
+			img.Pix[i] = grayLevel(v)
+		}
+		return png.Encode(w, img)
+	case FormatPGM:
+		bw := bufio.NewWriter(w)
+		fmt.Fprintf(bw, "P5\n%d %d\n255\n", mask.Width, mask.Height)
+		for _, v := range mask.Data {
+			bw.WriteByte(grayLevel(v))
+		}
+		return bw.Flush()
+	case FormatPBM:
+		bw := bufio.NewWriter(w)
+		fmt.Fprintf(bw, "P4\n%d %d\n", mask.Width, mask.Height)
+		row := make([]byte, (mask.Width+7)/8)
+		for y := 0; y < mask.Height; y++ {
+			clear(row)
+			for x := 0; x < mask.Width; x++ {
+				if mask.Data[y*mask.Width+x] >= 0.5 {
+					row[x/8] |= 0x80 >> (x % 8)
+				}
+			}
+			bw.Write(row)
+		}
+		return bw.Flush()
+	default:
+		return fmt.Errorf("unsupported mask format %q", format)
+	}
+}
+
+func grayLevel(v float64) byte {
+	return byte(math.Round(min(max(v, 0), 1) * 255))
+}
@@ -0,0 +1,216 @@
+// Package landmask reads, writes and rasterizes land masks in the formats
+// the server accepts: grayscale PNG, the map-ascii library's native format,
+// and Netpbm bitmaps (PBM) and graymaps (PGM). Masks are equirectangular,
+// covering -180 to 180 longitude left to right and 90 to -90 latitude top
+// to bottom. Land is bright and water dark, except in PBM bitmaps where set
+// (black) pixels are land, as drawn.
+package landmask
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strconv"
+
+	mapascii "github.com/Kivayan/map-ascii"
+)
+
+const (
+	FormatPNG = "png"
+	FormatPBM = "pbm"
+	FormatPGM = "pgm"
+)
+
+// Decode detects the format from the leading bytes and rejects masks with
+// more than maxPixels pixels before allocating them.
+func Decode(data []byte, maxPixels int) (*mapascii.LandMask, string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		mask, err := decodePNG(data, maxPixels)
+		return mask, FormatPNG, err
+	case len(data) >= 2 && data[0] == 'P' && (data[1] == '1' || data[1] == '4'):
+		mask, err := decodeNetpbm(data, maxPixels)
+		return mask, FormatPBM, err
+	case len(data) >= 2 && data[0] == 'P' && (data[1] == '2' || data[1] == '5'):
+		mask, err := decodeNetpbm(data, maxPixels)
+		return mask, FormatPGM, err
+	default:
+		return nil, "", fmt.Errorf("unsupported mask format; expected PNG, PBM or PGM")
+	}
+}
+
+func checkSize(width int, height int, maxPixels int) error {
+	if width < 2 || height < 2 {
+		return fmt.Errorf("mask must be at least 2x2 pixels, got %dx%d", width, height)
+	}
+	if maxPixels > 0 && width > maxPixels/height {
+		return fmt.Errorf("mask must have at most %d pixels, got %dx%d", maxPixels, width, height)
+	}
+	return nil
+}
+
+func decodePNG(data []byte, maxPixels int) (*mapascii.LandMask, error) {
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode mask PNG: %w", err)
+	}
+	if err := checkSize(cfg.Width, cfg.Height, maxPixels); err != nil {
+		return nil, err
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode mask PNG: %w", err)
+	}
+	return fromImage(img), nil
+}
+
+// fromImage converts like mapascii.LoadLandMask: the gray level of each
+// pixel scaled to 0..1.
+func fromImage(img image.Image) *mapascii.LandMask {
+	bounds := img.Bounds()
+	mask := &mapascii.LandMask{Width: bounds.Dx(), Height: bounds.Dy(), Data: make([]float64, bounds.Dx()*bounds.Dy())}
+	for y := 0; y < mask.Height; y++ {
+		for x := 0; x < mask.Width; x++ {
+			gray := color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray)
+			mask.Data[y*mask.Width+x] = float64(gray.Y) / 255.0
+		}
+	}
+	return mask
+}
+
+// decodeNetpbm reads P1 and P4 bitmaps, where 1 is land, and P2 and P5
+// graymaps scaled by their maximum value.
+func decodeNetpbm(data []byte, maxPixels int) (*mapascii.LandMask, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	bitmap := magic[1] == '1' || magic[1] == '4'
+	binary := magic[1] == '4' || magic[1] == '5'
+
+	width, height, maxValue := 0, 0, 1
+	fields := []*int{&width, &height, &maxValue}
+	if bitmap {
+		fields = fields[:2]
+	}
+	for _, field := range fields {
+		v, err := netpbmInt(r)
+		if err != nil {
+			return nil, fmt.Errorf("read Netpbm header: %w", err)
+		}
+		*field = v
+	}
+	if err := checkSize(width, height, maxPixels); err != nil {
+		return nil, err
+	}
+	if maxValue < 1 || maxValue > 65535 {
+		return nil, fmt.Errorf("Netpbm maximum value must be 1 to 65535, got %d", maxValue)
+	}
+
+	mask := &mapascii.LandMask{Width: width, Height: height, Data: make([]float64, width*height)}
+	switch {
+	case bitmap && binary:
+		row := make([]byte, (width+7)/8)
+		for y := 0; y < height; y++ {
+			if _, err := io.ReadFull(r, row); err != nil {
+				return nil, fmt.Errorf("read PBM row %d: %w", y, err)
+			}
+			for x := 0; x < width; x++ {
+				if row[x/8]&(0x80>>(x%8)) != 0 {
+					mask.Data[y*width+x] = 1
+				}
+			}
+		}
+	case binary:
+		sampleBytes := 1
+		if maxValue > 255 {
+			sampleBytes = 2
+		}
+		row := make([]byte, width*sampleBytes)
+		for y := 0; y < height; y++ {
+			if _, err := io.ReadFull(r, row); err != nil {
+				return nil, fmt.Errorf("read PGM row %d: %w", y, err)
+			}
+			for x := 0; x < width; x++ {
+				v := int(row[x*sampleBytes])
+				if sampleBytes == 2 {
+					v = v<<8 | int(row[x*2+1])
+				}
+				mask.Data[y*width+x] = min(float64(v)/float64(maxValue), 1)
+			}
+		}
+	default:
+		for i := range mask.Data {
+			var v int
+			var err error
+			if bitmap {
+				v, err = pbmBit(r)
+			} else {
+				v, err = netpbmInt(r)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("read pixel %d: %w", i, err)
+			}
+			mask.Data[i] = min(float64(v)/float64(maxValue), 1)
+		}
+	}
+	return mask, nil
+}
+
+// netpbmInt reads the next decimal number, skipping whitespace and
+// comments.
+func netpbmInt(r *bufio.Reader) (int, error) {
+	var digits []byte
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF && len(digits) > 0 {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case b == '#' && len(digits) == 0:
+			if _, err := r.ReadString('\n'); err != nil && err != io.EOF {
+				return 0, err
+			}
+		case b >= '0' && b <= '9':
+			digits = append(digits, b)
+		case isSpace(b) && len(digits) == 0:
+		case isSpace(b):
+			return strconv.Atoi(string(digits))
+		default:
+			return 0, fmt.Errorf("unexpected byte %q", b)
+		}
+	}
+	return strconv.Atoi(string(digits))
+}
+
+// pbmBit reads one plain PBM pixel; they may be written without spaces.
+func pbmBit(r *bufio.Reader) (int, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case b == '#':
+			if _, err := r.ReadString('\n'); err != nil && err != io.EOF {
+				return 0, err
+			}
+		case b == '0' || b == '1':
+			return int(b - '0'), nil
+		case !isSpace(b):
+			return 0, fmt.Errorf("unexpected byte %q", b)
+		}
+	}
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f'
+}
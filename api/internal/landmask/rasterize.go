@@ -0,0 +1,110 @@
+package landmask
+
+import (
+	"cmp"
+	"math"
+	"slices"
+
+	mapascii "github.com/Kivayan/map-ascii"
+
+	"map-ascii-generator/api/internal/geo"
+)
+
+// Rasterize draws lon/lat polygons onto a width by height mask. Each pixel
+// is sampled supersample times in each direction, so coastlines get
+// fractional values. Overlapping polygons are merged.
+func Rasterize(polygons []geo.Polygon, width int, height int, supersample int) *mapascii.LandMask {
+	cols, rows := width*supersample, height*supersample
+	covered := make([]uint64, (cols*rows+63)/64)
+	for _, polygon := range polygons {
+		fillPolygon(covered, polygon, cols, rows)
+	}
+
+	mask := &mapascii.LandMask{Width: width, Height: height, Data: make([]float64, width*height)}
+	samples := float64(supersample * supersample)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			count := 0
+			for sy := 0; sy < supersample; sy++ {
+				start := (y*supersample+sy)*cols + x*supersample
+				for i := start; i < start+supersample; i++ {
+					count += int(covered[i/64] >> (i % 64) & 1)
+				}
+			}
+			mask.Data[y*width+x] = float64(count) / samples
+		}
+	}
+	return mask
+}
+
+type edge struct {
+	x0, y0, x1, y1 float64
+}
+
+// fillPolygon sets the samples whose centers fall inside the polygon, by the
+// even-odd rule over all of its rings, scanning rows with an active edge
+// list.
+func fillPolygon(covered []uint64, polygon geo.Polygon, cols int, rows int) {
+	var edges []edge
+	for _, ring := range polygon {
+		for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+			x0, y0 := (ring[j].Lon()+180)/360*float64(cols), (90-ring[j].Lat())/180*float64(rows)
+			x1, y1 := (ring[i].Lon()+180)/360*float64(cols), (90-ring[i].Lat())/180*float64(rows)
+			if y0 == y1 {
+				continue
+			}
+			if y0 > y1 {
+				x0, y0, x1, y1 = x1, y1, x0, y0
+			}
+			edges = append(edges, edge{x0, y0, x1, y1})
+		}
+	}
+	if len(edges) == 0 {
+		return
+	}
+	slices.SortFunc(edges, func(a, b edge) int { return cmp.Compare(a.y0, b.y0) })
+
+	var active []edge
+	var crossings []float64
+	next := 0
+	first := max(0, int(math.Ceil(edges[0].y0-0.5)))
+	for row := first; row < rows; row++ {
+		center := float64(row) + 0.5
+		for next < len(edges) && edges[next].y0 <= center {
+			active = append(active, edges[next])
+			next++
+		}
+		active = slices.DeleteFunc(active, func(e edge) bool { return e.y1 <= center })
+		if len(active) == 0 {
+			if next == len(edges) {
+				return
+			}
+			continue
+		}
+
+		crossings = crossings[:0]
+		for _, e := range active {
+			crossings = append(crossings, e.x0+(center-e.y0)*(e.x1-e.x0)/(e.y1-e.y0))
+		}
+		slices.Sort(crossings)
+		for i := 0; i+1 < len(crossings); i += 2 {
+			from := max(0, int(math.Ceil(crossings[i]-0.5)))
+			to := min(cols, int(math.Ceil(crossings[i+1]-0.5)))
+			setBits(covered, row*cols+from, row*cols+to)
+		}
+	}
+}
+
+// setBits sets bits from through to-1.
+func setBits(covered []uint64, from int, to int) {
+	for i := from; i < to; {
+		if i%64 == 0 && to-i >= 64 {
+			covered[i/64] = math.MaxUint64
+			i += 64
+			continue
+		}
+		n := min(64-i%64, to-i)
+		covered[i/64] |= (math.MaxUint64 >> (64 - n)) << (i % 64)
+		i += n
+	}
+}
@@ -0,0 +1,207 @@
+package mmdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// maxDepth bounds nesting so a corrupt file cannot recurse forever.
+const maxDepth = 64
+
+// decoder reads values from a data section. Pointers are offsets from the
+// start of buf.
+type decoder struct {
+	buf []byte
+}
+
+// decode returns the value at offset and the offset just past it.
+func (d decoder) decode(offset int) (any, int, error) {
+	return d.value(offset, 0)
+}
+
+func (d decoder) value(offset int, depth int) (any, int, error) {
+	if depth > maxDepth {
+		return nil, 0, fmt.Errorf("data nested too deeply")
+	}
+
+	kind, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if kind == typePointer {
+		target, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.value(target, depth+1)
+		return value, next, err
+	}
+
+	switch kind {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := 0; i < size; i++ {
+			var key, value any
+			if key, offset, err = d.value(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key at offset %d is not a string", offset)
+			}
+			if value, offset, err = d.value(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			m[name] = value
+		}
+		return m, offset, nil
+	case typeArray:
+		list := make([]any, 0, min(size, 1024))
+		for i := 0; i < size; i++ {
+			var value any
+			if value, offset, err = d.value(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			list = append(list, value)
+		}
+		return list, offset, nil
+	case typeBool:
+		if size > 1 {
+			return nil, 0, fmt.Errorf("invalid bool size %d", size)
+		}
+		return size == 1, offset, nil
+	}
+
+	if offset+size > len(d.buf) {
+		return nil, 0, fmt.Errorf("value at offset %d runs past the data section", offset)
+	}
+	b := d.buf[offset : offset+size]
+	next := offset + size
+
+	switch kind {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("invalid unsigned integer size %d", size)
+		}
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid int32 size %d", size)
+		}
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		if size == 4 {
+			return int64(int32(n)), next, nil
+		}
+		return int64(n), next, nil
+	case typeUint128:
+		return append([]byte(nil), b...), next, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d at offset %d", kind, offset)
+	}
+}
+
+// control reads a control byte and its extended type and size bytes.
+func (d decoder) control(offset int) (int, int, int, error) {
+	if offset < 0 || offset >= len(d.buf) {
+		return 0, 0, 0, fmt.Errorf("offset %d outside the data section", offset)
+	}
+	ctrl := d.buf[offset]
+	offset++
+
+	kind := int(ctrl >> 5)
+	if kind == typeExtended {
+		if offset >= len(d.buf) {
+			return 0, 0, 0, fmt.Errorf("truncated extended type")
+		}
+		kind = 7 + int(d.buf[offset])
+		offset++
+	}
+
+	size := int(ctrl & 0x1f)
+	if kind == typePointer || size < 29 {
+		return kind, size, offset, nil
+	}
+
+	extra := size - 28
+	if offset+extra > len(d.buf) {
+		return 0, 0, 0, fmt.Errorf("truncated size")
+	}
+	n := 0
+	for _, c := range d.buf[offset : offset+extra] {
+		n = n<<8 | int(c)
+	}
+	switch extra {
+	case 1:
+		size = 29 + n
+	case 2:
+		size = 285 + n
+	default:
+		size = 65821 + n
+	}
+	return kind, size, offset + extra, nil
+}
+
+// pointer decodes a pointer whose control byte carried size bits, returning
+// the target offset and the offset after the pointer.
+func (d decoder) pointer(size int, offset int) (int, int, error) {
+	length := (size>>3)&3 + 1
+	if offset+length > len(d.buf) {
+		return 0, 0, fmt.Errorf("truncated pointer")
+	}
+	n := 0
+	if length < 4 {
+		n = size & 7
+	}
+	for _, c := range d.buf[offset : offset+length] {
+		n = n<<8 | int(c)
+	}
+	switch length {
+	case 2:
+		n += 2048
+	case 3:
+		n += 526336
+	}
+	return n, offset + length, nil
+}
@@ -0,0 +1,180 @@
+// Package mmdb reads MaxMind DB files (GeoLite2, DB-IP lite and other
+// databases in the same format) without memory mapping or external
+// dependencies. Only lookups are supported.
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"os"
+)
+
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// maxMetadataSize is how far from the end of the file the metadata marker
+// may start, as set by the format specification.
+const maxMetadataSize = 128 * 1024
+
+type Metadata struct {
+	DatabaseType string
+	IPVersion    int
+	RecordSize   int
+	NodeCount    int
+	BuildEpoch   uint64
+}
+
+type Reader struct {
+	buf       []byte
+	meta      Metadata
+	data      decoder
+	ipv4Start int
+}
+
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read mmdb file: %w", err)
+	}
+	r, err := New(buf)
+	if err != nil {
+		return nil, fmt.Errorf("parse mmdb file %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// New parses a database held in memory. buf must not be modified afterwards.
+func New(buf []byte) (*Reader, error) {
+	tail := buf[max(len(buf)-maxMetadataSize, 0):]
+	idx := bytes.LastIndex(tail, metadataMarker)
+	if idx < 0 {
+		return nil, fmt.Errorf("metadata marker not found")
+	}
+	metaStart := len(buf) - len(tail) + idx + len(metadataMarker)
+
+	raw, _, err := decoder{buf: buf[metaStart:]}.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("metadata is not a map")
+	}
+
+	meta := Metadata{
+		DatabaseType: stringField(fields, "database_type"),
+		IPVersion:    int(uintField(fields, "ip_version")),
+		RecordSize:   int(uintField(fields, "record_size")),
+		NodeCount:    int(uintField(fields, "node_count")),
+		BuildEpoch:   uintField(fields, "build_epoch"),
+	}
+	if meta.RecordSize != 24 && meta.RecordSize != 28 && meta.RecordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", meta.RecordSize)
+	}
+	if meta.IPVersion != 4 && meta.IPVersion != 6 {
+		return nil, fmt.Errorf("unsupported ip version %d", meta.IPVersion)
+	}
+
+	treeSize := meta.NodeCount * meta.RecordSize / 4
+	dataStart := treeSize + 16
+	if meta.NodeCount <= 0 || dataStart > metaStart-len(metadataMarker) {
+		return nil, fmt.Errorf("search tree exceeds file size")
+	}
+
+	r := &Reader{
+		buf:  buf,
+		meta: meta,
+		data: decoder{buf: buf[dataStart : metaStart-len(metadataMarker)]},
+	}
+
+	// IPv4 addresses live under ::/96 in IPv6 databases; walking the 96
+	// zero bits once saves doing it on every lookup.
+	if meta.IPVersion == 6 {
+		for i := 0; i < 96 && r.ipv4Start < meta.NodeCount; i++ {
+			if r.ipv4Start, err = r.record(r.ipv4Start, 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return r, nil
+}
+
+func (r *Reader) Metadata() Metadata {
+	return r.meta
+}
+
+// Lookup returns the record for ip, decoded into maps, slices, strings,
+// bools and numbers (uint64, int64 or float64; 128-bit values as []byte).
+// found is false when the database has no entry for the address.
+func (r *Reader) Lookup(ip netip.Addr) (record any, found bool, err error) {
+	ip = ip.Unmap()
+	var bits []byte
+	node := 0
+	switch {
+	case ip.Is4():
+		addr := ip.As4()
+		bits = addr[:]
+		node = r.ipv4Start
+	case r.meta.IPVersion == 4:
+		return nil, false, nil
+	default:
+		addr := ip.As16()
+		bits = addr[:]
+	}
+
+	for i := 0; i < len(bits)*8 && node < r.meta.NodeCount; i++ {
+		bit := int(bits[i/8]>>(7-i%8)) & 1
+		if node, err = r.record(node, bit); err != nil {
+			return nil, false, err
+		}
+	}
+
+	switch {
+	case node == r.meta.NodeCount:
+		return nil, false, nil
+	case node < r.meta.NodeCount:
+		return nil, false, fmt.Errorf("search tree is deeper than the address")
+	}
+
+	offset := node - r.meta.NodeCount - 16
+	value, _, err := r.data.decode(offset)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a tree node.
+func (r *Reader) record(node int, bit int) (int, error) {
+	size := r.meta.RecordSize / 4
+	start := node * size
+	if start+size > len(r.buf) {
+		return 0, fmt.Errorf("node %d outside the search tree", node)
+	}
+	b := r.buf[start : start+size]
+
+	switch r.meta.RecordSize {
+	case 24:
+		b = b[bit*3:]
+		return int(b[0])<<16 | int(b[1])<<8 | int(b[2]), nil
+	case 28:
+		if bit == 0 {
+			return int(b[3]&0xf0)<<20 | int(b[0])<<16 | int(b[1])<<8 | int(b[2]), nil
+		}
+		return int(b[3]&0x0f)<<24 | int(b[4])<<16 | int(b[5])<<8 | int(b[6]), nil
+	default:
+		return int(binary.BigEndian.Uint32(b[bit*4:])), nil
+	}
+}
+
+func stringField(fields map[string]any, key string) string {
+	value, _ := fields[key].(string)
+	return value
+}
+
+func uintField(fields map[string]any, key string) uint64 {
+	value, _ := fields[key].(uint64)
+	return value
+}
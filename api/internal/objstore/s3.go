@@ -0,0 +1,165 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const DefaultS3Endpoint = "https://s3.amazonaws.com"
+
+// S3 uploads objects to Amazon S3 or a service speaking its API, such as
+// Google Cloud Storage with HMAC keys, MinIO or Cloudflare R2. Requests are
+// signed with AWS Signature Version 4.
+type S3 struct {
+	Endpoint  *url.URL
+	Region    string
+	AccessKey string
+	SecretKey string
+	// PathStyle puts the bucket in the path instead of the host name, as
+	// most self-hosted services need.
+	PathStyle bool
+	Client    *http.Client
+}
+
+func NewS3(endpoint string, region string, accessKey string, secretKey string, pathStyle bool) (*S3, error) {
+	if endpoint == "" {
+		endpoint = DefaultS3Endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("storage endpoint must be an http or https URL")
+	}
+	if region == "" {
+		return nil, fmt.Errorf("storage region must not be empty")
+	}
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("storage access key and secret key must be set")
+	}
+
+	return &S3{
+		Endpoint:  u,
+		Region:    region,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		PathStyle: pathStyle,
+		Client:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Put stores body under key in bucket, replacing any existing object.
+func (s *S3) Put(ctx context.Context, bucket string, key string, body []byte, contentType string) error {
+	target := *s.Endpoint
+	escapedKey := escapePath(key)
+	if s.PathStyle {
+		base := strings.TrimSuffix(target.EscapedPath(), "/")
+		target.Path = strings.TrimSuffix(target.Path, "/") + "/" + bucket + "/" + key
+		target.RawPath = base + "/" + escapePath(bucket) + "/" + escapedKey
+	} else {
+		target.Host = bucket + "." + target.Host
+		target.Path = "/" + key
+		target.RawPath = "/" + escapedKey
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, body, time.Now().UTC())
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("PUT %s/%s: %s: %s", bucket, key, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// Ping checks that the endpoint answers HTTP. Any response counts, since
+// an unsigned request to the service root is refused by most providers.
+func (s *S3) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, s.Endpoint.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// sign adds the SigV4 Authorization header for a request with no query.
+func (s *S3) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256Hex(body)
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		"content-type:" + req.Header.Get("Content-Type"),
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), day)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.AccessKey, scope, signedHeaders, signature))
+}
+
+// escapePath encodes each segment of an object key as SigV4 expects: every
+// byte except unreserved characters, keeping the slashes.
+func escapePath(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,254 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Default              any                `json:"default,omitempty"`
+
+	missing []string
+}
+
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+var (
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+	timeType       = reflect.TypeOf(time.Time{})
+)
+
+// SchemaOf derives a schema from a Go type using its json struct tags, so the
+// document follows the request/response structs the handlers decode into.
+func SchemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == rawMessageType {
+		return &Schema{}
+	}
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: SchemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: SchemaOf(t.Elem())}
+	case reflect.Struct:
+		schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if embedded, ok := embeddedStruct(field); ok {
+				// encoding/json promotes the fields of untagged embedded structs.
+				inner := SchemaOf(embedded)
+				for name, prop := range inner.Properties {
+					schema.Properties[name] = prop
+				}
+				schema.Required = append(schema.Required, inner.Required...)
+				continue
+			}
+			name, omitEmpty, ok := jsonName(field)
+			if !ok {
+				continue
+			}
+			schema.Properties[name] = SchemaOf(field.Type)
+			if !omitEmpty {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+		sort.Strings(schema.Required)
+		return schema
+	default:
+		return &Schema{}
+	}
+}
+
+// SetDefaults records the values of v as schema defaults, recursing into
+// nested objects.
+func (s *Schema) SetDefaults(v any) {
+	s.setDefaults(reflect.ValueOf(v))
+}
+
+func (s *Schema) setDefaults(v reflect.Value) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	if (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.IsNil() {
+		return
+	}
+	if v.Kind() != reflect.Struct {
+		s.Default = v.Interface()
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, ok := jsonName(t.Field(i))
+		if !ok {
+			continue
+		}
+		if prop, ok := s.Properties[name]; ok {
+			prop.setDefaults(v.Field(i))
+		}
+	}
+}
+
+// Property walks nested object properties. A missing segment is recorded
+// for Err and a detached schema returned, so that chained calls describing
+// a renamed field do not panic.
+func (s *Schema) Property(path ...string) *Schema {
+	current := s
+	for _, name := range path {
+		next, ok := current.Properties[name]
+		if !ok {
+			s.missing = append(s.missing, strings.Join(path, "."))
+			return &Schema{}
+		}
+		current = next
+	}
+	return current
+}
+
+// Item is the schema of the items of an array, recorded for Err and
+// detached like a missing property when s is not an array.
+func (s *Schema) Item() *Schema {
+	if s.Items == nil {
+		s.missing = append(s.missing, "[]")
+		return &Schema{}
+	}
+	return s.Items
+}
+
+// Err reports the properties asked of s or of its nested schemas that do
+// not exist.
+func (s *Schema) Err() error {
+	var missing []string
+	s.collectMissing("", &missing)
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("no such properties: %s", strings.Join(missing, ", "))
+}
+
+func (s *Schema) collectMissing(prefix string, missing *[]string) {
+	for _, path := range s.missing {
+		*missing = append(*missing, prefix+path)
+	}
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s.Properties[name].collectMissing(prefix+name+".", missing)
+	}
+	if s.Items != nil {
+		s.Items.collectMissing(prefix+"[].", missing)
+	}
+	if s.AdditionalProperties != nil {
+		s.AdditionalProperties.collectMissing(prefix+"*.", missing)
+	}
+}
+
+func (s *Schema) Range(minimum float64, maximum float64) *Schema {
+	s.Minimum = &minimum
+	s.Maximum = &maximum
+	return s
+}
+
+func (s *Schema) Length(minLength int, maxLength int) *Schema {
+	s.MinLength = &minLength
+	s.MaxLength = &maxLength
+	return s
+}
+
+func (s *Schema) Describe(description string) *Schema {
+	s.Description = description
+	return s
+}
+
+func (s *Schema) EnumStrings(values []string) *Schema {
+	s.Enum = make([]any, 0, len(values))
+	for _, value := range values {
+		s.Enum = append(s.Enum, value)
+	}
+	return s
+}
+
+func embeddedStruct(field reflect.StructField) (reflect.Type, bool) {
+	t := field.Type
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if !field.Anonymous || t.Kind() != reflect.Struct {
+		return nil, false
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return t, name == ""
+}
+
+func jsonName(field reflect.StructField) (string, bool, bool) {
+	if !field.IsExported() {
+		return "", false, false
+	}
+
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+
+	name, opts, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+
+	return name, strings.Contains(opts, "omitempty"), true
+}
+
+// Optional clears required markers recursively, for request bodies where every
+// field has a server-side default.
+func (s *Schema) Optional() *Schema {
+	s.Required = nil
+	for _, prop := range s.Properties {
+		prop.Optional()
+	}
+	if s.Items != nil {
+		s.Items.Optional()
+	}
+	return s
+}
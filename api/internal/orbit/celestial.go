@@ -0,0 +1,59 @@
+package orbit
+
+import (
+	"math"
+	"time"
+)
+
+const degrees = math.Pi / 180
+
+// SubsolarPoint returns the longitude and latitude, in degrees, where the
+// Sun is directly overhead at t. It uses the low-precision solar
+// coordinates of the Astronomical Almanac, good to about 0.01° for
+// 1950-2050.
+func SubsolarPoint(t time.Time) (lon, lat float64) {
+	n := julianDate(t) - 2451545.0
+	meanLon := 280.460 + 0.9856474*n
+	anomaly := (357.528 + 0.9856003*n) * degrees
+	eclipticLon := (meanLon + 1.915*math.Sin(anomaly) + 0.020*math.Sin(2*anomaly)) * degrees
+	obliquity := (23.439 - 0.0000004*n) * degrees
+
+	ra := math.Atan2(math.Cos(obliquity)*math.Sin(eclipticLon), math.Cos(eclipticLon))
+	dec := math.Asin(math.Sin(obliquity) * math.Sin(eclipticLon))
+	return subPoint(ra, dec, t)
+}
+
+// SublunarPoint returns the longitude and latitude, in degrees, where the
+// Moon is directly overhead at t, as seen from the center of the Earth.
+// The Almanac's low-precision lunar series is good to about 0.3°.
+func SublunarPoint(t time.Time) (lon, lat float64) {
+	c := (julianDate(t) - 2451545.0) / 36525
+	sin := func(a, b float64) float64 { return math.Sin((a + b*c) * degrees) }
+
+	eclipticLon := 218.32 + 481267.881*c +
+		6.29*sin(135.0, 477198.87) - 1.27*sin(259.3, -413335.36) +
+		0.66*sin(235.7, 890534.22) + 0.21*sin(269.9, 954397.74) -
+		0.19*sin(357.5, 35999.05) - 0.11*sin(186.5, 966404.03)
+	eclipticLat := 5.13*sin(93.3, 483202.02) + 0.28*sin(228.2, 960400.89) -
+		0.28*sin(318.3, 6003.15) - 0.17*sin(217.6, -407332.21)
+
+	lambda, beta := eclipticLon*degrees, eclipticLat*degrees
+	x := math.Cos(beta) * math.Cos(lambda)
+	y := 0.9175*math.Cos(beta)*math.Sin(lambda) - 0.3978*math.Sin(beta)
+	z := 0.3978*math.Cos(beta)*math.Sin(lambda) + 0.9175*math.Sin(beta)
+	return subPoint(math.Atan2(y, x), math.Asin(z), t)
+}
+
+// subPoint converts right ascension and declination in radians to the
+// point below the body at t.
+func subPoint(ra, dec float64, t time.Time) (lon, lat float64) {
+	lon = math.Mod(ra-gmst(t)+3*math.Pi, twoPi) - math.Pi
+	if lon < -math.Pi {
+		lon += twoPi
+	}
+	return lon / degrees, dec / degrees
+}
+
+func julianDate(t time.Time) float64 {
+	return float64(t.UnixNano())/86400e9 + 2440587.5
+}
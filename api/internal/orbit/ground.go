@@ -0,0 +1,53 @@
+package orbit
+
+import (
+	"math"
+	"time"
+)
+
+// WGS-84 ellipsoid used for the geodetic latitude of the sub-satellite point.
+const (
+	wgs84A = 6378.137
+	wgs84F = 1 / 298.257223563
+)
+
+// SubPoint returns the longitude and geodetic latitude, in degrees, of the
+// point on the ground directly below the satellite at t.
+func (s *Satellite) SubPoint(t time.Time) (lon, lat float64, err error) {
+	r, err := s.Position(t)
+	if err != nil {
+		return 0, 0, err
+	}
+	lon, lat = GroundPoint(r, t)
+	return lon, lat, nil
+}
+
+// GroundPoint converts a TEME position in km at t to longitude and geodetic
+// latitude in degrees.
+func GroundPoint(r [3]float64, t time.Time) (lon, lat float64) {
+	lon = math.Atan2(r[1], r[0]) - gmst(t)
+	lon = math.Mod(lon+3*math.Pi, twoPi) - math.Pi
+
+	// Iterate the geodetic latitude, which converges in a few steps.
+	e2 := wgs84F * (2 - wgs84F)
+	p := math.Hypot(r[0], r[1])
+	lat = math.Atan2(r[2], p)
+	for range 5 {
+		sinLat := math.Sin(lat)
+		c := 1 / math.Sqrt(1-e2*sinLat*sinLat)
+		lat = math.Atan2(r[2]+wgs84A*c*e2*sinLat, p)
+	}
+	return lon * 180 / math.Pi, lat * 180 / math.Pi
+}
+
+// gmst is the Greenwich mean sidereal time at t in radians (IAU-82).
+func gmst(t time.Time) float64 {
+	tut1 := (julianDate(t) - 2451545.0) / 36525
+	seconds := -6.2e-6*tut1*tut1*tut1 + 0.093104*tut1*tut1 +
+		(876600*3600+8640184.812866)*tut1 + 67310.54841
+	angle := math.Mod(seconds*math.Pi/180/240, twoPi)
+	if angle < 0 {
+		angle += twoPi
+	}
+	return angle
+}
@@ -0,0 +1,263 @@
+package orbit
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// WGS-72 constants, which SGP4 element sets are fitted against.
+const (
+	earthRadiusKm = 6378.135
+	xke           = 0.0743669161331734132 // sqrt(GM) in earth radii^1.5 per minute
+	j2            = 0.001082616
+	j3            = -0.00000253881
+	j4            = -0.00000165597
+	j3oj2         = j3 / j2
+	twoPi         = 2 * math.Pi
+	x2o3          = 2.0 / 3.0
+)
+
+// deepSpacePeriod is the orbital period in minutes from which SGP4 needs
+// the deep-space (SDP4) terms for lunar and solar perturbations.
+const deepSpacePeriod = 225.0
+
+// Satellite is an SGP4 model initialized from a TLE. It implements the
+// near-Earth branch of the Spacetrack Report #3 model as revised by
+// Vallado et al. (2006); deep-space orbits are rejected.
+type Satellite struct {
+	epoch time.Time
+
+	ecco, inclo, nodeo, argpo, mo, bstar, no float64
+
+	isimp                                       bool
+	aycof, con41, cc1, cc4, cc5, d2, d3, d4     float64
+	delmo, eta, argpdot, omgcof, sinmao, t2cof  float64
+	t3cof, t4cof, t5cof, x1mth2, x7thm1, mdot   float64
+	nodedot, xlcof, xmcof, nodecf, sinio, cosio float64
+}
+
+// NewSatellite initializes the model. It fails for deep-space orbits
+// (period of 225 minutes or more) and for elements that are already decayed.
+func NewSatellite(tle TLE) (*Satellite, error) {
+	noKozai := tle.MeanMotion * twoPi / 1440.0
+	if twoPi/noKozai >= deepSpacePeriod {
+		return nil, fmt.Errorf("orbital period of %.0f minutes needs the deep-space model, which is not supported", twoPi/noKozai)
+	}
+
+	s := &Satellite{
+		epoch: tle.Epoch,
+		ecco:  tle.Eccentricity,
+		inclo: tle.Inclination * math.Pi / 180,
+		nodeo: tle.RAAN * math.Pi / 180,
+		argpo: tle.ArgPerigee * math.Pi / 180,
+		mo:    tle.MeanAnomaly * math.Pi / 180,
+		bstar: tle.BStar,
+	}
+
+	// Recover the original mean motion and semi-major axis (un-Kozai).
+	eccsq := s.ecco * s.ecco
+	omeosq := 1 - eccsq
+	rteosq := math.Sqrt(omeosq)
+	s.cosio = math.Cos(s.inclo)
+	cosio2 := s.cosio * s.cosio
+	ak := math.Pow(xke/noKozai, x2o3)
+	d1 := 0.75 * j2 * (3*cosio2 - 1) / (rteosq * omeosq)
+	del := d1 / (ak * ak)
+	adel := ak * (1 - del*del - del*(1.0/3.0+134*del*del/81))
+	del = d1 / (adel * adel)
+	s.no = noKozai / (1 + del)
+
+	ao := math.Pow(xke/s.no, x2o3)
+	s.sinio = math.Sin(s.inclo)
+	po := ao * omeosq
+	con42 := 1 - 5*cosio2
+	s.con41 = -con42 - cosio2 - cosio2
+	posq := po * po
+	rp := ao * (1 - s.ecco)
+	if rp < 1 {
+		return nil, fmt.Errorf("perigee is below the surface of the Earth")
+	}
+
+	// Perigees below 220 km use a truncated drag model.
+	s.isimp = rp < 220/earthRadiusKm+1
+
+	sfour := 78/earthRadiusKm + 1
+	qzms24 := math.Pow((120-78)/earthRadiusKm, 4)
+	if perige := (rp - 1) * earthRadiusKm; perige < 156 {
+		sfour = perige - 78
+		if perige < 98 {
+			sfour = 20
+		}
+		qzms24 = math.Pow((120-sfour)/earthRadiusKm, 4)
+		sfour = sfour/earthRadiusKm + 1
+	}
+
+	pinvsq := 1 / posq
+	tsi := 1 / (ao - sfour)
+	s.eta = ao * s.ecco * tsi
+	etasq := s.eta * s.eta
+	eeta := s.ecco * s.eta
+	psisq := math.Abs(1 - etasq)
+	coef := qzms24 * math.Pow(tsi, 4)
+	coef1 := coef / math.Pow(psisq, 3.5)
+	cc2 := coef1 * s.no * (ao*(1+1.5*etasq+eeta*(4+etasq)) +
+		0.375*j2*tsi/psisq*s.con41*(8+3*etasq*(8+etasq)))
+	s.cc1 = s.bstar * cc2
+	cc3 := 0.0
+	if s.ecco > 1e-4 {
+		cc3 = -2 * coef * tsi * j3oj2 * s.no * s.sinio / s.ecco
+	}
+	s.x1mth2 = 1 - cosio2
+	s.cc4 = 2 * s.no * coef1 * ao * omeosq *
+		(s.eta*(2+0.5*etasq) + s.ecco*(0.5+2*etasq) -
+			j2*tsi/(ao*psisq)*(-3*s.con41*(1-2*eeta+etasq*(1.5-0.5*eeta))+
+				0.75*s.x1mth2*(2*etasq-eeta*(1+etasq))*math.Cos(2*s.argpo)))
+	s.cc5 = 2 * coef1 * ao * omeosq * (1 + 2.75*(etasq+eeta) + eeta*etasq)
+
+	cosio4 := cosio2 * cosio2
+	temp1 := 1.5 * j2 * pinvsq * s.no
+	temp2 := 0.5 * temp1 * j2 * pinvsq
+	temp3 := -0.46875 * j4 * pinvsq * pinvsq * s.no
+	s.mdot = s.no + 0.5*temp1*rteosq*s.con41 + 0.0625*temp2*rteosq*(13-78*cosio2+137*cosio4)
+	s.argpdot = -0.5*temp1*con42 + 0.0625*temp2*(7-114*cosio2+395*cosio4) +
+		temp3*(3-36*cosio2+49*cosio4)
+	xhdot1 := -temp1 * s.cosio
+	s.nodedot = xhdot1 + (0.5*temp2*(4-19*cosio2)+2*temp3*(3-7*cosio2))*s.cosio
+	s.omgcof = s.bstar * cc3 * math.Cos(s.argpo)
+	if s.ecco > 1e-4 {
+		s.xmcof = -x2o3 * coef * s.bstar / eeta
+	}
+	s.nodecf = 3.5 * omeosq * xhdot1 * s.cc1
+	s.t2cof = 1.5 * s.cc1
+	if math.Abs(s.cosio+1) > 1.5e-12 {
+		s.xlcof = -0.25 * j3oj2 * s.sinio * (3 + 5*s.cosio) / (1 + s.cosio)
+	} else {
+		s.xlcof = -0.25 * j3oj2 * s.sinio * (3 + 5*s.cosio) / 1.5e-12
+	}
+	s.aycof = -0.5 * j3oj2 * s.sinio
+	s.delmo = math.Pow(1+s.eta*math.Cos(s.mo), 3)
+	s.sinmao = math.Sin(s.mo)
+	s.x7thm1 = 7*cosio2 - 1
+
+	if !s.isimp {
+		cc1sq := s.cc1 * s.cc1
+		s.d2 = 4 * ao * tsi * cc1sq
+		temp := s.d2 * tsi * s.cc1 / 3
+		s.d3 = (17*ao + sfour) * temp
+		s.d4 = 0.5 * temp * ao * tsi * (221*ao + 31*sfour) * s.cc1
+		s.t3cof = s.d2 + 2*cc1sq
+		s.t4cof = 0.25 * (3*s.d3 + s.cc1*(12*s.d2+10*cc1sq))
+		s.t5cof = 0.2 * (3*s.d4 + 12*s.cc1*s.d3 + 6*s.d2*s.d2 + 15*cc1sq*(2*s.d2+cc1sq))
+	}
+
+	return s, nil
+}
+
+// Epoch is the time the element set was fitted for.
+func (s *Satellite) Epoch() time.Time {
+	return s.epoch
+}
+
+// Position returns the satellite position at t in the TEME frame, in km.
+// It fails when the model breaks down, typically because the element set
+// is far too old and the predicted orbit has decayed.
+func (s *Satellite) Position(t time.Time) ([3]float64, error) {
+	tsince := t.Sub(s.epoch).Minutes()
+
+	xmdf := s.mo + s.mdot*tsince
+	argpdf := s.argpo + s.argpdot*tsince
+	nodedf := s.nodeo + s.nodedot*tsince
+	argpm := argpdf
+	mm := xmdf
+	t2 := tsince * tsince
+	nodem := nodedf + s.nodecf*t2
+	tempa := 1 - s.cc1*tsince
+	tempe := s.bstar * s.cc4 * tsince
+	templ := s.t2cof * t2
+
+	if !s.isimp {
+		delomg := s.omgcof * tsince
+		delm := s.xmcof * (math.Pow(1+s.eta*math.Cos(xmdf), 3) - s.delmo)
+		temp := delomg + delm
+		mm = xmdf + temp
+		argpm = argpdf - temp
+		t3 := t2 * tsince
+		t4 := t3 * tsince
+		tempa = tempa - s.d2*t2 - s.d3*t3 - s.d4*t4
+		tempe += s.bstar * s.cc5 * (math.Sin(mm) - s.sinmao)
+		templ += s.t3cof*t3 + t4*(s.t4cof+tsince*s.t5cof)
+	}
+
+	am := math.Pow(xke/s.no, x2o3) * tempa * tempa
+	em := s.ecco - tempe
+	if em >= 1 || em < -0.001 || am < 0.95 || math.IsNaN(am) {
+		return [3]float64{}, fmt.Errorf("orbit decayed %.1f days after the element set epoch", tsince/1440)
+	}
+	em = math.Max(em, 1e-6)
+	mm += s.no * templ
+	xlm := mm + argpm + nodem
+	nodem = math.Mod(nodem, twoPi)
+	argpm = math.Mod(argpm, twoPi)
+	xlm = math.Mod(xlm, twoPi)
+	mm = math.Mod(xlm-argpm-nodem, twoPi)
+
+	// Long-period periodics.
+	axnl := em * math.Cos(argpm)
+	temp := 1 / (am * (1 - em*em))
+	aynl := em*math.Sin(argpm) + temp*s.aycof
+	xl := mm + argpm + nodem + temp*s.xlcof*axnl
+
+	// Solve Kepler's equation.
+	u := math.Mod(xl-nodem, twoPi)
+	eo1 := u
+	var sineo1, coseo1 float64
+	for i, step := 0, 1.0; i < 10 && math.Abs(step) >= 1e-12; i++ {
+		sineo1, coseo1 = math.Sin(eo1), math.Cos(eo1)
+		step = (u - aynl*coseo1 + axnl*sineo1 - eo1) / (1 - coseo1*axnl - sineo1*aynl)
+		step = math.Max(-0.95, math.Min(0.95, step))
+		eo1 += step
+	}
+	sineo1, coseo1 = math.Sin(eo1), math.Cos(eo1)
+
+	// Short-period preliminary quantities.
+	ecose := axnl*coseo1 + aynl*sineo1
+	esine := axnl*sineo1 - aynl*coseo1
+	el2 := axnl*axnl + aynl*aynl
+	pl := am * (1 - el2)
+	if pl < 0 {
+		return [3]float64{}, fmt.Errorf("semi-latus rectum is negative")
+	}
+	rl := am * (1 - ecose)
+	betal := math.Sqrt(1 - el2)
+	temp = esine / (1 + betal)
+	sinu := am / rl * (sineo1 - aynl - axnl*temp)
+	cosu := am / rl * (coseo1 - axnl + aynl*temp)
+	su := math.Atan2(sinu, cosu)
+	sin2u := (cosu + cosu) * sinu
+	cos2u := 1 - 2*sinu*sinu
+	temp = 1 / pl
+	temp1 := 0.5 * j2 * temp
+	temp2 := temp1 * temp
+
+	// Update for short-period periodics.
+	mrt := rl*(1-1.5*temp2*betal*s.con41) + 0.5*temp1*s.x1mth2*cos2u
+	su -= 0.25 * temp2 * s.x7thm1 * sin2u
+	xnode := nodem + 1.5*temp2*s.cosio*sin2u
+	xinc := s.inclo + 1.5*temp2*s.cosio*s.sinio*cos2u
+	if mrt < 1 {
+		return [3]float64{}, fmt.Errorf("orbit decayed %.1f days after the element set epoch", tsince/1440)
+	}
+
+	sinsu, cossu := math.Sin(su), math.Cos(su)
+	snod, cnod := math.Sin(xnode), math.Cos(xnode)
+	sini, cosi := math.Sin(xinc), math.Cos(xinc)
+	xmx := -snod * cosi
+	xmy := cnod * cosi
+	ux := xmx*sinsu + cnod*cossu
+	uy := xmy*sinsu + snod*cossu
+	uz := sini * sinsu
+
+	r := mrt * earthRadiusKm
+	return [3]float64{r * ux, r * uy, r * uz}, nil
+}
@@ -0,0 +1,141 @@
+// Package orbit propagates satellites from two-line element sets with SGP4
+// and converts their positions to points on the ground. It also locates the
+// points below the Sun and the Moon.
+package orbit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TLE holds the fields of a two-line element set that SGP4 uses. Angles are
+// in degrees and the mean motion in revolutions per day, as written.
+type TLE struct {
+	Name          string
+	CatalogNumber int
+	Epoch         time.Time
+	BStar         float64
+	Inclination   float64
+	RAAN          float64
+	Eccentricity  float64
+	ArgPerigee    float64
+	MeanAnomaly   float64
+	MeanMotion    float64
+}
+
+// ParseTLE reads a two-line element set, optionally preceded by a name line
+// (three-line format). Checksums are verified.
+func ParseTLE(text string) (TLE, error) {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if line = strings.TrimRight(line, " \t\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	var tle TLE
+	switch len(lines) {
+	case 2:
+	case 3:
+		tle.Name = strings.TrimSpace(strings.TrimPrefix(lines[0], "0 "))
+		lines = lines[1:]
+	default:
+		return TLE{}, fmt.Errorf("expected 2 or 3 lines, got %d", len(lines))
+	}
+
+	for i, line := range lines {
+		if len(line) != 69 || line[0] != byte('1'+i) {
+			return TLE{}, fmt.Errorf("line %d must be 69 characters starting with %d", i+1, i+1)
+		}
+		if sum := checksum(line[:68]); int(line[68]-'0') != sum {
+			return TLE{}, fmt.Errorf("line %d checksum mismatch: expected %d", i+1, sum)
+		}
+	}
+	l1, l2 := lines[0], lines[1]
+	if l1[2:7] != l2[2:7] {
+		return TLE{}, fmt.Errorf("catalog numbers of line 1 and 2 differ")
+	}
+
+	p := fieldParser{}
+	tle.CatalogNumber = int(p.float(l1[2:7], "catalog number"))
+	year := int(p.float(l1[18:20], "epoch year"))
+	day := p.float(l1[20:32], "epoch day")
+	tle.BStar = p.exponent(l1[53:61], "bstar")
+	tle.Inclination = p.float(l2[8:16], "inclination")
+	tle.RAAN = p.float(l2[17:25], "right ascension")
+	tle.Eccentricity = p.float("0."+strings.TrimSpace(l2[26:33]), "eccentricity")
+	tle.ArgPerigee = p.float(l2[34:42], "argument of perigee")
+	tle.MeanAnomaly = p.float(l2[43:51], "mean anomaly")
+	tle.MeanMotion = p.float(l2[52:63], "mean motion")
+	if p.err != nil {
+		return TLE{}, p.err
+	}
+
+	// Two-digit years follow the NORAD convention: 57-99 are 1900s.
+	if year < 57 {
+		year += 2000
+	} else {
+		year += 1900
+	}
+	tle.Epoch = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC).
+		Add(time.Duration((day - 1) * float64(24*time.Hour)))
+
+	if tle.MeanMotion <= 0 || tle.Eccentricity >= 1 {
+		return TLE{}, fmt.Errorf("mean motion must be positive and eccentricity below 1")
+	}
+	return tle, nil
+}
+
+func checksum(line string) int {
+	sum := 0
+	for _, c := range line {
+		switch {
+		case c >= '0' && c <= '9':
+			sum += int(c - '0')
+		case c == '-':
+			sum++
+		}
+	}
+	return sum % 10
+}
+
+// fieldParser keeps the first parse error so the fields can be read in a row.
+type fieldParser struct {
+	err error
+}
+
+func (p *fieldParser) float(raw string, name string) float64 {
+	value, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("invalid %s %q", name, raw)
+	}
+	return value
+}
+
+// exponent reads the packed "±NNNNN±E" notation for 0.NNNNN × 10^±E.
+func (p *fieldParser) exponent(raw string, name string) float64 {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0
+	}
+	sign := 1.0
+	switch raw[0] {
+	case '-':
+		sign, raw = -1, raw[1:]
+	case '+':
+		raw = raw[1:]
+	}
+	cut := strings.LastIndexAny(raw, "+-")
+	if cut <= 0 {
+		if p.err == nil {
+			p.err = fmt.Errorf("invalid %s %q", name, raw)
+		}
+		return 0
+	}
+	mantissa := p.float("0."+raw[:cut], name)
+	exp := p.float(raw[cut:], name)
+	return sign * mantissa * math.Pow(10, exp)
+}
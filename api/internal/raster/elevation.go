@@ -0,0 +1,31 @@
+package raster
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+)
+
+// grids holds the measured grids the Docker build resamples to 0.5 degrees
+// from pinned downloads. The repository ships none, so a plain go build
+// has no embedded grids unless they are placed here first.
+//
+//go:embed all:grids
+var grids embed.FS
+
+// EmbeddedElevation returns the embedded elevation model in meters, ocean
+// floor negative, or nil when the build did not embed one.
+func EmbeddedElevation() (*Grid, error) {
+	return embedded("grids/elevation.asc.gz")
+}
+
+func embedded(name string) (*Grid, error) {
+	data, err := grids.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
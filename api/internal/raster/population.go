@@ -0,0 +1,7 @@
+package raster
+
+// EmbeddedPopulation returns the embedded population density in people
+// per km² of land, or nil when the build did not embed one.
+func EmbeddedPopulation() (*Grid, error) {
+	return embedded("grids/population.asc.gz")
+}
@@ -0,0 +1,169 @@
+// Package raster reads coarse global grids, such as elevation models and
+// population density, in the ESRI ASCII raster format.
+package raster
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Grid holds cell values row by row from the north. Cells without data are
+// NaN.
+type Grid struct {
+	cols     int
+	rows     int
+	west     float64
+	south    float64
+	cellSize float64
+	values   []float64
+}
+
+func LoadFile(path string) (*Grid, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read grid file: %w", err)
+	}
+	grid, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse grid file %s: %w", path, err)
+	}
+	return grid, nil
+}
+
+// Parse reads an ESRI ASCII grid in WGS84 degrees, optionally gzipped. Both
+// corner and center origins are accepted.
+func Parse(data []byte) (*Grid, error) {
+	var r io.Reader = bytes.NewReader(data)
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	scanner.Split(bufio.ScanWords)
+
+	header := make(map[string]float64)
+	var first string
+	for scanner.Scan() {
+		key := strings.ToLower(scanner.Text())
+		if _, err := strconv.ParseFloat(key, 64); err == nil {
+			first = key
+			break
+		}
+		if !scanner.Scan() {
+			break
+		}
+		value, err := strconv.ParseFloat(scanner.Text(), 64)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: invalid value %q", key, scanner.Text())
+		}
+		header[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	g := &Grid{cols: int(header["ncols"]), rows: int(header["nrows"]), cellSize: header["cellsize"]}
+	if g.cols <= 0 || g.rows <= 0 || g.cellSize <= 0 {
+		return nil, fmt.Errorf("header must set positive ncols, nrows and cellsize")
+	}
+	switch {
+	case hasKey(header, "xllcorner") && hasKey(header, "yllcorner"):
+		g.west, g.south = header["xllcorner"], header["yllcorner"]
+	case hasKey(header, "xllcenter") && hasKey(header, "yllcenter"):
+		g.west, g.south = header["xllcenter"]-g.cellSize/2, header["yllcenter"]-g.cellSize/2
+	default:
+		return nil, fmt.Errorf("header must set xllcorner and yllcorner or xllcenter and yllcenter")
+	}
+	noData, hasNoData := header["nodata_value"]
+
+	g.values = make([]float64, 0, g.cols*g.rows)
+	parse := func(text string) error {
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("cell %d: invalid value %q", len(g.values), text)
+		}
+		if hasNoData && value == noData {
+			value = math.NaN()
+		}
+		g.values = append(g.values, value)
+		return nil
+	}
+	if first != "" {
+		if err := parse(first); err != nil {
+			return nil, err
+		}
+	}
+	for scanner.Scan() && len(g.values) < g.cols*g.rows {
+		if err := parse(scanner.Text()); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(g.values) != g.cols*g.rows {
+		return nil, fmt.Errorf("expected %d cells, found %d", g.cols*g.rows, len(g.values))
+	}
+
+	return g, nil
+}
+
+func hasKey(header map[string]float64, key string) bool {
+	_, ok := header[key]
+	return ok
+}
+
+// global reports whether the grid wraps around in longitude.
+func (g *Grid) global() bool {
+	return math.Abs(float64(g.cols)*g.cellSize-360) < g.cellSize/2
+}
+
+// Sample interpolates bilinearly between the centers of the four
+// surrounding cells, ignoring those without data. It reports false outside
+// the grid.
+func (g *Grid) Sample(lon float64, lat float64) (float64, bool) {
+	x := (lon-g.west)/g.cellSize - 0.5
+	y := (g.south+float64(g.rows)*g.cellSize-lat)/g.cellSize - 0.5
+	if y < -0.5 || y > float64(g.rows)-0.5 {
+		return 0, false
+	}
+	if !g.global() && (x < -0.5 || x > float64(g.cols)-0.5) {
+		return 0, false
+	}
+
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+	sum, weights := 0.0, 0.0
+	for _, c := range [4]struct{ dx, dy int }{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+		col, row := x0+c.dx, max(0, min(y0+c.dy, g.rows-1))
+		if g.global() {
+			col = ((col % g.cols) + g.cols) % g.cols
+		} else {
+			col = max(0, min(col, g.cols-1))
+		}
+		value := g.values[row*g.cols+col]
+		if math.IsNaN(value) {
+			continue
+		}
+		w := math.Abs(1-float64(c.dx)-fx) * math.Abs(1-float64(c.dy)-fy)
+		sum += w * value
+		weights += w
+	}
+	if weights == 0 {
+		return 0, false
+	}
+	return sum / weights, true
+}
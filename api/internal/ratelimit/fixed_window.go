@@ -1,7 +1,6 @@
 package ratelimit
 
 import (
-	"sync"
 	"time"
 )
 
@@ -10,45 +9,53 @@ type bucket struct {
 	count       int
 }
 
+// FixedWindowLimiter counts requests in windows that start at a client's
+// first request, so a client can send up to twice the limit around a window
+// boundary.
 type FixedWindowLimiter struct {
-	mu     sync.Mutex
-	limit  int
-	window time.Duration
-
+	base
 	buckets map[string]bucket
 }
 
-func NewFixedWindowLimiter(limit int, window time.Duration) *FixedWindowLimiter {
-	if limit <= 0 {
-		limit = 1
-	}
-	if window <= 0 {
-		window = time.Minute
-	}
-
-	return &FixedWindowLimiter{
-		limit:   limit,
-		window:  window,
+// NewFixedWindowLimiter returns a limiter that tracks at most maxBuckets
+// clients, DefaultMaxBuckets when maxBuckets <= 0. It drops expired buckets
+// in a background goroutine until Stop is called.
+func NewFixedWindowLimiter(limit int, window time.Duration, maxBuckets int) *FixedWindowLimiter {
+	l := &FixedWindowLimiter{
+		base:    newBase(limit, window, maxBuckets),
 		buckets: make(map[string]bucket),
 	}
+	go l.sweepLoop(l.sweep)
+	return l
 }
 
+// Allow reports whether key may make another request at now. A new key
+// that would exceed maxBuckets evicts the least recently used one.
 func (l *FixedWindowLimiter) Allow(key string, now time.Time) bool {
-	if key == "" {
-		key = "anonymous"
-	}
+	key = clientKey(key)
 
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	b, ok := l.buckets[key]
+	// Refusing new clients while full would let one caller lock everyone
+	// out by sending made-up addresses, so the least recently used client
+	// makes room instead, without sweeping under the lock: it is usually an
+	// expired bucket anyway.
+	for !ok && len(l.buckets) >= l.maxBuckets {
+		if !l.evict() {
+			break
+		}
+	}
 	if !ok || now.Sub(b.windowStart) >= l.window {
 		l.buckets[key] = bucket{windowStart: now, count: 1}
-		l.cleanup(now)
+		l.used.touch(key)
 		return true
 	}
 
+	l.used.touch(key)
 	if b.count >= l.limit {
+		l.reject(now)
 		return false
 	}
 
@@ -57,10 +64,76 @@ func (l *FixedWindowLimiter) Allow(key string, now time.Time) bool {
 	return true
 }
 
-func (l *FixedWindowLimiter) cleanup(now time.Time) {
+func (l *FixedWindowLimiter) Quota(key string, now time.Time) Quota {
+	key = clientKey(key)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok || now.Sub(b.windowStart) >= l.window {
+		return Quota{Limit: l.limit, Remaining: l.limit, Reset: now}
+	}
+	return Quota{Limit: l.limit, Remaining: max(l.limit-b.count, 0), Reset: b.windowStart.Add(l.window)}
+}
+
+func (l *FixedWindowLimiter) Stats(now time.Time, top int) Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var clients []ClientCount
+	for key, b := range l.buckets {
+		if now.Sub(b.windowStart) < l.window {
+			clients = append(clients, ClientCount{Key: key, Requests: b.count})
+		}
+	}
+	return l.stats(now, len(l.buckets), clients, top)
+}
+
+func (l *FixedWindowLimiter) Counters(now time.Time) []Counter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var counters []Counter
 	for key, b := range l.buckets {
-		if now.Sub(b.windowStart) >= l.window*2 {
+		if now.Sub(b.windowStart) < l.window {
+			counters = append(counters, Counter{Key: key, WindowStart: b.windowStart, Count: b.count})
+		}
+	}
+	return counters
+}
+
+func (l *FixedWindowLimiter) Restore(counters []Counter, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, c := range counters {
+		if _, ok := l.buckets[c.Key]; ok || now.Sub(c.WindowStart) >= l.window || len(l.buckets) >= l.maxBuckets {
+			continue
+		}
+		l.buckets[c.Key] = bucket{windowStart: c.WindowStart, count: c.Count}
+		l.used.touch(c.Key)
+	}
+}
+
+// sweep drops buckets whose window has ended; the next request of such a
+// client starts a new window anyway.
+func (l *FixedWindowLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.windowStart) >= l.window {
 			delete(l.buckets, key)
+			l.used.remove(key)
 		}
 	}
 }
+
+// evict drops the least recently used bucket, reporting whether there was
+// one.
+func (l *FixedWindowLimiter) evict() bool {
+	key, ok := l.used.leastRecent()
+	if ok {
+		delete(l.buckets, key)
+		l.used.remove(key)
+	}
+	return ok
+}
@@ -0,0 +1,272 @@
+package ratelimit
+
+import (
+	"cmp"
+	"container/list"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxBuckets bounds the clients a limiter tracks at once.
+const DefaultMaxBuckets = 100000
+
+// sweepInterval is how often expired buckets are dropped in the background.
+const sweepInterval = time.Minute
+
+// Algorithm names a limiter implementation.
+type Algorithm string
+
+const (
+	AlgorithmFixed   Algorithm = "fixed"
+	AlgorithmSliding Algorithm = "sliding"
+)
+
+var algorithms = []Algorithm{AlgorithmFixed, AlgorithmSliding}
+
+// ParseAlgorithm accepts an algorithm name in any case, AlgorithmFixed when
+// empty.
+func ParseAlgorithm(raw string) (Algorithm, error) {
+	value := Algorithm(strings.ToLower(strings.TrimSpace(raw)))
+	if value == "" {
+		return AlgorithmFixed, nil
+	}
+	if !slices.Contains(algorithms, value) {
+		names := make([]string, len(algorithms))
+		for i, a := range algorithms {
+			names[i] = string(a)
+		}
+		return "", fmt.Errorf("rate limit algorithm must be one of: %s", strings.Join(names, ", "))
+	}
+	return value, nil
+}
+
+// Limiter allows a number of requests per window and client key.
+type Limiter interface {
+	Allow(key string, now time.Time) bool
+	// Quota returns the quota of key at now without counting a request.
+	Quota(key string, now time.Time) Quota
+	// Stats returns the state of the limiter at now with up to top clients.
+	Stats(now time.Time, top int) Stats
+	// SetLimits changes the limit and window in place, keeping current
+	// counters.
+	SetLimits(limit int, window time.Duration)
+	// SetMaxBuckets changes the bucket cap in place. Buckets above a
+	// lowered cap stay until they expire or new clients evict them.
+	SetMaxBuckets(maxBuckets int)
+	// Counters returns the buckets still counting at now, to carry them
+	// over a restart.
+	Counters(now time.Time) []Counter
+	// Restore adds buckets saved by Counters of a limiter with the same
+	// algorithm and window. Buckets that expired by now, or whose clients
+	// are already tracked, are skipped, and so are all beyond the cap.
+	Restore(counters []Counter, now time.Time)
+	// Stop ends the background sweeper. The limiter keeps working, but
+	// expired buckets are then only dropped when the cap is reached.
+	Stop()
+}
+
+// New returns a limiter using algorithm.
+func New(algorithm Algorithm, limit int, window time.Duration, maxBuckets int) Limiter {
+	if algorithm == AlgorithmSliding {
+		return NewSlidingWindowLimiter(limit, window, maxBuckets)
+	}
+	return NewFixedWindowLimiter(limit, window, maxBuckets)
+}
+
+// Quota describes what a client has left in its current window.
+type Quota struct {
+	Limit     int
+	Remaining int
+	// Reset is when the current window ends, or the time asked about when
+	// the client has no window running.
+	Reset time.Time
+}
+
+// Stats is a snapshot of a limiter's state.
+type Stats struct {
+	Buckets    int
+	MaxBuckets int
+	// RejectedLastMinute counts the requests refused in the last full
+	// minute.
+	RejectedLastMinute int
+	RejectedTotal      uint64
+	// Top lists the clients with the most requests in their current
+	// window, busiest first.
+	Top []ClientCount
+}
+
+// Counter is the bucket of one client. Previous is only used by the
+// sliding window, where Count is the current window's count.
+type Counter struct {
+	Key         string    `json:"key"`
+	WindowStart time.Time `json:"window_start"`
+	Previous    int       `json:"previous,omitempty"`
+	Count       int       `json:"count"`
+}
+
+type ClientCount struct {
+	Key      string
+	Requests int
+}
+
+// base holds what the limiter implementations share: settings, rejection
+// counters and the background sweeper. Its fields are guarded by mu.
+type base struct {
+	mu         sync.Mutex
+	limit      int
+	window     time.Duration
+	maxBuckets int
+	used       recency
+
+	rejectedTotal  uint64
+	rejectMinute   time.Time
+	rejectCurrent  int
+	rejectPrevious int
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newBase(limit int, window time.Duration, maxBuckets int) base {
+	if limit <= 0 {
+		limit = 1
+	}
+	if window <= 0 {
+		window = time.Minute
+	}
+	if maxBuckets <= 0 {
+		maxBuckets = DefaultMaxBuckets
+	}
+	return base{limit: limit, window: window, maxBuckets: maxBuckets, used: newRecency(), stop: make(chan struct{})}
+}
+
+// recency orders the tracked keys from least to most recently used, so a
+// full limiter can make room for a new client without scanning its
+// buckets.
+type recency struct {
+	order *list.List
+	elems map[string]*list.Element
+}
+
+func newRecency() recency {
+	return recency{order: list.New(), elems: make(map[string]*list.Element)}
+}
+
+func (r *recency) touch(key string) {
+	if e, ok := r.elems[key]; ok {
+		r.order.MoveToBack(e)
+		return
+	}
+	r.elems[key] = r.order.PushBack(key)
+}
+
+func (r *recency) remove(key string) {
+	if e, ok := r.elems[key]; ok {
+		r.order.Remove(e)
+		delete(r.elems, key)
+	}
+}
+
+func (r *recency) leastRecent() (string, bool) {
+	e := r.order.Front()
+	if e == nil {
+		return "", false
+	}
+	return e.Value.(string), true
+}
+
+func (l *base) SetLimits(limit int, window time.Duration) {
+	if limit <= 0 {
+		limit = 1
+	}
+	if window <= 0 {
+		window = time.Minute
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = limit
+	l.window = window
+}
+
+func (l *base) SetMaxBuckets(maxBuckets int) {
+	if maxBuckets <= 0 {
+		maxBuckets = DefaultMaxBuckets
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.maxBuckets = maxBuckets
+}
+
+func (l *base) Stop() {
+	l.stopOnce.Do(func() { close(l.stop) })
+}
+
+// sweepLoop calls sweep with mu held every sweepInterval until Stop.
+func (l *base) sweepLoop(sweep func(now time.Time)) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case now := <-ticker.C:
+			l.mu.Lock()
+			sweep(now)
+			l.mu.Unlock()
+		}
+	}
+}
+
+func (l *base) reject(now time.Time) {
+	l.rollRejections(now)
+	l.rejectCurrent++
+	l.rejectedTotal++
+}
+
+// rollRejections moves the rejection counters to the minute of now.
+func (l *base) rollRejections(now time.Time) {
+	minute := now.Truncate(time.Minute)
+	switch {
+	case !minute.After(l.rejectMinute):
+		return
+	case minute.Sub(l.rejectMinute) == time.Minute:
+		l.rejectPrevious = l.rejectCurrent
+	default:
+		l.rejectPrevious = 0
+	}
+	l.rejectMinute, l.rejectCurrent = minute, 0
+}
+
+// stats fills the shared part of Stats and keeps the top busiest of
+// clients.
+func (l *base) stats(now time.Time, buckets int, clients []ClientCount, top int) Stats {
+	l.rollRejections(now)
+	slices.SortFunc(clients, func(a ClientCount, b ClientCount) int {
+		return cmp.Or(cmp.Compare(b.Requests, a.Requests), cmp.Compare(a.Key, b.Key))
+	})
+	if len(clients) > top {
+		clients = clients[:max(top, 0)]
+	}
+	return Stats{
+		Buckets:            buckets,
+		MaxBuckets:         l.maxBuckets,
+		RejectedLastMinute: l.rejectPrevious,
+		RejectedTotal:      l.rejectedTotal,
+		Top:                clients,
+	}
+}
+
+func clientKey(key string) string {
+	if key == "" {
+		return "anonymous"
+	}
+	return key
+}
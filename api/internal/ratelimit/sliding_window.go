@@ -0,0 +1,161 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+type slidingBucket struct {
+	windowStart time.Time
+	previous    int
+	current     int
+}
+
+// SlidingWindowLimiter approximates a window sliding with every request:
+// the previous fixed window's count is weighted by how much of it still
+// overlaps the sliding one. This smooths out the bursts a fixed window
+// allows at its boundary while keeping two counters per client.
+type SlidingWindowLimiter struct {
+	base
+	buckets map[string]slidingBucket
+}
+
+// NewSlidingWindowLimiter returns a limiter that tracks at most maxBuckets
+// clients, DefaultMaxBuckets when maxBuckets <= 0. It drops expired buckets
+// in a background goroutine until Stop is called.
+func NewSlidingWindowLimiter(limit int, window time.Duration, maxBuckets int) *SlidingWindowLimiter {
+	l := &SlidingWindowLimiter{
+		base:    newBase(limit, window, maxBuckets),
+		buckets: make(map[string]slidingBucket),
+	}
+	go l.sweepLoop(l.sweep)
+	return l
+}
+
+// Allow reports whether key may make another request at now. A new key
+// that would exceed maxBuckets evicts the least recently used one.
+func (l *SlidingWindowLimiter) Allow(key string, now time.Time) bool {
+	key = clientKey(key)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	// Refusing new clients while full would let one caller lock everyone
+	// out by sending made-up addresses, so the least recently used client
+	// makes room instead, without sweeping under the lock: it is usually an
+	// expired bucket anyway.
+	for !ok && len(l.buckets) >= l.maxBuckets {
+		if !l.evict() {
+			break
+		}
+	}
+
+	b = l.advance(b, now)
+	l.used.touch(key)
+	if l.estimate(b, now)+1 > float64(l.limit) {
+		l.buckets[key] = b
+		l.reject(now)
+		return false
+	}
+
+	b.current++
+	l.buckets[key] = b
+	return true
+}
+
+func (l *SlidingWindowLimiter) Quota(key string, now time.Time) Quota {
+	key = clientKey(key)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		return Quota{Limit: l.limit, Remaining: l.limit, Reset: now}
+	}
+	b = l.advance(b, now)
+	remaining := int(math.Floor(float64(l.limit) - l.estimate(b, now)))
+	return Quota{Limit: l.limit, Remaining: max(remaining, 0), Reset: b.windowStart.Add(l.window)}
+}
+
+func (l *SlidingWindowLimiter) Stats(now time.Time, top int) Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var clients []ClientCount
+	for key, b := range l.buckets {
+		if requests := int(math.Ceil(l.estimate(l.advance(b, now), now))); requests > 0 {
+			clients = append(clients, ClientCount{Key: key, Requests: requests})
+		}
+	}
+	return l.stats(now, len(l.buckets), clients, top)
+}
+
+func (l *SlidingWindowLimiter) Counters(now time.Time) []Counter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var counters []Counter
+	for key, b := range l.buckets {
+		if now.Sub(b.windowStart) < 2*l.window {
+			counters = append(counters, Counter{Key: key, WindowStart: b.windowStart, Previous: b.previous, Count: b.current})
+		}
+	}
+	return counters
+}
+
+func (l *SlidingWindowLimiter) Restore(counters []Counter, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, c := range counters {
+		if _, ok := l.buckets[c.Key]; ok || now.Sub(c.WindowStart) >= 2*l.window || len(l.buckets) >= l.maxBuckets {
+			continue
+		}
+		l.buckets[c.Key] = slidingBucket{windowStart: c.WindowStart, previous: c.Previous, current: c.Count}
+		l.used.touch(c.Key)
+	}
+}
+
+// advance moves b to the fixed window containing now.
+func (l *SlidingWindowLimiter) advance(b slidingBucket, now time.Time) slidingBucket {
+	start := now.Truncate(l.window)
+	switch {
+	case !start.After(b.windowStart):
+		return b
+	case start.Sub(b.windowStart) == l.window:
+		b.previous, b.current = b.current, 0
+	default:
+		b.previous, b.current = 0, 0
+	}
+	b.windowStart = start
+	return b
+}
+
+// estimate is the number of requests in the window ending at now.
+func (l *SlidingWindowLimiter) estimate(b slidingBucket, now time.Time) float64 {
+	overlap := 1 - float64(now.Sub(b.windowStart))/float64(l.window)
+	return float64(b.previous)*max(overlap, 0) + float64(b.current)
+}
+
+// sweep drops buckets with no requests in the current or previous window.
+func (l *SlidingWindowLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.windowStart) >= 2*l.window {
+			delete(l.buckets, key)
+			l.used.remove(key)
+		}
+	}
+}
+
+// evict drops the least recently used bucket, reporting whether there was
+// one.
+func (l *SlidingWindowLimiter) evict() bool {
+	key, ok := l.used.leastRecent()
+	if ok {
+		delete(l.buckets, key)
+		l.used.remove(key)
+	}
+	return ok
+}
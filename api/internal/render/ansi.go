@@ -0,0 +1,189 @@
+package render
+
+import "strings"
+
+const ansiReset = "\x1b[0m"
+
+type Palette struct {
+	Map       Color
+	Frame     Color
+	Marker    Color
+	Highlight Color
+	Border    Color
+	Graticule Color
+	Overlay   Color
+	Footer    Color
+	// MapBg, OceanBg and FrameBg are background colors for land cells,
+	// water cells and the frame border.
+	MapBg   Color
+	OceanBg Color
+	FrameBg Color
+	// MarkerAttrs, LabelAttrs and FrameAttrs add text attributes such as
+	// bold to marker glyphs, marker labels and the frame border.
+	MarkerAttrs Attrs
+	LabelAttrs  Attrs
+	FrameAttrs  Attrs
+	// MapGradient colors land by latitude band from north to south; it
+	// needs Options.Latitudes set to its length.
+	MapGradient []Color
+	// Choropleth colors choropleth buckets from low to high values.
+	Choropleth []Color
+	// Field colors field levels from low to high values.
+	Field []Color
+	// Density colors density levels from sparse to dense; levels past the
+	// end reuse the last color.
+	Density []Color
+}
+
+func (p Palette) empty() bool {
+	return p.Map.IsZero() && p.Frame.IsZero() && p.Marker.IsZero() && p.Highlight.IsZero() && p.Border.IsZero() && p.Graticule.IsZero() && p.Overlay.IsZero() && p.Footer.IsZero() && p.MapBg.IsZero() && p.OceanBg.IsZero() && p.FrameBg.IsZero() && p.MarkerAttrs == 0 && p.LabelAttrs == 0 && p.FrameAttrs == 0 && len(p.Density) == 0 && len(p.Choropleth) == 0 && len(p.Field) == 0 && len(p.MapGradient) == 0
+}
+
+func (p Palette) colorFor(cell Cell) Color {
+	switch cell.Layer {
+	case LayerMap:
+		return scaleColor(p.MapGradient, cell.Level).or(p.Map)
+	case LayerOcean:
+		return p.Map
+	case LayerHighlight:
+		return p.Highlight.or(p.Map)
+	case LayerChoropleth:
+		return scaleColor(p.Choropleth, cell.Level).or(p.Map)
+	case LayerField:
+		return scaleColor(p.Field, cell.Level).or(p.Map)
+	case LayerBorder:
+		return p.Border.or(p.Map)
+	case LayerGraticule:
+		return p.Graticule.or(p.Map)
+	case LayerDensity:
+		return scaleColor(p.Density, cell.Level).or(p.Overlay.or(p.Marker.or(p.Map)))
+	case LayerOverlay:
+		return p.Overlay.or(p.Marker.or(p.Map))
+	case LayerFrame:
+		return p.Frame
+	case LayerFooter:
+		return p.Footer.or(p.Frame)
+	case LayerMarker, LayerLabel:
+		return p.Marker.or(p.Map)
+	default:
+		return Color{}
+	}
+}
+
+func (p Palette) backgroundFor(cell Cell) Color {
+	switch {
+	case cell.Ground == GroundLand:
+		return p.MapBg
+	case cell.Ground == GroundWater:
+		return p.OceanBg
+	case cell.Layer == LayerFrame:
+		return p.FrameBg
+	default:
+		return Color{}
+	}
+}
+
+func (p Palette) attrsFor(cell Cell) Attrs {
+	switch cell.Layer {
+	case LayerMarker:
+		return p.MarkerAttrs
+	case LayerLabel:
+		return p.LabelAttrs
+	case LayerFrame:
+		return p.FrameAttrs
+	default:
+		return 0
+	}
+}
+
+// sgr joins the attribute, foreground and background parameters for cell.
+// sticky reports whether it sets attributes or a background, which a later
+// foreground-only sequence would not clear.
+func (p Palette) sgr(cell Cell, mode ColorMode) (seq string, sticky bool) {
+	attrs, bg := p.attrsFor(cell).sgr(), p.backgroundFor(cell).backgroundSGR(mode)
+	params := make([]string, 0, 3)
+	for _, param := range []string{attrs, p.colorFor(cell).sgr(mode), bg} {
+		if param != "" {
+			params = append(params, param)
+		}
+	}
+	return strings.Join(params, ";"), attrs != "" || bg != ""
+}
+
+func scaleColor(scale []Color, level uint8) Color {
+	if len(scale) == 0 || level == 0 {
+		return Color{}
+	}
+	return scale[min(int(level), len(scale))-1]
+}
+
+// ANSI encodes the canvas with SGR color sequences. Color changes are only
+// emitted between differently colored cells and every colored row ends with a
+// reset; changes away from a sequence with attributes or a background reset
+// first. Mode "never" or an empty palette yields the plain text.
+func (c *Canvas) ANSI(mode ColorMode, palette Palette) string {
+	if mode == ColorModeNever || mode == "" || palette.empty() {
+		return c.Plain()
+	}
+
+	var b strings.Builder
+	for rowIdx, row := range c.Rows {
+		current, currentSticky := "", false
+		for _, cell := range row {
+			seq, sticky := palette.sgr(cell, mode)
+			next := ""
+			if seq != "" {
+				next = "\x1b[" + seq + "m"
+			}
+			if next != current {
+				switch {
+				case next == "":
+					b.WriteString(ansiReset)
+				case currentSticky:
+					b.WriteString("\x1b[0;" + seq + "m")
+				default:
+					b.WriteString(next)
+				}
+				current, currentSticky = next, sticky
+			}
+			cell.write(&b)
+		}
+		if current != "" {
+			b.WriteString(ansiReset)
+		}
+		if rowIdx != len(c.Rows)-1 {
+			b.WriteByte('\n')
+		}
+	}
+
+	return b.String()
+}
+
+// StyledCell is a canvas cell as ANSI draws it.
+type StyledCell struct {
+	Text string
+	// SGR holds the attribute and color parameters, empty for the
+	// terminal default.
+	SGR string
+}
+
+// Styled returns the cells of every row with the SGR parameters ANSI uses
+// for them. The cell after a wide glyph has empty text, so cell indexes are
+// terminal columns.
+func (c *Canvas) Styled(mode ColorMode, palette Palette) [][]StyledCell {
+	colored := mode != ColorModeNever && mode != "" && !palette.empty()
+	rows := make([][]StyledCell, len(c.Rows))
+	for rowIdx, row := range c.Rows {
+		rows[rowIdx] = make([]StyledCell, len(row))
+		for col, cell := range row {
+			var b strings.Builder
+			cell.write(&b)
+			styled := StyledCell{Text: b.String()}
+			if colored {
+				styled.SGR, _ = palette.sgr(cell, mode)
+			}
+			rows[rowIdx][col] = styled
+		}
+	}
+	return rows
+}
@@ -0,0 +1,77 @@
+package render
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Attrs is a set of SGR text attributes.
+type Attrs uint8
+
+const (
+	AttrBold Attrs = 1 << iota
+	AttrUnderline
+	AttrBlink
+	AttrReverse
+)
+
+var attrs = []struct {
+	name string
+	attr Attrs
+	code int
+}{
+	{"bold", AttrBold, 1},
+	{"underline", AttrUnderline, 4},
+	{"blink", AttrBlink, 5},
+	{"reverse", AttrReverse, 7},
+}
+
+func AttrNames() []string {
+	names := make([]string, 0, len(attrs))
+	for _, a := range attrs {
+		names = append(names, a.name)
+	}
+	return names
+}
+
+// ParseAttrs combines attribute names such as "bold" and "underline".
+func ParseAttrs(names []string) (Attrs, error) {
+	var set Attrs
+	for _, raw := range names {
+		name := strings.ToLower(strings.TrimSpace(raw))
+		found := false
+		for _, a := range attrs {
+			if a.name == name {
+				set |= a.attr
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown attribute %q", raw)
+		}
+	}
+	return set, nil
+}
+
+// names lists the attributes in a, never nil.
+func (a Attrs) names() []string {
+	names := []string{}
+	for _, attr := range attrs {
+		if a&attr.attr != 0 {
+			names = append(names, attr.name)
+		}
+	}
+	return names
+}
+
+func (a Attrs) sgr() string {
+	var codes []string
+	for _, attr := range attrs {
+		if a&attr.attr != 0 {
+			codes = append(codes, strconv.Itoa(attr.code))
+		}
+	}
+	return strings.Join(codes, ";")
+}
@@ -0,0 +1,61 @@
+package render
+
+// Regions resolves a coordinate to a region index, or -1 when it lies
+// outside every region.
+type Regions interface {
+	Locate(lon float64, lat float64) int
+}
+
+type Borders struct {
+	Regions Regions
+	Char    rune
+}
+
+// regionIDs locates the center of every land cell. Ocean cells get -1 so
+// coastlines never count as borders.
+func regionIDs(grid *Grid, regions Regions, proj projection) []int {
+	ids := make([]int, len(grid.Cells))
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			i := y*grid.Width + x
+			ids[i] = -1
+			if grid.Cells[i].Layer != LayerMap {
+				continue
+			}
+			if lon, lat, ok := cellCenter(grid, proj, x, y); ok {
+				ids[i] = regions.Locate(wrapLongitude(lon), lat)
+			}
+		}
+	}
+	return ids
+}
+
+// drawBorders marks land cells whose right or lower neighbour is land of a
+// different region, which keeps borders one cell thick.
+func drawBorders(grid *Grid, borders Borders, proj projection) {
+	if borders.Regions == nil {
+		return
+	}
+
+	ids := regionIDs(grid, borders.Regions, proj)
+	differs := func(a int, x int, y int) bool {
+		if x >= grid.Width || y >= grid.Height {
+			return false
+		}
+		b := ids[y*grid.Width+x]
+		return b >= 0 && b != a
+	}
+
+	ch := runeOrDefault(borders.Char, '+')
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			a := ids[y*grid.Width+x]
+			if a < 0 {
+				continue
+			}
+			if differs(a, x+1, y) || differs(a, x, y+1) {
+				grid.Set(x, y, Cell{Ch: ch, Layer: LayerBorder})
+			}
+		}
+	}
+}
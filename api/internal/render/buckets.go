@@ -0,0 +1,134 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Scale decides how values are split into the levels of a graded layer.
+type Scale string
+
+const (
+	ScaleLinear   Scale = "linear"
+	ScaleLog      Scale = "log"
+	ScaleQuantile Scale = "quantile"
+)
+
+var scales = []Scale{ScaleLinear, ScaleLog, ScaleQuantile}
+
+func Scales() []string {
+	names := make([]string, 0, len(scales))
+	for _, s := range scales {
+		names = append(names, string(s))
+	}
+	return names
+}
+
+// ParseScale returns an empty Scale for an empty value so each layer can
+// pick its own default.
+func ParseScale(raw string) (Scale, error) {
+	value := Scale(strings.ToLower(strings.TrimSpace(raw)))
+	if value == "" {
+		return "", nil
+	}
+	for _, s := range scales {
+		if s == value {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("scale must be one of: %s", strings.Join(Scales(), ", "))
+}
+
+// buckets holds levels+1 ascending edges. Linear and log edges are evenly
+// spaced between the smallest and largest value; quantile edges put about
+// the same number of values in each bucket.
+type buckets struct {
+	edges []float64
+}
+
+func newBuckets(values []float64, levels int, scale Scale) buckets {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	lo, hi := sorted[0], sorted[len(sorted)-1]
+
+	edges := make([]float64, levels+1)
+	for i := range edges {
+		t := float64(i) / float64(levels)
+		switch scale {
+		case ScaleQuantile:
+			edges[i] = sorted[min(i*len(sorted)/levels, len(sorted)-1)]
+		case ScaleLog:
+			edges[i] = math.Exp(math.Log(lo) + (math.Log(hi)-math.Log(lo))*t)
+		default:
+			edges[i] = lo + (hi-lo)*t
+		}
+	}
+	edges[0], edges[levels] = lo, hi
+	return buckets{edges: edges}
+}
+
+// index returns the last bucket whose lower edge is at or below value. When
+// all values are equal everything falls into the first bucket.
+func (b buckets) index(value float64) int {
+	idx := 0
+	if b.edges[0] == b.edges[len(b.edges)-1] {
+		return idx
+	}
+	for i := 1; i < len(b.edges)-1; i++ {
+		if b.edges[i] <= value {
+			idx = i
+		}
+	}
+	return idx
+}
+
+type legendEntry struct {
+	swatch Cell
+	label  string
+}
+
+func (b buckets) legend(swatch func(level int) Cell) []legendEntry {
+	entries := make([]legendEntry, 0, len(b.edges)-1)
+	for i := 0; i+1 < len(b.edges); i++ {
+		label := formatLegendValue(b.edges[i]) + "-" + formatLegendValue(b.edges[i+1])
+		entries = append(entries, legendEntry{swatch: swatch(i), label: label})
+	}
+	return entries
+}
+
+// legendRows lays out entries as "swatch label" separated by two spaces,
+// wrapped to width.
+func legendRows(entries []legendEntry, width int) [][]Cell {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var rows [][]Cell
+	var row []Cell
+	for _, e := range entries {
+		entry := []Cell{e.swatch, {Ch: ' '}}
+		for _, r := range e.label {
+			entry = append(entry, Cell{Ch: r})
+		}
+
+		if len(row) > 0 && len(row)+2+len(entry) > width {
+			rows = append(rows, row)
+			row = nil
+		}
+		if len(row) > 0 {
+			row = append(row, Cell{Ch: ' '}, Cell{Ch: ' '})
+		}
+		row = append(row, entry...)
+	}
+	return append(rows, row)
+}
+
+func formatLegendValue(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(v, 'g', 3, 64)
+}
@@ -0,0 +1,133 @@
+package render
+
+import "strings"
+
+type Layer uint8
+
+const (
+	LayerNone Layer = iota
+	LayerMap
+	LayerOcean
+	LayerHighlight
+	LayerChoropleth
+	LayerField
+	LayerBorder
+	LayerGraticule
+	LayerDensity
+	LayerOverlay
+	LayerFrame
+	LayerFooter
+	LayerMarker
+	LayerLabel
+)
+
+// Ground is what a map cell showed before other layers were drawn over it,
+// so background colors stay put under borders, lines and markers.
+type Ground uint8
+
+const (
+	GroundNone Ground = iota
+	GroundLand
+	GroundWater
+)
+
+type Cell struct {
+	Ch rune
+	// Glyph replaces Ch for characters made of several code points, such
+	// as emoji with modifiers.
+	Glyph string
+	Layer Layer
+	// Level grades cells of the same layer, starting at 1, so a palette can
+	// pick colors from a scale. Zero means ungraded.
+	Level  uint8
+	Ground Ground
+}
+
+// Grid is the map area, one cell per character.
+type Grid struct {
+	Width  int
+	Height int
+	Cells  []Cell
+}
+
+func newGrid(width int, height int) *Grid {
+	return &Grid{Width: width, Height: height, Cells: make([]Cell, width*height)}
+}
+
+func (g *Grid) At(x int, y int) Cell {
+	return g.Cells[y*g.Width+x]
+}
+
+// Set reports whether the cell was inside the grid.
+func (g *Grid) Set(x int, y int, cell Cell) bool {
+	if x < 0 || y < 0 || x >= g.Width || y >= g.Height {
+		return false
+	}
+	g.Cells[y*g.Width+x] = cell
+	return true
+}
+
+// Canvas is the final output: the map grid plus frame and margin rows.
+// Margin rows are empty.
+type Canvas struct {
+	Rows      [][]Cell
+	MapWidth  int
+	MapHeight int
+	// Markers has one entry per marker, in the order given.
+	Markers []MarkerCell
+}
+
+// compose frames the grid together with the inside rows (such as a footer),
+// which must be as wide as the grid, and appends the below rows (such as a
+// legend) under the frame, inside the margins.
+func compose(grid *Grid, frame *frame, margin int, inside [][]Cell, below [][]Cell) *Canvas {
+	rows := make([][]Cell, 0, grid.Height+len(inside)+2+2*margin+len(below))
+	for i := 0; i < margin; i++ {
+		rows = append(rows, nil)
+	}
+
+	frameWidth := grid.Width + 2
+	if frame != nil {
+		rows = append(rows, frame.top(frameWidth))
+	}
+	lines := make([][]Cell, 0, grid.Height+len(inside))
+	for y := 0; y < grid.Height; y++ {
+		lines = append(lines, grid.Cells[y*grid.Width:(y+1)*grid.Width])
+	}
+	lines = append(lines, inside...)
+	for _, line := range lines {
+		if frame == nil {
+			rows = append(rows, append([]Cell(nil), line...))
+			continue
+		}
+
+		framed := make([]Cell, 0, frameWidth)
+		framed = append(framed, Cell{Ch: frame.chars.vertical, Layer: LayerFrame})
+		framed = append(framed, line...)
+		framed = append(framed, Cell{Ch: frame.chars.vertical, Layer: LayerFrame})
+		rows = append(rows, framed)
+	}
+	if frame != nil {
+		rows = append(rows, frame.bottom(frameWidth))
+	}
+	rows = append(rows, below...)
+
+	for i := 0; i < margin; i++ {
+		rows = append(rows, nil)
+	}
+
+	return &Canvas{Rows: rows, MapWidth: grid.Width, MapHeight: grid.Height}
+}
+
+func (c *Canvas) Plain() string {
+	var b strings.Builder
+	for idx, row := range c.Rows {
+		for _, cell := range row {
+			cell.write(&b)
+		}
+		if idx != len(c.Rows)-1 {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,140 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Charset string
+
+const (
+	CharsetASCII   Charset = "ascii"
+	CharsetBraille Charset = "braille"
+	CharsetBlocks  Charset = "blocks"
+)
+
+var charsets = []Charset{CharsetASCII, CharsetBraille, CharsetBlocks}
+
+func Charsets() []string {
+	names := make([]string, 0, len(charsets))
+	for _, c := range charsets {
+		names = append(names, string(c))
+	}
+	return names
+}
+
+func ParseCharset(raw string) (Charset, error) {
+	value := Charset(strings.ToLower(strings.TrimSpace(raw)))
+	if value == "" {
+		return CharsetASCII, nil
+	}
+	for _, c := range charsets {
+		if c == value {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("charset must be one of: %s", strings.Join(Charsets(), ", "))
+}
+
+// landThreshold decides whether a sub-cell dot counts as land in the
+// binary charsets.
+const landThreshold = 0.5
+
+// brailleDotBits indexes the Unicode braille dot bit by [row][col] within
+// the 2x4 cell.
+var brailleDotBits = [4][2]rune{
+	{0x01, 0x08},
+	{0x02, 0x10},
+	{0x04, 0x20},
+	{0x40, 0x80},
+}
+
+// rasterizeBraille packs 2x4 dots per character, each dot supersampled on its
+// own, so the effective resolution is twice the width and four times the
+// height of the ASCII renderer.
+func rasterizeBraille(grid *Grid, sample landSampler, proj projection, supersample int) {
+	sampler := newDotSampler(sample, proj, grid.Width*2, grid.Height*4, supersample)
+
+	for row := 0; row < grid.Height; row++ {
+		for col := 0; col < grid.Width; col++ {
+			if _, _, ok := cellCenter(grid, proj, col, row); !ok {
+				grid.Set(col, row, Cell{Ch: ' ', Layer: LayerNone})
+				continue
+			}
+
+			var bits rune
+			for dy := 0; dy < 4; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					if sampler.fraction(col*2+dx, row*4+dy) >= landThreshold {
+						bits |= brailleDotBits[dy][dx]
+					}
+				}
+			}
+
+			if bits == 0 {
+				grid.Set(col, row, Cell{Ch: ' ', Layer: LayerOcean})
+				continue
+			}
+			grid.Set(col, row, Cell{Ch: 0x2800 + bits, Layer: LayerMap})
+		}
+	}
+}
+
+// rasterizeBlocks encodes two raster rows per character with the upper
+// half, lower half and full block characters.
+func rasterizeBlocks(grid *Grid, sample landSampler, proj projection, supersample int) {
+	sampler := newDotSampler(sample, proj, grid.Width, grid.Height*2, supersample)
+
+	for row := 0; row < grid.Height; row++ {
+		for col := 0; col < grid.Width; col++ {
+			if _, _, ok := cellCenter(grid, proj, col, row); !ok {
+				grid.Set(col, row, Cell{Ch: ' ', Layer: LayerNone})
+				continue
+			}
+
+			top := sampler.fraction(col, row*2) >= landThreshold
+			bottom := sampler.fraction(col, row*2+1) >= landThreshold
+
+			cell := Cell{Ch: ' ', Layer: LayerOcean}
+			switch {
+			case top && bottom:
+				cell = Cell{Ch: '█', Layer: LayerMap}
+			case top:
+				cell = Cell{Ch: '▀', Layer: LayerMap}
+			case bottom:
+				cell = Cell{Ch: '▄', Layer: LayerMap}
+			}
+			grid.Set(col, row, cell)
+		}
+	}
+}
+
+// dotSampler averages land coverage over a virtual raster of dotsX by dotsY
+// dots spanning the map.
+type dotSampler struct {
+	sample      landSampler
+	proj        projection
+	dotsX       int
+	dotsY       int
+	supersample int
+}
+
+func newDotSampler(sample landSampler, proj projection, dotsX int, dotsY int, supersample int) dotSampler {
+	return dotSampler{sample: sample, proj: proj, dotsX: dotsX, dotsY: dotsY, supersample: supersample}
+}
+
+func (d dotSampler) fraction(x int, y int) float64 {
+	sum := 0.0
+	for sy := 0; sy < d.supersample; sy++ {
+		for sx := 0; sx < d.supersample; sx++ {
+			fx := float64(x) + (float64(sx)+0.5)/float64(d.supersample)
+			fy := float64(y) + (float64(sy)+0.5)/float64(d.supersample)
+
+			if lon, lat, ok := d.proj.inverse(fx/float64(d.dotsX), fy/float64(d.dotsY)); ok {
+				sum += d.sample(lon, lat)
+			}
+		}
+	}
+
+	return sum / float64(d.supersample*d.supersample)
+}
@@ -0,0 +1,50 @@
+package render
+
+// Choropleth shades regions by value. Values are split into Levels buckets
+// according to Scale (linear when empty). An empty Ramp keeps the land
+// characters so only the color changes.
+type Choropleth struct {
+	Regions Regions
+	Values  map[int]float64
+	Ramp    []rune
+	Levels  int
+	Scale   Scale
+	Legend  bool
+}
+
+func (c Choropleth) char(level int, fallback rune) rune {
+	if len(c.Ramp) == 0 {
+		return fallback
+	}
+	return c.Ramp[min(level, len(c.Ramp)-1)]
+}
+
+// drawChoropleth returns the legend entries when Legend is set.
+func drawChoropleth(grid *Grid, c Choropleth, proj projection) []legendEntry {
+	if c.Regions == nil || len(c.Values) == 0 || c.Levels <= 0 {
+		return nil
+	}
+
+	values := make([]float64, 0, len(c.Values))
+	for _, v := range c.Values {
+		values = append(values, v)
+	}
+	b := newBuckets(values, c.Levels, c.Scale)
+
+	ids := regionIDs(grid, c.Regions, proj)
+	for i, id := range ids {
+		value, ok := c.Values[id]
+		if id < 0 || !ok {
+			continue
+		}
+		level := b.index(value)
+		grid.Cells[i] = Cell{Ch: c.char(level, grid.Cells[i].Ch), Layer: LayerChoropleth, Level: uint8(level + 1)}
+	}
+
+	if !c.Legend {
+		return nil
+	}
+	return b.legend(func(level int) Cell {
+		return Cell{Ch: c.char(level, '#'), Layer: LayerChoropleth, Level: uint8(level + 1)}
+	})
+}
@@ -0,0 +1,219 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type ColorMode string
+
+const (
+	ColorModeNever     ColorMode = "never"
+	ColorModeANSI16    ColorMode = "always"
+	ColorModeANSI256   ColorMode = "ansi256"
+	ColorModeTrueColor ColorMode = "truecolor"
+)
+
+type colorKind uint8
+
+const (
+	colorNone colorKind = iota
+	colorANSI16
+	colorRGB
+)
+
+// Color is either unset, one of the 16 named ANSI colors, or an RGB value
+// that is emitted as a 256-color index or truecolor depending on the mode.
+type Color struct {
+	kind    colorKind
+	code    int
+	r, g, b uint8
+}
+
+var ansi16Codes = map[string]int{
+	"black":          30,
+	"red":            31,
+	"green":          32,
+	"yellow":         33,
+	"blue":           34,
+	"magenta":        35,
+	"cyan":           36,
+	"white":          37,
+	"bright-black":   90,
+	"bright-red":     91,
+	"bright-green":   92,
+	"bright-yellow":  93,
+	"bright-blue":    94,
+	"bright-magenta": 95,
+	"bright-cyan":    96,
+	"bright-white":   97,
+}
+
+func ParseColorMode(raw string) (ColorMode, error) {
+	switch mode := ColorMode(strings.ToLower(strings.TrimSpace(raw))); mode {
+	case ColorModeNever, ColorModeANSI16, ColorModeANSI256, ColorModeTrueColor:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported color mode %q", raw)
+	}
+}
+
+// ParseColor accepts an empty string, an ANSI 16 color name or a "#rgb" /
+// "#rrggbb" hex color.
+func ParseColor(raw string) (Color, error) {
+	value := strings.ToLower(strings.TrimSpace(raw))
+	if value == "" {
+		return Color{}, nil
+	}
+	if code, ok := ansi16Codes[value]; ok {
+		return Color{kind: colorANSI16, code: code}, nil
+	}
+	if strings.HasPrefix(value, "#") {
+		return parseHex(value)
+	}
+
+	return Color{}, fmt.Errorf("unknown color %q", raw)
+}
+
+func RGB(r uint8, g uint8, b uint8) Color {
+	return Color{kind: colorRGB, r: r, g: g, b: b}
+}
+
+// Gradient returns n colors evenly spaced along the RGB stops, from the
+// first to the last.
+func Gradient(stops []Color, n int) []Color {
+	if len(stops) == 0 || n <= 0 {
+		return nil
+	}
+	colors := make([]Color, n)
+	for i := range colors {
+		t := 0.0
+		if n > 1 {
+			t = float64(i) / float64(n-1) * float64(len(stops)-1)
+		}
+		idx := min(int(t), len(stops)-2)
+		if idx < 0 {
+			colors[i] = stops[0]
+			continue
+		}
+		a, b, f := stops[idx], stops[idx+1], t-float64(idx)
+		mix := func(x uint8, y uint8) uint8 {
+			return uint8(math.Round(float64(x) + (float64(y)-float64(x))*f))
+		}
+		colors[i] = RGB(mix(a.r, b.r), mix(a.g, b.g), mix(a.b, b.b))
+	}
+	return colors
+}
+
+func (c Color) IsZero() bool {
+	return c.kind == colorNone
+}
+
+func (c Color) or(fallback Color) Color {
+	if c.IsZero() {
+		return fallback
+	}
+	return c
+}
+
+func (c Color) IsHex() bool {
+	return c.kind == colorRGB
+}
+
+func parseHex(value string) (Color, error) {
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return Color{}, fmt.Errorf("hex color %q must be #rgb or #rrggbb", value)
+	}
+
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return Color{}, fmt.Errorf("hex color %q must be #rgb or #rrggbb", value)
+	}
+
+	return RGB(uint8(n>>16), uint8(n>>8), uint8(n)), nil
+}
+
+// sgr returns the SGR parameters selecting c as a foreground color in mode.
+func (c Color) sgr(mode ColorMode) string {
+	switch c.kind {
+	case colorANSI16:
+		return strconv.Itoa(c.code)
+	case colorRGB:
+		if mode == ColorModeTrueColor {
+			return fmt.Sprintf("38;2;%d;%d;%d", c.r, c.g, c.b)
+		}
+		return "38;5;" + strconv.Itoa(xterm256Index(c.r, c.g, c.b))
+	default:
+		return ""
+	}
+}
+
+// backgroundSGR returns the SGR parameters selecting c as a background
+// color in mode.
+func (c Color) backgroundSGR(mode ColorMode) string {
+	switch c.kind {
+	case colorANSI16:
+		return strconv.Itoa(c.code + 10)
+	case colorRGB:
+		if mode == ColorModeTrueColor {
+			return fmt.Sprintf("48;2;%d;%d;%d", c.r, c.g, c.b)
+		}
+		return "48;5;" + strconv.Itoa(xterm256Index(c.r, c.g, c.b))
+	default:
+		return ""
+	}
+}
+
+var cubeLevels = [6]int{0, 95, 135, 175, 215, 255}
+
+// xterm256Index maps an RGB value to the nearest entry of the xterm 6x6x6
+// color cube or grayscale ramp.
+func xterm256Index(r uint8, g uint8, b uint8) int {
+	nearestLevel := func(v uint8) int {
+		best := 0
+		for i, level := range cubeLevels {
+			if absInt(int(v)-level) < absInt(int(v)-cubeLevels[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+
+	ri, gi, bi := nearestLevel(r), nearestLevel(g), nearestLevel(b)
+	cubeIndex := 16 + 36*ri + 6*gi + bi
+	cubeDist := distSq(int(r), int(g), int(b), cubeLevels[ri], cubeLevels[gi], cubeLevels[bi])
+
+	avg := (int(r) + int(g) + int(b)) / 3
+	grayStep := (avg - 8) / 10
+	if grayStep < 0 {
+		grayStep = 0
+	}
+	if grayStep > 23 {
+		grayStep = 23
+	}
+	grayLevel := 8 + 10*grayStep
+	grayDist := distSq(int(r), int(g), int(b), grayLevel, grayLevel, grayLevel)
+
+	if grayDist < cubeDist {
+		return 232 + grayStep
+	}
+	return cubeIndex
+}
+
+func distSq(r1 int, g1 int, b1 int, r2 int, g2 int, b2 int) int {
+	dr, dg, db := r1-r2, g1-g2, b1-b2
+	return dr*dr + dg*dg + db*db
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
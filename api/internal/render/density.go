@@ -0,0 +1,66 @@
+package render
+
+import (
+	"math"
+
+	"map-ascii-generator/api/internal/geo"
+)
+
+// Density plots a point cloud by counting points per cell. Cells with fewer
+// than Threshold points are left alone; the rest are graded over Ramp by
+// Scale, log when empty so a single hotspot does not flatten everything else.
+type Density struct {
+	Points    []geo.Point
+	Ramp      []rune
+	Threshold int
+	Scale     Scale
+	Legend    bool
+}
+
+var defaultDensityRamp = []rune("oO@")
+
+// drawDensity returns the legend entries when Legend is set.
+func drawDensity(grid *Grid, density Density, proj projection) []legendEntry {
+	ramp := density.Ramp
+	if len(ramp) == 0 {
+		ramp = defaultDensityRamp
+	}
+	threshold := max(density.Threshold, 1)
+
+	counts := make([]int, len(grid.Cells))
+	for _, p := range density.Points {
+		if x, y, ok := projectCell(proj, p.Lon(), p.Lat(), grid.Width, grid.Height); ok && x >= 0 && y >= 0 && x < grid.Width && y < grid.Height {
+			counts[y*grid.Width+x]++
+		}
+	}
+
+	var values []float64
+	for _, n := range counts {
+		if n >= threshold {
+			values = append(values, float64(n))
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	scale := density.Scale
+	if scale == "" {
+		scale = ScaleLog
+	}
+	b := newBuckets(values, len(ramp), scale)
+	swatch := func(level int) Cell {
+		return Cell{Ch: ramp[level], Layer: LayerDensity, Level: uint8(min(level+1, math.MaxUint8))}
+	}
+
+	for i, n := range counts {
+		if n >= threshold {
+			grid.Cells[i] = swatch(b.index(float64(n)))
+		}
+	}
+
+	if !density.Legend {
+		return nil
+	}
+	return b.legend(swatch)
+}
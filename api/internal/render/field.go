@@ -0,0 +1,63 @@
+package render
+
+// Field shades land cells by a continuous value sampled at each cell
+// center, such as temperature. Values are split into Levels equal buckets
+// between Min and Max, with values outside the range in the first or last
+// bucket. Edges, when set, gives the Levels+1 bucket bounds instead. An
+// empty Ramp keeps the land characters so only the color changes.
+type Field struct {
+	Sample func(lon float64, lat float64) (float64, bool)
+	Min    float64
+	Max    float64
+	Edges  []float64
+	Ramp   []rune
+	Levels int
+	Legend bool
+}
+
+func (f Field) char(level int, fallback rune) rune {
+	if len(f.Ramp) == 0 {
+		return fallback
+	}
+	return f.Ramp[min(level, len(f.Ramp)-1)]
+}
+
+// drawField returns the legend entries when Legend is set.
+func drawField(grid *Grid, f Field, proj projection) []legendEntry {
+	b := buckets{edges: f.Edges}
+	if len(b.edges) == 0 && f.Levels > 0 && f.Max > f.Min {
+		b.edges = make([]float64, f.Levels+1)
+		for i := range b.edges {
+			b.edges[i] = f.Min + (f.Max-f.Min)*float64(i)/float64(f.Levels)
+		}
+	}
+	if f.Sample == nil || len(b.edges) < 2 {
+		return nil
+	}
+
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			cell := grid.At(x, y)
+			if cell.Layer != LayerMap {
+				continue
+			}
+			lon, lat, ok := cellCenter(grid, proj, x, y)
+			if !ok {
+				continue
+			}
+			value, ok := f.Sample(wrapLongitude(lon), lat)
+			if !ok {
+				continue
+			}
+			level := b.index(value)
+			grid.Set(x, y, Cell{Ch: f.char(level, cell.Ch), Layer: LayerField, Level: uint8(level + 1)})
+		}
+	}
+
+	if !f.Legend {
+		return nil
+	}
+	return b.legend(func(level int) Cell {
+		return Cell{Ch: f.char(level, '#'), Layer: LayerField, Level: uint8(level + 1)}
+	})
+}
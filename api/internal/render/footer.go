@@ -0,0 +1,62 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Align string
+
+const (
+	AlignLeft   Align = "left"
+	AlignCenter Align = "center"
+	AlignRight  Align = "right"
+)
+
+var aligns = []Align{AlignLeft, AlignCenter, AlignRight}
+
+func Aligns() []string {
+	names := make([]string, 0, len(aligns))
+	for _, a := range aligns {
+		names = append(names, string(a))
+	}
+	return names
+}
+
+func ParseAlign(raw string) (Align, error) {
+	value := Align(strings.ToLower(strings.TrimSpace(raw)))
+	if value == "" {
+		return AlignLeft, nil
+	}
+	for _, a := range aligns {
+		if a == value {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("align must be one of: %s", strings.Join(Aligns(), ", "))
+}
+
+// Footer is a line of text under the map, inside the frame when there is
+// one. Text longer than the map width is cut.
+type Footer struct {
+	Text  string
+	Align Align
+}
+
+func (f Footer) row(width int) []Cell {
+	row := make([]Cell, width)
+	for i := range row {
+		row[i] = Cell{Ch: ' '}
+	}
+
+	text := fitCells(textCells(f.Text, LayerFooter), width)
+	start := 0
+	switch f.Align {
+	case AlignCenter:
+		start = (width - len(text)) / 2
+	case AlignRight:
+		start = width - len(text)
+	}
+	copy(row[start:], text)
+	return row
+}
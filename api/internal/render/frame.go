@@ -0,0 +1,92 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+)
+
+type FrameStyle string
+
+const (
+	FrameASCII   FrameStyle = "ascii"
+	FrameSingle  FrameStyle = "single"
+	FrameDouble  FrameStyle = "double"
+	FrameRounded FrameStyle = "rounded"
+)
+
+var frameStyles = []FrameStyle{FrameASCII, FrameSingle, FrameDouble, FrameRounded}
+
+func FrameStyles() []string {
+	names := make([]string, 0, len(frameStyles))
+	for _, s := range frameStyles {
+		names = append(names, string(s))
+	}
+	return names
+}
+
+func ParseFrameStyle(raw string) (FrameStyle, error) {
+	value := FrameStyle(strings.ToLower(strings.TrimSpace(raw)))
+	if value == "" {
+		return FrameASCII, nil
+	}
+	for _, s := range frameStyles {
+		if s == value {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("frame_style must be one of: %s", strings.Join(FrameStyles(), ", "))
+}
+
+type frameChars struct {
+	horizontal, vertical                       rune
+	topLeft, topRight, bottomLeft, bottomRight rune
+}
+
+var frameCharsets = map[FrameStyle]frameChars{
+	FrameASCII:   {'-', '|', '+', '+', '+', '+'},
+	FrameSingle:  {'─', '│', '┌', '┐', '└', '┘'},
+	FrameDouble:  {'═', '║', '╔', '╗', '╚', '╝'},
+	FrameRounded: {'─', '│', '╭', '╮', '╰', '╯'},
+}
+
+// frame describes the border drawn around the map by compose.
+type frame struct {
+	chars frameChars
+	title string
+}
+
+func newFrame(style FrameStyle, title string) *frame {
+	chars, ok := frameCharsets[style]
+	if !ok {
+		chars = frameCharsets[FrameASCII]
+	}
+	return &frame{chars: chars, title: title}
+}
+
+func (f *frame) top(width int) []Cell {
+	row := f.border(width, f.chars.topLeft, f.chars.topRight)
+
+	// The title is padded with a space on each side and keeps at least one
+	// border character next to each corner; longer titles are cut.
+	title := fitCells(textCells(strings.TrimSpace(f.title), LayerFrame), width-6)
+	if len(title) == 0 {
+		return row
+	}
+	label := append(append([]Cell{{Ch: ' ', Layer: LayerFrame}}, title...), Cell{Ch: ' ', Layer: LayerFrame})
+	copy(row[(width-len(label))/2:], label)
+	return row
+}
+
+func (f *frame) bottom(width int) []Cell {
+	return f.border(width, f.chars.bottomLeft, f.chars.bottomRight)
+}
+
+func (f *frame) border(width int, left rune, right rune) []Cell {
+	row := make([]Cell, width)
+	for i := range row {
+		row[i] = Cell{Ch: f.chars.horizontal, Layer: LayerFrame}
+	}
+	row[0].Ch = left
+	row[width-1].Ch = right
+	return row
+}
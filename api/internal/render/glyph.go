@@ -0,0 +1,169 @@
+package render
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// wideTail fills the column covered by the right half of a double-width
+// glyph. It prints nothing, so every row keeps one column per cell.
+const wideTail rune = -1
+
+// SplitGlyphs splits text into user-perceived characters: a base character
+// with its combining marks, variation selectors, skin tone modifiers, tags
+// and zero-width-joined sequences, or a pair of regional indicators (flag).
+// It covers what markers and labels need rather than the full Unicode
+// segmentation rules.
+func SplitGlyphs(text string) []string {
+	runes := []rune(text)
+	var glyphs []string
+	for i := 0; i < len(runes); {
+		j := i + 1
+		if isRegionalIndicator(runes[i]) && j < len(runes) && isRegionalIndicator(runes[j]) {
+			j++
+		}
+		for j < len(runes) {
+			if isGlyphExtender(runes[j]) {
+				j++
+				continue
+			}
+			if runes[j] == '\u200d' && j+1 < len(runes) {
+				j += 2
+				continue
+			}
+			break
+		}
+		glyphs = append(glyphs, string(runes[i:j]))
+		i = j
+	}
+	return glyphs
+}
+
+// GlyphWidth returns the number of terminal columns a glyph from SplitGlyphs
+// takes: 2 for East Asian wide characters, emoji and flags, 1 otherwise.
+func GlyphWidth(glyph string) int {
+	runes := []rune(glyph)
+	if len(runes) == 0 {
+		return 0
+	}
+	if isRegionalIndicator(runes[0]) || isWideRune(runes[0]) || strings.ContainsRune(glyph, '\ufe0f') {
+		return 2
+	}
+	return 1
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+func isGlyphExtender(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me) ||
+		(r >= 0xfe00 && r <= 0xfe0f) ||
+		(r >= 0x1f3fb && r <= 0x1f3ff) ||
+		(r >= 0xe0020 && r <= 0xe007f) ||
+		r == 0x20e3
+}
+
+// wideRanges lists East Asian Wide and Fullwidth blocks and the emoji that
+// are shown as emoji by default, sorted by start.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115f}, {0x231a, 0x231b}, {0x23e9, 0x23ec}, {0x23f0, 0x23f0},
+	{0x23f3, 0x23f3}, {0x25fd, 0x25fe}, {0x2614, 0x2615}, {0x2648, 0x2653},
+	{0x267f, 0x267f}, {0x2693, 0x2693}, {0x26a1, 0x26a1}, {0x26aa, 0x26ab},
+	{0x26bd, 0x26be}, {0x26c4, 0x26c5}, {0x26ce, 0x26ce}, {0x26d4, 0x26d4},
+	{0x26ea, 0x26ea}, {0x26f2, 0x26f3}, {0x26f5, 0x26f5}, {0x26fa, 0x26fa},
+	{0x26fd, 0x26fd}, {0x2705, 0x2705}, {0x270a, 0x270b}, {0x2728, 0x2728},
+	{0x274c, 0x274c}, {0x274e, 0x274e}, {0x2753, 0x2755}, {0x2757, 0x2757},
+	{0x2795, 0x2797}, {0x27b0, 0x27b0}, {0x27bf, 0x27bf}, {0x2b1b, 0x2b1c},
+	{0x2b50, 0x2b50}, {0x2b55, 0x2b55}, {0x2e80, 0x303e}, {0x3041, 0x33ff},
+	{0x3400, 0x4dbf}, {0x4e00, 0x9fff}, {0xa000, 0xa4cf}, {0xa960, 0xa97f},
+	{0xac00, 0xd7a3}, {0xf900, 0xfaff}, {0xfe10, 0xfe19}, {0xfe30, 0xfe6f},
+	{0xff00, 0xff60}, {0xffe0, 0xffe6}, {0x1f004, 0x1f004}, {0x1f0cf, 0x1f0cf},
+	{0x1f18e, 0x1f18e}, {0x1f191, 0x1f19a}, {0x1f200, 0x1f2ff}, {0x1f300, 0x1f64f},
+	{0x1f680, 0x1f6ff}, {0x1f7e0, 0x1f7eb}, {0x1f90c, 0x1f9ff}, {0x1fa70, 0x1faff},
+	{0x20000, 0x2fffd}, {0x30000, 0x3fffd},
+}
+
+func isWideRune(r rune) bool {
+	i := sort.Search(len(wideRanges), func(i int) bool { return wideRanges[i][1] >= r })
+	return i < len(wideRanges) && wideRanges[i][0] <= r
+}
+
+// glyphCells returns the cells for one glyph: a single cell, or the glyph
+// followed by a wideTail cell when it is double-width.
+func glyphCells(glyph string, layer Layer) []Cell {
+	cell := Cell{Layer: layer}
+	if runes := []rune(glyph); len(runes) == 1 {
+		cell.Ch = runes[0]
+	} else {
+		cell.Glyph = glyph
+	}
+	if GlyphWidth(glyph) == 2 {
+		return []Cell{cell, {Ch: wideTail, Layer: layer}}
+	}
+	return []Cell{cell}
+}
+
+// textCells lays out text one column per cell.
+func textCells(text string, layer Layer) []Cell {
+	var cells []Cell
+	for _, glyph := range SplitGlyphs(text) {
+		cells = append(cells, glyphCells(glyph, layer)...)
+	}
+	return cells
+}
+
+// fitCells cuts cells to at most width columns without splitting a
+// double-width glyph.
+func fitCells(cells []Cell, width int) []Cell {
+	if len(cells) <= width {
+		return cells
+	}
+	cells = cells[:max(width, 0)]
+	if len(cells) > 0 && cells[len(cells)-1].wide() {
+		cells = cells[:len(cells)-1]
+	}
+	return cells
+}
+
+// setCells draws cells from x, moving them left at the right edge so a
+// double-width glyph stays inside the grid.
+func setCells(grid *Grid, x int, y int, cells []Cell) {
+	x = min(x, grid.Width-len(cells))
+	for i, cell := range cells {
+		grid.Set(x+i, y, cell)
+	}
+}
+
+// repairWideCells blanks halves of double-width glyphs whose partner was
+// drawn over, so no row gains or loses a column.
+func repairWideCells(grid *Grid) {
+	for y := 0; y < grid.Height; y++ {
+		row := grid.Cells[y*grid.Width : (y+1)*grid.Width]
+		for x := range row {
+			if row[x].Ch == wideTail && (x == 0 || !row[x-1].wide()) {
+				row[x] = Cell{Ch: ' ', Layer: row[x].Layer}
+			}
+			if row[x].wide() && (x+1 == len(row) || row[x+1].Ch != wideTail) {
+				row[x] = Cell{Ch: ' ', Layer: row[x].Layer}
+			}
+		}
+	}
+}
+
+func (c Cell) wide() bool {
+	if c.Glyph != "" {
+		return GlyphWidth(c.Glyph) == 2
+	}
+	return isWideRune(c.Ch)
+}
+
+func (c Cell) write(b *strings.Builder) {
+	switch {
+	case c.Glyph != "":
+		b.WriteString(c.Glyph)
+	case c.Ch != wideTail:
+		b.WriteRune(c.Ch)
+	}
+}
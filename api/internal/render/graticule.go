@@ -0,0 +1,59 @@
+package render
+
+import "math"
+
+type Graticule struct {
+	Interval  float64
+	LonChar   rune
+	LatChar   rune
+	CrossChar rune
+	OverLand  bool
+}
+
+// drawGraticule draws meridians and parallels at every multiple of the
+// interval strictly inside the viewport. Unless OverLand is set, lines only
+// replace ocean cells so coastlines stay readable.
+func drawGraticule(grid *Grid, g Graticule, viewport Viewport) {
+	if g.Interval <= 0 {
+		return
+	}
+
+	lonCols := make(map[int]bool)
+	for lon := math.Ceil(viewport.MinLon/g.Interval) * g.Interval; lon < viewport.MaxLon; lon += g.Interval {
+		if lon <= viewport.MinLon {
+			continue
+		}
+		col, _ := CellForLonLat(lon, viewport.MaxLat, grid.Width, grid.Height, viewport)
+		lonCols[col] = true
+	}
+
+	latRows := make(map[int]bool)
+	for lat := math.Ceil(viewport.MinLat/g.Interval) * g.Interval; lat < viewport.MaxLat; lat += g.Interval {
+		if lat <= viewport.MinLat {
+			continue
+		}
+		_, row := CellForLonLat(viewport.MinLon, lat, grid.Width, grid.Height, viewport)
+		latRows[row] = true
+	}
+
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			onLon, onLat := lonCols[x], latRows[y]
+			if !onLon && !onLat {
+				continue
+			}
+			if !g.OverLand && grid.At(x, y).Layer != LayerOcean {
+				continue
+			}
+
+			ch := runeOrDefault(g.LatChar, '-')
+			switch {
+			case onLon && onLat:
+				ch = runeOrDefault(g.CrossChar, '+')
+			case onLon:
+				ch = runeOrDefault(g.LonChar, ':')
+			}
+			grid.Set(x, y, Cell{Ch: ch, Layer: LayerGraticule})
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package render
+
+import "strings"
+
+// GridCell is a canvas cell with its style spelled out, for renderers that
+// draw cells themselves instead of parsing ANSI. FG and BG are "#rrggbb",
+// empty for the terminal default; named colors use xterm's values.
+type GridCell struct {
+	Char  string
+	FG    string
+	BG    string
+	Attrs []string
+}
+
+// Grid returns the cells of every row with the palette's colors and
+// attributes, or unstyled when mode is "never". Like Styled, the cell after
+// a wide glyph has empty text.
+func (c *Canvas) Grid(mode ColorMode, palette Palette) [][]GridCell {
+	colored := mode != ColorModeNever && mode != "" && !palette.empty()
+	rows := make([][]GridCell, len(c.Rows))
+	for rowIdx, row := range c.Rows {
+		rows[rowIdx] = make([]GridCell, len(row))
+		for col, cell := range row {
+			var b strings.Builder
+			cell.write(&b)
+			grid := GridCell{Char: b.String(), Attrs: []string{}}
+			if colored {
+				if fg := palette.colorFor(cell); !fg.IsZero() {
+					grid.FG = fg.hex()
+				}
+				if bg := palette.backgroundFor(cell); !bg.IsZero() {
+					grid.BG = bg.hex()
+				}
+				grid.Attrs = palette.attrsFor(cell).names()
+			}
+			rows[rowIdx][col] = grid
+		}
+	}
+	return rows
+}
@@ -0,0 +1,27 @@
+package render
+
+// Highlight fills the land cells of the selected regions. A zero Char keeps
+// the land characters so only the color changes. Borders are drawn first
+// and stay on top because regionIDs only looks at plain land cells.
+type Highlight struct {
+	Regions  Regions
+	Selected map[int]bool
+	Char     rune
+}
+
+func drawHighlight(grid *Grid, highlight Highlight, proj projection) {
+	if highlight.Regions == nil || len(highlight.Selected) == 0 {
+		return
+	}
+
+	ids := regionIDs(grid, highlight.Regions, proj)
+	for i, id := range ids {
+		if id < 0 || !highlight.Selected[id] {
+			continue
+		}
+		grid.Cells[i].Layer = LayerHighlight
+		if highlight.Char != 0 {
+			grid.Cells[i].Ch = highlight.Char
+		}
+	}
+}
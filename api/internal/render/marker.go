@@ -0,0 +1,299 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type MarkerStyle string
+
+const (
+	MarkerCrosshair MarkerStyle = "crosshair"
+	MarkerDot       MarkerStyle = "dot"
+	MarkerPlus      MarkerStyle = "plus"
+	MarkerX         MarkerStyle = "x"
+	MarkerStar      MarkerStyle = "star"
+	MarkerPin       MarkerStyle = "pin"
+	MarkerNumbered  MarkerStyle = "numbered"
+)
+
+var markerStyles = []MarkerStyle{MarkerCrosshair, MarkerDot, MarkerPlus, MarkerX, MarkerStar, MarkerPin, MarkerNumbered}
+
+func MarkerStyles() []string {
+	names := make([]string, 0, len(markerStyles))
+	for _, s := range markerStyles {
+		names = append(names, string(s))
+	}
+	return names
+}
+
+func ParseMarkerStyle(raw string) (MarkerStyle, error) {
+	value := MarkerStyle(strings.ToLower(strings.TrimSpace(raw)))
+	if value == "" {
+		return MarkerCrosshair, nil
+	}
+	for _, s := range markerStyles {
+		if s == value {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("marker.style must be one of: %s", strings.Join(MarkerStyles(), ", "))
+}
+
+// MaxNumberedMarkers is the number of single-digit labels available to the
+// numbered style.
+const MaxNumberedMarkers = 9
+
+type Marker struct {
+	Lon   float64
+	Lat   float64
+	Style MarkerStyle
+	// Center, Horizontal, Vertical, ArmX and ArmY only apply to the
+	// crosshair style, Center also to dot; the other styles have fixed
+	// shapes. CenterGlyph, when set, replaces Center with a glyph from
+	// SplitGlyphs, which may be double-width.
+	Center      rune
+	CenterGlyph string
+	Horizontal  rune
+	Vertical    rune
+	ArmX        int
+	ArmY        int
+	// Number is the digit drawn by the numbered style, 1 to 9.
+	Number int
+	// Label is written next to the center, see drawLabel.
+	Label string
+	// SnapToLand moves a marker that falls on an ocean cell to the nearest
+	// land cell within snapRadius, e.g. for rounded coastal city coordinates.
+	SnapToLand bool
+}
+
+// MarkerCell is where a marker was drawn, in rows and columns of the
+// output including margin and frame. Markers on the far side of a globe are
+// not Visible and have Row and Col -1. Clipped means part of the shape or
+// label was cut off at the map edge.
+type MarkerCell struct {
+	Row     int
+	Col     int
+	Visible bool
+	Clipped bool
+	Snapped bool
+}
+
+// snapRadius is how far a marker may move with SnapToLand, in columns. Rows
+// count charAspect columns, so the search area is round on screen.
+const snapRadius = 3
+
+type markerCell struct {
+	dx, dy int
+	ch     rune
+}
+
+// stencil returns the cells of the fixed-size styles relative to the
+// center.
+func (m Marker) stencil() []markerCell {
+	switch m.Style {
+	case MarkerDot:
+		return []markerCell{{0, 0, runeOrDefault(m.Center, 'O')}}
+	case MarkerPlus:
+		return []markerCell{
+			{0, -1, '|'},
+			{-1, 0, '-'}, {0, 0, '+'}, {1, 0, '-'},
+			{0, 1, '|'},
+		}
+	case MarkerX:
+		return []markerCell{
+			{-1, -1, '\\'}, {1, -1, '/'},
+			{0, 0, 'X'},
+			{-1, 1, '/'}, {1, 1, '\\'},
+		}
+	case MarkerStar:
+		return []markerCell{
+			{-1, -1, '\\'}, {0, -1, '|'}, {1, -1, '/'},
+			{-1, 0, '-'}, {0, 0, '*'}, {1, 0, '-'},
+			{-1, 1, '/'}, {0, 1, '|'}, {1, 1, '\\'},
+		}
+	case MarkerPin:
+		// The head sits above the point so the tip marks the location.
+		return []markerCell{{0, -1, 'O'}, {0, 0, 'V'}}
+	case MarkerNumbered:
+		return []markerCell{{-1, 0, '('}, {0, 0, rune('0' + m.Number)}, {1, 0, ')'}}
+	}
+	return nil
+}
+
+// drawMarkers draws every marker first and the labels afterwards, so labels
+// can avoid all markers. A marker on the far side of a globe is skipped.
+// land marks the cells that were land before any layers were drawn; it is
+// only read for markers with SnapToLand. The returned cells are in grid
+// coordinates, one per marker.
+func drawMarkers(grid *Grid, markers []Marker, proj projection, land []bool, charAspect float64) ([]MarkerCell, error) {
+	type placed struct {
+		index, x, y, extent int
+		label               []Cell
+	}
+	var labels []placed
+	cells := make([]MarkerCell, len(markers))
+
+	for i, marker := range markers {
+		if err := checkMarker(marker); err != nil {
+			return nil, err
+		}
+
+		x, y, ok := projectCell(proj, marker.Lon, marker.Lat, grid.Width, grid.Height)
+		if !ok {
+			cells[i] = MarkerCell{Row: -1, Col: -1}
+			continue
+		}
+		snapped := false
+		if marker.SnapToLand {
+			x, y, snapped = snapToLand(grid, land, x, y, charAspect)
+		}
+		cells[i] = MarkerCell{Row: y, Col: x, Visible: true, Snapped: snapped}
+
+		// extent is how far the shape reaches sideways from the center
+		// on the label rows; the crosshair only has its vertical arm there.
+		extent := 0
+		if marker.Style == MarkerCrosshair || marker.Style == "" {
+			cells[i].Clipped = drawCrosshair(grid, marker, x, y)
+		} else {
+			for _, c := range marker.stencil() {
+				if !grid.Set(x+c.dx, y+c.dy, Cell{Ch: c.ch, Layer: LayerMarker}) {
+					cells[i].Clipped = true
+				}
+				extent = max(extent, c.dx, -c.dx)
+			}
+		}
+		if marker.CenterGlyph != "" && (marker.Style == MarkerCrosshair || marker.Style == MarkerDot || marker.Style == "") {
+			cells := glyphCells(marker.CenterGlyph, LayerMarker)
+			setCells(grid, x, y, cells)
+			extent = max(extent, len(cells)-1)
+		}
+		if marker.Label != "" {
+			labels = append(labels, placed{index: i, x: x, y: y, extent: extent, label: textCells(marker.Label, LayerLabel)})
+		}
+	}
+
+	for _, l := range labels {
+		if !drawLabel(grid, l.x, l.y, l.extent, l.label) {
+			cells[l.index].Clipped = true
+		}
+	}
+	repairWideCells(grid)
+	return cells, nil
+}
+
+// snapToLand returns the nearest land cell to x, y, or x, y itself when it
+// is land or no land lies within snapRadius.
+func snapToLand(grid *Grid, land []bool, x int, y int, charAspect float64) (int, int, bool) {
+	if land == nil || land[y*grid.Width+x] {
+		return x, y, false
+	}
+
+	rows := int(snapRadius / charAspect)
+	bestX, bestY, best := x, y, math.Inf(1)
+	for dy := -rows; dy <= rows; dy++ {
+		for dx := -snapRadius; dx <= snapRadius; dx++ {
+			cx, cy := x+dx, y+dy
+			if cx < 0 || cy < 0 || cx >= grid.Width || cy >= grid.Height || !land[cy*grid.Width+cx] {
+				continue
+			}
+			d := math.Hypot(float64(dx), float64(dy)*charAspect)
+			if d <= snapRadius && d < best {
+				bestX, bestY, best = cx, cy, d
+			}
+		}
+	}
+	return bestX, bestY, !math.IsInf(best, 1)
+}
+
+func checkMarker(marker Marker) error {
+	if !isFiniteCoord(marker.Lon, marker.Lat) {
+		return fmt.Errorf("marker lon and lat must be finite")
+	}
+	if marker.ArmX < -1 {
+		return fmt.Errorf("marker ArmX must be >= -1, got %d", marker.ArmX)
+	}
+	if marker.ArmY < -1 {
+		return fmt.Errorf("marker ArmY must be >= -1, got %d", marker.ArmY)
+	}
+	if marker.Style == MarkerNumbered && (marker.Number < 1 || marker.Number > MaxNumberedMarkers) {
+		return fmt.Errorf("marker Number must be between 1 and %d, got %d", MaxNumberedMarkers, marker.Number)
+	}
+	return nil
+}
+
+// drawCrosshair reports whether an arm was cut off at the map edge. Arms of
+// length -1 span the map and never count as cut.
+func drawCrosshair(grid *Grid, marker Marker, xCenter int, yCenter int) bool {
+	center := runeOrDefault(marker.Center, 'O')
+	horizontal := runeOrDefault(marker.Horizontal, '-')
+	vertical := runeOrDefault(marker.Vertical, '|')
+
+	xStart, xEnd := 0, grid.Width-1
+	if marker.ArmX >= 0 {
+		xStart = max(0, xCenter-marker.ArmX)
+		xEnd = min(grid.Width-1, xCenter+marker.ArmX)
+	}
+	yStart, yEnd := 0, grid.Height-1
+	if marker.ArmY >= 0 {
+		yStart = max(0, yCenter-marker.ArmY)
+		yEnd = min(grid.Height-1, yCenter+marker.ArmY)
+	}
+
+	for y := yStart; y <= yEnd; y++ {
+		grid.Set(xCenter, y, Cell{Ch: vertical, Layer: LayerMarker})
+	}
+	for x := xStart; x <= xEnd; x++ {
+		grid.Set(x, yCenter, Cell{Ch: horizontal, Layer: LayerMarker})
+	}
+	grid.Set(xCenter, yCenter, Cell{Ch: center, Layer: LayerMarker})
+
+	clippedX := marker.ArmX >= 0 && (xCenter-marker.ArmX < 0 || xCenter+marker.ArmX >= grid.Width)
+	clippedY := marker.ArmY >= 0 && (yCenter-marker.ArmY < 0 || yCenter+marker.ArmY >= grid.Height)
+	return clippedX || clippedY
+}
+
+// drawLabel writes a label diagonally next to the marker center, one cell
+// clear of the arms or of a shape reaching extent cells sideways. It tries above-right first and flips to the left or
+// below when the label would leave the map or cover another marker; when
+// nothing fits, the first placement is used and cut at the map edge. It
+// reports whether the whole label is inside the map.
+func drawLabel(grid *Grid, x int, y int, extent int, label []Cell) bool {
+	type placement struct{ x, y int }
+	right, left := x+extent+2, x-extent-1-len(label)
+	candidates := []placement{
+		{right, y - 1},
+		{left, y - 1},
+		{right, y + 1},
+		{left, y + 1},
+	}
+
+	fits := func(p placement) bool {
+		if p.x < 0 || p.y < 0 || p.x+len(label) > grid.Width || p.y >= grid.Height {
+			return false
+		}
+		for i := range label {
+			if layer := grid.At(p.x+i, p.y).Layer; layer == LayerMarker || layer == LayerLabel {
+				return false
+			}
+		}
+		return true
+	}
+
+	best := candidates[0]
+	if best.y < 0 {
+		best = candidates[2]
+	}
+	for _, p := range candidates {
+		if fits(p) {
+			best = p
+			break
+		}
+	}
+	inside := true
+	for i, cell := range label {
+		inside = grid.Set(best.x+i, best.y, cell) && inside
+	}
+	return inside
+}
@@ -0,0 +1,133 @@
+package render
+
+import (
+	"math"
+
+	"map-ascii-generator/api/internal/geo"
+)
+
+// Overlay draws user supplied geometry on top of the map. Polygon interiors
+// are only filled when FillChar is set; their rings are always outlined.
+// StartChar and EndChar, when set, mark the first and last vertex of the
+// lines, e.g. the ends of a recorded track.
+type Overlay struct {
+	Features  []geo.Feature
+	PointChar rune
+	LineChar  rune
+	FillChar  rune
+	StartChar rune
+	EndChar   rune
+}
+
+func drawOverlay(grid *Grid, overlay Overlay, proj projection) {
+	if overlay.FillChar != 0 {
+		fillOverlayPolygons(grid, overlay.Features, overlay.FillChar, proj)
+	}
+
+	lineChar := runeOrDefault(overlay.LineChar, '*')
+	step := proj.degreesPerCell(grid.Width, grid.Height) / 2
+	for _, feature := range overlay.Features {
+		for _, line := range feature.Lines {
+			traceLine(grid, line, lineChar, step, proj)
+		}
+		for _, poly := range feature.Polygons {
+			for _, ring := range poly {
+				traceLine(grid, ring, lineChar, step, proj)
+			}
+		}
+	}
+
+	plot := func(p geo.Point, ch rune) {
+		if x, y, ok := projectCell(proj, p.Lon(), p.Lat(), grid.Width, grid.Height); ok {
+			grid.Set(x, y, Cell{Ch: ch, Layer: LayerOverlay})
+		}
+	}
+
+	pointChar := runeOrDefault(overlay.PointChar, 'o')
+	for _, feature := range overlay.Features {
+		for _, p := range feature.Points {
+			plot(p, pointChar)
+		}
+	}
+
+	first, last, ok := lineEnds(overlay.Features)
+	if !ok {
+		return
+	}
+	if overlay.StartChar != 0 {
+		plot(first, overlay.StartChar)
+	}
+	if overlay.EndChar != 0 {
+		plot(last, overlay.EndChar)
+	}
+}
+
+func lineEnds(features []geo.Feature) (geo.Point, geo.Point, bool) {
+	var first, last geo.Point
+	found := false
+	for _, feature := range features {
+		for _, line := range feature.Lines {
+			if len(line) == 0 {
+				continue
+			}
+			if !found {
+				first, found = line[0], true
+			}
+			last = line[len(line)-1]
+		}
+	}
+	return first, last, found
+}
+
+// traceLine interpolates each segment in lon/lat space, as GeoJSON defines
+// them, with at most step degrees between samples.
+func traceLine(grid *Grid, line []geo.Point, ch rune, step float64, proj projection) {
+	plot := func(lon float64, lat float64) {
+		if x, y, ok := projectCell(proj, lon, lat, grid.Width, grid.Height); ok {
+			grid.Set(x, y, Cell{Ch: ch, Layer: LayerOverlay})
+		}
+	}
+
+	if len(line) == 1 {
+		plot(line[0].Lon(), line[0].Lat())
+	}
+	for i := 1; i < len(line); i++ {
+		a, b := line[i-1], line[i]
+		dLon, dLat := b.Lon()-a.Lon(), b.Lat()-a.Lat()
+		n := max(1, int(math.Ceil(math.Max(math.Abs(dLon), math.Abs(dLat))/step)))
+		for j := 0; j <= n; j++ {
+			t := float64(j) / float64(n)
+			plot(a.Lon()+t*dLon, a.Lat()+t*dLat)
+		}
+	}
+}
+
+func fillOverlayPolygons(grid *Grid, features []geo.Feature, ch rune, proj projection) {
+	var polygons []geo.Polygon
+	var bounds []geo.Bounds
+	for _, feature := range features {
+		for _, poly := range feature.Polygons {
+			polygons = append(polygons, poly)
+			bounds = append(bounds, poly.Bounds())
+		}
+	}
+	if len(polygons) == 0 {
+		return
+	}
+
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			lon, lat, ok := cellCenter(grid, proj, x, y)
+			if !ok {
+				continue
+			}
+			lon = wrapLongitude(lon)
+			for i, poly := range polygons {
+				if bounds[i].Contains(lon, lat) && poly.Contains(lon, lat) {
+					grid.Set(x, y, Cell{Ch: ch, Layer: LayerOverlay})
+					break
+				}
+			}
+		}
+	}
+}
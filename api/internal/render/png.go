@@ -0,0 +1,267 @@
+package render
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// A PNG cell is 6x12 font pixels: a 5x7 glyph two pixels below the top,
+// two rows of descenders and a column of spacing. Every font pixel is
+// drawn as pngScale image pixels.
+const (
+	pngScale      = 2
+	pngCellWidth  = 6 * pngScale
+	pngCellHeight = 12 * pngScale
+	pngGlyphTop   = 2
+	pngUnderline  = 10
+)
+
+// boxArms are the arms of the box drawing characters the renderer uses,
+// as up, down, left and right: 1 for a light line, 2 for a double one.
+// Rounded corners are drawn square.
+var boxArms = map[rune][4]uint8{
+	'─': {0, 0, 1, 1},
+	'│': {1, 1, 0, 0},
+	'┌': {0, 1, 0, 1},
+	'┐': {0, 1, 1, 0},
+	'└': {1, 0, 0, 1},
+	'┘': {1, 0, 1, 0},
+	'├': {1, 1, 0, 1},
+	'┤': {1, 1, 1, 0},
+	'┬': {0, 1, 1, 1},
+	'┴': {1, 0, 1, 1},
+	'┼': {1, 1, 1, 1},
+	'╭': {0, 1, 0, 1},
+	'╮': {0, 1, 1, 0},
+	'╰': {1, 0, 0, 1},
+	'╯': {1, 0, 1, 0},
+	'═': {0, 0, 2, 2},
+	'║': {2, 2, 0, 0},
+	'╔': {0, 2, 0, 2},
+	'╗': {0, 2, 2, 0},
+	'╚': {2, 0, 0, 2},
+	'╝': {2, 0, 2, 0},
+}
+
+// PNG draws the canvas like SVG, with a built-in bitmap font instead of
+// a system one: ASCII, box drawing, block and braille characters are
+// drawn, any other character as an empty box. Blink is ignored.
+func (c *Canvas) PNG(mode ColorMode, palette Palette) ([]byte, error) {
+	colored := mode != ColorModeNever && mode != "" && !palette.empty()
+
+	columns := 0
+	for _, row := range c.Rows {
+		columns = max(columns, len(row))
+	}
+	img := image.NewRGBA(image.Rect(0, 0, columns*pngCellWidth, len(c.Rows)*pngCellHeight))
+	background := pngPen{img: img, color: imageBackground.rgba()}
+	background.fill(0, 0, img.Rect.Dx(), img.Rect.Dy())
+
+	for rowIdx, row := range c.Rows {
+		styles := imageStyles(row, colored, palette)
+		for col, cell := range row {
+			style := styles[col]
+			origin := image.Pt(col*pngCellWidth, rowIdx*pngCellHeight)
+			if style.bg != imageBackground {
+				bg := pngPen{img: img, origin: origin, color: style.bg.rgba()}
+				bg.fill(0, 0, pngCellWidth, pngCellHeight)
+			}
+			pen := pngPen{img: img, origin: origin, color: style.fg.rgba()}
+			pen.cell(cell, style.attrs&AttrBold != 0)
+			if style.attrs&AttrUnderline != 0 {
+				pen.fill(0, pngUnderline*pngScale, pngCellWidth, (pngUnderline+1)*pngScale)
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (c Color) rgba() color.RGBA {
+	if c.kind == colorANSI16 {
+		c = ansi16RGB[c.code]
+	}
+	return color.RGBA{R: c.r, G: c.g, B: c.b, A: 0xff}
+}
+
+// pngPen draws in one cell of the image, in image pixels from its top
+// left corner.
+type pngPen struct {
+	img    *image.RGBA
+	origin image.Point
+	color  color.RGBA
+}
+
+func (p pngPen) fill(x0 int, y0 int, x1 int, y1 int) {
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			p.img.SetRGBA(p.origin.X+x, p.origin.Y+y, p.color)
+		}
+	}
+}
+
+// cell draws the character of cell. Bold glyphs of the font are drawn
+// twice, one image pixel apart.
+func (p pngPen) cell(cell Cell, bold bool) {
+	switch {
+	case cell.Glyph == "" && cell.Ch <= ' ':
+		// Spaces, controls and the right half of a wide glyph.
+	case cell.Glyph != "" || cell.wide():
+		p.missing(cell.wide())
+	case p.box(cell.Ch), p.block(cell.Ch), p.braille(cell.Ch):
+	default:
+		rows, ok := fontGlyphs[cell.Ch]
+		if !ok {
+			p.missing(false)
+			return
+		}
+		p.glyph(rows)
+		if bold {
+			p.origin.X++
+			p.glyph(rows)
+		}
+	}
+}
+
+func (p pngPen) glyph(rows []string) {
+	for y, row := range rows {
+		for x, pixel := range row {
+			if pixel == '#' {
+				p.fill(x*pngScale, (pngGlyphTop+y)*pngScale, (x+1)*pngScale, (pngGlyphTop+y+1)*pngScale)
+			}
+		}
+	}
+}
+
+// missing outlines the glyph area, across two cells for a wide glyph.
+func (p pngPen) missing(wide bool) {
+	right := 5 * pngScale
+	if wide {
+		right += pngCellWidth
+	}
+	top, bottom := pngGlyphTop*pngScale, (pngGlyphTop+7)*pngScale
+	p.fill(0, top, right, top+pngScale)
+	p.fill(0, bottom-pngScale, right, bottom)
+	p.fill(0, top, pngScale, bottom)
+	p.fill(right-pngScale, top, right, bottom)
+}
+
+// box draws a box drawing character with lines from the middle of the
+// cell to its edges. Double lines meet at their inner and outer corners.
+func (p pngPen) box(ch rune) bool {
+	arms, ok := boxArms[ch]
+	if !ok {
+		return false
+	}
+	up, down, left, right := arms[0], arms[1], arms[2], arms[3]
+	const (
+		cx, cy = pngCellWidth/2 - pngScale/2, pngCellHeight/2 - pngScale/2
+		gap    = 3 * pngScale / 2
+	)
+
+	// A light arm is a line through the middle; a double one is two lines
+	// gap pixels either side of it, each ending at the line of the
+	// crossing arm on its side, or running to the far one when there is
+	// none.
+	arm := func(weight uint8, horizontal bool, toward int, sideArms [2]uint8) {
+		offsets := []int{0}
+		if weight == 2 {
+			offsets = []int{-gap, gap}
+		}
+		for i, offset := range offsets {
+			reach := pngScale
+			if weight == 2 {
+				reach = gap + pngScale
+				if sideArms[i] != 0 {
+					reach = pngScale - gap
+				}
+			}
+			if horizontal {
+				y := cy + offset
+				if toward < 0 {
+					p.fill(0, y, cx+reach, y+pngScale)
+				} else {
+					p.fill(cx+pngScale-reach, y, pngCellWidth, y+pngScale)
+				}
+			} else {
+				x := cx + offset
+				if toward < 0 {
+					p.fill(x, 0, x+pngScale, cy+reach)
+				} else {
+					p.fill(x, cy+pngScale-reach, x+pngScale, pngCellHeight)
+				}
+			}
+		}
+	}
+	if up != 0 {
+		arm(up, false, -1, [2]uint8{left, right})
+	}
+	if down != 0 {
+		arm(down, false, 1, [2]uint8{left, right})
+	}
+	if left != 0 {
+		arm(left, true, -1, [2]uint8{up, down})
+	}
+	if right != 0 {
+		arm(right, true, 1, [2]uint8{up, down})
+	}
+	return true
+}
+
+// block draws the full, half and shade block elements.
+func (p pngPen) block(ch rune) bool {
+	w, h := pngCellWidth, pngCellHeight
+	shade := func(ink func(x, y int) bool) {
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				if ink(x, y) {
+					p.fill(x, y, x+1, y+1)
+				}
+			}
+		}
+	}
+	switch ch {
+	case '█':
+		p.fill(0, 0, w, h)
+	case '▀':
+		p.fill(0, 0, w, h/2)
+	case '▄':
+		p.fill(0, h/2, w, h)
+	case '▌':
+		p.fill(0, 0, w/2, h)
+	case '▐':
+		p.fill(w/2, 0, w, h)
+	case '░':
+		shade(func(x, y int) bool { return x%2 == 0 && y%2 == 0 })
+	case '▒':
+		shade(func(x, y int) bool { return (x+y)%2 == 0 })
+	case '▓':
+		shade(func(x, y int) bool { return x%2 != 0 || y%2 != 0 })
+	default:
+		return false
+	}
+	return true
+}
+
+// braille draws the dots of a braille pattern, two columns of four.
+func (p pngPen) braille(ch rune) bool {
+	if ch < 0x2800 || ch > 0x28ff {
+		return false
+	}
+	const dot = 3 * pngScale / 2
+	for row, bits := range brailleDotBits {
+		for col, bit := range bits {
+			if (ch-0x2800)&bit != 0 {
+				x, y := pngScale+col*pngCellWidth/2, pngScale+row*pngCellHeight/4
+				p.fill(x, y, x+dot, y+dot)
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,211 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type Projection string
+
+const (
+	ProjectionEquirectangular Projection = "equirectangular"
+	ProjectionOrthographic    Projection = "orthographic"
+)
+
+var projections = []Projection{ProjectionEquirectangular, ProjectionOrthographic}
+
+func Projections() []string {
+	names := make([]string, 0, len(projections))
+	for _, p := range projections {
+		names = append(names, string(p))
+	}
+	return names
+}
+
+func ParseProjection(raw string) (Projection, error) {
+	value := Projection(strings.ToLower(strings.TrimSpace(raw)))
+	if value == "" {
+		return ProjectionEquirectangular, nil
+	}
+	for _, p := range projections {
+		if p == value {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("projection must be one of: %s", strings.Join(Projections(), ", "))
+}
+
+// projection maps fractional map positions (0..1 across the grid, y down) to
+// coordinates and back. ok is false for positions or coordinates that are not
+// visible, such as space around a globe or its far side.
+type projection interface {
+	inverse(fx float64, fy float64) (lon float64, lat float64, ok bool)
+	forward(lon float64, lat float64) (fx float64, fy float64, ok bool)
+	// degreesPerCell is the finest angular size of a cell, used to choose
+	// sampling steps when tracing lines.
+	degreesPerCell(width int, height int) float64
+}
+
+type equirectangular struct {
+	viewport Viewport
+}
+
+func (p equirectangular) inverse(fx float64, fy float64) (float64, float64, bool) {
+	lonSpan := p.viewport.MaxLon - p.viewport.MinLon
+	latSpan := p.viewport.MaxLat - p.viewport.MinLat
+	return p.viewport.MinLon + fx*lonSpan, p.viewport.MaxLat - latSpan*fy, true
+}
+
+func (p equirectangular) forward(lon float64, lat float64) (float64, float64, bool) {
+	u := normalizeLongitude(lon, p.viewport)
+	v := clamp((p.viewport.MaxLat-lat)/(p.viewport.MaxLat-p.viewport.MinLat), 0.0, 1.0)
+	return u, v, true
+}
+
+func (p equirectangular) degreesPerCell(width int, height int) float64 {
+	return math.Min((p.viewport.MaxLon-p.viewport.MinLon)/float64(width), (p.viewport.MaxLat-p.viewport.MinLat)/float64(height))
+}
+
+// Orthographic shows the hemisphere facing the center point, as seen from
+// space. The globe fills the full map width.
+type Orthographic struct {
+	CenterLon float64
+	CenterLat float64
+}
+
+func (o Orthographic) inverse(fx float64, fy float64) (float64, float64, bool) {
+	x, y := 2*fx-1, 1-2*fy
+	rho := math.Hypot(x, y)
+	if rho > 1 {
+		return 0, 0, false
+	}
+	if rho == 0 {
+		return o.CenterLon, o.CenterLat, true
+	}
+
+	lon0, lat0 := o.CenterLon*math.Pi/180, o.CenterLat*math.Pi/180
+	sinC, cosC := rho, math.Sqrt(1-rho*rho)
+	lat := math.Asin(cosC*math.Sin(lat0) + y*sinC*math.Cos(lat0)/rho)
+	lon := lon0 + math.Atan2(x*sinC, rho*cosC*math.Cos(lat0)-y*sinC*math.Sin(lat0))
+
+	return wrapLongitude(lon * 180 / math.Pi), lat * 180 / math.Pi, true
+}
+
+func (o Orthographic) forward(lon float64, lat float64) (float64, float64, bool) {
+	lon0, lat0 := o.CenterLon*math.Pi/180, o.CenterLat*math.Pi/180
+	lam, phi := lon*math.Pi/180, lat*math.Pi/180
+
+	cosC := math.Sin(lat0)*math.Sin(phi) + math.Cos(lat0)*math.Cos(phi)*math.Cos(lam-lon0)
+	if cosC < 0 {
+		return 0, 0, false
+	}
+
+	x := math.Cos(phi) * math.Sin(lam-lon0)
+	y := math.Cos(lat0)*math.Sin(phi) - math.Sin(lat0)*math.Cos(phi)*math.Cos(lam-lon0)
+	return (x + 1) / 2, (1 - y) / 2, true
+}
+
+func (o Orthographic) degreesPerCell(width int, height int) float64 {
+	return 180.0 / float64(max(width, height))
+}
+
+// GlobeHeight is the number of rows that keeps the globe round for the
+// given character aspect.
+func GlobeHeight(width int, charAspect float64) int {
+	return int(math.Round(float64(width) / charAspect))
+}
+
+// cellCenter returns the coordinates at the center of a grid cell.
+func cellCenter(grid *Grid, proj projection, x int, y int) (float64, float64, bool) {
+	return proj.inverse((float64(x)+0.5)/float64(grid.Width), (float64(y)+0.5)/float64(grid.Height))
+}
+
+// projectCell returns the cell a coordinate falls into, using the same
+// rounding as marker placement.
+func projectCell(proj projection, lon float64, lat float64, width int, height int) (int, int, bool) {
+	u, v, ok := proj.forward(lon, lat)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(math.Round(u * float64(width-1))), int(math.Round(v * float64(height-1))), true
+}
+
+// drawLimb outlines the globe on ocean cells at its edge so the hemisphere
+// stays visible when the ocean is blank.
+func drawLimb(grid *Grid, ch rune) {
+	outside := func(x int, y int) bool {
+		if x < 0 || y < 0 || x >= grid.Width || y >= grid.Height {
+			return true
+		}
+		return grid.At(x, y).Layer == LayerNone
+	}
+
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			if grid.At(x, y).Layer != LayerOcean {
+				continue
+			}
+			if outside(x-1, y) || outside(x+1, y) || outside(x, y-1) || outside(x, y+1) {
+				grid.Set(x, y, Cell{Ch: ch, Layer: LayerFrame})
+			}
+		}
+	}
+}
+
+// drawCurvedGraticule traces meridians and parallels point by point, for
+// projections where they are not straight columns and rows. Meridians stop
+// at the outermost parallels so they do not smear into the poles.
+func drawCurvedGraticule(grid *Grid, g Graticule, proj projection) {
+	if g.Interval <= 0 {
+		return
+	}
+
+	const onLon, onLat = 1, 2
+	marks := make([]uint8, len(grid.Cells))
+	mark := func(lon float64, lat float64, bit uint8) {
+		x, y, ok := projectCell(proj, lon, lat, grid.Width, grid.Height)
+		if ok && x >= 0 && y >= 0 && x < grid.Width && y < grid.Height {
+			marks[y*grid.Width+x] |= bit
+		}
+	}
+
+	step := proj.degreesPerCell(grid.Width, grid.Height) / 4
+	polar := 90.0 - math.Mod(90.0, g.Interval)
+	if polar == 90.0 {
+		polar -= g.Interval
+	}
+	meridianEnd := polar
+	if meridianEnd <= 0 {
+		meridianEnd = 90.0
+	}
+	for lon := -180.0; lon < 180.0; lon += g.Interval {
+		for lat := -meridianEnd; lat <= meridianEnd; lat += step {
+			mark(lon, lat, onLon)
+		}
+	}
+	for lat := -polar; lat <= polar; lat += g.Interval {
+		for lon := -180.0; lon < 180.0; lon += step {
+			mark(lon, lat, onLat)
+		}
+	}
+
+	for i, m := range marks {
+		if m == 0 {
+			continue
+		}
+		layer := grid.Cells[i].Layer
+		if layer == LayerNone || layer == LayerFrame || (!g.OverLand && layer != LayerOcean) {
+			continue
+		}
+
+		ch := runeOrDefault(g.LatChar, '-')
+		switch m {
+		case onLon | onLat:
+			ch = runeOrDefault(g.CrossChar, '+')
+		case onLon:
+			ch = runeOrDefault(g.LonChar, ':')
+		}
+		grid.Cells[i] = Cell{Ch: ch, Layer: LayerGraticule}
+	}
+}
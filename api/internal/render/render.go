@@ -0,0 +1,421 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+
+	mapascii "github.com/Kivayan/map-ascii"
+)
+
+type Viewport = mapascii.Viewport
+
+type Options struct {
+	Width       int
+	Supersample int
+	CharAspect  float64
+	Margin      int
+	Frame       bool
+	FrameStyle  FrameStyle
+	// Title is centered in the top frame border.
+	Title      string
+	Footer     *Footer
+	Charset    Charset
+	Ramp       []rune
+	OceanChar  rune
+	Borders    *Borders
+	Timezones  *Borders
+	Highlight  *Highlight
+	Choropleth *Choropleth
+	Field      *Field
+	SeaLevel   *SeaLevel
+	Graticule  *Graticule
+	Density    *Density
+	Overlay    *Overlay
+	Tracks     []Track
+	Symbols    []Symbol
+	Viewport   *Viewport
+	// Orthographic renders a globe instead of the viewport when set.
+	Orthographic *Orthographic
+	Markers      []Marker
+	// Latitudes grades land cells into that many equal bands from the north
+	// to the south pole, for Palette.MapGradient.
+	Latitudes int
+}
+
+// Render rasterizes the land mask into a canvas. It mirrors the layout of
+// mapascii.RenderWorldASCIIWithOptions (map, marker, frame, vertical margins)
+// while keeping per-cell layer information for colorizing and overlays.
+func Render(mask *mapascii.LandMask, opts Options) (*Canvas, error) {
+	return RenderContext(context.Background(), mask, opts)
+}
+
+// RenderContext is Render that gives up with ctx's error once ctx is done,
+// checked between drawing stages.
+func RenderContext(ctx context.Context, mask *mapascii.LandMask, opts Options) (*Canvas, error) {
+	if mask == nil || mask.Width < 2 || mask.Height < 2 || len(mask.Data) != mask.Width*mask.Height {
+		return nil, fmt.Errorf("invalid land mask")
+	}
+	if opts.Width <= 0 {
+		return nil, fmt.Errorf("size must be > 0, got %d", opts.Width)
+	}
+	if opts.Supersample <= 0 {
+		return nil, fmt.Errorf("supersample must be > 0, got %d", opts.Supersample)
+	}
+	if math.IsNaN(opts.CharAspect) || math.IsInf(opts.CharAspect, 0) || opts.CharAspect <= 0.0 {
+		return nil, fmt.Errorf("char_aspect must be > 0, got %v", opts.CharAspect)
+	}
+	if opts.Margin < 0 {
+		return nil, fmt.Errorf("vertical margin rows must be >= 0, got %d", opts.Margin)
+	}
+
+	viewport := WorldViewport()
+	if opts.Viewport != nil {
+		viewport = *opts.Viewport
+	}
+
+	width := opts.Width
+	height := MapHeight(width, opts.CharAspect, viewport)
+	var proj projection = equirectangular{viewport: viewport}
+	if opts.Orthographic != nil {
+		if !isFiniteCoord(opts.Orthographic.CenterLon, opts.Orthographic.CenterLat) {
+			return nil, fmt.Errorf("orthographic center must be finite")
+		}
+		height = GlobeHeight(width, opts.CharAspect)
+		proj = *opts.Orthographic
+	}
+	if height <= 0 {
+		return nil, fmt.Errorf("size=%d with char_aspect=%v and viewport produces zero map height", width, opts.CharAspect)
+	}
+
+	sample := func(lon float64, lat float64) float64 {
+		return SampleLand(mask, lon, lat)
+	}
+	if opts.SeaLevel != nil && opts.SeaLevel.Offset != 0 {
+		sample = opts.SeaLevel.sampler(sample)
+	}
+
+	grid := newGrid(width, height)
+	switch opts.Charset {
+	case CharsetBraille:
+		rasterizeBraille(grid, sample, proj, opts.Supersample)
+	case CharsetBlocks:
+		rasterizeBlocks(grid, sample, proj, opts.Supersample)
+	default:
+		rasterize(grid, sample, proj, opts.Supersample, opts.Ramp)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if opts.OceanChar != 0 {
+		fillOcean(grid, opts.OceanChar)
+	}
+	if opts.Latitudes > 0 {
+		gradeLatitudes(grid, proj, min(opts.Latitudes, math.MaxUint8))
+	}
+	ground := make([]Ground, len(grid.Cells))
+	for i, cell := range grid.Cells {
+		switch cell.Layer {
+		case LayerMap:
+			ground[i] = GroundLand
+		case LayerOcean:
+			ground[i] = GroundWater
+		}
+	}
+
+	var land []bool
+	if slices.ContainsFunc(opts.Markers, func(m Marker) bool { return m.SnapToLand }) {
+		land = make([]bool, len(grid.Cells))
+		for i, cell := range grid.Cells {
+			land[i] = cell.Layer == LayerMap
+		}
+	}
+
+	if opts.Orthographic != nil {
+		drawLimb(grid, '.')
+	}
+
+	// Timezone lines go first: border cells no longer count as land, so
+	// drawing them after the country borders would leave gaps.
+	if opts.Timezones != nil {
+		drawBorders(grid, *opts.Timezones, proj)
+	}
+
+	if opts.Borders != nil {
+		drawBorders(grid, *opts.Borders, proj)
+	}
+
+	if opts.Highlight != nil {
+		drawHighlight(grid, *opts.Highlight, proj)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	legendWidth := width
+	if opts.Frame {
+		legendWidth += 2
+	}
+	var below [][]Cell
+	if opts.Choropleth != nil {
+		below = append(below, legendRows(drawChoropleth(grid, *opts.Choropleth, proj), legendWidth)...)
+	}
+	if opts.Field != nil {
+		below = append(below, legendRows(drawField(grid, *opts.Field, proj), legendWidth)...)
+	}
+
+	if opts.Graticule != nil {
+		if opts.Orthographic != nil {
+			drawCurvedGraticule(grid, *opts.Graticule, proj)
+		} else {
+			drawGraticule(grid, *opts.Graticule, viewport)
+		}
+	}
+
+	if opts.Density != nil {
+		below = append(below, legendRows(drawDensity(grid, *opts.Density, proj), legendWidth)...)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if opts.Overlay != nil {
+		drawOverlay(grid, *opts.Overlay, proj)
+	}
+
+	for _, track := range opts.Tracks {
+		drawTrack(grid, track, proj)
+	}
+
+	drawSymbols(grid, opts.Symbols, proj)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	markers, err := drawMarkers(grid, opts.Markers, proj, land, opts.CharAspect)
+	if err != nil {
+		return nil, err
+	}
+	for i := range grid.Cells {
+		grid.Cells[i].Ground = ground[i]
+	}
+
+	var border *frame
+	if opts.Frame {
+		border = newFrame(opts.FrameStyle, opts.Title)
+	}
+	var inside [][]Cell
+	if opts.Footer != nil {
+		inside = append(inside, opts.Footer.row(width))
+	}
+	canvas := compose(grid, border, opts.Margin, inside, below)
+	top, left := opts.Margin, 0
+	if border != nil {
+		top, left = top+1, 1
+	}
+	for _, m := range markers {
+		if m.Visible {
+			m.Row, m.Col = m.Row+top, m.Col+left
+		}
+		canvas.Markers = append(canvas.Markers, m)
+	}
+	return canvas, nil
+}
+
+// fillOcean replaces the character of every ocean cell inside the map area.
+// Frame and margin rows are not part of the grid and stay untouched.
+func fillOcean(grid *Grid, ch rune) {
+	for i := range grid.Cells {
+		if grid.Cells[i].Layer == LayerOcean {
+			grid.Cells[i].Ch = ch
+		}
+	}
+}
+
+func gradeLatitudes(grid *Grid, proj projection, bands int) {
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			if grid.At(x, y).Layer != LayerMap {
+				continue
+			}
+			if _, lat, ok := cellCenter(grid, proj, x, y); ok {
+				band := min(int((90-lat)/180*float64(bands)), bands-1)
+				grid.Cells[y*grid.Width+x].Level = uint8(max(band, 0) + 1)
+			}
+		}
+	}
+}
+
+func WorldViewport() Viewport {
+	return Viewport{MinLon: -180.0, MinLat: -90.0, MaxLon: 180.0, MaxLat: 90.0}
+}
+
+// CenteredWorldViewport is the full world re-centered on the given meridian.
+// Longitudes beyond ±180 wrap around, which rolls the projected columns.
+func CenteredWorldViewport(centralMeridian float64) Viewport {
+	return Viewport{MinLon: centralMeridian - 180.0, MinLat: -90.0, MaxLon: centralMeridian + 180.0, MaxLat: 90.0}
+}
+
+func MapHeight(width int, charAspect float64, viewport Viewport) int {
+	lonSpan := viewport.MaxLon - viewport.MinLon
+	latSpan := viewport.MaxLat - viewport.MinLat
+	return int(math.Round((float64(width) * latSpan / lonSpan) / charAspect))
+}
+
+// FitTerminal picks the width and char aspect of a map that fills cols
+// columns without growing past rows, where height is MapHeight or
+// GlobeHeight for the map's viewport. It keeps charAspect when the map fits
+// and otherwise squashes it up to maxAspect before narrowing the map.
+func FitTerminal(cols int, rows int, charAspect float64, maxAspect float64, height func(width int, charAspect float64) int) (int, float64) {
+	width := max(cols, 1)
+	if rows < 1 || height(width, charAspect) <= rows {
+		return width, charAspect
+	}
+	if maxAspect > charAspect {
+		needed := charAspect * float64(height(width, charAspect)) / float64(rows)
+		charAspect = min(math.Ceil(needed*100)/100, maxAspect)
+	}
+	for width > 1 && height(width, charAspect) > rows {
+		width--
+	}
+	return width, charAspect
+}
+
+// rasterize maps land coverage to the density ramp. Cells whose center is
+// not visible in the projection are left blank on LayerNone.
+func rasterize(grid *Grid, sample landSampler, proj projection, supersample int, ramp []rune) {
+	subsamples := float64(supersample * supersample)
+
+	for row := 0; row < grid.Height; row++ {
+		for col := 0; col < grid.Width; col++ {
+			if _, _, ok := cellCenter(grid, proj, col, row); !ok {
+				grid.Set(col, row, Cell{Ch: ' ', Layer: LayerNone})
+				continue
+			}
+
+			landSum := 0.0
+			for sy := 0; sy < supersample; sy++ {
+				for sx := 0; sx < supersample; sx++ {
+					x := float64(col) + (float64(sx)+0.5)/float64(supersample)
+					y := float64(row) + (float64(sy)+0.5)/float64(supersample)
+
+					if lon, lat, ok := proj.inverse(x/float64(grid.Width), y/float64(grid.Height)); ok {
+						landSum += sample(lon, lat)
+					}
+				}
+			}
+
+			fraction := landSum / subsamples
+			ch, ocean := rune(charForLandFraction(fraction)), fraction < 0.12
+			if len(ramp) > 0 {
+				idx := rampIndex(len(ramp), fraction)
+				ch, ocean = ramp[idx], idx == 0
+			}
+
+			layer := LayerMap
+			if ocean {
+				layer = LayerOcean
+			}
+			grid.Set(col, row, Cell{Ch: ch, Layer: layer})
+		}
+	}
+}
+
+// landSampler returns the land coverage at lon/lat, from 0 to 1.
+type landSampler func(lon float64, lat float64) float64
+
+// SampleLand returns the mask value at lon/lat without validating the mask,
+// matching the nearest-pixel lookup used by the map-ascii library.
+func SampleLand(mask *mapascii.LandMask, lon float64, lat float64) float64 {
+	u := math.Mod((lon+180.0)/360.0, 1.0)
+	if u < 0.0 {
+		u += 1.0
+	}
+	v := clamp((90.0-lat)/180.0, 0.0, 1.0)
+
+	x := min(int(u*float64(mask.Width)), mask.Width-1)
+	y := min(int(v*float64(mask.Height)), mask.Height-1)
+
+	return mask.Data[y*mask.Width+x]
+}
+
+func charForLandFraction(fraction float64) byte {
+	switch {
+	case fraction < 0.12:
+		return ' '
+	case fraction < 0.38:
+		return '.'
+	case fraction < 0.62:
+		return '*'
+	case fraction < 0.86:
+		return '@'
+	default:
+		return '#'
+	}
+}
+
+// rampIndex spreads the land fraction evenly over a ramp of n characters,
+// from ocean at index 0 to full land at n-1.
+func rampIndex(n int, fraction float64) int {
+	idx := int(fraction * float64(n))
+	if idx >= n {
+		idx = n - 1
+	}
+	if idx < 0 {
+		idx = 0
+	}
+	return idx
+}
+
+// CellForLonLat returns the map cell a coordinate falls into, using the same
+// rounding as marker placement.
+func CellForLonLat(lon float64, lat float64, width int, height int, viewport Viewport) (int, int) {
+	x, y, _ := projectCell(equirectangular{viewport: viewport}, lon, lat, width, height)
+	return x, y
+}
+
+func normalizeLongitude(lon float64, viewport Viewport) float64 {
+	lonSpan := viewport.MaxLon - viewport.MinLon
+	u := (lon - viewport.MinLon) / lonSpan
+	if lonSpan >= 360.0 {
+		u = math.Mod(u, 1.0)
+		if u < 0.0 {
+			u += 1.0
+		}
+		return u
+	}
+
+	return clamp(u, 0.0, 1.0)
+}
+
+// wrapLongitude maps lon into [-180, 180).
+func wrapLongitude(lon float64) float64 {
+	lon = math.Mod(lon+180.0, 360.0)
+	if lon < 0.0 {
+		lon += 360.0
+	}
+	return lon - 180.0
+}
+
+func isFiniteCoord(lon float64, lat float64) bool {
+	return !math.IsNaN(lon) && !math.IsInf(lon, 0) && !math.IsNaN(lat) && !math.IsInf(lat, 0)
+}
+
+func runeOrDefault(value rune, fallback rune) rune {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
+
+func clamp(value float64, lo float64, hi float64) float64 {
+	if value < lo {
+		return lo
+	}
+	if value > hi {
+		return hi
+	}
+	return value
+}
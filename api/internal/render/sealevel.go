@@ -0,0 +1,26 @@
+package render
+
+// SeaLevel redraws the coastline for a sea Offset meters above (or, when
+// negative, below) today's. Land at or below a positive Offset floods and
+// sea floor above a negative Offset is exposed. Whether a point connects to
+// the ocean is not checked, so inland basins below the new level flood too.
+type SeaLevel struct {
+	Elevation func(lon float64, lat float64) (float64, bool)
+	Offset    float64
+}
+
+func (s SeaLevel) sampler(land landSampler) landSampler {
+	return func(lon float64, lat float64) float64 {
+		value := land(lon, lat)
+		elevation, ok := s.Elevation(lon, lat)
+		switch {
+		case !ok:
+			return value
+		case s.Offset > 0 && value > 0 && elevation <= s.Offset:
+			return 0
+		case s.Offset < 0 && value < 1 && elevation > s.Offset:
+			return 1
+		}
+		return value
+	}
+}
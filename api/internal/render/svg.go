@@ -0,0 +1,137 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Monospace fonts advance about 0.6em per character; these sizes keep
+// every coordinate a whole number.
+const (
+	svgFontSize   = 15
+	svgCharWidth  = 9
+	svgLineHeight = 18
+)
+
+// The terminal-like colors SVG and PNG draw uncolored cells with.
+var (
+	imageForeground = RGB(0xd0, 0xd0, 0xd0)
+	imageBackground = RGB(0x00, 0x00, 0x00)
+)
+
+// ansi16RGB approximates the named colors with xterm's defaults.
+var ansi16RGB = map[int]Color{
+	30: RGB(0x00, 0x00, 0x00),
+	31: RGB(0xcd, 0x00, 0x00),
+	32: RGB(0x00, 0xcd, 0x00),
+	33: RGB(0xcd, 0xcd, 0x00),
+	34: RGB(0x00, 0x00, 0xee),
+	35: RGB(0xcd, 0x00, 0xcd),
+	36: RGB(0x00, 0xcd, 0xcd),
+	37: RGB(0xe5, 0xe5, 0xe5),
+	90: RGB(0x7f, 0x7f, 0x7f),
+	91: RGB(0xff, 0x00, 0x00),
+	92: RGB(0x00, 0xff, 0x00),
+	93: RGB(0xff, 0xff, 0x00),
+	94: RGB(0x5c, 0x5c, 0xff),
+	95: RGB(0xff, 0x00, 0xff),
+	96: RGB(0x00, 0xff, 0xff),
+	97: RGB(0xff, 0xff, 0xff),
+}
+
+func (c Color) hex() string {
+	if c.kind == colorANSI16 {
+		c = ansi16RGB[c.code]
+	}
+	return fmt.Sprintf("#%02x%02x%02x", c.r, c.g, c.b)
+}
+
+type imageStyle struct {
+	fg, bg Color
+	attrs  Attrs
+}
+
+// imageStyles is the style of each cell of row in an image, with the
+// palette's colors and attributes when colored.
+func imageStyles(row []Cell, colored bool, palette Palette) []imageStyle {
+	styles := make([]imageStyle, len(row))
+	for col, cell := range row {
+		style := imageStyle{fg: imageForeground, bg: imageBackground}
+		if colored {
+			style.fg = palette.colorFor(cell).or(imageForeground)
+			style.bg = palette.backgroundFor(cell).or(imageBackground)
+			style.attrs = palette.attrsFor(cell)
+			if style.attrs&AttrReverse != 0 {
+				style.fg, style.bg = style.bg, style.fg
+			}
+		}
+		styles[col] = style
+	}
+	return styles
+}
+
+// SVG draws the canvas as monospaced text on a terminal-like black
+// background, with the palette's colors and attributes unless mode is
+// "never". Blink is ignored.
+func (c *Canvas) SVG(mode ColorMode, palette Palette) string {
+	colored := mode != ColorModeNever && mode != "" && !palette.empty()
+
+	columns := 0
+	for _, row := range c.Rows {
+		columns = max(columns, len(row))
+	}
+	width := columns * svgCharWidth
+	height := len(c.Rows) * svgLineHeight
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="monospace" font-size="%d">`+"\n", width, height, width, height, svgFontSize)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", imageBackground.hex())
+
+	for rowIdx, row := range c.Rows {
+		y := rowIdx * svgLineHeight
+		styles := imageStyles(row, colored, palette)
+
+		for start := 0; start < len(row); {
+			end := start + 1
+			for end < len(row) && styles[end].bg == styles[start].bg {
+				end++
+			}
+			if styles[start].bg != imageBackground {
+				fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", start*svgCharWidth, y, (end-start)*svgCharWidth, svgLineHeight, styles[start].bg.hex())
+			}
+			start = end
+		}
+
+		fmt.Fprintf(&b, `<text y="%d" xml:space="preserve">`, y+svgFontSize)
+		for start := 0; start < len(row); {
+			end := start + 1
+			for end < len(row) && styles[end].fg == styles[start].fg && styles[end].attrs == styles[start].attrs {
+				end++
+			}
+			var text strings.Builder
+			for _, cell := range row[start:end] {
+				cell.write(&text)
+			}
+			style := styles[start]
+			fmt.Fprintf(&b, `<tspan x="%d" fill="%s"`, start*svgCharWidth, style.fg.hex())
+			if style.attrs&AttrBold != 0 {
+				b.WriteString(` font-weight="bold"`)
+			}
+			if style.attrs&AttrUnderline != 0 {
+				b.WriteString(` text-decoration="underline"`)
+			}
+			b.WriteString(">" + svgEscape(text.String()) + "</tspan>")
+			start = end
+		}
+		b.WriteString("</text>\n")
+	}
+
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+var svgEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func svgEscape(s string) string {
+	return svgEscaper.Replace(s)
+}
@@ -0,0 +1,18 @@
+package render
+
+// Symbol is a single character plotted at a coordinate, such as an
+// earthquake scaled by magnitude. When symbols share a cell the later one
+// wins, so callers order them by importance.
+type Symbol struct {
+	Lon float64
+	Lat float64
+	Ch  rune
+}
+
+func drawSymbols(grid *Grid, symbols []Symbol, proj projection) {
+	for _, symbol := range symbols {
+		if x, y, ok := projectCell(proj, symbol.Lon, symbol.Lat, grid.Width, grid.Height); ok {
+			grid.Set(x, y, Cell{Ch: symbol.Ch, Layer: LayerOverlay})
+		}
+	}
+}
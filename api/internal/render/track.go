@@ -0,0 +1,56 @@
+package render
+
+import (
+	"math"
+
+	"map-ascii-generator/api/internal/geo"
+)
+
+// Track is a path sampled in time, such as a satellite ground track. Unlike
+// overlay lines, segments that jump by more than 180 degrees of longitude
+// are taken to cross the antimeridian and are split there instead of being
+// drawn across the whole map.
+type Track struct {
+	Points []geo.Point
+	Char   rune
+}
+
+func drawTrack(grid *Grid, track Track, proj projection) {
+	ch := runeOrDefault(track.Char, '~')
+	step := proj.degreesPerCell(grid.Width, grid.Height) / 2
+	for _, line := range splitAntimeridian(track.Points) {
+		traceLine(grid, line, ch, step, proj)
+	}
+}
+
+// splitAntimeridian cuts points into lines that do not cross ±180°, adding
+// the interpolated crossing to both sides.
+func splitAntimeridian(points []geo.Point) [][]geo.Point {
+	if len(points) == 0 {
+		return nil
+	}
+
+	var lines [][]geo.Point
+	line := []geo.Point{points[0]}
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		dLon := b.Lon() - a.Lon()
+		if math.Abs(dLon) <= 180 {
+			line = append(line, b)
+			continue
+		}
+
+		edge := 180.0
+		if dLon > 0 {
+			edge = -180
+		}
+		// Unwrap b next to a to interpolate the latitude at the edge.
+		bLon := b.Lon() - math.Copysign(360, dLon)
+		t := (edge - a.Lon()) / (bLon - a.Lon())
+		lat := a.Lat() + t*(b.Lat()-a.Lat())
+
+		lines = append(lines, append(line, geo.Point{edge, lat}))
+		line = []geo.Point{{-edge, lat}, b}
+	}
+	return append(lines, line)
+}
@@ -0,0 +1,257 @@
+package simpleyaml
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Parse decodes the small YAML subset used by the server's config files:
+// block maps, block lists, flow lists ([a, b]), quoted/unquoted scalars and
+// comments. Scalars are returned as strings; callers convert them.
+func Parse(data []byte) (map[string]any, error) {
+	lines, err := splitLines(string(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return map[string]any{}, nil
+	}
+
+	p := &parser{lines: lines}
+	root, err := p.parseMap(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, p.errorf("unexpected content")
+	}
+
+	return root, nil
+}
+
+type line struct {
+	num    int
+	indent int
+	text   string
+}
+
+type parser struct {
+	lines []line
+	pos   int
+}
+
+func splitLines(src string) ([]line, error) {
+	var out []line
+	for idx, raw := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		trimmedLeft := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(trimmedLeft, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", idx+1)
+		}
+
+		text := strings.TrimSpace(stripComment(trimmedLeft))
+		if text == "" || text == "---" {
+			continue
+		}
+
+		out = append(out, line{num: idx + 1, indent: len(raw) - len(trimmedLeft), text: text})
+	}
+
+	return out, nil
+}
+
+func stripComment(s string) string {
+	var quote rune
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || s[i-1] == ' '):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	num := 0
+	if p.pos < len(p.lines) {
+		num = p.lines[p.pos].num
+	} else if len(p.lines) > 0 {
+		num = p.lines[len(p.lines)-1].num
+	}
+	return fmt.Errorf("line %d: %s", num, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) parseBlock(indent int) (any, error) {
+	if isListItem(p.lines[p.pos].text) {
+		return p.parseList(indent)
+	}
+	return p.parseMap(indent)
+}
+
+func (p *parser) parseMap(indent int) (map[string]any, error) {
+	out := map[string]any{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		if isListItem(l.text) {
+			return nil, p.errorf("unexpected list item in mapping")
+		}
+
+		key, rest, ok := splitKey(l.text)
+		if !ok {
+			return nil, p.errorf("expected \"key: value\"")
+		}
+		if _, exists := out[key]; exists {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		p.pos++
+
+		if rest != "" {
+			value, err := parseScalar(rest)
+			if err != nil {
+				return nil, p.errorf("%v", err)
+			}
+			out[key] = value
+			continue
+		}
+
+		if p.pos >= len(p.lines) {
+			out[key] = ""
+			continue
+		}
+
+		next := p.lines[p.pos]
+		switch {
+		case next.indent > indent:
+			value, err := p.parseBlock(next.indent)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = value
+		case next.indent == indent && isListItem(next.text):
+			value, err := p.parseList(indent)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = value
+		default:
+			out[key] = ""
+		}
+	}
+
+	return out, nil
+}
+
+func (p *parser) parseList(indent int) ([]any, error) {
+	out := []any{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent != indent || !isListItem(l.text) {
+			if l.indent > indent {
+				return nil, p.errorf("unexpected indentation")
+			}
+			break
+		}
+
+		rest := strings.TrimSpace(strings.TrimPrefix(l.text, "-"))
+		if rest == "" {
+			p.pos++
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				value, err := p.parseBlock(p.lines[p.pos].indent)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, value)
+			} else {
+				out = append(out, "")
+			}
+			continue
+		}
+
+		if _, _, ok := splitKey(rest); ok {
+			// "- key: value" opens a mapping whose keys align with "key".
+			itemIndent := l.indent + len(l.text) - len(rest)
+			p.lines[p.pos] = line{num: l.num, indent: itemIndent, text: rest}
+			value, err := p.parseMap(itemIndent)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, value)
+			continue
+		}
+
+		value, err := parseScalar(rest)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		out = append(out, value)
+		p.pos++
+	}
+
+	return out, nil
+}
+
+func isListItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func splitKey(text string) (string, string, bool) {
+	var quote rune
+	for i, r := range text {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ':' && (i == len(text)-1 || text[i+1] == ' '):
+			key := strings.TrimSpace(text[:i])
+			if key == "" {
+				return "", "", false
+			}
+			return unquote(key), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+func parseScalar(text string) (any, error) {
+	if strings.HasPrefix(text, "[") {
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("unterminated flow list")
+		}
+		inner := strings.TrimSpace(text[1 : len(text)-1])
+		items := []any{}
+		if inner == "" {
+			return items, nil
+		}
+		for _, part := range strings.Split(inner, ",") {
+			items = append(items, unquote(strings.TrimSpace(part)))
+		}
+		return items, nil
+	}
+
+	if (strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'")) && (len(text) < 2 || text[len(text)-1] != text[0]) {
+		return nil, fmt.Errorf("unterminated quoted string")
+	}
+
+	return unquote(text), nil
+}
+
+func unquote(text string) string {
+	if len(text) >= 2 && (text[0] == '"' || text[0] == '\'') && text[len(text)-1] == text[0] {
+		return text[1 : len(text)-1]
+	}
+	return text
+}
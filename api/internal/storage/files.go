@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const recordExt = ".json"
+
+// Dir keeps each record in a file of its own, in a subdirectory per
+// collection.
+type Dir struct {
+	path string
+	// mu serializes writes; readers see either the old or the new file.
+	mu sync.Mutex
+}
+
+// OpenDir uses path as the storage directory, creating it if needed.
+func OpenDir(path string) (*Dir, error) {
+	if path == "" {
+		return nil, fmt.Errorf("storage directory must not be empty")
+	}
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, fmt.Errorf("create storage directory: %w", err)
+	}
+	return &Dir{path: path}, nil
+}
+
+func (d *Dir) Path() string {
+	return d.path
+}
+
+// Put stores value as JSON under key, replacing any previous record.
+func (d *Dir) Put(collection string, key string, value any) error {
+	file, err := d.file(collection, key)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".record-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// Get decodes the record stored under key into value and reports whether
+// there was one.
+func (d *Dir) Get(collection string, key string, value any) (bool, error) {
+	file, err := d.file(collection, key)
+	if err != nil {
+		return false, err
+	}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return false, fmt.Errorf("%s: %w", file, err)
+	}
+	return true, nil
+}
+
+// Delete removes the record stored under key; missing records are not an
+// error.
+func (d *Dir) Delete(collection string, key string) error {
+	file, err := d.file(collection, key)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Keys lists the keys in collection in sorted order.
+func (d *Dir) Keys(collection string) ([]string, error) {
+	if err := checkName("collection", collection); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(d.path, collection))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), recordExt)
+		if !ok || entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		key, err := url.PathUnescape(name)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// file maps a record to its path. Keys are escaped, so any string can be a
+// key without reaching outside the collection.
+func (d *Dir) file(collection string, key string) (string, error) {
+	if err := checkName("collection", collection); err != nil {
+		return "", err
+	}
+	if key == "" {
+		return "", fmt.Errorf("key must not be empty")
+	}
+	name := url.PathEscape(key)
+	if strings.HasPrefix(name, ".") {
+		name = "%2E" + name[1:]
+	}
+	return filepath.Join(d.path, collection, name+recordExt), nil
+}
+
+func checkName(kind string, name string) error {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid %s name %q", kind, name)
+	}
+	return nil
+}
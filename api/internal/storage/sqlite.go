@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// SQLite keeps the records in a SQLite database file, as rows of a table
+// records (collection, key, value) with the value as JSON text, so the
+// sqlite3 shell can read them. The module has no SQLite driver: the records
+// are held in memory and every change writes a new database file in the
+// SQLite format and renames it over the old one. That suits the few
+// megabytes of state the server keeps, and a crash leaves either the old
+// or the new file.
+type SQLite struct {
+	path string
+
+	mu      sync.RWMutex
+	records map[string]map[string][]byte
+	// counter is the file change counter of the database header.
+	counter uint32
+}
+
+// OpenSQLite reads the database at path, creating it and its directory if
+// needed. The file must not be written by other programs while it is open.
+func OpenSQLite(path string) (*SQLite, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create storage directory: %w", err)
+	}
+	db := &SQLite{path: path, records: make(map[string]map[string][]byte)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := db.write(); err != nil {
+			return nil, fmt.Errorf("create database: %w", err)
+		}
+		return db, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read database: %w", err)
+	}
+	rows, counter, err := decodeDatabase(data)
+	if err != nil {
+		return nil, fmt.Errorf("read database %s: %w", path, err)
+	}
+	for _, row := range rows {
+		db.collection(row.collection)[row.key] = row.value
+	}
+	db.counter = counter
+	return db, nil
+}
+
+func (db *SQLite) Path() string {
+	return db.path
+}
+
+func (db *SQLite) Put(collection string, key string, value any) error {
+	if err := checkRecord(collection, key); err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	records := db.collection(collection)
+	old, existed := records[key]
+	records[key] = data
+	if err := db.write(); err != nil {
+		if existed {
+			records[key] = old
+		} else {
+			delete(records, key)
+		}
+		return err
+	}
+	return nil
+}
+
+func (db *SQLite) Get(collection string, key string, value any) (bool, error) {
+	if err := checkRecord(collection, key); err != nil {
+		return false, err
+	}
+
+	db.mu.RLock()
+	data, ok := db.records[collection][key]
+	db.mu.RUnlock()
+
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return false, fmt.Errorf("%s %s/%s: %w", db.path, collection, key, err)
+	}
+	return true, nil
+}
+
+func (db *SQLite) Delete(collection string, key string) error {
+	if err := checkRecord(collection, key); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	old, ok := db.records[collection][key]
+	if !ok {
+		return nil
+	}
+	delete(db.records[collection], key)
+	if err := db.write(); err != nil {
+		db.records[collection][key] = old
+		return err
+	}
+	return nil
+}
+
+func (db *SQLite) Keys(collection string) ([]string, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("collection must not be empty")
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return slices.Sorted(maps.Keys(db.records[collection])), nil
+}
+
+// collection returns the records of name, adding the collection if
+// needed. The caller holds the write lock.
+func (db *SQLite) collection(name string) map[string][]byte {
+	records, ok := db.records[name]
+	if !ok {
+		records = make(map[string][]byte)
+		db.records[name] = records
+	}
+	return records
+}
+
+// write replaces the database file with the current records, in order of
+// collection and key. The caller holds the write lock.
+func (db *SQLite) write() error {
+	var rows []row
+	for _, collection := range slices.Sorted(maps.Keys(db.records)) {
+		records := db.records[collection]
+		for _, key := range slices.Sorted(maps.Keys(records)) {
+			rows = append(rows, row{collection: collection, key: key, value: records[key]})
+		}
+	}
+	data := encodeDatabase(rows, db.counter+1)
+
+	tmp, err := os.CreateTemp(filepath.Dir(db.path), ".state-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), db.path); err != nil {
+		return err
+	}
+	db.counter++
+	return nil
+}
+
+func checkRecord(collection string, key string) error {
+	if collection == "" {
+		return fmt.Errorf("collection must not be empty")
+	}
+	if key == "" {
+		return fmt.Errorf("key must not be empty")
+	}
+	return nil
+}
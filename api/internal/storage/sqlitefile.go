@@ -0,0 +1,526 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// This file reads and writes the parts of the SQLite database file format
+// (https://www.sqlite.org/fileformat.html) the records table needs: the
+// header, table b-trees and overflow pages. Writing always lays out a fresh
+// database; reading follows whatever layout the sqlite3 shell left behind.
+
+const (
+	pageSize = 4096
+	// sqliteVersion is the library version the header claims wrote the
+	// file, 3.46.0.
+	sqliteVersion = 3046000
+
+	pageInteriorTable = 0x05
+	pageLeafTable     = 0x0d
+
+	recordsTable  = "records"
+	recordsSchema = "CREATE TABLE records (collection TEXT NOT NULL, key TEXT NOT NULL, value TEXT NOT NULL)"
+)
+
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+// row is a row of the records table.
+type row struct {
+	collection string
+	key        string
+	value      []byte
+}
+
+// encodeDatabase lays out a database holding rows: the schema on page 1
+// and the records table in the pages after it.
+func encodeDatabase(rows []row, counter uint32) []byte {
+	p := &pager{pages: [][]byte{make([]byte, pageSize)}}
+
+	cells := make([][]byte, len(rows))
+	for i, r := range rows {
+		cells[i] = p.leafCell(int64(i+1), record(r.collection, r.key, r.value))
+	}
+	root := p.tree(cells)
+
+	schema := p.leafCell(1, record("table", recordsTable, recordsTable, int64(root), recordsSchema))
+	writeLeaf(p.pages[0], 100, [][]byte{schema})
+
+	header := p.pages[0][:100]
+	copy(header, sqliteMagic)
+	binary.BigEndian.PutUint16(header[16:], pageSize)
+	header[18], header[19] = 1, 1
+	header[21], header[22], header[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(header[24:], counter)
+	binary.BigEndian.PutUint32(header[28:], uint32(len(p.pages)))
+	binary.BigEndian.PutUint32(header[40:], 1)
+	binary.BigEndian.PutUint32(header[44:], 4)
+	binary.BigEndian.PutUint32(header[56:], 1)
+	binary.BigEndian.PutUint32(header[92:], counter)
+	binary.BigEndian.PutUint32(header[96:], sqliteVersion)
+
+	return bytes.Join(p.pages, nil)
+}
+
+// pager hands out the pages of a database being written, numbered from 1.
+type pager struct {
+	pages [][]byte
+}
+
+func (p *pager) add() (int, []byte) {
+	page := make([]byte, pageSize)
+	p.pages = append(p.pages, page)
+	return len(p.pages), page
+}
+
+// leafCell is a table leaf cell for payload, spilling what does not fit on
+// the page to a chain of overflow pages.
+func (p *pager) leafCell(rowid int64, payload []byte) []byte {
+	cell := appendVarint(nil, uint64(len(payload)))
+	cell = appendVarint(cell, uint64(rowid))
+
+	local := localPayload(len(payload), pageSize)
+	cell = append(cell, payload[:local]...)
+	if local == len(payload) {
+		return cell
+	}
+
+	number, page := p.add()
+	cell = binary.BigEndian.AppendUint32(cell, uint32(number))
+	for rest := payload[local:]; ; {
+		rest = rest[copy(page[4:], rest):]
+		if len(rest) == 0 {
+			return cell
+		}
+		prev := page
+		number, page = p.add()
+		binary.BigEndian.PutUint32(prev, uint32(number))
+	}
+}
+
+// maxInteriorCells is how many child pointers fit on an interior page
+// besides the right-most one, with rowids of up to 9 bytes.
+const maxInteriorCells = (pageSize - 12) / (4 + 9 + 2)
+
+// tree writes a table b-tree holding cells, whose rowids run from 1, and
+// returns its root page.
+func (p *pager) tree(cells [][]byte) int {
+	type child struct {
+		page     int
+		maxRowid int64
+	}
+
+	// Fill leaves in order, starting a new one when the next cell and its
+	// pointer would not fit.
+	var children []child
+	for start := 0; start < len(cells) || len(children) == 0; {
+		end, used := start, 8
+		for end < len(cells) && used+len(cells[end])+2 <= pageSize {
+			used += len(cells[end]) + 2
+			end++
+		}
+		number, page := p.add()
+		writeLeaf(page, 0, cells[start:end])
+		children = append(children, child{page: number, maxRowid: int64(end)})
+		start = end
+	}
+
+	// Interior pages point at the children of the level below: a cell
+	// per child with its largest rowid, and the last child as the
+	// right-most pointer. Children are spread evenly, so every page has
+	// at least one cell.
+	for len(children) > 1 {
+		groups := (len(children) + maxInteriorCells) / (maxInteriorCells + 1)
+		var parents []child
+		for g := range groups {
+			group := children[g*len(children)/groups : (g+1)*len(children)/groups]
+			pointers := make([][]byte, len(group)-1)
+			for i, c := range group[:len(group)-1] {
+				pointers[i] = appendVarint(binary.BigEndian.AppendUint32(nil, uint32(c.page)), uint64(c.maxRowid))
+			}
+			last := group[len(group)-1]
+			number, page := p.add()
+			writeInterior(page, pointers, last.page)
+			parents = append(parents, child{page: number, maxRowid: last.maxRowid})
+		}
+		children = parents
+	}
+	return children[0].page
+}
+
+// writeLeaf lays out a table leaf page with its header at offset and the
+// cells packed at the end of the page.
+func writeLeaf(page []byte, offset int, cells [][]byte) {
+	writeCells(page, offset, pageLeafTable, 8, cells)
+}
+
+func writeInterior(page []byte, cells [][]byte, rightmost int) {
+	writeCells(page, 0, pageInteriorTable, 12, cells)
+	binary.BigEndian.PutUint32(page[8:], uint32(rightmost))
+}
+
+func writeCells(page []byte, offset int, kind byte, headerSize int, cells [][]byte) {
+	content := len(page)
+	for i, cell := range cells {
+		content -= len(cell)
+		copy(page[content:], cell)
+		binary.BigEndian.PutUint16(page[offset+headerSize+2*i:], uint16(content))
+	}
+	page[offset] = kind
+	binary.BigEndian.PutUint16(page[offset+3:], uint16(len(cells)))
+	// A content area starting at 65536 is written as 0.
+	binary.BigEndian.PutUint16(page[offset+5:], uint16(content))
+}
+
+// localPayload is how many bytes of a table leaf cell's payload of size
+// total stay on the page, for pages of usable bytes.
+func localPayload(total int, usable int) int {
+	maxLocal := usable - 35
+	if total <= maxLocal {
+		return total
+	}
+	minLocal := (usable-12)*32/255 - 23
+	local := minLocal + (total-minLocal)%(usable-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+	return local
+}
+
+// record encodes values, which are strings, byte slices holding text and
+// integers, in the record format.
+func record(values ...any) []byte {
+	var types, body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case string:
+			types = appendVarint(types, uint64(len(v))*2+13)
+			body = append(body, v...)
+		case []byte:
+			types = appendVarint(types, uint64(len(v))*2+13)
+			body = append(body, v...)
+		case int64:
+			kind, size := intSerialType(v)
+			types = appendVarint(types, kind)
+			for i := size - 1; i >= 0; i-- {
+				body = append(body, byte(v>>(8*i)))
+			}
+		}
+	}
+
+	// The header size counts its own varint.
+	size := len(types) + 1
+	for len(appendVarint(nil, uint64(size))) != size-len(types) {
+		size = len(types) + len(appendVarint(nil, uint64(size)))
+	}
+	out := appendVarint(nil, uint64(size))
+	out = append(out, types...)
+	return append(out, body...)
+}
+
+// intSerialType is the serial type and size in bytes of the smallest
+// integer encoding for v.
+func intSerialType(v int64) (uint64, int) {
+	switch {
+	case v == 0:
+		return 8, 0
+	case v == 1:
+		return 9, 0
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		return 1, 1
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		return 2, 2
+	case v >= -1<<23 && v < 1<<23:
+		return 3, 3
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		return 4, 4
+	case v >= -1<<47 && v < 1<<47:
+		return 5, 6
+	default:
+		return 6, 8
+	}
+}
+
+// appendVarint appends v as a SQLite varint: big-endian groups of 7 bits
+// with the high bit set on all but the last byte, and a ninth byte of
+// 8 bits for values that need it.
+func appendVarint(b []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(b, buf[:]...)
+	}
+	var buf [8]byte
+	i := len(buf) - 1
+	buf[i] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		buf[i] = byte(v&0x7f) | 0x80
+	}
+	return append(b, buf[i:]...)
+}
+
+// readVarint decodes the varint at the start of b and returns its length,
+// 0 when b ends first.
+func readVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9; i++ {
+		if i >= len(b) {
+			return 0, 0
+		}
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return v, 9
+}
+
+// decodeDatabase reads the rows of the records table and the file change
+// counter from a database file.
+func decodeDatabase(data []byte) ([]row, uint32, error) {
+	if len(data) < 100 || !bytes.Equal(data[:16], sqliteMagic) {
+		return nil, 0, fmt.Errorf("not a SQLite database")
+	}
+	size := int(binary.BigEndian.Uint16(data[16:]))
+	if size == 1 {
+		size = 65536
+	}
+	if size < 512 || size&(size-1) != 0 || len(data)%size != 0 {
+		return nil, 0, fmt.Errorf("invalid page size %d", size)
+	}
+	if data[18] > 1 || data[19] > 1 {
+		return nil, 0, fmt.Errorf("database is in WAL mode; switch it back with PRAGMA journal_mode=DELETE")
+	}
+	if encoding := binary.BigEndian.Uint32(data[56:]); encoding != 1 {
+		return nil, 0, fmt.Errorf("database text encoding must be UTF-8")
+	}
+	r := &reader{data: data, pageSize: size, usable: size - int(data[20])}
+
+	root := 0
+	err := r.table(1, func(values []any) error {
+		if len(values) >= 4 && values[0] == "table" && values[1] == recordsTable {
+			rootpage, _ := values[3].(int64)
+			root = int(rootpage)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("schema: %w", err)
+	}
+	if root == 0 {
+		return nil, 0, fmt.Errorf("no %s table", recordsTable)
+	}
+
+	var rows []row
+	err = r.table(root, func(values []any) error {
+		if len(values) < 3 {
+			return fmt.Errorf("%s row has %d columns, want 3", recordsTable, len(values))
+		}
+		collection, ok1 := text(values[0])
+		key, ok2 := text(values[1])
+		value, ok3 := text(values[2])
+		if !ok1 || !ok2 || !ok3 {
+			return fmt.Errorf("%s row is not text", recordsTable)
+		}
+		rows = append(rows, row{collection: collection, key: key, value: []byte(value)})
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", recordsTable, err)
+	}
+	return rows, binary.BigEndian.Uint32(data[24:]), nil
+}
+
+func text(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	}
+	return "", false
+}
+
+// reader walks the table b-trees of a database file.
+type reader struct {
+	data     []byte
+	pageSize int
+	usable   int
+	visited  map[int]bool
+}
+
+func (r *reader) page(number int) ([]byte, error) {
+	if number < 1 || number*r.pageSize > len(r.data) {
+		return nil, fmt.Errorf("page %d out of range", number)
+	}
+	if r.visited[number] {
+		return nil, fmt.Errorf("page %d is used twice", number)
+	}
+	if r.visited == nil {
+		r.visited = make(map[int]bool)
+	}
+	r.visited[number] = true
+	return r.data[(number-1)*r.pageSize : number*r.pageSize], nil
+}
+
+// table calls fn with the values of every row of the table b-tree rooted
+// at root, in rowid order.
+func (r *reader) table(root int, fn func([]any) error) error {
+	page, err := r.page(root)
+	if err != nil {
+		return err
+	}
+	header := page
+	if root == 1 {
+		header = page[100:]
+	}
+	if len(header) < 12 {
+		return fmt.Errorf("page %d is truncated", root)
+	}
+	kind := header[0]
+	headerSize := 8
+	if kind == pageInteriorTable {
+		headerSize = 12
+	} else if kind != pageLeafTable {
+		return fmt.Errorf("page %d is not a table b-tree page", root)
+	}
+
+	count := int(binary.BigEndian.Uint16(header[3:]))
+	if headerSize+2*count > len(header) {
+		return fmt.Errorf("page %d has too many cells", root)
+	}
+	for i := range count {
+		offset := int(binary.BigEndian.Uint16(header[headerSize+2*i:]))
+		if offset >= len(page) {
+			return fmt.Errorf("page %d: cell %d out of range", root, i)
+		}
+		cell := page[offset:]
+		if kind == pageInteriorTable {
+			if len(cell) < 4 {
+				return fmt.Errorf("page %d: cell %d is truncated", root, i)
+			}
+			if err := r.table(int(binary.BigEndian.Uint32(cell)), fn); err != nil {
+				return err
+			}
+			continue
+		}
+		payload, err := r.payload(cell)
+		if err != nil {
+			return fmt.Errorf("page %d: cell %d: %w", root, i, err)
+		}
+		values, err := decodeRecord(payload)
+		if err != nil {
+			return fmt.Errorf("page %d: cell %d: %w", root, i, err)
+		}
+		if err := fn(values); err != nil {
+			return err
+		}
+	}
+	if kind == pageInteriorTable {
+		return r.table(int(binary.BigEndian.Uint32(header[8:])), fn)
+	}
+	return nil
+}
+
+// payload reads the payload of a table leaf cell, following its overflow
+// pages.
+func (r *reader) payload(cell []byte) ([]byte, error) {
+	total, n := readVarint(cell)
+	if n == 0 || total > uint64(len(r.data)) {
+		return nil, fmt.Errorf("invalid payload size")
+	}
+	cell = cell[n:]
+	if _, n = readVarint(cell); n == 0 {
+		return nil, fmt.Errorf("invalid rowid")
+	}
+	cell = cell[n:]
+
+	local := localPayload(int(total), r.usable)
+	if local > len(cell) || (local < int(total) && local+4 > len(cell)) {
+		return nil, fmt.Errorf("cell is truncated")
+	}
+	payload := append([]byte(nil), cell[:local]...)
+	next := 0
+	if local < int(total) {
+		next = int(binary.BigEndian.Uint32(cell[local:]))
+	}
+	for len(payload) < int(total) {
+		page, err := r.page(next)
+		if err != nil {
+			return nil, fmt.Errorf("overflow: %w", err)
+		}
+		chunk := page[4:r.usable]
+		payload = append(payload, chunk[:min(len(chunk), int(total)-len(payload))]...)
+		next = int(binary.BigEndian.Uint32(page))
+	}
+	return payload, nil
+}
+
+// decodeRecord reads the values of a record: nil, int64, float64, string
+// for text and []byte for blobs.
+func decodeRecord(payload []byte) ([]any, error) {
+	headerSize, n := readVarint(payload)
+	if n == 0 || headerSize > uint64(len(payload)) {
+		return nil, fmt.Errorf("invalid record header")
+	}
+	types, body := payload[n:headerSize], payload[headerSize:]
+
+	var values []any
+	for len(types) > 0 {
+		kind, n := readVarint(types)
+		if n == 0 {
+			return nil, fmt.Errorf("invalid record header")
+		}
+		types = types[n:]
+
+		size := 0
+		switch {
+		case kind >= 12:
+			size = int((kind - 12) / 2)
+		case kind >= 1 && kind <= 4:
+			size = int(kind)
+		case kind == 5:
+			size = 6
+		case kind == 6 || kind == 7:
+			size = 8
+		case kind == 10 || kind == 11:
+			return nil, fmt.Errorf("invalid serial type %d", kind)
+		}
+		if size > len(body) {
+			return nil, fmt.Errorf("record is truncated")
+		}
+		field := body[:size]
+		body = body[size:]
+
+		switch {
+		case kind == 0:
+			values = append(values, nil)
+		case kind == 8 || kind == 9:
+			values = append(values, int64(kind-8))
+		case kind == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(field)))
+		case kind <= 6:
+			v := int64(int8(field[0]))
+			for _, b := range field[1:] {
+				v = v<<8 | int64(b)
+			}
+			values = append(values, v)
+		case kind%2 == 1:
+			values = append(values, string(field))
+		default:
+			values = append(values, append([]byte(nil), field...))
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,57 @@
+// Package storage keeps small JSON records by collection and key, in a
+// SQLite database by default or as one file per record.
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	BackendSQLite = "sqlite"
+	BackendFiles  = "files"
+
+	// databaseFile is the SQLite database in the state directory.
+	databaseFile = "state.db"
+)
+
+// Backends are the accepted values of Open's backend.
+var Backends = []string{BackendSQLite, BackendFiles}
+
+type Store interface {
+	// Put stores value as JSON under key, replacing any previous record.
+	Put(collection string, key string, value any) error
+	// Get decodes the record stored under key into value and reports
+	// whether there was one.
+	Get(collection string, key string, value any) (bool, error)
+	// Delete removes the record stored under key; missing records are not
+	// an error.
+	Delete(collection string, key string) error
+	// Keys lists the keys in collection in sorted order.
+	Keys(collection string) ([]string, error)
+}
+
+// Open keeps records in dir with backend: in dir/state.db for
+// BackendSQLite, or as files in dir for BackendFiles.
+func Open(backend string, dir string) (Store, error) {
+	switch backend {
+	case BackendSQLite:
+		if dir == "" {
+			return nil, fmt.Errorf("storage directory must not be empty")
+		}
+		db, err := OpenSQLite(filepath.Join(dir, databaseFile))
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case BackendFiles:
+		d, err := OpenDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
+	default:
+		return nil, fmt.Errorf("storage backend must be one of: %s", strings.Join(Backends, ", "))
+	}
+}
@@ -0,0 +1,238 @@
+// Package trace records OpenTelemetry-style spans and exports them to an
+// OTLP/HTTP collector as JSON, without the OpenTelemetry SDK. Incoming W3C
+// traceparent headers are continued; spans are only kept for sampled
+// traces. A nil *Tracer and a nil *Span do nothing, so callers need no
+// checks when tracing is off.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// Kind is the OTLP span kind.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+)
+
+// Attr is a span attribute. Values are strings, ints, float64s or bools.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+func String(key string, value string) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+func Int(key string, value int) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+func Float64(key string, value float64) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+func Bool(key string, value bool) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+type Span struct {
+	tracer   *Tracer
+	traceID  TraceID
+	spanID   SpanID
+	parentID SpanID
+	kind     Kind
+	start    time.Time
+
+	mu       sync.Mutex
+	name     string
+	end      time.Time
+	attrs    []Attr
+	failed   bool
+	errorMsg string
+	ended    bool
+}
+
+type spanContext struct{}
+
+// FromContext returns the span ctx carries, or nil.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContext{}).(*Span)
+	return span
+}
+
+// Tracer starts spans and hands finished ones to its exporter.
+type Tracer struct {
+	exporter *Exporter
+	// sampleRatio is the share of new traces kept; traces continued from
+	// a traceparent header follow its sampled flag instead.
+	sampleRatio float64
+}
+
+func New(exporter *Exporter, sampleRatio float64) *Tracer {
+	return &Tracer{exporter: exporter, sampleRatio: min(max(sampleRatio, 0), 1)}
+}
+
+// Start begins a span that is a child of the span in ctx, or the root of a
+// new trace, and returns ctx carrying it. Unsampled traces get a nil span.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := &Span{
+		tracer:   t,
+		traceID:  parent.traceID,
+		spanID:   newSpanID(),
+		parentID: parent.spanID,
+		kind:     KindInternal,
+		start:    time.Now(),
+		name:     name,
+		attrs:    attrs,
+	}
+	return context.WithValue(ctx, spanContext{}, span), span
+}
+
+// StartServer begins the server span of an incoming request, continuing
+// the trace of its traceparent header when it has a valid one.
+func (t *Tracer) StartServer(r *http.Request, name string, attrs ...Attr) (context.Context, *Span) {
+	ctx := r.Context()
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{tracer: t, spanID: newSpanID(), kind: KindServer, start: time.Now(), name: name, attrs: attrs}
+	traceID, parentID, sampled, ok := parseTraceparent(r.Header.Get("traceparent"))
+	if ok {
+		span.traceID, span.parentID = traceID, parentID
+	} else {
+		span.traceID = newTraceID()
+		sampled = t.sample(span.traceID)
+	}
+	if !sampled {
+		return ctx, nil
+	}
+	return context.WithValue(ctx, spanContext{}, span), span
+}
+
+// sample keeps a trace when its ID falls within the sample ratio, so every
+// service sampling by ID agrees on the same traces.
+func (t *Tracer) sample(id TraceID) bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+	bound := uint64(t.sampleRatio * (1 << 63))
+	return binary.BigEndian.Uint64(id[8:])>>1 < bound
+}
+
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed with err's message; nil errors are
+// ignored.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.failed, s.errorMsg = true, err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span and queues it for export. Only the first call
+// counts, so End can be both deferred and called early.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended, s.end = true, time.Now()
+	s.mu.Unlock()
+
+	s.tracer.exporter.enqueue(s)
+}
+
+func (s *Span) TraceID() TraceID {
+	if s == nil {
+		return TraceID{}
+	}
+	return s.traceID
+}
+
+// parseTraceparent reads a W3C traceparent header, version 00.
+func parseTraceparent(header string) (TraceID, SpanID, bool, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return TraceID{}, SpanID{}, false, false
+	}
+
+	var traceID TraceID
+	var spanID SpanID
+	var flags [1]byte
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == (TraceID{}) {
+		return TraceID{}, SpanID{}, false, false
+	}
+	if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil || spanID == (SpanID{}) {
+		return TraceID{}, SpanID{}, false, false
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return TraceID{}, SpanID{}, false, false
+	}
+	return traceID, spanID, flags[0]&1 == 1, true
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	_, _ = rand.Read(id[:])
+	return id
+}
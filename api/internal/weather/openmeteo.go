@@ -0,0 +1,94 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"map-ascii-generator/api/internal/geo"
+)
+
+// DefaultOpenMeteoURL is the public Open-Meteo forecast endpoint.
+const DefaultOpenMeteoURL = "https://api.open-meteo.com/v1/forecast"
+
+// openMeteoBatch is how many coordinates go into one request, which keeps
+// URLs well under common length limits.
+const openMeteoBatch = 100
+
+// OpenMeteo reads current conditions from the Open-Meteo forecast API,
+// which accepts many coordinates per request. Get performs the HTTP GET so
+// the caller controls timeouts and size limits.
+type OpenMeteo struct {
+	URL string
+	Get func(ctx context.Context, url string) ([]byte, error)
+}
+
+func (o OpenMeteo) Name() string {
+	return "open-meteo"
+}
+
+func (o OpenMeteo) Current(ctx context.Context, v Variable, points []geo.Point) ([]float64, error) {
+	param := "temperature_2m"
+	if v == CloudCover {
+		param = "cloud_cover"
+	}
+
+	values := make([]float64, 0, len(points))
+	for start := 0; start < len(points); start += openMeteoBatch {
+		batch := points[start:min(start+openMeteoBatch, len(points))]
+		got, err := o.fetch(ctx, param, batch)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, got...)
+	}
+	return values, nil
+}
+
+func (o OpenMeteo) fetch(ctx context.Context, param string, points []geo.Point) ([]float64, error) {
+	lats := make([]string, len(points))
+	lons := make([]string, len(points))
+	for i, p := range points {
+		lats[i] = strconv.FormatFloat(p.Lat(), 'f', -1, 64)
+		lons[i] = strconv.FormatFloat(p.Lon(), 'f', -1, 64)
+	}
+	query := url.Values{
+		"latitude":  {strings.Join(lats, ",")},
+		"longitude": {strings.Join(lons, ",")},
+		"current":   {param},
+	}
+
+	body, err := o.Get(ctx, o.URL+"?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	// A single location comes back as an object, several as an array.
+	type location struct {
+		Current map[string]*float64 `json:"current"`
+	}
+	var locations []location
+	if err := json.Unmarshal(body, &locations); err != nil {
+		var single location
+		if err := json.Unmarshal(body, &single); err != nil {
+			return nil, fmt.Errorf("open-meteo: invalid response: %w", err)
+		}
+		locations = []location{single}
+	}
+	if len(locations) != len(points) {
+		return nil, fmt.Errorf("open-meteo: got %d locations for %d points", len(locations), len(points))
+	}
+
+	values := make([]float64, len(points))
+	for i, loc := range locations {
+		values[i] = math.NaN()
+		if value := loc.Current[param]; value != nil {
+			values[i] = *value
+		}
+	}
+	return values, nil
+}
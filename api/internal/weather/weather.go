@@ -0,0 +1,138 @@
+// Package weather samples current weather on a coarse global grid from a
+// pluggable data source, for shading maps.
+package weather
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"map-ascii-generator/api/internal/geo"
+)
+
+type Variable string
+
+const (
+	Temperature Variable = "temperature"
+	CloudCover  Variable = "cloud_cover"
+)
+
+var variables = []Variable{Temperature, CloudCover}
+
+func Variables() []string {
+	names := make([]string, 0, len(variables))
+	for _, v := range variables {
+		names = append(names, string(v))
+	}
+	return names
+}
+
+// ParseVariable returns an empty Variable for an empty value, which leaves
+// the weather layer off.
+func ParseVariable(raw string) (Variable, error) {
+	value := Variable(strings.ToLower(strings.TrimSpace(raw)))
+	if value == "" {
+		return "", nil
+	}
+	for _, v := range variables {
+		if v == value {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("weather.variable must be one of: %s", strings.Join(Variables(), ", "))
+}
+
+func (v Variable) Unit() string {
+	if v == CloudCover {
+		return "%"
+	}
+	return "°C"
+}
+
+// Range is the default span of values shaded from the first to the last
+// level.
+func (v Variable) Range() (float64, float64) {
+	if v == CloudCover {
+		return 0, 100
+	}
+	return -30, 40
+}
+
+// Source provides current values of a variable. Values are returned in the
+// order of points, NaN where the source has none. Implementations must be
+// safe for concurrent use.
+type Source interface {
+	Name() string
+	Current(ctx context.Context, v Variable, points []geo.Point) ([]float64, error)
+}
+
+// Grid holds values on a regular lattice every Step degrees, from -180 to
+// 180 longitude and -90 to 90 latitude inclusive.
+type Grid struct {
+	Step    float64
+	Fetched time.Time
+	cols    int
+	rows    int
+	values  []float64
+}
+
+// Lattice returns the grid points for step, row by row from the south.
+func Lattice(step float64) []geo.Point {
+	cols, rows := latticeSize(step)
+	points := make([]geo.Point, 0, cols*rows)
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			points = append(points, geo.Point{-180 + float64(col)*step, -90 + float64(row)*step})
+		}
+	}
+	return points
+}
+
+func latticeSize(step float64) (int, int) {
+	return int(math.Round(360/step)) + 1, int(math.Round(180/step)) + 1
+}
+
+// Fetch samples v from src on the lattice for step, which must divide 180.
+func Fetch(ctx context.Context, src Source, v Variable, step float64) (*Grid, error) {
+	if step <= 0 || math.Mod(180, step) != 0 {
+		return nil, fmt.Errorf("grid step must divide 180 degrees, got %v", step)
+	}
+	points := Lattice(step)
+	values, err := src.Current(ctx, v, points)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != len(points) {
+		return nil, fmt.Errorf("%s returned %d values for %d points", src.Name(), len(values), len(points))
+	}
+
+	cols, rows := latticeSize(step)
+	return &Grid{Step: step, Fetched: time.Now().UTC(), cols: cols, rows: rows, values: values}, nil
+}
+
+// Sample interpolates bilinearly between the four surrounding grid points,
+// ignoring those without a value.
+func (g *Grid) Sample(lon float64, lat float64) (float64, bool) {
+	x := (lon + 180) / g.Step
+	y := (lat + 90) / g.Step
+	x0 := max(0, min(int(math.Floor(x)), g.cols-2))
+	y0 := max(0, min(int(math.Floor(y)), g.rows-2))
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	sum, weights := 0.0, 0.0
+	for _, c := range [4]struct{ dx, dy int }{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+		value := g.values[(y0+c.dy)*g.cols+x0+c.dx]
+		if math.IsNaN(value) {
+			continue
+		}
+		w := math.Abs(1-float64(c.dx)-fx) * math.Abs(1-float64(c.dy)-fy)
+		sum += w * value
+		weights += w
+	}
+	if weights == 0 {
+		return 0, false
+	}
+	return sum / weights, true
+}